@@ -0,0 +1,178 @@
+package bandwidth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Limits are the byte-rate limits applied to data transfer.
+// A value of zero means unlimited.
+type Limits struct {
+	// Max bytes per second transferred across all peers
+	GlobalBytesPerSecond uint64
+	// Max bytes per second transferred with any single peer
+	PeerBytesPerSecond uint64
+}
+
+// Limiter keeps track of the rate at which data is transferred, globally and
+// per peer, and calculates how long a transfer must wait to stay within the
+// configured limits.
+// Limits can be changed at any time, including while transfers are in
+// progress.
+type Limiter struct {
+	lk         sync.Mutex
+	now        func() time.Time
+	global     *bucket
+	peerRate   uint64
+	peerRates  map[peer.ID]uint64
+	peerBucket map[peer.ID]*bucket
+}
+
+// NewLimiter returns a limiter with the given limits
+func NewLimiter(limits Limits) *Limiter {
+	l := &Limiter{
+		now:        time.Now,
+		peerRates:  make(map[peer.ID]uint64),
+		peerBucket: make(map[peer.ID]*bucket),
+	}
+	l.global = newBucket(limits.GlobalBytesPerSecond, l.now())
+	l.peerRate = limits.PeerBytesPerSecond
+	return l
+}
+
+// Limits returns the current global and default per-peer limits
+func (l *Limiter) Limits() Limits {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	return Limits{
+		GlobalBytesPerSecond: l.global.rate,
+		PeerBytesPerSecond:   l.peerRate,
+	}
+}
+
+// SetLimits changes the global limit and the default limit for peers that
+// don't have a limit set with SetPeerLimit
+func (l *Limiter) SetLimits(limits Limits) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	now := l.now()
+	l.global.setRate(limits.GlobalBytesPerSecond, now)
+	l.peerRate = limits.PeerBytesPerSecond
+	for p, b := range l.peerBucket {
+		if _, ok := l.peerRates[p]; !ok {
+			b.setRate(limits.PeerBytesPerSecond, now)
+		}
+	}
+}
+
+// SetPeerLimit overrides the default per-peer limit for the given peer
+func (l *Limiter) SetPeerLimit(p peer.ID, bytesPerSecond uint64) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	l.peerRates[p] = bytesPerSecond
+	if b, ok := l.peerBucket[p]; ok {
+		b.setRate(bytesPerSecond, l.now())
+	}
+}
+
+// ClearPeerLimit removes the limit set for the given peer with SetPeerLimit,
+// so that the default per-peer limit applies
+func (l *Limiter) ClearPeerLimit(p peer.ID) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	delete(l.peerRates, p)
+	if b, ok := l.peerBucket[p]; ok {
+		b.setRate(l.peerRate, l.now())
+	}
+}
+
+// Reserve records that the given number of bytes were transferred with the
+// given peer. It returns the amount of time to wait before transferring
+// more data with the peer, in order to stay within the limits, or zero if
+// there is no need to wait.
+func (l *Limiter) Reserve(p peer.ID, bytes uint64) time.Duration {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	now := l.now()
+	pb, ok := l.peerBucket[p]
+	if !ok {
+		rate, ok := l.peerRates[p]
+		if !ok {
+			rate = l.peerRate
+		}
+		pb = newBucket(rate, now)
+		l.peerBucket[p] = pb
+	}
+
+	wait := l.global.take(bytes, now)
+	if peerWait := pb.take(bytes, now); peerWait > wait {
+		wait = peerWait
+	}
+	return wait
+}
+
+// RemovePeer discards the rate information kept for the given peer
+// (but not a limit set with SetPeerLimit)
+func (l *Limiter) RemovePeer(p peer.ID) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	delete(l.peerBucket, p)
+}
+
+// bucket is a token bucket that refills at the configured rate, with a
+// capacity of one second of data.
+// Taking more bytes than are available puts the bucket into debt, and the
+// debt must be paid back before more data can be transferred.
+type bucket struct {
+	rate      uint64
+	available float64
+	last      time.Time
+}
+
+func newBucket(rate uint64, now time.Time) *bucket {
+	return &bucket{rate: rate, available: float64(rate), last: now}
+}
+
+func (b *bucket) setRate(rate uint64, now time.Time) {
+	b.refill(now)
+	b.rate = rate
+	if b.available > float64(rate) {
+		b.available = float64(rate)
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	b.last = now
+	if elapsed <= 0 {
+		return
+	}
+	b.available += elapsed.Seconds() * float64(b.rate)
+	if b.available > float64(b.rate) {
+		b.available = float64(b.rate)
+	}
+}
+
+// take removes the given number of bytes from the bucket and returns
+// how long to wait until the bucket is out of debt
+func (b *bucket) take(bytes uint64, now time.Time) time.Duration {
+	// a rate of zero means unlimited
+	if b.rate == 0 {
+		return 0
+	}
+
+	b.refill(now)
+	b.available -= float64(bytes)
+	if b.available >= 0 {
+		return 0
+	}
+	return time.Duration(-b.available / float64(b.rate) * float64(time.Second))
+}
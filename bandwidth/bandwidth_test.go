@@ -0,0 +1,70 @@
+package bandwidth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestLimiter(t *testing.T) {
+	peers := testutil.GeneratePeers(2)
+	start := time.Now()
+
+	newTestLimiter := func(limits Limits) (*Limiter, func(time.Duration)) {
+		now := start
+		l := NewLimiter(limits)
+		l.now = func() time.Time { return now }
+		l.global.last = now
+		advance := func(d time.Duration) {
+			now = now.Add(d)
+		}
+		return l, advance
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		l, _ := newTestLimiter(Limits{})
+		require.Zero(t, l.Reserve(peers[0], 1<<30))
+		require.Zero(t, l.Reserve(peers[1], 1<<30))
+	})
+
+	t.Run("global limit", func(t *testing.T) {
+		l, advance := newTestLimiter(Limits{GlobalBytesPerSecond: 100})
+		require.Zero(t, l.Reserve(peers[0], 60))
+		// 40 bytes left in the bucket, so taking 90 puts it 50 bytes into
+		// debt across all peers
+		require.Equal(t, 500*time.Millisecond, l.Reserve(peers[1], 90))
+		advance(500 * time.Millisecond)
+		require.Zero(t, l.Reserve(peers[0], 0))
+		require.Equal(t, 100*time.Millisecond, l.Reserve(peers[0], 10))
+	})
+
+	t.Run("per peer limit", func(t *testing.T) {
+		l, advance := newTestLimiter(Limits{PeerBytesPerSecond: 100})
+		require.Equal(t, time.Second, l.Reserve(peers[0], 200))
+		// other peers are not affected
+		require.Zero(t, l.Reserve(peers[1], 100))
+		advance(time.Second)
+		require.Zero(t, l.Reserve(peers[0], 0))
+	})
+
+	t.Run("peer override", func(t *testing.T) {
+		l, _ := newTestLimiter(Limits{PeerBytesPerSecond: 100})
+		l.SetPeerLimit(peers[0], 0)
+		require.Zero(t, l.Reserve(peers[0], 1000))
+		l.ClearPeerLimit(peers[0])
+		require.Equal(t, 10*time.Second, l.Reserve(peers[0], 1000))
+	})
+
+	t.Run("adjust limits at runtime", func(t *testing.T) {
+		l, _ := newTestLimiter(Limits{GlobalBytesPerSecond: 100, PeerBytesPerSecond: 100})
+		require.Zero(t, l.Reserve(peers[0], 100))
+		l.SetLimits(Limits{GlobalBytesPerSecond: 200})
+		require.Equal(t, Limits{GlobalBytesPerSecond: 200}, l.Limits())
+		require.Equal(t, 500*time.Millisecond, l.Reserve(peers[0], 100))
+		l.SetLimits(Limits{})
+		require.Zero(t, l.Reserve(peers[0], 1000))
+	})
+}
@@ -0,0 +1,62 @@
+package datatransfer
+
+// Capabilities are the features of data transfer that a peer supports. Peers
+// advertise their capabilities when they open or restart a channel, and when
+// they respond to a request that does, so that the other peer can refuse or
+// adapt operations the peer does not support, rather than fail part way
+// through a transfer.
+type Capabilities struct {
+	// Restart is true if the peer can restart channels
+	Restart bool
+	// Pause is true if the peer can pause and resume channels
+	Pause bool
+	// Transports are the transports the peer supports, in order of
+	// preference, or nil if the peer did not say
+	Transports []TransportID
+	// Compression are the names of the compression schemes the peer can
+	// decode, in order of preference
+	Compression []string
+	// MaxMessageSize is the size in bytes of the largest data transfer
+	// message the peer accepts, or zero if there is no limit
+	MaxMessageSize uint64
+}
+
+// LegacyCapabilities1_1 are the capabilities implied by a peer that speaks
+// version 1.1 of the data transfer protocol, which cannot advertise them
+var LegacyCapabilities1_1 = Capabilities{Restart: true, Pause: true}
+
+// LegacyCapabilities1_0 are the capabilities implied by a peer that speaks
+// version 1.0 of the data transfer protocol, which cannot restart channels
+var LegacyCapabilities1_0 = Capabilities{Pause: true}
+
+// SupportsTransport returns true if the peer supports the given transport.
+// A peer that did not say which transports it supports is assumed to
+// support all of them.
+func (c Capabilities) SupportsTransport(id TransportID) bool {
+	if c.Transports == nil {
+		return true
+	}
+	for _, supported := range c.Transports {
+		if supported == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsCompression returns true if the peer can decode the compression
+// scheme with the given name
+func (c Capabilities) SupportsCompression(name string) bool {
+	for _, supported := range c.Compression {
+		if supported == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsMessageSize returns true if the peer accepts a message of the given
+// size in bytes
+func (c Capabilities) AllowsMessageSize(size uint64) bool {
+	return c.MaxMessageSize == 0 || size <= c.MaxMessageSize
+}
@@ -0,0 +1,510 @@
+package channelmonitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+)
+
+var log = logging.Logger("dt-chanmon")
+
+// MonitorAPI is the interface of the data transfer manager used by a monitor
+type MonitorAPI interface {
+	SubscribeToChannelEvents(chid datatransfer.ChannelID, subscriber datatransfer.Subscriber) datatransfer.Unsubscribe
+	RestartDataTransferChannel(ctx context.Context, chid datatransfer.ChannelID) error
+	CloseDataTransferChannelWithError(ctx context.Context, chid datatransfer.ChannelID, cherr error) error
+}
+
+// Direction is the direction of the data on the channels a monitor watches,
+// relative to the node that opened them
+type Direction int
+
+const (
+	// Push channels send data, and are monitored by the amount of data sent
+	Push Direction = iota
+	// Pull channels receive data, and are monitored by the amount of data
+	// received
+	Pull
+)
+
+func (d Direction) String() string {
+	if d == Pull {
+		return "pull"
+	}
+	return "push"
+}
+
+// Monitor watches the data-rate for push or pull channels, and restarts
+// a channel if the data-rate falls too low
+type Monitor struct {
+	ctx       context.Context
+	stop      context.CancelFunc
+	mgr       MonitorAPI
+	direction Direction
+	cfg       *Config
+
+	lk       sync.RWMutex
+	channels map[*monitoredChannel]struct{}
+}
+
+type Config struct {
+	// Max time to wait for other side to accept the channel before attempting restart
+	AcceptTimeout time.Duration
+	// Interval between checks of transfer rate
+	Interval time.Duration
+	// Min bytes that must be sent (push) or received (pull) in interval
+	MinBytesTransferred uint64
+	// Number of times to check transfer rate per interval
+	ChecksPerInterval uint32
+	// Backoff after restarting
+	RestartBackoff time.Duration
+	// Number of times to try to restart before failing
+	MaxConsecutiveRestarts uint32
+	// Max time to wait for the responder to send a Complete message once all
+	// data has been transferred
+	CompleteTimeout time.Duration
+}
+
+// NewMonitor creates a monitor for channels in the given direction. The
+// monitor is disabled if cfg is nil.
+func NewMonitor(mgr MonitorAPI, direction Direction, cfg *Config) *Monitor {
+	checkConfig(direction, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Monitor{
+		ctx:       ctx,
+		stop:      cancel,
+		mgr:       mgr,
+		direction: direction,
+		cfg:       cfg,
+		channels:  make(map[*monitoredChannel]struct{}),
+	}
+}
+
+func checkConfig(direction Direction, cfg *Config) {
+	if cfg == nil {
+		return
+	}
+
+	prefix := fmt.Sprintf("data-transfer channel %s monitor config ", direction)
+	if cfg.AcceptTimeout <= 0 {
+		panic(fmt.Sprintf(prefix+"AcceptTimeout is %s but must be > 0", cfg.AcceptTimeout))
+	}
+	if cfg.Interval <= 0 {
+		panic(fmt.Sprintf(prefix+"Interval is %s but must be > 0", cfg.Interval))
+	}
+	if cfg.ChecksPerInterval == 0 {
+		panic(fmt.Sprintf(prefix+"ChecksPerInterval is %d but must be > 0", cfg.ChecksPerInterval))
+	}
+	if cfg.MinBytesTransferred == 0 {
+		panic(fmt.Sprintf(prefix+"MinBytesTransferred is %d but must be > 0", cfg.MinBytesTransferred))
+	}
+	if cfg.MaxConsecutiveRestarts == 0 {
+		panic(fmt.Sprintf(prefix+"MaxConsecutiveRestarts is %d but must be > 0", cfg.MaxConsecutiveRestarts))
+	}
+	if cfg.CompleteTimeout <= 0 {
+		panic(fmt.Sprintf(prefix+"CompleteTimeout is %s but must be > 0", cfg.CompleteTimeout))
+	}
+}
+
+// AddChannel adds a channel to the channel monitor
+func (m *Monitor) AddChannel(chid datatransfer.ChannelID) *monitoredChannel {
+	if !m.enabled() {
+		return nil
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	mpc := newMonitoredChannel(m.mgr, chid, m.direction, m.cfg, m.onMonitoredChannelShutdown)
+	m.channels[mpc] = struct{}{}
+	return mpc
+}
+
+func (m *Monitor) Shutdown() {
+	// Causes the run loop to exit
+	m.stop()
+}
+
+// onShutdown shuts down all monitored channels. It is called when the run
+// loop exits.
+func (m *Monitor) onShutdown() {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	for ch := range m.channels {
+		ch.Shutdown()
+	}
+}
+
+// onMonitoredChannelShutdown is called when a monitored channel shuts down
+func (m *Monitor) onMonitoredChannelShutdown(mpc *monitoredChannel) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	delete(m.channels, mpc)
+}
+
+// enabled indicates whether the channel monitor is running
+func (m *Monitor) enabled() bool {
+	return m.cfg != nil
+}
+
+func (m *Monitor) Start() {
+	if !m.enabled() {
+		return
+	}
+
+	go m.run()
+}
+
+func (m *Monitor) run() {
+	defer m.onShutdown()
+
+	// Check data-rate ChecksPerInterval times per interval
+	tickInterval := m.cfg.Interval / time.Duration(m.cfg.ChecksPerInterval)
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	log.Infof("Starting %s channel monitor with "+
+		"%d checks per %s interval (check interval %s); min bytes per interval: %d, restart backoff: %s; max consecutive restarts: %d",
+		m.direction, m.cfg.ChecksPerInterval, m.cfg.Interval, tickInterval, m.cfg.MinBytesTransferred, m.cfg.RestartBackoff, m.cfg.MaxConsecutiveRestarts)
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkDataRate()
+		}
+	}
+}
+
+// check data rate for all monitored channels
+func (m *Monitor) checkDataRate() {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+
+	for ch := range m.channels {
+		ch.checkDataRate()
+	}
+}
+
+// monitoredChannel keeps track of the data-rate for a channel, and
+// restarts the channel if the rate falls below the minimum allowed
+type monitoredChannel struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mgr        MonitorAPI
+	chid       datatransfer.ChannelID
+	direction  Direction
+	cfg        *Config
+	unsub      datatransfer.Unsubscribe
+	onShutdown func(*monitoredChannel)
+	shutdownLk sync.Mutex
+
+	statsLk sync.RWMutex
+	// queued is the amount of data queued to be sent on a push channel
+	queued uint64
+	// transferred is the amount of data sent on a push channel, or received
+	// on a pull channel
+	transferred uint64
+	// idle is true while the channel is not expected to transfer data
+	idle                bool
+	dataRatePoints      chan *dataRatePoint
+	consecutiveRestarts int
+
+	restartLk   sync.RWMutex
+	restartedAt time.Time
+}
+
+func newMonitoredChannel(
+	mgr MonitorAPI,
+	chid datatransfer.ChannelID,
+	direction Direction,
+	cfg *Config,
+	onShutdown func(*monitoredChannel),
+) *monitoredChannel {
+	ctx, cancel := context.WithCancel(context.Background())
+	mpc := &monitoredChannel{
+		ctx:            ctx,
+		cancel:         cancel,
+		mgr:            mgr,
+		chid:           chid,
+		direction:      direction,
+		cfg:            cfg,
+		onShutdown:     onShutdown,
+		dataRatePoints: make(chan *dataRatePoint, cfg.ChecksPerInterval),
+	}
+	mpc.start()
+	return mpc
+}
+
+// Cancel the context and unsubscribe from events
+func (mc *monitoredChannel) Shutdown() {
+	mc.shutdownLk.Lock()
+	defer mc.shutdownLk.Unlock()
+
+	// Check if the channel was already shut down
+	if mc.cancel == nil {
+		return
+	}
+	mc.cancel() // cancel context so all go-routines exit
+	mc.cancel = nil
+
+	// unsubscribe from data transfer events
+	mc.unsub()
+
+	// Inform the Manager that this channel has shut down
+	go mc.onShutdown(mc)
+}
+
+func (mc *monitoredChannel) start() {
+	// Prevent shutdown until after startup
+	mc.shutdownLk.Lock()
+	defer mc.shutdownLk.Unlock()
+
+	log.Debugf("%s: starting %s channel data-rate monitoring", mc.chid, mc.direction)
+
+	// Watch to make sure the responder accepts the channel in time
+	cancelAcceptTimer := mc.watchForResponderAccept()
+
+	// Watch for data rate events
+	mc.unsub = mc.mgr.SubscribeToChannelEvents(mc.chid, func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+		mc.statsLk.Lock()
+		defer mc.statsLk.Unlock()
+
+		// Once the channel completes, shut down the monitor
+		state := channelState.Status()
+		if channels.IsChannelCleaningUp(state) || channels.IsChannelTerminated(state) {
+			log.Debugf("%s: stopping %s channel data-rate monitoring", mc.chid, mc.direction)
+			go mc.Shutdown()
+			return
+		}
+
+		mc.idle = isIdle(state)
+
+		switch event.Code {
+		case datatransfer.Accept:
+			// The Accept event is fired when we receive an Accept message from the responder
+			cancelAcceptTimer()
+		case datatransfer.Error:
+			// If there's an error, attempt to restart the channel
+			log.Debugf("%s: data transfer error, restarting", mc.chid)
+			go mc.restartChannel()
+		case datatransfer.DataQueued:
+			// Keep track of the amount of data queued
+			mc.queued = channelState.Queued()
+		case datatransfer.DataSent:
+			if mc.direction == Push {
+				// Keep track of the amount of data sent
+				mc.transferred = channelState.Sent()
+				// Some data was sent so reset the consecutive restart counter
+				mc.consecutiveRestarts = 0
+			}
+		case datatransfer.DataReceivedProgress:
+			if mc.direction == Pull {
+				// Keep track of the amount of data received
+				mc.transferred = channelState.Received()
+				// Some data was received so reset the consecutive restart
+				// counter
+				mc.consecutiveRestarts = 0
+			}
+		case datatransfer.FinishTransfer:
+			// The client has finished transferring all data. Watch to make
+			// sure that the responder sends a message to acknowledge that the
+			// transfer is complete
+			go mc.watchForResponderComplete()
+		}
+	})
+}
+
+// watchForResponderAccept watches to make sure that the responder sends
+// an Accept to our open channel request before the accept timeout.
+// Returns a function that can be used to cancel the timer.
+func (mc *monitoredChannel) watchForResponderAccept() func() {
+	// Start a timer for the accept timeout
+	timer := time.NewTimer(mc.cfg.AcceptTimeout)
+
+	go func() {
+		defer timer.Stop()
+
+		select {
+		case <-mc.ctx.Done():
+		case <-timer.C:
+			// Timer expired before we received an Accept from the responder,
+			// fail the data transfer
+			err := xerrors.Errorf("%s: timed out waiting %s for Accept message from remote peer",
+				mc.chid, mc.cfg.AcceptTimeout)
+			mc.closeChannelAndShutdown(err)
+		}
+	}()
+
+	return func() { timer.Stop() }
+}
+
+// Wait up to the configured timeout for the responder to send a Complete message
+func (mc *monitoredChannel) watchForResponderComplete() {
+	// Start a timer for the complete timeout
+	timer := time.NewTimer(mc.cfg.CompleteTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-mc.ctx.Done():
+		// When the Complete message is received, the channel shuts down
+	case <-timer.C:
+		// Timer expired before we received a Complete from the responder
+		err := xerrors.Errorf("%s: timed out waiting %s for Complete message from remote peer",
+			mc.chid, mc.cfg.CompleteTimeout)
+		mc.closeChannelAndShutdown(err)
+	}
+}
+
+type dataRatePoint struct {
+	pending     uint64
+	transferred uint64
+	idle        bool
+}
+
+// check if the amount of data transferred in the interval was too low, and
+// if so restart the channel
+func (mc *monitoredChannel) checkDataRate() {
+	mc.statsLk.Lock()
+	defer mc.statsLk.Unlock()
+
+	// Before returning, add the current data rate stats to the queue
+	defer func() {
+		var pending uint64
+		if mc.queued > mc.transferred { // should always be true but just in case
+			pending = mc.queued - mc.transferred
+		}
+		mc.dataRatePoints <- &dataRatePoint{
+			pending:     pending,
+			transferred: mc.transferred,
+			idle:        mc.idle,
+		}
+	}()
+
+	// Check that there are enough data points that an interval has elapsed
+	if len(mc.dataRatePoints) < int(mc.cfg.ChecksPerInterval) {
+		log.Debugf("%s: not enough data points to check data rate yet (%d / %d)",
+			mc.chid, len(mc.dataRatePoints), mc.cfg.ChecksPerInterval)
+
+		return
+	}
+
+	// Pop the data point from one interval ago
+	atIntervalStart := <-mc.dataRatePoints
+
+	transferredInInterval := mc.transferred - atIntervalStart.transferred
+	log.Debugf("%s: since last check: transferred: %d - %d = %d, pending: %d, idle: %t, required %d",
+		mc.chid, mc.transferred, atIntervalStart.transferred, transferredInInterval, atIntervalStart.pending, mc.idle, mc.cfg.MinBytesTransferred)
+
+	// A channel that was idle during the interval, eg because it was paused
+	// while the responder waits for payment, is not expected to transfer data
+	if mc.idle || atIntervalStart.idle {
+		return
+	}
+
+	if transferredInInterval >= mc.cfg.MinBytesTransferred {
+		return
+	}
+
+	// If there was enough pending data to cover the minimum required amount,
+	// and the amount sent was lower than the minimum required, restart the
+	// push channel.
+	// Unlike a push channel, the receiver of a pull channel doesn't know how
+	// much data the responder has queued, so if the amount received was lower
+	// than the minimum required, restart the pull channel.
+	if mc.direction == Pull || atIntervalStart.pending > transferredInInterval {
+		go mc.restartChannel()
+	}
+}
+
+// isIdle returns true if a channel with the given status is not expected to
+// transfer data: either peer paused it, the responder queued it, or all the
+// data has been transferred
+func isIdle(status datatransfer.Status) bool {
+	switch status {
+	case datatransfer.InitiatorPaused, datatransfer.ResponderPaused, datatransfer.BothPaused,
+		datatransfer.Queued,
+		datatransfer.TransferFinished, datatransfer.ResponderCompleted, datatransfer.Finalizing,
+		datatransfer.ResponderFinalizing, datatransfer.ResponderFinalizingTransferFinished:
+		return true
+	default:
+		return false
+	}
+}
+
+func (mc *monitoredChannel) restartChannel() {
+	// Check if the channel is already being restarted
+	mc.restartLk.Lock()
+	restartedAt := mc.restartedAt
+	if restartedAt.IsZero() {
+		mc.restartedAt = time.Now()
+	}
+	mc.restartLk.Unlock()
+
+	if !restartedAt.IsZero() {
+		log.Debugf("%s: restart called but already restarting channel (for %s so far; restart backoff is %s)",
+			mc.chid, time.Since(mc.restartedAt), mc.cfg.RestartBackoff)
+		return
+	}
+
+	mc.statsLk.Lock()
+	mc.consecutiveRestarts++
+	restartCount := mc.consecutiveRestarts
+	mc.statsLk.Unlock()
+
+	if uint32(restartCount) > mc.cfg.MaxConsecutiveRestarts {
+		// If no data has been transferred since the last transfer, and we've
+		// reached the consecutive restart limit, close the channel and
+		// shutdown the monitor
+		err := xerrors.Errorf("%s: after %d consecutive restarts failed to reach required data transfer rate", mc.chid, restartCount)
+		mc.closeChannelAndShutdown(err)
+		return
+	}
+
+	// Send a restart message for the channel.
+	// Note that at the networking layer there is logic to retry if a network
+	// connection cannot be established, so this may take some time.
+	log.Infof("%s: sending restart message (%d consecutive restarts)", mc.chid, restartCount)
+	err := mc.mgr.RestartDataTransferChannel(mc.ctx, mc.chid)
+	if err != nil {
+		// If it wasn't possible to restart the channel, close the channel
+		// and shut down the monitor
+		cherr := xerrors.Errorf("%s: failed to send restart message: %s", mc.chid, err)
+		mc.closeChannelAndShutdown(cherr)
+	} else if mc.cfg.RestartBackoff > 0 {
+		log.Infof("%s: restart message sent successfully, backing off %s before allowing any other restarts",
+			mc.chid, mc.cfg.RestartBackoff)
+		// Backoff a little time after a restart before attempting another
+		select {
+		case <-time.After(mc.cfg.RestartBackoff):
+		case <-mc.ctx.Done():
+		}
+
+		log.Debugf("%s: restart back-off %s complete",
+			mc.chid, mc.cfg.RestartBackoff)
+	}
+
+	mc.restartLk.Lock()
+	mc.restartedAt = time.Time{}
+	mc.restartLk.Unlock()
+}
+
+func (mc *monitoredChannel) closeChannelAndShutdown(cherr error) {
+	log.Errorf("closing data-transfer channel: %s", cherr)
+	err := mc.mgr.CloseDataTransferChannelWithError(mc.ctx, mc.chid, cherr)
+	if err != nil {
+		log.Errorf("error closing data-transfer channel %s: %w", mc.chid, err)
+	}
+
+	mc.Shutdown()
+}
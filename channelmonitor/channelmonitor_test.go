@@ -0,0 +1,774 @@
+package channelmonitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+func TestPushChannelMonitorAutoRestart(t *testing.T) {
+	type testCase struct {
+		name         string
+		errOnRestart bool
+		dataQueued   uint64
+		dataSent     uint64
+		errorEvent   bool
+	}
+	testCases := []testCase{{
+		name:         "attempt restart",
+		errOnRestart: false,
+		dataQueued:   10,
+		dataSent:     5,
+	}, {
+		name:         "fail attempt restart",
+		errOnRestart: true,
+		dataQueued:   10,
+		dataSent:     5,
+	}, {
+		name:         "error event",
+		errOnRestart: false,
+		dataQueued:   10,
+		dataSent:     10,
+		errorEvent:   true,
+	}, {
+		name:         "error event then fail attempt restart",
+		errOnRestart: true,
+		dataQueued:   10,
+		dataSent:     10,
+		errorEvent:   true,
+	}}
+
+	ch1 := datatransfer.ChannelID{
+		Initiator: "initiator",
+		Responder: "responder",
+		ID:        1,
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := &mockChannelState{chid: ch1, status: datatransfer.Ongoing}
+			mockAPI := newMockMonitorAPI(ch, tc.errOnRestart)
+
+			m := NewMonitor(mockAPI, Push, &Config{
+				AcceptTimeout:          time.Hour,
+				Interval:               10 * time.Millisecond,
+				ChecksPerInterval:      10,
+				MinBytesTransferred:    1,
+				MaxConsecutiveRestarts: 3,
+				CompleteTimeout:        time.Hour,
+			})
+			m.Start()
+			m.AddChannel(ch1)
+			mch := getFirstMonitoredChannel(t, m)
+
+			mockAPI.accept()
+			mockAPI.dataQueued(tc.dataQueued)
+			mockAPI.dataSent(tc.dataSent)
+			if tc.errorEvent {
+				mockAPI.errorEvent()
+			}
+
+			if tc.errOnRestart {
+				// If there is no recovery from restart, wait for the push
+				// channel to be closed
+				<-mockAPI.closed
+				return
+			}
+
+			// Verify that channel was restarted
+			select {
+			case <-time.After(100 * time.Millisecond):
+				require.Fail(t, "failed to restart channel")
+			case <-mockAPI.restarts:
+			}
+
+			// Simulate sending the remaining data
+			delta := tc.dataQueued - tc.dataSent
+			if delta > 0 {
+				mockAPI.dataSent(delta)
+			}
+
+			// Simulate the complete event
+			mockAPI.completed()
+
+			// Verify that channel has been shutdown
+			verifyChannelShutdown(t, mch)
+		})
+	}
+}
+
+func TestPushChannelMonitorDataRate(t *testing.T) {
+	type dataPoint struct {
+		queued uint64
+		sent   uint64
+	}
+	type testCase struct {
+		name          string
+		minBytesSent  uint64
+		dataPoints    []dataPoint
+		expectRestart bool
+	}
+	testCases := []testCase{{
+		name:         "restart when min sent (1) < pending (10)",
+		minBytesSent: 1,
+		dataPoints: []dataPoint{{
+			queued: 20,
+			sent:   10,
+		}},
+		expectRestart: true,
+	}, {
+		name:         "dont restart when min sent (20) >= pending (10)",
+		minBytesSent: 1,
+		dataPoints: []dataPoint{{
+			queued: 20,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   20,
+		}},
+		expectRestart: false,
+	}, {
+		name:         "restart when min sent (5) < pending (10)",
+		minBytesSent: 10,
+		dataPoints: []dataPoint{{
+			queued: 20,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   15,
+		}},
+		expectRestart: true,
+	}, {
+		name:         "dont restart when pending is zero",
+		minBytesSent: 1,
+		dataPoints: []dataPoint{{
+			queued: 20,
+			sent:   20,
+		}},
+		expectRestart: false,
+	}, {
+		name:         "dont restart when pending increases but sent also increases within interval",
+		minBytesSent: 1,
+		dataPoints: []dataPoint{{
+			queued: 10,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   20,
+		}},
+		expectRestart: false,
+	}, {
+		name:         "restart when pending increases and sent doesn't increase within interval",
+		minBytesSent: 1,
+		dataPoints: []dataPoint{{
+			queued: 10,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   20,
+		}},
+		expectRestart: true,
+	}, {
+		name:         "dont restart with typical progression",
+		minBytesSent: 1,
+		dataPoints: []dataPoint{{
+			queued: 10,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   10,
+		}, {
+			queued: 20,
+			sent:   15,
+		}, {
+			queued: 30,
+			sent:   25,
+		}, {
+			queued: 35,
+			sent:   30,
+		}, {
+			queued: 35,
+			sent:   35,
+		}},
+		expectRestart: false,
+	}}
+
+	ch1 := datatransfer.ChannelID{
+		Initiator: "initiator",
+		Responder: "responder",
+		ID:        1,
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := &mockChannelState{chid: ch1, status: datatransfer.Ongoing}
+			mockAPI := newMockMonitorAPI(ch, false)
+
+			checksPerInterval := uint32(1)
+			m := NewMonitor(mockAPI, Push, &Config{
+				AcceptTimeout:          time.Hour,
+				Interval:               time.Hour,
+				ChecksPerInterval:      checksPerInterval,
+				MinBytesTransferred:    tc.minBytesSent,
+				MaxConsecutiveRestarts: 3,
+				CompleteTimeout:        time.Hour,
+			})
+
+			// Note: Don't start monitor, we'll call checkDataRate() manually
+
+			m.AddChannel(ch1)
+
+			totalChecks := checksPerInterval + uint32(len(tc.dataPoints))
+			for i := uint32(0); i < totalChecks; i++ {
+				if i < uint32(len(tc.dataPoints)) {
+					dp := tc.dataPoints[i]
+					mockAPI.dataQueued(dp.queued)
+					mockAPI.dataSent(dp.sent)
+				}
+				m.checkDataRate()
+			}
+
+			// Check if channel was restarted
+			select {
+			case <-time.After(5 * time.Millisecond):
+				if tc.expectRestart {
+					require.Fail(t, "failed to restart channel")
+				}
+			case <-mockAPI.restarts:
+				if !tc.expectRestart {
+					require.Fail(t, "expected no channel restart")
+				}
+			}
+		})
+	}
+}
+
+func TestPullChannelMonitorAutoRestart(t *testing.T) {
+	type testCase struct {
+		name         string
+		errOnRestart bool
+		errorEvent   bool
+	}
+	testCases := []testCase{{
+		name:         "attempt restart",
+		errOnRestart: false,
+	}, {
+		name:         "fail attempt restart",
+		errOnRestart: true,
+	}, {
+		name:         "error event",
+		errOnRestart: false,
+		errorEvent:   true,
+	}}
+
+	ch1 := datatransfer.ChannelID{
+		Initiator: "initiator",
+		Responder: "responder",
+		ID:        1,
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := &mockChannelState{chid: ch1, status: datatransfer.Ongoing}
+			mockAPI := newMockMonitorAPI(ch, tc.errOnRestart)
+
+			m := NewMonitor(mockAPI, Pull, &Config{
+				AcceptTimeout:          time.Hour,
+				Interval:               10 * time.Millisecond,
+				ChecksPerInterval:      10,
+				MinBytesTransferred:    1,
+				MaxConsecutiveRestarts: 3,
+				CompleteTimeout:        time.Hour,
+			})
+			m.Start()
+			m.AddChannel(ch1)
+			mch := getFirstMonitoredChannel(t, m)
+
+			mockAPI.accept()
+			mockAPI.dataReceived(5)
+			if tc.errorEvent {
+				mockAPI.errorEvent()
+			}
+
+			if tc.errOnRestart {
+				// If there is no recovery from restart, wait for the pull
+				// channel to be closed
+				<-mockAPI.closed
+				return
+			}
+
+			// Verify that channel was restarted
+			select {
+			case <-time.After(100 * time.Millisecond):
+				require.Fail(t, "failed to restart channel")
+			case <-mockAPI.restarts:
+			}
+
+			// Simulate receiving the remaining data
+			mockAPI.dataReceived(10)
+
+			// Simulate the complete event
+			mockAPI.completed()
+
+			// Verify that channel has been shutdown
+			verifyChannelShutdown(t, mch)
+		})
+	}
+}
+
+func TestPullChannelMonitorDataRate(t *testing.T) {
+	type dataPoint struct {
+		received uint64
+		paused   bool
+	}
+	type testCase struct {
+		name             string
+		minBytesReceived uint64
+		dataPoints       []dataPoint
+		expectRestart    bool
+	}
+	testCases := []testCase{{
+		name:             "restart when received (0) < min received (1)",
+		minBytesReceived: 1,
+		dataPoints:       []dataPoint{{received: 10}, {received: 10}},
+		expectRestart:    true,
+	}, {
+		name:             "dont restart when received (10) >= min received (10)",
+		minBytesReceived: 10,
+		dataPoints:       []dataPoint{{received: 10}, {received: 20}},
+		expectRestart:    false,
+	}, {
+		name:             "restart when received (5) < min received (10)",
+		minBytesReceived: 10,
+		dataPoints:       []dataPoint{{received: 10}, {received: 15}},
+		expectRestart:    true,
+	}, {
+		name:             "dont restart with typical progression",
+		minBytesReceived: 1,
+		dataPoints:       []dataPoint{{received: 10}, {received: 20}, {received: 25}, {received: 30}, {received: 35}},
+		expectRestart:    false,
+	}, {
+		name:             "dont restart while responder is paused",
+		minBytesReceived: 1,
+		dataPoints:       []dataPoint{{received: 10}, {received: 10, paused: true}, {received: 10, paused: true}},
+		expectRestart:    false,
+	}, {
+		name:             "dont restart in the interval the responder resumes",
+		minBytesReceived: 1,
+		dataPoints:       []dataPoint{{received: 10, paused: true}, {received: 10}},
+		expectRestart:    false,
+	}, {
+		name:             "restart when no data is received after the responder resumes",
+		minBytesReceived: 1,
+		dataPoints:       []dataPoint{{received: 10, paused: true}, {received: 10}, {received: 10}},
+		expectRestart:    true,
+	}}
+
+	ch1 := datatransfer.ChannelID{
+		Initiator: "initiator",
+		Responder: "responder",
+		ID:        1,
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := &mockChannelState{chid: ch1, status: datatransfer.Ongoing}
+			mockAPI := newMockMonitorAPI(ch, false)
+
+			m := NewMonitor(mockAPI, Pull, &Config{
+				AcceptTimeout:          time.Hour,
+				Interval:               time.Hour,
+				ChecksPerInterval:      1,
+				MinBytesTransferred:    tc.minBytesReceived,
+				MaxConsecutiveRestarts: 3,
+				CompleteTimeout:        time.Hour,
+			})
+
+			// Note: Don't start monitor, we'll call checkDataRate() manually
+
+			m.AddChannel(ch1)
+
+			for _, dp := range tc.dataPoints {
+				if dp.paused && ch.status != datatransfer.ResponderPaused {
+					mockAPI.pauseResponder()
+				}
+				if !dp.paused && ch.status == datatransfer.ResponderPaused {
+					mockAPI.resumeResponder()
+				}
+				mockAPI.dataReceived(dp.received)
+				m.checkDataRate()
+			}
+
+			// Check if channel was restarted
+			select {
+			case <-time.After(5 * time.Millisecond):
+				if tc.expectRestart {
+					require.Fail(t, "failed to restart channel")
+				}
+			case <-mockAPI.restarts:
+				if !tc.expectRestart {
+					require.Fail(t, "expected no channel restart")
+				}
+			}
+		})
+	}
+}
+
+func TestChannelMonitorMaxConsecutiveRestarts(t *testing.T) {
+	ch1 := datatransfer.ChannelID{
+		Initiator: "initiator",
+		Responder: "responder",
+		ID:        1,
+	}
+	for _, direction := range []Direction{Push, Pull} {
+		t.Run(direction.String(), func(t *testing.T) {
+			ch := &mockChannelState{chid: ch1, status: datatransfer.Ongoing}
+			mockAPI := newMockMonitorAPI(ch, false)
+
+			maxConsecutiveRestarts := 3
+			m := NewMonitor(mockAPI, direction, &Config{
+				AcceptTimeout:          time.Hour,
+				Interval:               time.Hour,
+				ChecksPerInterval:      1,
+				MinBytesTransferred:    2,
+				MaxConsecutiveRestarts: uint32(maxConsecutiveRestarts),
+				CompleteTimeout:        time.Hour,
+			})
+
+			// Note: Don't start monitor, we'll call checkDataRate() manually
+
+			m.AddChannel(ch1)
+			mch := getFirstMonitoredChannel(t, m)
+
+			mockAPI.dataQueued(10)
+			mockAPI.dataTransferred(direction, 5)
+
+			// Check once to add a data point to the queue.
+			// Subsequent checks will compare against the previous data point.
+			m.checkDataRate()
+
+			// Each check should trigger a restart up to the maximum number of restarts
+			triggerMaxRestarts := func() {
+				for i := 0; i < maxConsecutiveRestarts; i++ {
+					m.checkDataRate()
+
+					err := mockAPI.awaitRestart()
+					require.NoError(t, err)
+				}
+			}
+			triggerMaxRestarts()
+
+			// When data is transferred it should reset the consecutive
+			// restarts back to zero
+			mockAPI.dataTransferred(direction, 6)
+
+			// Trigger restarts up to max again
+			triggerMaxRestarts()
+
+			// Reached max restarts, so now there should not be another restart
+			// attempt.
+			// Instead the channel should be closed and the monitor shut down.
+			m.checkDataRate()
+			err := mockAPI.awaitRestart()
+			require.Error(t, err) // require error because expecting no restart
+			verifyChannelShutdown(t, mch)
+		})
+	}
+}
+
+func TestChannelMonitorTimeouts(t *testing.T) {
+	type testCase struct {
+		name           string
+		expectAccept   bool
+		expectComplete bool
+	}
+	testCases := []testCase{{
+		name:         "accept in time",
+		expectAccept: true,
+	}, {
+		name:         "accept too late",
+		expectAccept: false,
+	}, {
+		name:           "complete in time",
+		expectAccept:   true,
+		expectComplete: true,
+	}, {
+		name:           "complete too late",
+		expectAccept:   true,
+		expectComplete: false,
+	}}
+
+	ch1 := datatransfer.ChannelID{
+		Initiator: "initiator",
+		Responder: "responder",
+		ID:        1,
+	}
+	for _, direction := range []Direction{Push, Pull} {
+		for _, tc := range testCases {
+			direction := direction
+			tc := tc
+			t.Run(direction.String()+" "+tc.name, func(t *testing.T) {
+				ch := &mockChannelState{chid: ch1, status: datatransfer.Ongoing}
+				mockAPI := newMockMonitorAPI(ch, false)
+
+				verifyClosedAndShutdown := func(mch *monitoredChannel, timeout time.Duration) {
+					// Verify channel has been closed
+					select {
+					case <-time.After(timeout):
+						require.Fail(t, "failed to close channel")
+					case <-mockAPI.closed:
+					}
+
+					// Verify that channel has been shutdown
+					verifyChannelShutdown(t, mch)
+				}
+
+				verifyNotClosed := func(timeout time.Duration) {
+					// Verify channel has not been closed
+					select {
+					case <-time.After(timeout):
+					case <-mockAPI.closed:
+						require.Fail(t, "expected channel not to have been closed")
+					}
+				}
+
+				acceptTimeout := 10 * time.Millisecond
+				completeTimeout := 10 * time.Millisecond
+				m := NewMonitor(mockAPI, direction, &Config{
+					AcceptTimeout:          acceptTimeout,
+					Interval:               time.Hour,
+					ChecksPerInterval:      1,
+					MinBytesTransferred:    1,
+					MaxConsecutiveRestarts: 1,
+					CompleteTimeout:        completeTimeout,
+				})
+				m.Start()
+				m.AddChannel(ch1)
+				mch := getFirstMonitoredChannel(t, m)
+
+				if tc.expectAccept {
+					// Fire the Accept event
+					mockAPI.accept()
+				}
+
+				if !tc.expectAccept {
+					// If we are expecting the test to have a timeout waiting for
+					// the accept event verify that channel was closed (because a
+					// timeout error occurred)
+					verifyClosedAndShutdown(mch, 5*acceptTimeout)
+					return
+				}
+
+				// If we're not expecting the test to have a timeout waiting for
+				// the accept event, verify that channel was not closed
+				verifyNotClosed(2 * acceptTimeout)
+
+				// Fire the FinishTransfer event
+				mockAPI.finishTransfer()
+				if tc.expectComplete {
+					// Fire the Complete event
+					mockAPI.completed()
+				}
+
+				if !tc.expectComplete {
+					// If we are expecting the test to have a timeout waiting for
+					// the complete event verify that channel was closed (because a
+					// timeout error occurred)
+					verifyClosedAndShutdown(mch, 5*completeTimeout)
+					return
+				}
+
+				// If we're not expecting the test to have a timeout waiting for
+				// the accept event, verify that channel was not closed
+				verifyNotClosed(2 * completeTimeout)
+			})
+		}
+	}
+}
+
+func getFirstMonitoredChannel(t *testing.T, m *Monitor) *monitoredChannel {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for mch := range m.channels {
+		return mch
+	}
+	require.FailNow(t, "no monitored channels")
+	return nil
+}
+
+func verifyChannelShutdown(t *testing.T, mch *monitoredChannel) {
+	select {
+	case <-time.After(10 * time.Millisecond):
+		require.Fail(t, "failed to shutdown channel")
+	case <-mch.ctx.Done():
+	}
+}
+
+type mockMonitorAPI struct {
+	ch            *mockChannelState
+	restartErrors chan error
+	restarts      chan struct{}
+	closed        chan struct{}
+
+	lk         sync.Mutex
+	subscriber datatransfer.Subscriber
+}
+
+func newMockMonitorAPI(ch *mockChannelState, errOnRestart bool) *mockMonitorAPI {
+	m := &mockMonitorAPI{
+		ch:            ch,
+		restarts:      make(chan struct{}, 1),
+		closed:        make(chan struct{}),
+		restartErrors: make(chan error, 1),
+	}
+	var restartErr error
+	if errOnRestart {
+		restartErr = xerrors.Errorf("restart err")
+	}
+	m.restartErrors <- restartErr
+	return m
+}
+
+func (m *mockMonitorAPI) SubscribeToChannelEvents(chid datatransfer.ChannelID, subscriber datatransfer.Subscriber) datatransfer.Unsubscribe {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.subscriber = subscriber
+
+	return func() {
+		m.lk.Lock()
+		defer m.lk.Unlock()
+
+		m.subscriber = nil
+	}
+}
+
+func (m *mockMonitorAPI) callSubscriber(e datatransfer.Event, state datatransfer.ChannelState) {
+	m.subscriber(e, state)
+}
+
+func (m *mockMonitorAPI) RestartDataTransferChannel(ctx context.Context, chid datatransfer.ChannelID) error {
+	defer func() {
+		m.restarts <- struct{}{}
+	}()
+
+	select {
+	case err := <-m.restartErrors:
+		return err
+	default:
+		return nil
+	}
+}
+
+func (m *mockMonitorAPI) awaitRestart() error {
+	select {
+	case <-time.After(10 * time.Millisecond):
+		return xerrors.Errorf("failed to restart channel")
+	case <-m.restarts:
+		return nil
+	}
+}
+
+func (m *mockMonitorAPI) CloseDataTransferChannelWithError(ctx context.Context, chid datatransfer.ChannelID, cherr error) error {
+	close(m.closed)
+	return nil
+}
+
+func (m *mockMonitorAPI) accept() {
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.Accept}, m.ch)
+}
+
+func (m *mockMonitorAPI) dataQueued(n uint64) {
+	m.ch.queued = n
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.DataQueued}, m.ch)
+}
+
+func (m *mockMonitorAPI) dataSent(n uint64) {
+	m.ch.sent = n
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.DataSent}, m.ch)
+}
+
+func (m *mockMonitorAPI) finishTransfer() {
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.FinishTransfer}, m.ch)
+}
+
+func (m *mockMonitorAPI) dataReceived(n uint64) {
+	m.ch.received = n
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.DataReceivedProgress}, m.ch)
+}
+
+// dataTransferred simulates data being transferred on a channel in the given
+// direction
+func (m *mockMonitorAPI) dataTransferred(direction Direction, n uint64) {
+	if direction == Push {
+		m.dataSent(n)
+	} else {
+		m.dataReceived(n)
+	}
+}
+
+func (m *mockMonitorAPI) pauseResponder() {
+	m.ch.status = datatransfer.ResponderPaused
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.PauseResponder}, m.ch)
+}
+
+func (m *mockMonitorAPI) resumeResponder() {
+	m.ch.status = datatransfer.Ongoing
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.ResumeResponder}, m.ch)
+}
+
+func (m *mockMonitorAPI) completed() {
+	m.ch.status = datatransfer.Completed
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.Complete}, m.ch)
+}
+
+func (m *mockMonitorAPI) errorEvent() {
+	m.callSubscriber(datatransfer.Event{Code: datatransfer.Error}, m.ch)
+}
+
+// mockChannelState implements the parts of the channel state that the
+// monitor reads
+type mockChannelState struct {
+	datatransfer.ChannelState
+
+	chid     datatransfer.ChannelID
+	queued   uint64
+	sent     uint64
+	received uint64
+	status   datatransfer.Status
+}
+
+func (m *mockChannelState) Queued() uint64 {
+	return m.queued
+}
+
+func (m *mockChannelState) Sent() uint64 {
+	return m.sent
+}
+
+func (m *mockChannelState) Received() uint64 {
+	return m.received
+}
+
+func (m *mockChannelState) ChannelID() datatransfer.ChannelID {
+	return m.chid
+}
+
+func (m *mockChannelState) Status() datatransfer.Status {
+	return m.status
+}
@@ -2,13 +2,16 @@ package channels
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	basicnode "github.com/ipld/go-ipld-prime/node/basic"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/channels/internal"
@@ -42,13 +45,35 @@ type channelState struct {
 	received uint64
 	// more informative status on a channel
 	message string
+	// whether the local peer paused the channel to stay within the bandwidth
+	// limits
+	throttled bool
 	// additional vouchers
 	vouchers []internal.EncodedVoucher
 	// additional voucherResults
-	voucherResults       []internal.EncodedVoucherResult
+	voucherResults []internal.EncodedVoucherResult
+	// time the channel was created in unix nanoseconds
+	createdAt int64
+	// time data was last queued, sent or received in unix nanoseconds
+	lastDataActivity int64
+	// transport that moves data on the channel
+	transport datatransfer.TransportID
+	// code of the error the other peer rejected or cancelled the channel with
+	errorCode datatransfer.ErrorCode
+	// priority of the channel
+	priority int
+	// caller-supplied label and metadata
+	label    string
+	metadata []internal.MetadataEntry
+	// time the channel must finish by in unix nanoseconds
+	deadline             int64
 	voucherResultDecoder DecoderByTypeFunc
 	voucherDecoder       DecoderByTypeFunc
 	channelCIDsReader    ChannelCIDsReader
+	// reads the blocks the initiator of a pull channel already had
+	doNotSendCIDsReader ChannelCIDsReader
+	// reads the recent events on the channel
+	history *channelHistory
 }
 
 // EmptyChannelState is the zero value for channel state, meaning not present
@@ -89,20 +114,38 @@ func (c channelState) Voucher() datatransfer.Voucher {
 	if len(c.vouchers) == 0 {
 		return nil
 	}
-	decoder, _ := c.voucherDecoder(c.vouchers[0].Type)
+	decoder, has := c.voucherDecoder(c.vouchers[0].Type)
+	if !has {
+		return nil
+	}
 	encodable, _ := decoder.DecodeFromCbor(c.vouchers[0].Voucher.Raw)
 	return encodable.(datatransfer.Voucher)
 }
 
 // ReceivedCids returns the cids received so far on this channel
 func (c channelState) ReceivedCids() []cid.Cid {
-	receivedCids, err := c.channelCIDsReader(c.ChannelID())
+	receivedCids, err := c.channelCIDsReader.ReadList(c.ChannelID())
 	if err != nil {
 		log.Error(err)
 	}
 	return receivedCids
 }
 
+// ReceivedCidsLen returns the number of cids received so far on this channel
+func (c channelState) ReceivedCidsLen() int {
+	length, err := c.channelCIDsReader.ListLen(c.ChannelID())
+	if err != nil {
+		log.Error(err)
+	}
+	return length
+}
+
+// ForEachReceivedCid calls the callback with each cid received so far on this
+// channel in the order they were received, reading them one at a time
+func (c channelState) ForEachReceivedCid(cb func(cid.Cid) error) error {
+	return c.channelCIDsReader.IterateList(c.ChannelID(), cb)
+}
+
 // Sender returns the peer id for the node that is sending data
 func (c channelState) Sender() peer.ID { return c.sender }
 
@@ -171,7 +214,101 @@ func (c channelState) OtherPeer() peer.ID {
 	return c.sender
 }
 
-func fromInternalChannelState(c internal.ChannelState, voucherDecoder DecoderByTypeFunc, voucherResultDecoder DecoderByTypeFunc, channelCIDsReader ChannelCIDsReader) datatransfer.ChannelState {
+// CreatedAt returns the time the channel was created
+func (c channelState) CreatedAt() time.Time {
+	return unixNanoTime(c.createdAt)
+}
+
+// LastDataActivity returns the last time data was queued, sent or received
+func (c channelState) LastDataActivity() time.Time {
+	return unixNanoTime(c.lastDataActivity)
+}
+
+// History returns the most recent lifecycle events on the channel
+func (c channelState) History() []datatransfer.ChannelHistoryEntry {
+	if c.history == nil {
+		return nil
+	}
+	entries, err := c.history.read(c.ChannelID())
+	if err != nil {
+		log.Error(err)
+	}
+	history := make([]datatransfer.ChannelHistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		history = append(history, datatransfer.ChannelHistoryEntry{
+			Code:      datatransfer.EventCode(entry.Event),
+			Status:    entry.Status,
+			Message:   entry.Message,
+			Timestamp: unixNanoTime(entry.Timestamp),
+		})
+	}
+	return history
+}
+
+// Transport returns the ID of the transport that moves data on the channel
+func (c channelState) Transport() datatransfer.TransportID {
+	return c.transport
+}
+
+// ErrorCode returns the code of the error the other peer rejected or
+// cancelled the channel with
+func (c channelState) ErrorCode() datatransfer.ErrorCode {
+	return c.errorCode
+}
+
+// Priority returns the priority of the channel
+func (c channelState) Priority() int {
+	return c.priority
+}
+
+// Label returns the label the initiator set on the channel
+func (c channelState) Label() string {
+	return c.label
+}
+
+// Metadata returns the metadata the initiator set on the channel
+func (c channelState) Metadata() map[string]string {
+	if len(c.metadata) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(c.metadata))
+	for _, entry := range c.metadata {
+		metadata[entry.Key] = entry.Value
+	}
+	return metadata
+}
+
+// Deadline returns the time the channel must finish by, or the zero time if
+// the channel has no timeout
+func (c channelState) Deadline() time.Time {
+	return unixNanoTime(c.deadline)
+}
+
+// Throttled indicates whether the local peer paused the channel to stay
+// within the bandwidth limits
+func (c channelState) Throttled() bool {
+	return c.throttled
+}
+
+// DoNotSendCids returns the CIDs of blocks the initiator of a pull channel
+// already had when it opened the channel
+func (c channelState) DoNotSendCids() []cid.Cid {
+	doNotSendCids, err := c.doNotSendCIDsReader.ReadList(c.ChannelID())
+	// channels opened without any do not send cids have no list
+	if err != nil && !xerrors.Is(err, datastore.ErrNotFound) {
+		log.Error(err)
+	}
+	return doNotSendCids
+}
+
+func unixNanoTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+func fromInternalChannelState(c internal.ChannelState, voucherDecoder DecoderByTypeFunc, voucherResultDecoder DecoderByTypeFunc, channelCIDsReader ChannelCIDsReader, doNotSendCIDsReader ChannelCIDsReader, history *channelHistory) datatransfer.ChannelState {
 	return channelState{
 		selfPeer:             c.SelfPeer,
 		isPull:               c.Initiator == c.Recipient,
@@ -186,11 +323,22 @@ func fromInternalChannelState(c internal.ChannelState, voucherDecoder DecoderByT
 		sent:                 c.Sent,
 		received:             c.Received,
 		message:              c.Message,
+		throttled:            c.Throttled,
 		vouchers:             c.Vouchers,
 		voucherResults:       c.VoucherResults,
+		createdAt:            c.CreatedAt,
+		lastDataActivity:     c.LastDataActivity,
+		transport:            c.Transport,
+		errorCode:            c.ErrorCode,
+		priority:             int(c.Priority),
+		label:                c.Label,
+		metadata:             c.Metadata,
+		deadline:             c.Deadline,
 		voucherResultDecoder: voucherResultDecoder,
 		voucherDecoder:       voucherDecoder,
 		channelCIDsReader:    channelCIDsReader,
+		doNotSendCIDsReader:  doNotSendCIDsReader,
+		history:              history,
 	}
 }
 
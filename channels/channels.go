@@ -3,6 +3,7 @@ package channels
 import (
 	"context"
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/ipfs/go-cid"
@@ -27,7 +28,13 @@ import (
 
 type DecoderByTypeFunc func(identifier datatransfer.TypeIdentifier) (encoding.Decoder, bool)
 
-type ChannelCIDsReader func(chid datatransfer.ChannelID) ([]cid.Cid, error)
+// ChannelCIDsReader reads the cids received on channels, which the channel
+// states read only when they are asked for them
+type ChannelCIDsReader interface {
+	ReadList(chid datatransfer.ChannelID) ([]cid.Cid, error)
+	IterateList(chid datatransfer.ChannelID, cb func(cid.Cid) error) error
+	ListLen(chid datatransfer.ChannelID) (int, error)
+}
 
 type Notifier func(datatransfer.Event, datatransfer.ChannelState)
 
@@ -55,7 +62,10 @@ type Channels struct {
 	stateMachines        fsm.Group
 	migrateStateMachines func(context.Context) error
 	cidLists             cidlists.CIDLists
+	doNotSendLists       cidlists.CIDLists
 	seenCIDs             *cidsets.CIDSetManager
+	index                *channelIndex
+	history              *channelHistory
 }
 
 // ChannelEnvironment -- just a proxy for DTNetwork for now
@@ -63,7 +73,7 @@ type ChannelEnvironment interface {
 	Protect(id peer.ID, tag string)
 	Unprotect(id peer.ID, tag string) bool
 	ID() peer.ID
-	CleanupChannel(chid datatransfer.ChannelID)
+	CleanupChannel(chid datatransfer.ChannelID, transport datatransfer.TransportID)
 }
 
 // New returns a new thread safe list of channels
@@ -78,7 +88,10 @@ func New(ds datastore.Batching,
 	seenCIDsDS := namespace.Wrap(ds, datastore.NewKey("seencids"))
 	c := &Channels{
 		cidLists:             cidLists,
+		doNotSendLists:       cidlists.NewDatastoreCIDLists(namespace.Wrap(ds, datastore.NewKey("donotsend"))),
 		seenCIDs:             cidsets.NewCIDSetManager(seenCIDsDS),
+		index:                newChannelIndex(namespace.Wrap(ds, datastore.NewKey("channel-index"))),
+		history:              newChannelHistory(namespace.Wrap(ds, datastore.NewKey("channel-history"))),
 		notifier:             notifier,
 		voucherDecoder:       voucherDecoder,
 		voucherResultDecoder: voucherResultDecoder,
@@ -95,16 +108,24 @@ func New(ds datastore.Batching,
 		StateEntryFuncs: ChannelStateEntryFuncs,
 		Notifier:        c.dispatch,
 		FinalityStates:  ChannelFinalityStates,
-	}, channelMigrations, versioning.VersionKey("2"))
+	}, channelMigrations, versioning.VersionKey("3"))
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
-// Start migrates the channel data store as needed
+// Start migrates the channel data store as needed, and builds the channel
+// index if it does not exist yet
 func (c *Channels) Start(ctx context.Context) error {
-	return c.migrateStateMachines(ctx)
+	if err := c.migrateStateMachines(ctx); err != nil {
+		return err
+	}
+	return c.index.build(func() ([]internal.ChannelState, error) {
+		var internalChannels []internal.ChannelState
+		err := c.stateMachines.List(&internalChannels)
+		return internalChannels, err
+	})
 }
 
 func (c *Channels) dispatch(eventName fsm.EventName, channel fsm.StateType) {
@@ -122,7 +143,19 @@ func (c *Channels) dispatch(eventName fsm.EventName, channel fsm.StateType) {
 		Timestamp: time.Now(),
 	}
 
-	c.notifier(evt, fromInternalChannelState(realChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList))
+	if err := c.index.update(realChannel); err != nil {
+		log.Errorf("failed to update index for channel %s-%s-%d: %s", realChannel.Initiator, realChannel.Responder, realChannel.TransferID, err)
+	}
+
+	// the channel has already transitioned, so the history records the
+	// status the event left the channel in
+	if _, ok := unrecordedEvents[evtCode]; !ok {
+		if err := c.history.record(realChannel, evtCode); err != nil {
+			log.Errorf("failed to record history for channel %s-%s-%d: %s", realChannel.Initiator, realChannel.Responder, realChannel.TransferID, err)
+		}
+	}
+
+	c.notifier(evt, fromInternalChannelState(realChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists, c.doNotSendLists, c.history))
 
 	// When the channel has been cleaned up, remove the caches of seen cids
 	if evt.Code == datatransfer.CleanupComplete {
@@ -140,7 +173,7 @@ func (c *Channels) dispatch(eventName fsm.EventName, channel fsm.StateType) {
 
 // CreateNew creates a new channel id and channel state and saves to channels.
 // returns error if the channel exists already.
-func (c *Channels) CreateNew(selfPeer peer.ID, tid datatransfer.TransferID, baseCid cid.Cid, selector ipld.Node, voucher datatransfer.Voucher, initiator, dataSender, dataReceiver peer.ID) (datatransfer.ChannelID, error) {
+func (c *Channels) CreateNew(selfPeer peer.ID, tid datatransfer.TransferID, baseCid cid.Cid, selector ipld.Node, voucher datatransfer.Voucher, initiator, dataSender, dataReceiver peer.ID, transport datatransfer.TransportID, opts datatransfer.ChannelOptions) (datatransfer.ChannelID, error) {
 	var responder peer.ID
 	if dataSender == initiator {
 		responder = dataReceiver
@@ -156,7 +189,8 @@ func (c *Channels) CreateNew(selfPeer peer.ID, tid datatransfer.TransferID, base
 	if err != nil {
 		return datatransfer.ChannelID{}, err
 	}
-	err = c.stateMachines.Begin(chid, &internal.ChannelState{
+	now := time.Now()
+	state := &internal.ChannelState{
 		SelfPeer:   selfPeer,
 		TransferID: tid,
 		Initiator:  initiator,
@@ -173,8 +207,22 @@ func (c *Channels) CreateNew(selfPeer peer.ID, tid datatransfer.TransferID, base
 				},
 			},
 		},
-		Status: datatransfer.Requested,
-	})
+		TotalSize: opts.TotalSize,
+		Status:    datatransfer.Requested,
+		CreatedAt: now.UnixNano(),
+		Transport: transport,
+		Priority:  int64(opts.Priority),
+		Label:     opts.Label,
+		Metadata:  metadataEntries(opts.Metadata),
+	}
+	if opts.Timeout > 0 {
+		state.Deadline = now.Add(opts.Timeout).UnixNano()
+	}
+	err = c.stateMachines.Begin(chid, state)
+	if err != nil {
+		return datatransfer.ChannelID{}, err
+	}
+	err = c.index.add(*state)
 	if err != nil {
 		return datatransfer.ChannelID{}, err
 	}
@@ -182,9 +230,31 @@ func (c *Channels) CreateNew(selfPeer peer.ID, tid datatransfer.TransferID, base
 	if err != nil {
 		return datatransfer.ChannelID{}, err
 	}
+	if len(opts.DoNotSendCids) > 0 {
+		err = c.doNotSendLists.CreateList(chid, opts.DoNotSendCids)
+		if err != nil {
+			return datatransfer.ChannelID{}, err
+		}
+	}
 	return chid, c.stateMachines.Send(chid, datatransfer.Open)
 }
 
+// metadataEntries converts channel metadata to the form it is stored in,
+// sorted by key
+func metadataEntries(metadata map[string]string) []internal.MetadataEntry {
+	if len(metadata) == 0 {
+		return nil
+	}
+	entries := make([]internal.MetadataEntry, 0, len(metadata))
+	for key, value := range metadata {
+		entries = append(entries, internal.MetadataEntry{Key: key, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
 // InProgress returns a list of in progress channels
 func (c *Channels) InProgress() (map[datatransfer.ChannelID]datatransfer.ChannelState, error) {
 	var internalChannels []internal.ChannelState
@@ -195,11 +265,44 @@ func (c *Channels) InProgress() (map[datatransfer.ChannelID]datatransfer.Channel
 	channels := make(map[datatransfer.ChannelID]datatransfer.ChannelState, len(internalChannels))
 	for _, internalChannel := range internalChannels {
 		channels[datatransfer.ChannelID{ID: internalChannel.TransferID, Responder: internalChannel.Responder, Initiator: internalChannel.Initiator}] =
-			fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList)
+			fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists, c.doNotSendLists, c.history)
+	}
+	return channels, nil
+}
+
+// List returns the channels that match the given filter, sorted by creation
+// time. Only the index is searched, so the state of a channel is decoded only
+// if it is in the requested page of results.
+func (c *Channels) List(ctx context.Context, filter datatransfer.ChannelFilter) ([]datatransfer.ChannelState, error) {
+	chids, err := c.index.list(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	channels := make([]datatransfer.ChannelState, 0, len(chids))
+	for _, chid := range chids {
+		var internalChannel internal.ChannelState
+		err := c.stateMachines.Get(chid).Get(&internalChannel)
+		if err != nil {
+			return nil, xerrors.Errorf("getting channel %s: %w", chid, err)
+		}
+		channels = append(channels, fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists, c.doNotSendLists, c.history))
 	}
 	return channels, nil
 }
 
+// Statuses returns the current status of every channel, read from the
+// channel index
+func (c *Channels) Statuses(ctx context.Context) (map[datatransfer.ChannelID]datatransfer.Status, error) {
+	statuses := make(map[datatransfer.ChannelID]datatransfer.Status)
+	err := c.index.forEach(ctx, func(entry *internal.ChannelIndexEntry) {
+		statuses[entryChannelID(entry)] = entry.Status
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
 // GetByID searches for a channel in the slice of channels with id `chid`.
 // Returns datatransfer.EmptyChannelState if there is no channel with that id
 func (c *Channels) GetByID(ctx context.Context, chid datatransfer.ChannelID) (datatransfer.ChannelState, error) {
@@ -208,12 +311,42 @@ func (c *Channels) GetByID(ctx context.Context, chid datatransfer.ChannelID) (da
 	if err != nil {
 		return nil, NewErrNotFound(chid)
 	}
-	return fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList), nil
+	return fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists, c.doNotSendLists, c.history), nil
+}
+
+// Accept marks a data transfer as accepted, and records the transport
+// that will move its data
+func (c *Channels) Accept(chid datatransfer.ChannelID, transport datatransfer.TransportID) error {
+	return c.send(chid, datatransfer.Accept, transport)
+}
+
+// Enqueued marks a data transfer as accepted but queued until the responder
+// has capacity to serve it, and records the transport that will move its data
+// and the reason it was queued
+func (c *Channels) Enqueued(chid datatransfer.ChannelID, transport datatransfer.TransportID, reason string) error {
+	return c.send(chid, datatransfer.Enqueued, transport, reason)
 }
 
-// Accept marks a data transfer as accepted
-func (c *Channels) Accept(chid datatransfer.ChannelID) error {
-	return c.send(chid, datatransfer.Accept)
+// Admitted marks a queued data transfer as admitted
+func (c *Channels) Admitted(chid datatransfer.ChannelID) error {
+	return c.send(chid, datatransfer.Admitted)
+}
+
+// TotalSizeSet sets the total size of the data being transferred
+func (c *Channels) TotalSizeSet(chid datatransfer.ChannelID, size uint64) error {
+	return c.send(chid, datatransfer.TotalSizeSet, size)
+}
+
+// SizeExceeded records that a data transfer has received more data than its
+// total size allows
+func (c *Channels) SizeExceeded(chid datatransfer.ChannelID) error {
+	return c.send(chid, datatransfer.SizeExceeded)
+}
+
+// Verified records that the data of a data transfer matches the receipt the
+// other peer sent for it
+func (c *Channels) Verified(chid datatransfer.ChannelID) error {
+	return c.send(chid, datatransfer.Verified)
 }
 
 // Restart marks a data transfer as restarted
@@ -319,6 +452,28 @@ func (c *Channels) Disconnected(chid datatransfer.ChannelID) error {
 	return c.send(chid, datatransfer.Disconnected)
 }
 
+// Throttled indicates the channel was paused locally to stay within bandwidth limits
+func (c *Channels) Throttled(chid datatransfer.ChannelID) error {
+	return c.send(chid, datatransfer.Throttled)
+}
+
+// Unthrottled indicates the channel was resumed after being throttled
+func (c *Channels) Unthrottled(chid datatransfer.ChannelID) error {
+	return c.send(chid, datatransfer.Unthrottled)
+}
+
+// Resumed indicates the channel was restarted automatically when the manager
+// started
+func (c *Channels) Resumed(chid datatransfer.ChannelID) error {
+	return c.send(chid, datatransfer.Resumed)
+}
+
+// ResumeFailed indicates the channel could not be restarted automatically
+// when the manager started
+func (c *Channels) ResumeFailed(chid datatransfer.ChannelID, err error) error {
+	return c.send(chid, datatransfer.ResumeFailed, err)
+}
+
 // HasChannel returns true if the given channel id is being tracked
 func (c *Channels) HasChannel(chid datatransfer.ChannelID) (bool, error) {
 	return c.stateMachines.Has(chid)
@@ -327,10 +482,11 @@ func (c *Channels) HasChannel(chid datatransfer.ChannelID) (bool, error) {
 // removeSeenCIDCaches cleans up the caches of "seen" blocks, ie
 // blocks that have already been queued / sent / received
 func (c *Channels) removeSeenCIDCaches(chid datatransfer.ChannelID) error {
+	// the sets are keyed by the regular event (see fireProgressEvent)
 	progressStates := []datatransfer.EventCode{
-		datatransfer.DataQueuedProgress,
-		datatransfer.DataSentProgress,
-		datatransfer.DataReceivedProgress,
+		datatransfer.DataQueued,
+		datatransfer.DataSent,
+		datatransfer.DataReceived,
 	}
 	for _, evt := range progressStates {
 		sid := cidsets.SetID(chid.String() + "/" + datatransfer.Events[evt])
@@ -1,8 +1,11 @@
 package channels
 
 import (
+	"time"
+
 	logging "github.com/ipfs/go-log/v2"
 	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-statemachine/fsm"
 
@@ -25,28 +28,52 @@ var transferringStates = []fsm.StateKey{
 // ChannelEvents describe the events taht can
 var ChannelEvents = fsm.Events{
 	fsm.Event(datatransfer.Open).FromAny().To(datatransfer.Requested),
-	fsm.Event(datatransfer.Accept).From(datatransfer.Requested).To(datatransfer.Ongoing),
+	fsm.Event(datatransfer.Accept).From(datatransfer.Requested).To(datatransfer.Ongoing).
+		Action(func(chst *internal.ChannelState, transport datatransfer.TransportID) error {
+			chst.Transport = transport
+			return nil
+		}),
+	fsm.Event(datatransfer.Enqueued).FromMany(datatransfer.Requested, datatransfer.Queued).To(datatransfer.Queued).
+		Action(func(chst *internal.ChannelState, transport datatransfer.TransportID, reason string) error {
+			chst.Transport = transport
+			chst.Message = reason
+			return nil
+		}),
+	fsm.Event(datatransfer.Admitted).From(datatransfer.Queued).To(datatransfer.Ongoing).Action(func(chst *internal.ChannelState) error {
+		chst.Message = ""
+		return nil
+	}),
+	fsm.Event(datatransfer.TotalSizeSet).FromAny().ToNoChange().Action(func(chst *internal.ChannelState, size uint64) error {
+		chst.TotalSize = size
+		return nil
+	}),
+	fsm.Event(datatransfer.SizeExceeded).FromMany(transferringStates...).ToNoChange().Action(func(chst *internal.ChannelState) error {
+		chst.Message = datatransfer.ErrSizeExceeded.Error()
+		return nil
+	}),
+	fsm.Event(datatransfer.Verified).FromAny().ToNoChange(),
 	fsm.Event(datatransfer.Restart).FromAny().ToNoChange().Action(func(chst *internal.ChannelState) error {
 		chst.Message = ""
+		chst.Throttled = false
 		return nil
 	}),
 
 	fsm.Event(datatransfer.Cancel).FromAny().To(datatransfer.Cancelling),
 
-	fsm.Event(datatransfer.DataReceived).FromMany(transferringStates...).ToNoChange(),
+	fsm.Event(datatransfer.DataReceived).FromMany(transferringStates...).ToNoChange().Action(recordDataActivity),
 	fsm.Event(datatransfer.DataReceivedProgress).FromMany(transferringStates...).ToNoChange().
 		Action(func(chst *internal.ChannelState, delta uint64) error {
 			chst.Received += delta
 			return nil
 		}),
 
-	fsm.Event(datatransfer.DataSent).FromMany(transferringStates...).ToNoChange(),
+	fsm.Event(datatransfer.DataSent).FromMany(transferringStates...).ToNoChange().Action(recordDataActivity),
 	fsm.Event(datatransfer.DataSentProgress).FromMany(transferringStates...).ToNoChange().
 		Action(func(chst *internal.ChannelState, delta uint64) error {
 			chst.Sent += delta
 			return nil
 		}),
-	fsm.Event(datatransfer.DataQueued).FromMany(transferringStates...).ToNoChange(),
+	fsm.Event(datatransfer.DataQueued).FromMany(transferringStates...).ToNoChange().Action(recordDataActivity),
 	fsm.Event(datatransfer.DataQueuedProgress).FromMany(transferringStates...).ToNoChange().
 		Action(func(chst *internal.ChannelState, delta uint64) error {
 			chst.Queued += delta
@@ -56,9 +83,33 @@ var ChannelEvents = fsm.Events{
 		chst.Message = datatransfer.ErrDisconnected.Error()
 		return nil
 	}),
+	fsm.Event(datatransfer.Throttled).FromMany(transferringStates...).ToNoChange().Action(func(chst *internal.ChannelState) error {
+		chst.Throttled = true
+		chst.Message = datatransfer.ErrThrottled.Error()
+		return nil
+	}),
+	fsm.Event(datatransfer.Unthrottled).FromMany(transferringStates...).ToNoChange().Action(func(chst *internal.ChannelState) error {
+		chst.Throttled = false
+		if chst.Message == datatransfer.ErrThrottled.Error() {
+			chst.Message = ""
+		}
+		return nil
+	}),
+	fsm.Event(datatransfer.Resumed).FromMany(transferringStates...).ToNoChange().Action(func(chst *internal.ChannelState) error {
+		chst.Message = ""
+		return nil
+	}),
+	fsm.Event(datatransfer.ResumeFailed).FromMany(transferringStates...).ToNoChange().Action(func(chst *internal.ChannelState, err error) error {
+		chst.Message = err.Error()
+		return nil
+	}),
 
 	fsm.Event(datatransfer.Error).FromAny().To(datatransfer.Failing).Action(func(chst *internal.ChannelState, err error) error {
 		chst.Message = err.Error()
+		var remoteErr *datatransfer.RemoteError
+		if xerrors.As(err, &remoteErr) {
+			chst.ErrorCode = remoteErr.Code
+		}
 		return nil
 	}),
 	fsm.Event(datatransfer.NewVoucher).FromAny().ToNoChange().
@@ -116,6 +167,23 @@ var ChannelEvents = fsm.Events{
 	fsm.Event(datatransfer.CompleteCleanupOnRestart).FromAny().ToNoChange(),
 }
 
+// unrecordedEvents are the events that are too frequent to keep in the
+// history of a channel
+var unrecordedEvents = map[datatransfer.EventCode]struct{}{
+	datatransfer.DataReceived:         {},
+	datatransfer.DataReceivedProgress: {},
+	datatransfer.DataSent:             {},
+	datatransfer.DataSentProgress:     {},
+	datatransfer.DataQueued:           {},
+	datatransfer.DataQueuedProgress:   {},
+}
+
+// recordDataActivity records the time data was queued, sent or received
+func recordDataActivity(chst *internal.ChannelState) error {
+	chst.LastDataActivity = time.Now().UnixNano()
+	return nil
+}
+
 // ChannelStateEntryFuncs are handlers called as we enter different states
 // (currently unused for this fsm)
 var ChannelStateEntryFuncs = fsm.StateEntryFuncs{
@@ -129,7 +197,7 @@ func cleanupConnection(ctx fsm.Context, env ChannelEnvironment, channel internal
 	if otherParty == env.ID() {
 		otherParty = channel.Responder
 	}
-	env.CleanupChannel(datatransfer.ChannelID{ID: channel.TransferID, Initiator: channel.Initiator, Responder: channel.Responder})
+	env.CleanupChannel(datatransfer.ChannelID{ID: channel.TransferID, Initiator: channel.Initiator, Responder: channel.Responder}, channel.Transport)
 	env.Unprotect(otherParty, datatransfer.ChannelID{ID: channel.TransferID, Initiator: channel.Initiator, Responder: channel.Responder}.String())
 	return ctx.Trigger(datatransfer.CleanupComplete)
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	basicnode "github.com/ipld/go-ipld-prime/node/basic"
 	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
@@ -28,6 +29,7 @@ import (
 	"github.com/filecoin-project/go-data-transfer/channels/internal/migrations"
 	v0 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v0"
 	v1 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v1"
+	v2 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v2"
 	"github.com/filecoin-project/go-data-transfer/cidlists"
 	"github.com/filecoin-project/go-data-transfer/encoding"
 	"github.com/filecoin-project/go-data-transfer/testutil"
@@ -60,19 +62,28 @@ func TestChannels(t *testing.T) {
 	err = channelList.Start(ctx)
 	require.NoError(t, err)
 	t.Run("adding channels", func(t *testing.T) {
-		chid, err := channelList.CreateNew(peers[0], tid1, cids[0], selector, fv1, peers[0], peers[0], peers[1])
+		chid, err := channelList.CreateNew(peers[0], tid1, cids[0], selector, fv1, peers[0], peers[0], peers[1], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.NoError(t, err)
 		require.Equal(t, peers[0], chid.Initiator)
 		require.Equal(t, tid1, chid.ID)
 
 		// cannot add twice for same channel id
-		_, err = channelList.CreateNew(peers[0], tid1, cids[1], selector, fv2, peers[0], peers[1], peers[0])
+		_, err = channelList.CreateNew(peers[0], tid1, cids[1], selector, fv2, peers[0], peers[1], peers[0], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.Error(t, err)
 		state := checkEvent(ctx, t, received, datatransfer.Open)
 		require.Equal(t, datatransfer.Requested, state.Status())
+		require.Empty(t, state.DoNotSendCids())
 
 		// can add for different id
-		chid, err = channelList.CreateNew(peers[2], tid2, cids[1], selector, fv2, peers[3], peers[2], peers[3])
+		opts := datatransfer.ChannelOptions{
+			Priority:      3,
+			TotalSize:     1000,
+			Label:         "backup",
+			Metadata:      map[string]string{"deal": "1"},
+			Timeout:       time.Minute,
+			DoNotSendCids: cids[:1],
+		}
+		chid, err = channelList.CreateNew(peers[2], tid2, cids[1], selector, fv2, peers[3], peers[2], peers[3], datatransfer.TransportID("stream"), opts)
 		require.NoError(t, err)
 		require.Equal(t, peers[3], chid.Initiator)
 		require.Equal(t, tid2, chid.ID)
@@ -80,6 +91,13 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, datatransfer.Requested, state.Status())
 		require.Equal(t, peers[2], state.SelfPeer())
 		require.Equal(t, peers[3], state.OtherPeer())
+		require.Equal(t, datatransfer.TransportID("stream"), state.Transport())
+		require.Equal(t, 3, state.Priority())
+		require.Equal(t, uint64(1000), state.TotalSize())
+		require.Equal(t, "backup", state.Label())
+		require.Equal(t, map[string]string{"deal": "1"}, state.Metadata())
+		require.WithinDuration(t, time.Now().Add(time.Minute), state.Deadline(), 10*time.Second)
+		require.Equal(t, cids[:1], state.DoNotSendCids())
 	})
 
 	t.Run("in progress channels", func(t *testing.T) {
@@ -116,13 +134,16 @@ func TestChannels(t *testing.T) {
 		state, err := channelList.GetByID(ctx, datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1})
 		require.NoError(t, err)
 		require.Equal(t, state.Status(), datatransfer.Requested)
+		require.Equal(t, datatransfer.DefaultTransport, state.Transport())
 
-		err = channelList.Accept(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1})
+		// accepting records the transport chosen by the responder
+		err = channelList.Accept(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, datatransfer.TransportID("stream"))
 		require.NoError(t, err)
 		state = checkEvent(ctx, t, received, datatransfer.Accept)
 		require.Equal(t, state.Status(), datatransfer.Ongoing)
+		require.Equal(t, datatransfer.TransportID("stream"), state.Transport())
 
-		err = channelList.Accept(datatransfer.ChannelID{Initiator: peers[1], Responder: peers[0], ID: tid1})
+		err = channelList.Accept(datatransfer.ChannelID{Initiator: peers[1], Responder: peers[0], ID: tid1}, datatransfer.DefaultTransport)
 		require.True(t, xerrors.As(err, new(*channels.ErrNotFound)))
 	})
 
@@ -136,13 +157,14 @@ func TestChannels(t *testing.T) {
 		err = channelList.Start(ctx)
 		require.NoError(t, err)
 
-		_, err = channelList.CreateNew(peers[0], tid1, cids[0], selector, fv1, peers[0], peers[0], peers[1])
+		_, err = channelList.CreateNew(peers[0], tid1, cids[0], selector, fv1, peers[0], peers[0], peers[1], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.NoError(t, err)
 		state := checkEvent(ctx, t, received, datatransfer.Open)
 		require.Equal(t, datatransfer.Requested, state.Status())
 		require.Equal(t, uint64(0), state.Received())
 		require.Equal(t, uint64(0), state.Sent())
 		require.Empty(t, state.ReceivedCids())
+		require.Zero(t, state.ReceivedCidsLen())
 
 		err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[0], 50)
 		require.NoError(t, err)
@@ -188,6 +210,13 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, uint64(100), state.Received())
 		require.Equal(t, uint64(100), state.Sent())
 		require.Equal(t, []cid.Cid{cids[0], cids[1], cids[0]}, state.ReceivedCids())
+		require.Equal(t, 3, state.ReceivedCidsLen())
+		var iterated []cid.Cid
+		require.NoError(t, state.ForEachReceivedCid(func(c cid.Cid) error {
+			iterated = append(iterated, c)
+			return nil
+		}))
+		require.Equal(t, []cid.Cid{cids[0], cids[1], cids[0]}, iterated)
 	})
 
 	t.Run("pause/resume", func(t *testing.T) {
@@ -265,10 +294,11 @@ func TestChannels(t *testing.T) {
 		state = checkEvent(ctx, t, received, datatransfer.Error)
 		require.Equal(t, datatransfer.Failing, state.Status())
 		require.Equal(t, "something went wrong", state.Message())
+		require.Equal(t, datatransfer.NoError, state.ErrorCode())
 		state = checkEvent(ctx, t, received, datatransfer.CleanupComplete)
 		require.Equal(t, datatransfer.Failed, state.Status())
 
-		chid, err := channelList.CreateNew(peers[0], tid2, cids[1], selector, fv2, peers[2], peers[1], peers[2])
+		chid, err := channelList.CreateNew(peers[0], tid2, cids[1], selector, fv2, peers[2], peers[1], peers[2], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.NoError(t, err)
 		require.Equal(t, peers[2], chid.Initiator)
 		require.Equal(t, tid2, chid.ID)
@@ -285,7 +315,7 @@ func TestChannels(t *testing.T) {
 
 	t.Run("test self peer and other peer", func(t *testing.T) {
 		// sender is self peer
-		chid, err := channelList.CreateNew(peers[1], tid1, cids[0], selector, fv1, peers[1], peers[1], peers[2])
+		chid, err := channelList.CreateNew(peers[1], tid1, cids[0], selector, fv1, peers[1], peers[1], peers[2], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.NoError(t, err)
 		ch, err := channelList.GetByID(context.Background(), chid)
 		require.NoError(t, err)
@@ -293,7 +323,7 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, peers[2], ch.OtherPeer())
 
 		// recipient is self peer
-		chid, err = channelList.CreateNew(peers[2], datatransfer.TransferID(1001), cids[0], selector, fv1, peers[1], peers[2], peers[1])
+		chid, err = channelList.CreateNew(peers[2], datatransfer.TransferID(1001), cids[0], selector, fv1, peers[1], peers[2], peers[1], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.NoError(t, err)
 		ch, err = channelList.GetByID(context.Background(), chid)
 		require.NoError(t, err)
@@ -315,7 +345,7 @@ func TestChannels(t *testing.T) {
 		err = channelList.Start(ctx)
 		require.NoError(t, err)
 
-		chid, err := channelList.CreateNew(peers[3], tid1, cids[0], selector, fv1, peers[3], peers[0], peers[3])
+		chid, err := channelList.CreateNew(peers[3], tid1, cids[0], selector, fv1, peers[3], peers[0], peers[3], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.NoError(t, err)
 		state := checkEvent(ctx, t, received, datatransfer.Open)
 		require.Equal(t, datatransfer.Requested, state.Status())
@@ -326,10 +356,41 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, datatransfer.ErrDisconnected.Error(), state.Message())
 	})
 
+	t.Run("total size", func(t *testing.T) {
+		ds := datastore.NewMapDatastore()
+		received := make(chan event)
+		notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+			received <- event{evt, chst}
+		}
+		dir := os.TempDir()
+		cidLists, err := cidlists.NewCIDLists(dir)
+		require.NoError(t, err)
+		channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+		require.NoError(t, err)
+		err = channelList.Start(ctx)
+		require.NoError(t, err)
+
+		chid, err := channelList.CreateNew(peers[3], tid1, cids[0], selector, fv1, peers[3], peers[0], peers[3], datatransfer.DefaultTransport,
+			datatransfer.ChannelOptions{TotalSize: 1000})
+		require.NoError(t, err)
+		state := checkEvent(ctx, t, received, datatransfer.Open)
+		require.Equal(t, uint64(1000), state.TotalSize())
+
+		err = channelList.SizeExceeded(chid)
+		require.NoError(t, err)
+		state = checkEvent(ctx, t, received, datatransfer.SizeExceeded)
+		require.Equal(t, datatransfer.ErrSizeExceeded.Error(), state.Message())
+
+		err = channelList.TotalSizeSet(chid, 1200)
+		require.NoError(t, err)
+		state = checkEvent(ctx, t, received, datatransfer.TotalSizeSet)
+		require.Equal(t, uint64(1200), state.TotalSize())
+	})
+
 	t.Run("test self peer and other peer", func(t *testing.T) {
 		peers := testutil.GeneratePeers(3)
 		// sender is self peer
-		chid, err := channelList.CreateNew(peers[1], tid1, cids[0], selector, fv1, peers[1], peers[1], peers[2])
+		chid, err := channelList.CreateNew(peers[1], tid1, cids[0], selector, fv1, peers[1], peers[1], peers[2], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.NoError(t, err)
 		ch, err := channelList.GetByID(context.Background(), chid)
 		require.NoError(t, err)
@@ -337,7 +398,7 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, peers[2], ch.OtherPeer())
 
 		// recipient is self peer
-		chid, err = channelList.CreateNew(peers[2], datatransfer.TransferID(1001), cids[0], selector, fv1, peers[1], peers[2], peers[1])
+		chid, err = channelList.CreateNew(peers[2], datatransfer.TransferID(1001), cids[0], selector, fv1, peers[1], peers[2], peers[1], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
 		require.NoError(t, err)
 		ch, err = channelList.GetByID(context.Background(), chid)
 		require.NoError(t, err)
@@ -346,6 +407,391 @@ func TestChannels(t *testing.T) {
 	})
 }
 
+func TestListChannels(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ds := datastore.NewMapDatastore()
+	received := make(chan event)
+	notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+		received <- event{evt, chst}
+	}
+
+	cids := testutil.GenerateCids(2)
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	peers := testutil.GeneratePeers(3)
+	self := peers[0]
+
+	dir := os.TempDir()
+	cidLists, err := cidlists.NewCIDLists(dir)
+	require.NoError(t, err)
+	channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, self)
+	require.NoError(t, err)
+	err = channelList.Start(ctx)
+	require.NoError(t, err)
+
+	// push initiated by self
+	pushOut, err := channelList.CreateNew(self, datatransfer.TransferID(rand.Uint64()), cids[0], selector, testutil.NewFakeDTType(), self, self, peers[1], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
+	require.NoError(t, err)
+	checkEvent(ctx, t, received, datatransfer.Open)
+	time.Sleep(time.Millisecond)
+	// pull initiated by self
+	pullOut, err := channelList.CreateNew(self, datatransfer.TransferID(rand.Uint64()), cids[1], selector, testutil.NewFakeDTType(), self, peers[1], self, datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
+	require.NoError(t, err)
+	checkEvent(ctx, t, received, datatransfer.Open)
+	time.Sleep(time.Millisecond)
+	afterPull := time.Now()
+	time.Sleep(time.Millisecond)
+	// push initiated by another peer
+	pushIn, err := channelList.CreateNew(self, datatransfer.TransferID(rand.Uint64()), cids[0], selector, testutil.NewFakeDTType(), peers[2], peers[2], self, datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
+	require.NoError(t, err)
+	checkEvent(ctx, t, received, datatransfer.Open)
+
+	require.NoError(t, channelList.Accept(pushOut, datatransfer.DefaultTransport))
+	checkEvent(ctx, t, received, datatransfer.Accept)
+
+	listIDs := func(filter datatransfer.ChannelFilter) []datatransfer.ChannelID {
+		chsts, err := channelList.List(ctx, filter)
+		require.NoError(t, err)
+		chids := make([]datatransfer.ChannelID, 0, len(chsts))
+		for _, chst := range chsts {
+			chids = append(chids, chst.ChannelID())
+		}
+		return chids
+	}
+
+	testCases := map[string]struct {
+		filter   datatransfer.ChannelFilter
+		expected []datatransfer.ChannelID
+	}{
+		"no filter": {
+			expected: []datatransfer.ChannelID{pushOut, pullOut, pushIn},
+		},
+		"descending": {
+			filter:   datatransfer.ChannelFilter{Descending: true},
+			expected: []datatransfer.ChannelID{pushIn, pullOut, pushOut},
+		},
+		"peers": {
+			filter:   datatransfer.ChannelFilter{Peers: []peer.ID{peers[1]}},
+			expected: []datatransfer.ChannelID{pushOut, pullOut},
+		},
+		"statuses": {
+			filter:   datatransfer.ChannelFilter{Statuses: []datatransfer.Status{datatransfer.Requested}},
+			expected: []datatransfer.ChannelID{pullOut, pushIn},
+		},
+		"status after a status change": {
+			filter:   datatransfer.ChannelFilter{Statuses: []datatransfer.Status{datatransfer.Ongoing}},
+			expected: []datatransfer.ChannelID{pushOut},
+		},
+		"several statuses": {
+			filter:   datatransfer.ChannelFilter{Statuses: []datatransfer.Status{datatransfer.Ongoing, datatransfer.Requested, datatransfer.Ongoing}},
+			expected: []datatransfer.ChannelID{pushOut, pullOut, pushIn},
+		},
+		"statuses and peers": {
+			filter:   datatransfer.ChannelFilter{Statuses: []datatransfer.Status{datatransfer.Requested}, Peers: []peer.ID{peers[1]}},
+			expected: []datatransfer.ChannelID{pullOut},
+		},
+		"push": {
+			filter:   datatransfer.ChannelFilter{Direction: datatransfer.PushDirection},
+			expected: []datatransfer.ChannelID{pushOut, pushIn},
+		},
+		"pull": {
+			filter:   datatransfer.ChannelFilter{Direction: datatransfer.PullDirection},
+			expected: []datatransfer.ChannelID{pullOut},
+		},
+		"responder": {
+			filter:   datatransfer.ChannelFilter{Role: datatransfer.ResponderRole},
+			expected: []datatransfer.ChannelID{pushIn},
+		},
+		"initiator push": {
+			filter:   datatransfer.ChannelFilter{Role: datatransfer.InitiatorRole, Direction: datatransfer.PushDirection},
+			expected: []datatransfer.ChannelID{pushOut},
+		},
+		"voucher type": {
+			filter:   datatransfer.ChannelFilter{VoucherTypes: []datatransfer.TypeIdentifier{"OtherType"}},
+			expected: []datatransfer.ChannelID{},
+		},
+		"base cid": {
+			filter:   datatransfer.ChannelFilter{BaseCid: cids[0]},
+			expected: []datatransfer.ChannelID{pushOut, pushIn},
+		},
+		"created after": {
+			filter:   datatransfer.ChannelFilter{CreatedAfter: afterPull},
+			expected: []datatransfer.ChannelID{pushIn},
+		},
+		"created before": {
+			filter:   datatransfer.ChannelFilter{CreatedBefore: afterPull},
+			expected: []datatransfer.ChannelID{pushOut, pullOut},
+		},
+		"paging": {
+			filter:   datatransfer.ChannelFilter{Offset: 1, Limit: 1},
+			expected: []datatransfer.ChannelID{pullOut},
+		},
+		"offset past end": {
+			filter:   datatransfer.ChannelFilter{Offset: 3},
+			expected: []datatransfer.ChannelID{},
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			require.Equal(t, data.expected, listIDs(data.filter))
+		})
+	}
+
+	t.Run("indexes existing entries by status and peer", func(t *testing.T) {
+		// remove the status and peer keys, as if the index was built by an
+		// older version
+		for _, prefix := range []string{"/channel-index/status", "/channel-index/peer"} {
+			res, err := ds.Query(query.Query{Prefix: prefix, KeysOnly: true})
+			require.NoError(t, err)
+			entries, err := res.Rest()
+			require.NoError(t, err)
+			require.NotEmpty(t, entries)
+			for _, entry := range entries {
+				require.NoError(t, ds.Delete(datastore.NewKey(entry.Key)))
+			}
+		}
+		require.NoError(t, ds.Delete(datastore.NewKey("/channel-index/fields-built")))
+
+		channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, self)
+		require.NoError(t, err)
+		err = channelList.Start(ctx)
+		require.NoError(t, err)
+
+		chsts, err := channelList.List(ctx, datatransfer.ChannelFilter{Statuses: []datatransfer.Status{datatransfer.Requested}})
+		require.NoError(t, err)
+		require.Len(t, chsts, 2)
+		require.Equal(t, pullOut, chsts[0].ChannelID())
+		require.Equal(t, pushIn, chsts[1].ChannelID())
+
+		chsts, err = channelList.List(ctx, datatransfer.ChannelFilter{Peers: []peer.ID{peers[2]}})
+		require.NoError(t, err)
+		require.Len(t, chsts, 1)
+		require.Equal(t, pushIn, chsts[0].ChannelID())
+	})
+
+	t.Run("builds index for existing channels", func(t *testing.T) {
+		// remove the index, as if the channels were created by an older version
+		res, err := ds.Query(query.Query{Prefix: "/channel-index", KeysOnly: true})
+		require.NoError(t, err)
+		entries, err := res.Rest()
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.NoError(t, ds.Delete(datastore.NewKey(entry.Key)))
+		}
+
+		channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, self)
+		require.NoError(t, err)
+		err = channelList.Start(ctx)
+		require.NoError(t, err)
+
+		chsts, err := channelList.List(ctx, datatransfer.ChannelFilter{Statuses: []datatransfer.Status{datatransfer.Ongoing}})
+		require.NoError(t, err)
+		require.Len(t, chsts, 1)
+		require.Equal(t, pushOut, chsts[0].ChannelID())
+
+		// the index is rebuilt with the creation times of the channels
+		chsts, err = channelList.List(ctx, datatransfer.ChannelFilter{CreatedBefore: afterPull})
+		require.NoError(t, err)
+		require.Len(t, chsts, 2)
+		require.Equal(t, pushOut, chsts[0].ChannelID())
+		require.Equal(t, pullOut, chsts[1].ChannelID())
+	})
+}
+
+func TestChannelRetention(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ds := datastore.NewMapDatastore()
+	received := make(chan event, 32)
+	notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+		received <- event{evt, chst}
+	}
+
+	cids := testutil.GenerateCids(1)
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	peers := testutil.GeneratePeers(2)
+
+	dir := os.TempDir()
+	cidLists, err := cidlists.NewCIDLists(dir)
+	require.NoError(t, err)
+	channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+	require.NoError(t, err)
+	err = channelList.Start(ctx)
+	require.NoError(t, err)
+
+	createChannel := func(opts datatransfer.ChannelOptions) datatransfer.ChannelID {
+		chid, err := channelList.CreateNew(peers[0], datatransfer.TransferID(rand.Uint64()), cids[0], selector, testutil.NewFakeDTType(), peers[0], peers[1], peers[0], datatransfer.DefaultTransport, opts)
+		require.NoError(t, err)
+		checkEvent(ctx, t, received, datatransfer.Open)
+		return chid
+	}
+	cancelChannel := func(chid datatransfer.ChannelID) {
+		require.NoError(t, channelList.Cancel(chid))
+		checkEvent(ctx, t, received, datatransfer.Cancel)
+		checkEvent(ctx, t, received, datatransfer.CleanupComplete)
+		time.Sleep(time.Millisecond)
+	}
+
+	cancelled1 := createChannel(datatransfer.ChannelOptions{DoNotSendCids: cids})
+	chst, err := channelList.GetByID(ctx, cancelled1)
+	require.NoError(t, err)
+	require.Equal(t, cids, chst.DoNotSendCids())
+	require.NoError(t, channelList.DataReceived(cancelled1, cids[0], 100))
+	checkEvent(ctx, t, received, datatransfer.DataReceivedProgress)
+	checkEvent(ctx, t, received, datatransfer.DataReceived)
+	cancelChannel(cancelled1)
+
+	failed := createChannel(datatransfer.ChannelOptions{})
+	require.NoError(t, channelList.Error(failed, errors.New("something went wrong")))
+	checkEvent(ctx, t, received, datatransfer.Error)
+	checkEvent(ctx, t, received, datatransfer.CleanupComplete)
+	time.Sleep(time.Millisecond)
+
+	cancelled2 := createChannel(datatransfer.ChannelOptions{})
+	cancelChannel(cancelled2)
+
+	ongoing := createChannel(datatransfer.ChannelOptions{})
+
+	t.Run("max count", func(t *testing.T) {
+		purged, err := channelList.Sweep(ctx, channels.RetentionPolicy{MaxCount: 2})
+		require.NoError(t, err)
+		require.Equal(t, []datatransfer.ChannelID{cancelled1}, purged)
+		state := checkEvent(ctx, t, received, datatransfer.Purged)
+		require.Equal(t, cancelled1, state.ChannelID())
+		require.Equal(t, datatransfer.Cancelled, state.Status())
+
+		has, err := channelList.HasChannel(cancelled1)
+		require.NoError(t, err)
+		require.False(t, has)
+		_, err = cidLists.ReadList(cancelled1)
+		require.Error(t, err)
+		res, err := ds.Query(query.Query{Prefix: "/seencids/" + cancelled1.String(), KeysOnly: true})
+		require.NoError(t, err)
+		seen, err := res.Rest()
+		require.NoError(t, err)
+		require.Empty(t, seen)
+		res, err = ds.Query(query.Query{Prefix: "/donotsend", KeysOnly: true})
+		require.NoError(t, err)
+		doNotSend, err := res.Rest()
+		require.NoError(t, err)
+		require.Empty(t, doNotSend)
+
+		chsts, err := channelList.List(ctx, datatransfer.ChannelFilter{})
+		require.NoError(t, err)
+		require.Len(t, chsts, 3)
+
+		// the purged channel is no longer indexed by status
+		chsts, err = channelList.List(ctx, datatransfer.ChannelFilter{Statuses: []datatransfer.Status{datatransfer.Cancelled}})
+		require.NoError(t, err)
+		require.Len(t, chsts, 1)
+		require.Equal(t, cancelled2, chsts[0].ChannelID())
+		res, err = ds.Query(query.Query{Prefix: "/channel-index", KeysOnly: true})
+		require.NoError(t, err)
+		keys, err := res.Rest()
+		require.NoError(t, err)
+		for _, key := range keys {
+			require.NotContains(t, key.Key, cancelled1.String())
+		}
+	})
+
+	t.Run("max age per status", func(t *testing.T) {
+		purged, err := channelList.Sweep(ctx, channels.RetentionPolicy{
+			MaxAge:       time.Nanosecond,
+			StatusMaxAge: map[datatransfer.Status]time.Duration{datatransfer.Failed: time.Hour},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []datatransfer.ChannelID{cancelled2}, purged)
+		state := checkEvent(ctx, t, received, datatransfer.Purged)
+		require.Equal(t, cancelled2, state.ChannelID())
+
+		for _, chid := range []datatransfer.ChannelID{failed, ongoing} {
+			has, err := channelList.HasChannel(chid)
+			require.NoError(t, err)
+			require.True(t, has)
+		}
+	})
+
+	t.Run("cannot purge channel that has not terminated", func(t *testing.T) {
+		require.Error(t, channelList.Purge(ongoing))
+	})
+}
+
+func TestChannelTimestampsAndHistory(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ds := datastore.NewMapDatastore()
+	received := make(chan event)
+	notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+		received <- event{evt, chst}
+	}
+
+	cids := testutil.GenerateCids(1)
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	peers := testutil.GeneratePeers(2)
+
+	dir := os.TempDir()
+	cidLists, err := cidlists.NewCIDLists(dir)
+	require.NoError(t, err)
+	channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+	require.NoError(t, err)
+	err = channelList.Start(ctx)
+	require.NoError(t, err)
+
+	before := time.Now()
+	chid, err := channelList.CreateNew(peers[0], datatransfer.TransferID(rand.Uint64()), cids[0], selector, testutil.NewFakeDTType(), peers[0], peers[0], peers[1], datatransfer.DefaultTransport, datatransfer.ChannelOptions{})
+	require.NoError(t, err)
+	state := checkEvent(ctx, t, received, datatransfer.Open)
+	require.False(t, state.CreatedAt().Before(before))
+	require.False(t, state.CreatedAt().After(time.Now()))
+	require.True(t, state.LastDataActivity().IsZero())
+
+	require.NoError(t, channelList.Accept(chid, datatransfer.DefaultTransport))
+	checkEvent(ctx, t, received, datatransfer.Accept)
+
+	beforeData := time.Now()
+	require.NoError(t, channelList.DataSent(chid, cids[0], 100))
+	checkEvent(ctx, t, received, datatransfer.DataSentProgress)
+	state = checkEvent(ctx, t, received, datatransfer.DataSent)
+	require.False(t, state.LastDataActivity().Before(beforeData))
+
+	require.NoError(t, channelList.PauseResponder(chid))
+	state = checkEvent(ctx, t, received, datatransfer.PauseResponder)
+
+	// data events are not recorded in the history
+	history := state.History()
+	require.Len(t, history, 3)
+	require.Equal(t, datatransfer.Open, history[0].Code)
+	require.Equal(t, datatransfer.Requested, history[0].Status)
+	require.Equal(t, datatransfer.Accept, history[1].Code)
+	require.Equal(t, datatransfer.Ongoing, history[1].Status)
+	require.Equal(t, datatransfer.PauseResponder, history[2].Code)
+	require.Equal(t, datatransfer.ResponderPaused, history[2].Status)
+	for i := 1; i < len(history); i++ {
+		require.False(t, history[i].Timestamp.Before(history[i-1].Timestamp))
+	}
+
+	// the history is persisted with the status each event left the channel in
+	stored, err := channelList.GetByID(ctx, chid)
+	require.NoError(t, err)
+	require.Equal(t, history, stored.History())
+
+	t.Run("history is bounded", func(t *testing.T) {
+		for i := 0; i < 40; i++ {
+			require.NoError(t, channelList.NewVoucher(chid, testutil.NewFakeDTType()))
+			state = checkEvent(ctx, t, received, datatransfer.NewVoucher)
+		}
+		history := state.History()
+		require.Len(t, history, 32)
+		for _, entry := range history {
+			require.Equal(t, datatransfer.NewVoucher, entry.Code)
+			require.Equal(t, datatransfer.ResponderPaused, entry.Status)
+		}
+	})
+}
+
 func TestIsChannelTerminated(t *testing.T) {
 	require.True(t, channels.IsChannelTerminated(datatransfer.Cancelled))
 	require.True(t, channels.IsChannelTerminated(datatransfer.Failed))
@@ -608,6 +1054,138 @@ func TestMigrationsV1(t *testing.T) {
 	}
 }
 
+func TestMigrationsV2(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	ds := datastore.NewMapDatastore()
+	received := make(chan event)
+	notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+		received <- event{evt, chst}
+	}
+	numChannels := 5
+	transferIDs := make([]datatransfer.TransferID, numChannels)
+	initiators := make([]peer.ID, numChannels)
+	responders := make([]peer.ID, numChannels)
+	baseCids := make([]cid.Cid, numChannels)
+
+	totalSizes := make([]uint64, numChannels)
+	queueds := make([]uint64, numChannels)
+	sents := make([]uint64, numChannels)
+	receiveds := make([]uint64, numChannels)
+	messages := make([]string, numChannels)
+	vouchers := make([]datatransfer.Voucher, numChannels)
+	voucherResults := make([]datatransfer.VoucherResult, numChannels)
+	allSelector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	allSelectorBuf := new(bytes.Buffer)
+	err := dagcbor.Encoder(allSelector, allSelectorBuf)
+	require.NoError(t, err)
+	allSelectorBytes := allSelectorBuf.Bytes()
+	selfPeer := testutil.GeneratePeers(1)[0]
+	dir := os.TempDir()
+	cidLists, err := cidlists.NewCIDLists(dir)
+	require.NoError(t, err)
+
+	list, err := migrations.GetChannelStateMigrations(selfPeer, cidLists)
+	require.NoError(t, err)
+	vds, up := versionedds.NewVersionedDatastore(ds, list, versioning.VersionKey("2"))
+	require.NoError(t, up(ctx))
+
+	for i := 0; i < numChannels; i++ {
+		transferIDs[i] = datatransfer.TransferID(rand.Uint64())
+		initiators[i] = testutil.GeneratePeers(1)[0]
+		responders[i] = testutil.GeneratePeers(1)[0]
+		baseCids[i] = testutil.GenerateCids(1)[0]
+		totalSizes[i] = rand.Uint64()
+		queueds[i] = rand.Uint64()
+		sents[i] = rand.Uint64()
+		receiveds[i] = rand.Uint64()
+		messages[i] = string(testutil.RandomBytes(20))
+		vouchers[i] = testutil.NewFakeDTType()
+		vBytes, err := encoding.Encode(vouchers[i])
+		require.NoError(t, err)
+		voucherResults[i] = testutil.NewFakeDTType()
+		vrBytes, err := encoding.Encode(voucherResults[i])
+		require.NoError(t, err)
+		channel := v2.ChannelState{
+			TransferID: transferIDs[i],
+			Initiator:  initiators[i],
+			Responder:  responders[i],
+			BaseCid:    baseCids[i],
+			Selector: &cbg.Deferred{
+				Raw: allSelectorBytes,
+			},
+			Sender:    initiators[i],
+			Recipient: responders[i],
+			TotalSize: totalSizes[i],
+			Status:    datatransfer.Ongoing,
+			Queued:    queueds[i],
+			Sent:      sents[i],
+			Received:  receiveds[i],
+			Message:   messages[i],
+			Vouchers: []internal.EncodedVoucher{
+				{
+					Type: vouchers[i].Type(),
+					Voucher: &cbg.Deferred{
+						Raw: vBytes,
+					},
+				},
+			},
+			VoucherResults: []internal.EncodedVoucherResult{
+				{
+					Type: voucherResults[i].Type(),
+					VoucherResult: &cbg.Deferred{
+						Raw: vrBytes,
+					},
+				},
+			},
+			SelfPeer: selfPeer,
+		}
+		buf := new(bytes.Buffer)
+		err = channel.MarshalCBOR(buf)
+		require.NoError(t, err)
+		err = vds.Put(datastore.NewKey(datatransfer.ChannelID{
+			Initiator: initiators[i],
+			Responder: responders[i],
+			ID:        transferIDs[i],
+		}.String()), buf.Bytes())
+		require.NoError(t, err)
+	}
+
+	channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, selfPeer)
+	require.NoError(t, err)
+	err = channelList.Start(ctx)
+	require.NoError(t, err)
+
+	for i := 0; i < numChannels; i++ {
+
+		channel, err := channelList.GetByID(ctx, datatransfer.ChannelID{
+			Initiator: initiators[i],
+			Responder: responders[i],
+			ID:        transferIDs[i],
+		})
+		require.NoError(t, err)
+		require.Equal(t, selfPeer, channel.SelfPeer())
+		require.Equal(t, transferIDs[i], channel.TransferID())
+		require.Equal(t, baseCids[i], channel.BaseCID())
+		require.Equal(t, allSelector, channel.Selector())
+		require.Equal(t, initiators[i], channel.Sender())
+		require.Equal(t, responders[i], channel.Recipient())
+		require.Equal(t, totalSizes[i], channel.TotalSize())
+		require.Equal(t, datatransfer.Ongoing, channel.Status())
+		require.Equal(t, queueds[i], channel.Queued())
+		require.Equal(t, sents[i], channel.Sent())
+		require.Equal(t, receiveds[i], channel.Received())
+		require.Equal(t, messages[i], channel.Message())
+		require.Equal(t, vouchers[i], channel.LastVoucher())
+		require.Equal(t, voucherResults[i], channel.LastVoucherResult())
+		require.True(t, channel.CreatedAt().IsZero())
+		require.True(t, channel.LastDataActivity().IsZero())
+		require.Empty(t, channel.History())
+	}
+}
+
 type event struct {
 	event datatransfer.Event
 	state datatransfer.ChannelState
@@ -638,7 +1216,7 @@ func (fe *fakeEnv) ID() peer.ID {
 	return peer.ID("")
 }
 
-func (fe *fakeEnv) CleanupChannel(chid datatransfer.ChannelID) {
+func (fe *fakeEnv) CleanupChannel(chid datatransfer.ChannelID, transport datatransfer.TransportID) {
 }
 
 func decoderByType(identifier datatransfer.TypeIdentifier) (encoding.Decoder, bool) {
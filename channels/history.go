@@ -0,0 +1,82 @@
+package channels
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels/internal"
+)
+
+// maxHistoryLength is the maximum number of events kept in the history of
+// a channel
+const maxHistoryLength = 32
+
+// channelHistory keeps the most recent events on each channel in the
+// datastore. Events are recorded as the FSM dispatches them, once the
+// channel has transitioned, so each entry has the status the event left the
+// channel in.
+type channelHistory struct {
+	ds datastore.Datastore
+}
+
+func newChannelHistory(ds datastore.Datastore) *channelHistory {
+	return &channelHistory{ds: ds}
+}
+
+// record appends an event to the history of the channel, discarding the
+// oldest events if the history is full
+func (ch *channelHistory) record(chst internal.ChannelState, code datatransfer.EventCode) error {
+	chid := datatransfer.ChannelID{Initiator: chst.Initiator, Responder: chst.Responder, ID: chst.TransferID}
+	history, err := ch.get(chid)
+	if err != nil {
+		return err
+	}
+	history.Entries = append(history.Entries, internal.ChannelHistoryEntry{
+		Event:     uint64(code),
+		Status:    chst.Status,
+		Timestamp: time.Now().UnixNano(),
+		Message:   chst.Message,
+	})
+	if len(history.Entries) > maxHistoryLength {
+		history.Entries = append([]internal.ChannelHistoryEntry(nil), history.Entries[len(history.Entries)-maxHistoryLength:]...)
+	}
+	buf := new(bytes.Buffer)
+	if err := history.MarshalCBOR(buf); err != nil {
+		return xerrors.Errorf("encoding history for channel %s: %w", chid, err)
+	}
+	return ch.ds.Put(indexKey(chid), buf.Bytes())
+}
+
+// read returns the recorded events on the channel, oldest first
+func (ch *channelHistory) read(chid datatransfer.ChannelID) ([]internal.ChannelHistoryEntry, error) {
+	history, err := ch.get(chid)
+	if err != nil {
+		return nil, err
+	}
+	return history.Entries, nil
+}
+
+func (ch *channelHistory) get(chid datatransfer.ChannelID) (*internal.ChannelHistory, error) {
+	var history internal.ChannelHistory
+	data, err := ch.ds.Get(indexKey(chid))
+	if err != nil {
+		// channels that have not recorded any events yet have no history
+		if xerrors.Is(err, datastore.ErrNotFound) {
+			return &history, nil
+		}
+		return nil, xerrors.Errorf("reading history for channel %s: %w", chid, err)
+	}
+	if err := history.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return nil, xerrors.Errorf("decoding history for channel %s: %w", chid, err)
+	}
+	return &history, nil
+}
+
+// remove deletes the history of the channel
+func (ch *channelHistory) remove(chid datatransfer.ChannelID) error {
+	return ch.ds.Delete(indexKey(chid))
+}
@@ -0,0 +1,484 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels/internal"
+)
+
+var (
+	indexBuiltKey      = datastore.NewKey("built")
+	fieldIndexBuiltKey = datastore.NewKey("fields-built")
+	entriesKey         = datastore.NewKey("channels")
+	statusIndexKey     = datastore.NewKey("status")
+	peerIndexKey       = datastore.NewKey("peer")
+)
+
+// channelIndex keeps a summary of each channel in the datastore, so that
+// channels can be filtered without decoding every channel state.
+// Channels are also indexed by status and by the other peer, so that
+// filtering on those fields only reads the entries of the matching channels.
+type channelIndex struct {
+	ds      datastore.Batching
+	entries datastore.Batching
+
+	lk       sync.Mutex
+	statuses map[datatransfer.ChannelID]datatransfer.Status
+}
+
+func newChannelIndex(ds datastore.Batching) *channelIndex {
+	return &channelIndex{
+		ds:       ds,
+		entries:  namespace.Wrap(ds, entriesKey),
+		statuses: make(map[datatransfer.ChannelID]datatransfer.Status),
+	}
+}
+
+func indexKey(chid datatransfer.ChannelID) datastore.Key {
+	return datastore.NewKey(chid.String())
+}
+
+func statusKey(status datatransfer.Status) datastore.Key {
+	return statusIndexKey.ChildString(strconv.FormatUint(uint64(status), 10))
+}
+
+func peerKey(p peer.ID) datastore.Key {
+	return peerIndexKey.ChildString(p.String())
+}
+
+// fieldKeys returns the keys that index the channel by status and by the
+// other peer
+func fieldKeys(entry *internal.ChannelIndexEntry) []datastore.Key {
+	chid := entryChannelID(entry)
+	return []datastore.Key{
+		statusKey(entry.Status).Child(indexKey(chid)),
+		peerKey(chid.OtherParty(entry.SelfPeer)).Child(indexKey(chid)),
+	}
+}
+
+// build indexes all existing channels, if the index has not already been built
+func (ci *channelIndex) build(list func() ([]internal.ChannelState, error)) error {
+	built, err := ci.ds.Has(indexBuiltKey)
+	if err != nil {
+		return xerrors.Errorf("checking channel index: %w", err)
+	}
+	if built {
+		return ci.buildFieldIndex()
+	}
+
+	channels, err := list()
+	if err != nil {
+		return xerrors.Errorf("listing channels to index: %w", err)
+	}
+	// the time the current status of existing channels was reached is
+	// unknown, so count the age of the status from when the index was built
+	now := time.Now()
+	for _, ch := range channels {
+		entry := newIndexEntry(ch)
+		entry.StatusUpdatedAt = now.UnixNano()
+		if err := ci.put(&entry, nil); err != nil {
+			return err
+		}
+	}
+	if err := ci.ds.Put(fieldIndexBuiltKey, []byte{1}); err != nil {
+		return err
+	}
+	return ci.ds.Put(indexBuiltKey, []byte{1})
+}
+
+// buildFieldIndex indexes the existing entries by status and by peer, if
+// the index was built before channels were indexed by those fields
+func (ci *channelIndex) buildFieldIndex() error {
+	built, err := ci.ds.Has(fieldIndexBuiltKey)
+	if err != nil {
+		return xerrors.Errorf("checking channel index: %w", err)
+	}
+	if built {
+		return nil
+	}
+
+	batch, err := ci.ds.Batch()
+	if err != nil {
+		return xerrors.Errorf("indexing channels: %w", err)
+	}
+	var putErr error
+	err = ci.forEach(context.TODO(), func(entry *internal.ChannelIndexEntry) {
+		for _, key := range fieldKeys(entry) {
+			if err := batch.Put(key, []byte{}); err != nil && putErr == nil {
+				putErr = xerrors.Errorf("indexing channel %s: %w", entryChannelID(entry), err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if putErr != nil {
+		return putErr
+	}
+	if err := batch.Commit(); err != nil {
+		return xerrors.Errorf("indexing channels: %w", err)
+	}
+	return ci.ds.Put(fieldIndexBuiltKey, []byte{1})
+}
+
+func newIndexEntry(ch internal.ChannelState) internal.ChannelIndexEntry {
+	entry := internal.ChannelIndexEntry{
+		SelfPeer:   ch.SelfPeer,
+		TransferID: ch.TransferID,
+		Initiator:  ch.Initiator,
+		Responder:  ch.Responder,
+		Sender:     ch.Sender,
+		BaseCid:    ch.BaseCid,
+		Status:     ch.Status,
+		CreatedAt:  ch.CreatedAt,
+	}
+	if len(ch.Vouchers) > 0 {
+		entry.VoucherType = ch.Vouchers[0].Type
+	}
+	return entry
+}
+
+func entryChannelID(entry *internal.ChannelIndexEntry) datatransfer.ChannelID {
+	return datatransfer.ChannelID{Initiator: entry.Initiator, Responder: entry.Responder, ID: entry.TransferID}
+}
+
+// put writes the entry and the keys that index it, replacing the keys of the
+// previous entry for the channel, if there is one
+func (ci *channelIndex) put(entry *internal.ChannelIndexEntry, previous *internal.ChannelIndexEntry) error {
+	chid := entryChannelID(entry)
+	buf := new(bytes.Buffer)
+	if err := entry.MarshalCBOR(buf); err != nil {
+		return xerrors.Errorf("encoding index entry for channel %s: %w", chid, err)
+	}
+	batch, err := ci.ds.Batch()
+	if err != nil {
+		return xerrors.Errorf("writing index entry for channel %s: %w", chid, err)
+	}
+	if previous != nil && previous.Status != entry.Status {
+		if err := batch.Delete(statusKey(previous.Status).Child(indexKey(chid))); err != nil {
+			return xerrors.Errorf("writing index entry for channel %s: %w", chid, err)
+		}
+	}
+	if err := batch.Put(entriesKey.Child(indexKey(chid)), buf.Bytes()); err != nil {
+		return xerrors.Errorf("writing index entry for channel %s: %w", chid, err)
+	}
+	for _, key := range fieldKeys(entry) {
+		if err := batch.Put(key, []byte{}); err != nil {
+			return xerrors.Errorf("writing index entry for channel %s: %w", chid, err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return xerrors.Errorf("writing index entry for channel %s: %w", chid, err)
+	}
+
+	ci.lk.Lock()
+	ci.statuses[chid] = entry.Status
+	ci.lk.Unlock()
+	return nil
+}
+
+func (ci *channelIndex) get(chid datatransfer.ChannelID) (*internal.ChannelIndexEntry, error) {
+	return ci.getByKey(indexKey(chid))
+}
+
+func (ci *channelIndex) getByKey(key datastore.Key) (*internal.ChannelIndexEntry, error) {
+	data, err := ci.entries.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var entry internal.ChannelIndexEntry
+	if err := entry.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return nil, xerrors.Errorf("decoding index entry %s: %w", key, err)
+	}
+	return &entry, nil
+}
+
+// add indexes a newly created channel
+func (ci *channelIndex) add(ch internal.ChannelState) error {
+	entry := newIndexEntry(ch)
+	entry.StatusUpdatedAt = entry.CreatedAt
+	return ci.put(&entry, nil)
+}
+
+// update records the current status of the channel, if it has changed
+func (ci *channelIndex) update(ch internal.ChannelState) error {
+	chid := datatransfer.ChannelID{Initiator: ch.Initiator, Responder: ch.Responder, ID: ch.TransferID}
+	ci.lk.Lock()
+	status, ok := ci.statuses[chid]
+	ci.lk.Unlock()
+	if ok && status == ch.Status {
+		return nil
+	}
+
+	previous, err := ci.get(chid)
+	var entry internal.ChannelIndexEntry
+	if err == datastore.ErrNotFound {
+		entry = newIndexEntry(ch)
+	} else if err != nil {
+		return err
+	} else {
+		entry = *previous
+	}
+	entry.Status = ch.Status
+	entry.StatusUpdatedAt = time.Now().UnixNano()
+	return ci.put(&entry, previous)
+}
+
+// remove deletes the index entry for a channel, and the keys that index it
+func (ci *channelIndex) remove(chid datatransfer.ChannelID) error {
+	ci.lk.Lock()
+	delete(ci.statuses, chid)
+	ci.lk.Unlock()
+
+	entry, err := ci.get(chid)
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	batch, err := ci.ds.Batch()
+	if err != nil {
+		return xerrors.Errorf("removing index entry for channel %s: %w", chid, err)
+	}
+	for _, key := range append(fieldKeys(entry), entriesKey.Child(indexKey(chid))) {
+		if err := batch.Delete(key); err != nil {
+			return xerrors.Errorf("removing index entry for channel %s: %w", chid, err)
+		}
+	}
+	return batch.Commit()
+}
+
+// forEach calls the given function with each entry in the index
+func (ci *channelIndex) forEach(ctx context.Context, cb func(*internal.ChannelIndexEntry)) error {
+	res, err := ci.entries.Query(query.Query{})
+	if err != nil {
+		return xerrors.Errorf("querying channel index: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		r, ok := res.NextSync()
+		if !ok {
+			return nil
+		}
+		if r.Error != nil {
+			return xerrors.Errorf("reading channel index: %w", r.Error)
+		}
+		var entry internal.ChannelIndexEntry
+		if err := entry.UnmarshalCBOR(bytes.NewReader(r.Value)); err != nil {
+			return xerrors.Errorf("decoding channel index entry %s: %w", r.Key, err)
+		}
+		cb(&entry)
+	}
+}
+
+// forEachIndexed calls the given function with each entry indexed under the
+// given field key
+func (ci *channelIndex) forEachIndexed(ctx context.Context, prefix datastore.Key, cb func(*internal.ChannelIndexEntry)) error {
+	res, err := ci.ds.Query(query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return xerrors.Errorf("querying channel index: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		r, ok := res.NextSync()
+		if !ok {
+			return nil
+		}
+		if r.Error != nil {
+			return xerrors.Errorf("reading channel index: %w", r.Error)
+		}
+		entry, err := ci.getByKey(datastore.NewKey(datastore.RawKey(r.Key).BaseNamespace()))
+		if err == datastore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		cb(entry)
+	}
+}
+
+// forEachCandidate calls the given function with each entry that may match
+// the filter. If the filter has statuses or peers, only the entries indexed
+// under those statuses (or else peers) are read, otherwise every entry is.
+func (ci *channelIndex) forEachCandidate(ctx context.Context, filter datatransfer.ChannelFilter, cb func(*internal.ChannelIndexEntry)) error {
+	var prefixes []datastore.Key
+	switch {
+	case len(filter.Statuses) > 0:
+		for _, st := range filter.Statuses {
+			prefixes = append(prefixes, statusKey(st))
+		}
+	case len(filter.Peers) > 0:
+		for _, p := range filter.Peers {
+			prefixes = append(prefixes, peerKey(p))
+		}
+	default:
+		return ci.forEach(ctx, cb)
+	}
+
+	// the same channel can be indexed under more than one of the prefixes
+	seen := make(map[datatransfer.ChannelID]struct{})
+	for _, prefix := range prefixes {
+		err := ci.forEachIndexed(ctx, prefix, func(entry *internal.ChannelIndexEntry) {
+			chid := entryChannelID(entry)
+			if _, ok := seen[chid]; ok {
+				return
+			}
+			seen[chid] = struct{}{}
+			cb(entry)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns the IDs of the channels that match the filter, sorted and
+// paged as specified by the filter
+func (ci *channelIndex) list(ctx context.Context, filter datatransfer.ChannelFilter) ([]datatransfer.ChannelID, error) {
+	var matches []*internal.ChannelIndexEntry
+	err := ci.forEachCandidate(ctx, filter, func(entry *internal.ChannelIndexEntry) {
+		if matchesFilter(entry, filter) {
+			matches = append(matches, entry)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if filter.Descending {
+			a, b = b, a
+		}
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		return entryChannelID(a).String() < entryChannelID(b).String()
+	})
+
+	if filter.Offset > 0 {
+		if filter.Offset >= len(matches) {
+			return nil, nil
+		}
+		matches = matches[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(matches) {
+		matches = matches[:filter.Limit]
+	}
+
+	chids := make([]datatransfer.ChannelID, 0, len(matches))
+	for _, entry := range matches {
+		chids = append(chids, entryChannelID(entry))
+	}
+	return chids, nil
+}
+
+func matchesFilter(entry *internal.ChannelIndexEntry, filter datatransfer.ChannelFilter) bool {
+	if len(filter.Peers) > 0 {
+		otherParty := entryChannelID(entry).OtherParty(entry.SelfPeer)
+		found := false
+		for _, p := range filter.Peers {
+			if p == otherParty {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.Statuses) > 0 {
+		found := false
+		for _, st := range filter.Statuses {
+			if st == entry.Status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch filter.Direction {
+	case datatransfer.PushDirection:
+		if entry.Sender != entry.Initiator {
+			return false
+		}
+	case datatransfer.PullDirection:
+		if entry.Sender == entry.Initiator {
+			return false
+		}
+	}
+
+	switch filter.Role {
+	case datatransfer.InitiatorRole:
+		if entry.Initiator != entry.SelfPeer {
+			return false
+		}
+	case datatransfer.ResponderRole:
+		if entry.Responder != entry.SelfPeer {
+			return false
+		}
+	}
+
+	if len(filter.VoucherTypes) > 0 {
+		found := false
+		for _, vt := range filter.VoucherTypes {
+			if vt == entry.VoucherType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if filter.BaseCid.Defined() && !filter.BaseCid.Equals(entry.BaseCid) {
+		return false
+	}
+
+	// channels created before creation times were recorded have no creation time,
+	// so they never match a time range
+	if !filter.CreatedAfter.IsZero() {
+		if entry.CreatedAt == 0 || entry.CreatedAt < filter.CreatedAfter.UnixNano() {
+			return false
+		}
+	}
+	if !filter.CreatedBefore.IsZero() {
+		if entry.CreatedAt == 0 || entry.CreatedAt >= filter.CreatedBefore.UnixNano() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+//go:generate cbor-gen-for --map-encoding ChannelIndexEntry
+
+// ChannelIndexEntry is a summary of a channel that is stored on disk
+// alongside the channel FSM, so that channels can be searched without
+// decoding every ChannelState
+type ChannelIndexEntry struct {
+	// PeerId of the manager peer
+	SelfPeer peer.ID
+	// an identifier for this channel shared by request and responder
+	TransferID datatransfer.TransferID
+	// Initiator is the person who intiated this datatransfer request
+	Initiator peer.ID
+	// Responder is the person who is responding to this datatransfer request
+	Responder peer.ID
+	// the party that is sending the data (not who initiated the request)
+	Sender peer.ID
+	// base CID for the piece being transferred
+	BaseCid cid.Cid
+	// type of the voucher the channel was opened with
+	VoucherType datatransfer.TypeIdentifier
+	// current status of this deal
+	Status datatransfer.Status
+	// time the channel was created in unix nanoseconds, or zero if unknown
+	CreatedAt int64
+	// time the status of the channel last changed in unix nanoseconds
+	StatusUpdatedAt int64
+}
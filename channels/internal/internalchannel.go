@@ -8,7 +8,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 )
 
-//go:generate cbor-gen-for --map-encoding ChannelState EncodedVoucher EncodedVoucherResult
+//go:generate cbor-gen-for --map-encoding ChannelState EncodedVoucher EncodedVoucherResult ChannelHistory ChannelHistoryEntry MetadataEntry
 
 // EncodedVoucher is how the voucher is stored on disk
 type EncodedVoucher struct {
@@ -55,7 +55,53 @@ type ChannelState struct {
 	// total bytes received by this node (0 if sender)
 	Received uint64
 	// more informative status on a channel
-	Message        string
+	Message string
+	// whether the local peer paused the channel to stay within the bandwidth
+	// limits
+	Throttled      bool
 	Vouchers       []EncodedVoucher
 	VoucherResults []EncodedVoucherResult
+	// time the channel was created in unix nanoseconds, or zero if unknown
+	CreatedAt int64
+	// time data was last queued, sent or received in unix nanoseconds
+	LastDataActivity int64
+	// the transport that moves data on the channel, empty for the default
+	// transport
+	Transport datatransfer.TransportID
+	// the code of the error the other peer rejected or cancelled the channel
+	// with, if any
+	ErrorCode datatransfer.ErrorCode
+	// the priority of the channel, set by the initiator
+	Priority int64
+	// caller-supplied label and metadata, set by the initiator
+	Label    string
+	Metadata []MetadataEntry
+	// time by which the channel must finish in unix nanoseconds, or zero if
+	// the channel has no timeout
+	Deadline int64
+}
+
+// MetadataEntry is a key and value of the metadata of a channel
+type MetadataEntry struct {
+	Key   string
+	Value string
+}
+
+// ChannelHistory is the most recent events on a channel, oldest first. It is
+// stored alongside the channel FSM rather than in the ChannelState, so that
+// each event is recorded once the channel has transitioned.
+type ChannelHistory struct {
+	Entries []ChannelHistoryEntry
+}
+
+// ChannelHistoryEntry records an event in the lifecycle of a channel
+type ChannelHistoryEntry struct {
+	// the datatransfer.EventCode of the event
+	Event uint64
+	// status of the channel after the event
+	Status datatransfer.Status
+	// time of the event in unix nanoseconds
+	Timestamp int64
+	// channel message after the event
+	Message string
 }
@@ -19,7 +19,7 @@ func (t *ChannelState) MarshalCBOR(w io.Writer) error {
 		_, err := w.Write(cbg.CborNull)
 		return err
 	}
-	if _, err := w.Write([]byte{176}); err != nil {
+	if _, err := w.Write([]byte{184, 25}); err != nil {
 		return err
 	}
 
@@ -291,6 +291,22 @@ func (t *ChannelState) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.Throttled (bool) (bool)
+	if len("Throttled") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Throttled\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Throttled"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Throttled")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteBool(w, t.Throttled); err != nil {
+		return err
+	}
+
 	// t.Vouchers ([]internal.EncodedVoucher) (slice)
 	if len("Vouchers") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"Vouchers\" was too long")
@@ -340,6 +356,181 @@ func (t *ChannelState) MarshalCBOR(w io.Writer) error {
 			return err
 		}
 	}
+
+	// t.CreatedAt (int64) (int64)
+	if len("CreatedAt") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"CreatedAt\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("CreatedAt"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("CreatedAt")); err != nil {
+		return err
+	}
+
+	if t.CreatedAt >= 0 {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.CreatedAt)); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajNegativeInt, uint64(-t.CreatedAt-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.LastDataActivity (int64) (int64)
+	if len("LastDataActivity") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"LastDataActivity\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("LastDataActivity"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("LastDataActivity")); err != nil {
+		return err
+	}
+
+	if t.LastDataActivity >= 0 {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.LastDataActivity)); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajNegativeInt, uint64(-t.LastDataActivity-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.Transport (datatransfer.TransportID) (string)
+	if len("Transport") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Transport\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Transport"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Transport")); err != nil {
+		return err
+	}
+
+	if len(t.Transport) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Transport was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Transport))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Transport)); err != nil {
+		return err
+	}
+
+	// t.ErrorCode (datatransfer.ErrorCode) (uint64)
+	if len("ErrorCode") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"ErrorCode\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("ErrorCode"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("ErrorCode")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.ErrorCode)); err != nil {
+		return err
+	}
+
+	// t.Priority (int64) (int64)
+	if len("Priority") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Priority\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Priority"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Priority")); err != nil {
+		return err
+	}
+
+	if t.Priority >= 0 {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Priority)); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajNegativeInt, uint64(-t.Priority-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.Label (string) (string)
+	if len("Label") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Label\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Label"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Label")); err != nil {
+		return err
+	}
+
+	if len(t.Label) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Label was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Label))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Label)); err != nil {
+		return err
+	}
+
+	// t.Metadata ([]internal.MetadataEntry) (slice)
+	if len("Metadata") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Metadata\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Metadata"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Metadata")); err != nil {
+		return err
+	}
+
+	if len(t.Metadata) > cbg.MaxLength {
+		return xerrors.Errorf("Slice value in field t.Metadata was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajArray, uint64(len(t.Metadata))); err != nil {
+		return err
+	}
+	for _, v := range t.Metadata {
+		if err := v.MarshalCBOR(w); err != nil {
+			return err
+		}
+	}
+
+	// t.Deadline (int64) (int64)
+	if len("Deadline") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Deadline\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Deadline"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Deadline")); err != nil {
+		return err
+	}
+
+	if t.Deadline >= 0 {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Deadline)); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajNegativeInt, uint64(-t.Deadline-1)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -556,6 +747,24 @@ func (t *ChannelState) UnmarshalCBOR(r io.Reader) error {
 
 				t.Message = string(sval)
 			}
+			// t.Throttled (bool) (bool)
+		case "Throttled":
+
+			maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+			if maj != cbg.MajOther {
+				return fmt.Errorf("booleans must be major type 7")
+			}
+			switch extra {
+			case 20:
+				t.Throttled = false
+			case 21:
+				t.Throttled = true
+			default:
+				return fmt.Errorf("booleans are either major type 7, value 20 or 21 (got %d)", extra)
+			}
 			// t.Vouchers ([]internal.EncodedVoucher) (slice)
 		case "Vouchers":
 
@@ -616,6 +825,178 @@ func (t *ChannelState) UnmarshalCBOR(r io.Reader) error {
 				t.VoucherResults[i] = v
 			}
 
+			// t.CreatedAt (int64) (int64)
+		case "CreatedAt":
+			{
+				maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative oveflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.CreatedAt = int64(extraI)
+			}
+			// t.LastDataActivity (int64) (int64)
+		case "LastDataActivity":
+			{
+				maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative oveflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.LastDataActivity = int64(extraI)
+			}
+			// t.Transport (datatransfer.TransportID) (string)
+		case "Transport":
+
+			{
+				sval, err := cbg.ReadStringBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+
+				t.Transport = datatransfer.TransportID(sval)
+			}
+			// t.ErrorCode (datatransfer.ErrorCode) (uint64)
+		case "ErrorCode":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.ErrorCode = datatransfer.ErrorCode(extra)
+
+			}
+			// t.Priority (int64) (int64)
+		case "Priority":
+			{
+				maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative oveflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.Priority = int64(extraI)
+			}
+			// t.Label (string) (string)
+		case "Label":
+
+			{
+				sval, err := cbg.ReadStringBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+
+				t.Label = string(sval)
+			}
+			// t.Metadata ([]internal.MetadataEntry) (slice)
+		case "Metadata":
+
+			maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+
+			if extra > cbg.MaxLength {
+				return fmt.Errorf("t.Metadata: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Metadata = make([]MetadataEntry, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+
+				var v MetadataEntry
+				if err := v.UnmarshalCBOR(br); err != nil {
+					return err
+				}
+
+				t.Metadata[i] = v
+			}
+
+			// t.Deadline (int64) (int64)
+		case "Deadline":
+			{
+				maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative oveflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.Deadline = int64(extraI)
+			}
+
 		default:
 			return fmt.Errorf("unknown struct field %d: '%s'", i, name)
 		}
@@ -853,3 +1234,431 @@ func (t *EncodedVoucherResult) UnmarshalCBOR(r io.Reader) error {
 
 	return nil
 }
+func (t *ChannelHistory) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write([]byte{161}); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Entries ([]internal.ChannelHistoryEntry) (slice)
+	if len("Entries") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Entries\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Entries"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Entries")); err != nil {
+		return err
+	}
+
+	if len(t.Entries) > cbg.MaxLength {
+		return xerrors.Errorf("Slice value in field t.Entries was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajArray, uint64(len(t.Entries))); err != nil {
+		return err
+	}
+	for _, v := range t.Entries {
+		if err := v.MarshalCBOR(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *ChannelHistory) UnmarshalCBOR(r io.Reader) error {
+	*t = ChannelHistory{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("ChannelHistory: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadStringBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Entries ([]internal.ChannelHistoryEntry) (slice)
+		case "Entries":
+
+			maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+
+			if extra > cbg.MaxLength {
+				return fmt.Errorf("t.Entries: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Entries = make([]ChannelHistoryEntry, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+
+				var v ChannelHistoryEntry
+				if err := v.UnmarshalCBOR(br); err != nil {
+					return err
+				}
+
+				t.Entries[i] = v
+			}
+
+		default:
+			return fmt.Errorf("unknown struct field %d: '%s'", i, name)
+		}
+	}
+
+	return nil
+}
+func (t *ChannelHistoryEntry) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write([]byte{164}); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Event (uint64) (uint64)
+	if len("Event") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Event\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Event"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Event")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Event)); err != nil {
+		return err
+	}
+
+	// t.Status (datatransfer.Status) (uint64)
+	if len("Status") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Status\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Status"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Status")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Status)); err != nil {
+		return err
+	}
+
+	// t.Timestamp (int64) (int64)
+	if len("Timestamp") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Timestamp\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Timestamp"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Timestamp")); err != nil {
+		return err
+	}
+
+	if t.Timestamp >= 0 {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Timestamp)); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajNegativeInt, uint64(-t.Timestamp-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.Message (string) (string)
+	if len("Message") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Message\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Message"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Message")); err != nil {
+		return err
+	}
+
+	if len(t.Message) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Message was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Message))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Message)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *ChannelHistoryEntry) UnmarshalCBOR(r io.Reader) error {
+	*t = ChannelHistoryEntry{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("ChannelHistoryEntry: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadStringBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Event (uint64) (uint64)
+		case "Event":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Event = uint64(extra)
+
+			}
+			// t.Status (datatransfer.Status) (uint64)
+		case "Status":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Status = datatransfer.Status(extra)
+
+			}
+			// t.Timestamp (int64) (int64)
+		case "Timestamp":
+			{
+				maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative oveflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.Timestamp = int64(extraI)
+			}
+			// t.Message (string) (string)
+		case "Message":
+
+			{
+				sval, err := cbg.ReadStringBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+
+				t.Message = string(sval)
+			}
+
+		default:
+			return fmt.Errorf("unknown struct field %d: '%s'", i, name)
+		}
+	}
+
+	return nil
+}
+func (t *MetadataEntry) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write([]byte{162}); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Key (string) (string)
+	if len("Key") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Key\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Key"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Key")); err != nil {
+		return err
+	}
+
+	if len(t.Key) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Key was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Key))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Key)); err != nil {
+		return err
+	}
+
+	// t.Value (string) (string)
+	if len("Value") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Value\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Value"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Value")); err != nil {
+		return err
+	}
+
+	if len(t.Value) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Value was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Value))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Value)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *MetadataEntry) UnmarshalCBOR(r io.Reader) error {
+	*t = MetadataEntry{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("MetadataEntry: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadStringBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Key (string) (string)
+		case "Key":
+
+			{
+				sval, err := cbg.ReadStringBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+
+				t.Key = string(sval)
+			}
+			// t.Value (string) (string)
+		case "Value":
+
+			{
+				sval, err := cbg.ReadStringBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+
+				t.Value = string(sval)
+			}
+
+		default:
+			return fmt.Errorf("unknown struct field %d: '%s'", i, name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels/internal"
+)
+
+// RetentionPolicy determines how long terminated channels (channels that are
+// Completed, Failed or Cancelled) are kept before they are purged
+type RetentionPolicy struct {
+	// MaxAge is how long a channel is kept after it terminates.
+	// Zero means channels are kept regardless of age.
+	MaxAge time.Duration
+	// MaxCount is the maximum number of terminated channels to keep. When
+	// there are more, the channels that terminated longest ago are purged.
+	// Zero means there is no limit.
+	MaxCount int
+	// StatusMaxAge overrides MaxAge for channels with a particular terminal
+	// status, eg to keep failed channels around for longer than completed
+	// channels
+	StatusMaxAge map[datatransfer.Status]time.Duration
+}
+
+func (p RetentionPolicy) maxAge(status datatransfer.Status) time.Duration {
+	if maxAge, ok := p.StatusMaxAge[status]; ok {
+		return maxAge
+	}
+	return p.MaxAge
+}
+
+// Sweep purges the terminated channels that should no longer be retained
+// according to the policy, and returns the IDs of the purged channels
+func (c *Channels) Sweep(ctx context.Context, policy RetentionPolicy) ([]datatransfer.ChannelID, error) {
+	now := time.Now().UnixNano()
+
+	var expired []datatransfer.ChannelID
+	var retained []*internal.ChannelIndexEntry
+	err := c.index.forEach(ctx, func(entry *internal.ChannelIndexEntry) {
+		if !IsChannelTerminated(entry.Status) {
+			return
+		}
+		maxAge := policy.maxAge(entry.Status)
+		if maxAge > 0 && time.Duration(now-entry.StatusUpdatedAt) >= maxAge {
+			expired = append(expired, entryChannelID(entry))
+			return
+		}
+		retained = append(retained, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.MaxCount > 0 && len(retained) > policy.MaxCount {
+		sort.Slice(retained, func(i, j int) bool {
+			return retained[i].StatusUpdatedAt < retained[j].StatusUpdatedAt
+		})
+		for _, entry := range retained[:len(retained)-policy.MaxCount] {
+			expired = append(expired, entryChannelID(entry))
+		}
+	}
+
+	purged := make([]datatransfer.ChannelID, 0, len(expired))
+	for _, chid := range expired {
+		if err := c.Purge(chid); err != nil {
+			return purged, err
+		}
+		purged = append(purged, chid)
+	}
+	return purged, nil
+}
+
+// Purge deletes all data stored for a terminated channel: the channel state,
+// the list of received CIDs, the history and the caches of seen CIDs.
+// A Purged event is emitted before the channel is deleted.
+func (c *Channels) Purge(chid datatransfer.ChannelID) error {
+	var internalChannel internal.ChannelState
+	err := c.stateMachines.Get(chid).Get(&internalChannel)
+	if err != nil {
+		return NewErrNotFound(chid)
+	}
+	if !IsChannelTerminated(internalChannel.Status) {
+		return xerrors.Errorf("cannot purge channel %s: channel has not terminated", chid)
+	}
+
+	c.notifier(datatransfer.Event{
+		Code:      datatransfer.Purged,
+		Message:   internalChannel.Message,
+		Timestamp: time.Now(),
+	}, fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists, c.doNotSendLists, c.history))
+
+	if err := c.stateMachines.Get(chid).End(); err != nil {
+		return xerrors.Errorf("deleting state for channel %s: %w", chid, err)
+	}
+	if err := c.cidLists.DeleteList(chid); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("deleting received cids for channel %s: %w", chid, err)
+	}
+	if err := c.doNotSendLists.DeleteList(chid); err != nil {
+		return xerrors.Errorf("deleting do not send cids for channel %s: %w", chid, err)
+	}
+	if err := c.removeSeenCIDCaches(chid); err != nil {
+		return xerrors.Errorf("deleting seen cids for channel %s: %w", chid, err)
+	}
+	if err := c.history.remove(chid); err != nil {
+		return xerrors.Errorf("deleting history for channel %s: %w", chid, err)
+	}
+	return c.index.remove(chid)
+}
@@ -1,6 +1,7 @@
 package cidlists
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
@@ -12,11 +13,13 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 )
 
-// CIDLists maintains files that contain a list of CIDs received for different data transfers
+// CIDLists maintains lists of CIDs received for different data transfers
 type CIDLists interface {
 	CreateList(chid datatransfer.ChannelID, initalCids []cid.Cid) error
 	AppendList(chid datatransfer.ChannelID, c cid.Cid) error
 	ReadList(chid datatransfer.ChannelID) ([]cid.Cid, error)
+	IterateList(chid datatransfer.ChannelID, cb func(cid.Cid) error) error
+	ListLen(chid datatransfer.ChannelID) (int, error)
 	DeleteList(chid datatransfer.ChannelID) error
 }
 
@@ -24,7 +27,7 @@ type cidLists struct {
 	baseDir string
 }
 
-// NewCIDLists initializes a new set of cid lists in a given directory
+// NewCIDLists initializes a new set of cid lists in files in a given directory
 func NewCIDLists(baseDir string) (CIDLists, error) {
 	base := filepath.Clean(string(baseDir))
 	info, err := os.Stat(string(base))
@@ -76,30 +79,57 @@ func (cl *cidLists) AppendList(chid datatransfer.ChannelID, c cid.Cid) (err erro
 }
 
 // ReadList reads an on disk list of cids for the given data transfer channel
-func (cl *cidLists) ReadList(chid datatransfer.ChannelID) (cids []cid.Cid, err error) {
-	f, err := os.Open(transferFilename(cl.baseDir, chid))
+func (cl *cidLists) ReadList(chid datatransfer.ChannelID) ([]cid.Cid, error) {
+	var receivedCids []cid.Cid
+	err := cl.IterateList(chid, func(c cid.Cid) error {
+		receivedCids = append(receivedCids, c)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return receivedCids, nil
+}
+
+// IterateList calls the callback with each cid in the on disk list for the
+// given data transfer channel in order, reading them one at a time
+func (cl *cidLists) IterateList(chid datatransfer.ChannelID, cb func(cid.Cid) error) (err error) {
+	f, err := os.Open(transferFilename(cl.baseDir, chid))
+	if err != nil {
+		return err
+	}
 	defer func() {
 		closeErr := f.Close()
 		if err == nil {
 			err = closeErr
 		}
 	}()
-	var receivedCids []cid.Cid
+	r := bufio.NewReader(f)
 	for {
-		c, err := cbg.ReadCid(f)
+		c, err := cbg.ReadCid(r)
 		if err != nil {
 			if err == io.EOF {
-				return receivedCids, nil
+				return nil
 			}
-			return nil, err
+			return err
+		}
+		if err := cb(c); err != nil {
+			return err
 		}
-		receivedCids = append(receivedCids, c)
 	}
 }
 
+// ListLen returns the number of cids in the on disk list for the given data
+// transfer channel, which are counted by reading them
+func (cl *cidLists) ListLen(chid datatransfer.ChannelID) (int, error) {
+	length := 0
+	err := cl.IterateList(chid, func(cid.Cid) error {
+		length++
+		return nil
+	})
+	return length, err
+}
+
 // DeleteList deletes the list for the given data transfer channel
 func (cl *cidLists) DeleteList(chid datatransfer.ChannelID) error {
 	return os.Remove(transferFilename(cl.baseDir, chid))
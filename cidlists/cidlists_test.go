@@ -1,6 +1,7 @@
 package cidlists_test
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -9,6 +10,11 @@ import (
 	"testing"
 
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	badgerds "github.com/ipfs/go-ds-badger"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
 	"github.com/stretchr/testify/require"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
@@ -66,6 +72,10 @@ func TestCIDLists(t *testing.T) {
 		savedCids2, err := cidLists.ReadList(chid2)
 		require.NoError(t, err)
 		require.Equal(t, []cid.Cid{newCid2}, savedCids2)
+
+		length, err := cidLists.ListLen(chid1)
+		require.NoError(t, err)
+		require.Equal(t, len(initialCids1)+1, length)
 	})
 
 	t.Run("deleting lists", func(t *testing.T) {
@@ -82,3 +92,148 @@ func TestCIDLists(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestDatastoreCIDLists(t *testing.T) {
+	dstore := ds_sync.MutexWrap(ds.NewMapDatastore())
+
+	chid1 := datatransfer.ChannelID{ID: datatransfer.TransferID(rand.Uint64()), Initiator: testutil.GeneratePeers(1)[0], Responder: testutil.GeneratePeers(1)[0]}
+	chid2 := datatransfer.ChannelID{ID: datatransfer.TransferID(rand.Uint64()), Initiator: testutil.GeneratePeers(1)[0], Responder: testutil.GeneratePeers(1)[0]}
+	initialCids1 := testutil.GenerateCids(100)
+
+	cidLists := cidlists.NewDatastoreCIDLists(dstore)
+
+	t.Run("creating and reading lists", func(t *testing.T) {
+		require.NoError(t, cidLists.CreateList(chid1, initialCids1))
+		require.NoError(t, cidLists.CreateList(chid2, nil))
+
+		savedCids1, err := cidLists.ReadList(chid1)
+		require.NoError(t, err)
+		require.Equal(t, initialCids1, savedCids1)
+
+		savedCids2, err := cidLists.ReadList(chid2)
+		require.NoError(t, err)
+		require.Nil(t, savedCids2)
+	})
+
+	t.Run("appending lists", func(t *testing.T) {
+		newCid1 := testutil.GenerateCids(1)[0]
+		require.NoError(t, cidLists.AppendList(chid1, newCid1))
+		initialCids1 = append(initialCids1, newCid1)
+
+		// a new instance reads the lists from the datastore
+		savedCids1, err := cidlists.NewDatastoreCIDLists(dstore).ReadList(chid1)
+		require.NoError(t, err)
+		require.Equal(t, initialCids1, savedCids1)
+		length, err := cidlists.NewDatastoreCIDLists(dstore).ListLen(chid1)
+		require.NoError(t, err)
+		require.Equal(t, len(initialCids1), length)
+	})
+
+	t.Run("iterating lists", func(t *testing.T) {
+		var iterated []cid.Cid
+		stopErr := errors.New("stop")
+		err := cidLists.IterateList(chid1, func(c cid.Cid) error {
+			iterated = append(iterated, c)
+			if len(iterated) == 10 {
+				return stopErr
+			}
+			return nil
+		})
+		require.Equal(t, stopErr, err)
+		require.Equal(t, initialCids1[:10], iterated)
+	})
+
+	t.Run("deleting lists", func(t *testing.T) {
+		require.NoError(t, cidLists.DeleteList(chid1))
+		_, err := cidLists.ReadList(chid1)
+		require.Error(t, err)
+		res, err := dstore.Query(query.Query{KeysOnly: true})
+		require.NoError(t, err)
+		entries, err := res.Rest()
+		require.NoError(t, err)
+		// only the empty list of the second channel is left
+		require.Len(t, entries, 1)
+
+		// deleting a list that does not exist does nothing
+		require.NoError(t, cidLists.DeleteList(chid1))
+	})
+}
+
+func TestMigrateFiles(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "cidlisttest")
+	require.NoError(t, err)
+	defer os.RemoveAll(baseDir)
+
+	files, err := cidlists.NewCIDLists(baseDir)
+	require.NoError(t, err)
+	chids := make([]datatransfer.ChannelID, 3)
+	lists := make([][]cid.Cid, 3)
+	for i := range chids {
+		// file names are parsed back into channel IDs, so the peer IDs must be valid
+		chids[i] = datatransfer.ChannelID{ID: datatransfer.TransferID(rand.Uint64()), Initiator: p2ptest.RandPeerIDFatal(t), Responder: p2ptest.RandPeerIDFatal(t)}
+		lists[i] = testutil.GenerateCids(10*i + 1)
+		require.NoError(t, files.CreateList(chids[i], lists[i]))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(baseDir, "other-file"), nil, 0666))
+
+	cidLists := cidlists.NewDatastoreCIDLists(ds_sync.MutexWrap(ds.NewMapDatastore()))
+	migrated, err := cidlists.MigrateFiles(baseDir, cidLists)
+	require.NoError(t, err)
+	require.Equal(t, 3, migrated)
+	for i, chid := range chids {
+		savedCids, err := cidLists.ReadList(chid)
+		require.NoError(t, err)
+		require.Equal(t, lists[i], savedCids)
+		_, err = files.ReadList(chid)
+		require.True(t, os.IsNotExist(err))
+	}
+	_, err = os.Stat(filepath.Join(baseDir, "other-file"))
+	require.NoError(t, err)
+
+	// there is nothing left to migrate
+	migrated, err = cidlists.MigrateFiles(baseDir, cidLists)
+	require.NoError(t, err)
+	require.Zero(t, migrated)
+}
+
+func BenchmarkCIDLists(b *testing.B) {
+	const listLen = 1000
+	cids := testutil.GenerateCids(listLen)
+
+	run := func(b *testing.B, cidLists cidlists.CIDLists) {
+		chid := datatransfer.ChannelID{ID: datatransfer.TransferID(rand.Uint64()), Initiator: testutil.GeneratePeers(1)[0], Responder: testutil.GeneratePeers(1)[0]}
+		require.NoError(b, cidLists.CreateList(chid, nil))
+		b.Run("append", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, cidLists.AppendList(chid, cids[i%listLen]))
+			}
+		})
+		require.NoError(b, cidLists.CreateList(chid, cids))
+		b.Run("read", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				savedCids, err := cidLists.ReadList(chid)
+				require.NoError(b, err)
+				require.Len(b, savedCids, listLen)
+			}
+		})
+	}
+
+	b.Run("files", func(b *testing.B) {
+		baseDir, err := ioutil.TempDir("", "cidlistbench")
+		require.NoError(b, err)
+		defer os.RemoveAll(baseDir)
+		cidLists, err := cidlists.NewCIDLists(baseDir)
+		require.NoError(b, err)
+		run(b, cidLists)
+	})
+
+	b.Run("datastore", func(b *testing.B) {
+		dir, err := ioutil.TempDir("", "cidlistbench")
+		require.NoError(b, err)
+		defer os.RemoveAll(dir)
+		dstore, err := badgerds.NewDatastore(dir, nil)
+		require.NoError(b, err)
+		defer dstore.Close()
+		run(b, cidlists.NewDatastoreCIDLists(dstore))
+	})
+}
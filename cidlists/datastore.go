@@ -0,0 +1,277 @@
+package cidlists
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// dsCIDLists keeps the list of CIDs received for each data transfer in a
+// datastore. Each CID is stored under its own key, by its index in the list,
+// along with the length of the list, so that appending a CID is a single
+// write and lists can be read one CID at a time.
+type dsCIDLists struct {
+	ds datastore.Batching
+
+	lk   sync.Mutex
+	lens map[datatransfer.ChannelID]uint64
+}
+
+// NewDatastoreCIDLists initializes a new set of cid lists in a datastore
+func NewDatastoreCIDLists(ds datastore.Batching) CIDLists {
+	return &dsCIDLists{
+		ds:   ds,
+		lens: make(map[datatransfer.ChannelID]uint64),
+	}
+}
+
+// CreateList initializes a new CID list with the given initial cids (or can be empty) for a data transfer channel,
+// replacing any existing list for the channel
+func (cl *dsCIDLists) CreateList(chid datatransfer.ChannelID, initialCids []cid.Cid) error {
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+
+	if err := cl.deleteList(chid); err != nil {
+		return err
+	}
+	batch, err := cl.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for i, c := range initialCids {
+		if err := batch.Put(cidKey(chid, uint64(i)), c.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(lenKey(chid), encodeLen(uint64(len(initialCids)))); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	cl.lens[chid] = uint64(len(initialCids))
+	return nil
+}
+
+// AppendList appends a single CID to the list for a given data transfer channel
+func (cl *dsCIDLists) AppendList(chid datatransfer.ChannelID, c cid.Cid) error {
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+
+	length, err := cl.listLen(chid)
+	switch {
+	case xerrors.Is(err, datastore.ErrNotFound):
+		// appending to a list that was not created creates it, as with files
+		length = 0
+	case err != nil:
+		return err
+	}
+	batch, err := cl.ds.Batch()
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(cidKey(chid, length), c.Bytes()); err != nil {
+		return err
+	}
+	if err := batch.Put(lenKey(chid), encodeLen(length+1)); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	cl.lens[chid] = length + 1
+	return nil
+}
+
+// ReadList reads the list of cids for the given data transfer channel
+func (cl *dsCIDLists) ReadList(chid datatransfer.ChannelID) ([]cid.Cid, error) {
+	var receivedCids []cid.Cid
+	err := cl.IterateList(chid, func(c cid.Cid) error {
+		receivedCids = append(receivedCids, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receivedCids, nil
+}
+
+// IterateList calls the callback with each cid in the list for the given data
+// transfer channel in order, reading them one at a time
+func (cl *dsCIDLists) IterateList(chid datatransfer.ChannelID, cb func(cid.Cid) error) error {
+	cl.lk.Lock()
+	length, err := cl.listLen(chid)
+	cl.lk.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < length; i++ {
+		data, err := cl.ds.Get(cidKey(chid, i))
+		if err != nil {
+			return xerrors.Errorf("reading cid %d of list for channel %s: %w", i, chid, err)
+		}
+		_, c, err := cid.CidFromBytes(data)
+		if err != nil {
+			return xerrors.Errorf("decoding cid %d of list for channel %s: %w", i, chid, err)
+		}
+		if err := cb(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListLen returns the number of cids in the list for the given data transfer
+// channel
+func (cl *dsCIDLists) ListLen(chid datatransfer.ChannelID) (int, error) {
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+
+	length, err := cl.listLen(chid)
+	return int(length), err
+}
+
+// DeleteList deletes the list for the given data transfer channel
+func (cl *dsCIDLists) DeleteList(chid datatransfer.ChannelID) error {
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+
+	return cl.deleteList(chid)
+}
+
+func (cl *dsCIDLists) deleteList(chid datatransfer.ChannelID) error {
+	length, err := cl.listLen(chid)
+	if xerrors.Is(err, datastore.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	batch, err := cl.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < length; i++ {
+		if err := batch.Delete(cidKey(chid, i)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Delete(lenKey(chid)); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	delete(cl.lens, chid)
+	return nil
+}
+
+// listLen returns the length of the list for a channel, reading it from the
+// datastore the first time. The lock must be held.
+func (cl *dsCIDLists) listLen(chid datatransfer.ChannelID) (uint64, error) {
+	if length, ok := cl.lens[chid]; ok {
+		return length, nil
+	}
+	data, err := cl.ds.Get(lenKey(chid))
+	if err != nil {
+		return 0, xerrors.Errorf("reading length of cid list for channel %s: %w", chid, err)
+	}
+	if len(data) != 8 {
+		return 0, xerrors.Errorf("invalid length of cid list for channel %s", chid)
+	}
+	length := binary.BigEndian.Uint64(data)
+	cl.lens[chid] = length
+	return length, nil
+}
+
+func listKey(chid datatransfer.ChannelID) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%d-%s-%s", chid.ID, chid.Initiator, chid.Responder))
+}
+
+func lenKey(chid datatransfer.ChannelID) datastore.Key {
+	return listKey(chid).ChildString("len")
+}
+
+func cidKey(chid datatransfer.ChannelID, index uint64) datastore.Key {
+	return listKey(chid).ChildString("cids").ChildString(strconv.FormatUint(index, 36))
+}
+
+func encodeLen(length uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, length)
+	return data
+}
+
+// MigrateFiles moves the cid lists kept in files in the given directory to
+// the given cid lists, deleting each file once its list is moved. It returns
+// the number of lists that were migrated. Files that are not cid lists are
+// left alone.
+func MigrateFiles(baseDir string, to CIDLists) (int, error) {
+	base := filepath.Clean(baseDir)
+	infos, err := ioutil.ReadDir(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, xerrors.Errorf("reading cid lists directory %s: %w", base, err)
+	}
+
+	files := &cidLists{baseDir: base}
+	migrated := 0
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		chid, ok := parseTransferFilename(info.Name())
+		if !ok {
+			continue
+		}
+		cids, err := files.ReadList(chid)
+		if err != nil {
+			return migrated, xerrors.Errorf("reading cid list file for channel %s: %w", chid, err)
+		}
+		if err := to.CreateList(chid, cids); err != nil {
+			return migrated, xerrors.Errorf("migrating cid list for channel %s: %w", chid, err)
+		}
+		if err := files.DeleteList(chid); err != nil {
+			return migrated, xerrors.Errorf("deleting cid list file for channel %s: %w", chid, err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// parseTransferFilename parses the channel ID from the name of a cid list
+// file, as written by transferFilename
+func parseTransferFilename(filename string) (datatransfer.ChannelID, bool) {
+	parts := strings.Split(filename, "-")
+	if len(parts) != 3 {
+		return datatransfer.ChannelID{}, false
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return datatransfer.ChannelID{}, false
+	}
+	initiator, err := peer.Decode(parts[1])
+	if err != nil {
+		return datatransfer.ChannelID{}, false
+	}
+	responder, err := peer.Decode(parts[2])
+	if err != nil {
+		return datatransfer.ChannelID{}, false
+	}
+	return datatransfer.ChannelID{ID: datatransfer.TransferID(id), Initiator: initiator, Responder: responder}, true
+}
@@ -31,7 +31,15 @@ func (mgr *CIDSetManager) InsertSetCID(sid SetID, c cid.Cid) (exists bool, err e
 
 // DeleteSet deletes a CID set
 func (mgr *CIDSetManager) DeleteSet(sid SetID) error {
-	return mgr.getSet(sid).Truncate()
+	err := mgr.getSet(sid).Truncate()
+	if err != nil {
+		return err
+	}
+
+	mgr.lk.Lock()
+	delete(mgr.sets, sid)
+	mgr.lk.Unlock()
+	return nil
 }
 
 // getSet gets the cidSet for the given SetID
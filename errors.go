@@ -1,5 +1,7 @@
 package datatransfer
 
+import "fmt"
+
 type errorType string
 
 func (e errorType) Error() string {
@@ -36,3 +38,137 @@ const ErrDisconnected = errorType("other peer appears to have hung up. restart C
 
 // ErrRemoved indicates the channel was inactive long enough that it was put in a permaneant error state
 const ErrRemoved = errorType("channel removed due to inactivity")
+
+// ErrThrottled indicates the channel is paused until the transfer rate falls back within the bandwidth limits
+const ErrThrottled = errorType("channel throttled by bandwidth limit")
+
+// ErrTimedOut indicates the channel did not finish within the timeout it was opened with
+const ErrTimedOut = errorType("channel timed out")
+
+// ErrSizeExceeded indicates the channel received more data than its total size allows
+const ErrSizeExceeded = errorType("received more data than the total size of the channel")
+
+// ErrIntegrity indicates the data of the channel does not match the receipt the other peer computed for it
+const ErrIntegrity = errorType("data does not match the receipt for the channel")
+
+// ErrInvalidSignature indicates a message was not signed by its sender for the channel it was sent on
+const ErrInvalidSignature = errorType("message signature is missing or invalid")
+
+// ErrQueued indicates the responder queued the request until it has capacity to serve the channel
+const ErrQueued = errorType("request queued for admission")
+
+// ErrorCode says why a peer rejected, cancelled or queued a channel. Error codes are
+// only sent to peers that support the 1.2 protocol.
+type ErrorCode uint64
+
+const (
+	// NoError means the peer did not say why it rejected or cancelled the
+	// channel
+	NoError ErrorCode = iota
+
+	// ErrorUnknownVoucherType means the peer has no validator for the voucher
+	// type of the request
+	ErrorUnknownVoucherType
+
+	// ErrorValidationFailed means the peer's validator rejected the voucher
+	ErrorValidationFailed
+
+	// ErrorResourceExhausted means the peer is out of capacity to serve the
+	// channel, and the request may succeed later
+	ErrorResourceExhausted
+
+	// ErrorUnknownChannel means the peer has no record of the channel
+	ErrorUnknownChannel
+
+	// ErrorInternal means the peer failed to process the request
+	ErrorInternal
+
+	// ErrorQueued means the peer accepted the request but queued it until it
+	// has capacity to serve the channel. It is sent with a paused response
+	// rather than a rejection.
+	ErrorQueued
+
+	// ErrorTimedOut means the peer cancelled the channel because it did not
+	// finish within the time the peer allowed for it
+	ErrorTimedOut
+
+	// ErrorSizeExceeded means the peer cancelled the channel because it
+	// received more data than the total size of the channel allows
+	ErrorSizeExceeded
+
+	// ErrorIntegrity means the peer cancelled the channel because its data
+	// does not match the receipt computed for the channel
+	ErrorIntegrity
+
+	// ErrorInvalidSignature means the peer rejected the request because it
+	// was not signed, or its signature was not valid for the channel
+	ErrorInvalidSignature
+)
+
+// ErrorCodes are human readable names for error codes
+var ErrorCodes = map[ErrorCode]string{
+	NoError:                 "NoError",
+	ErrorUnknownVoucherType: "UnknownVoucherType",
+	ErrorValidationFailed:   "ValidationFailed",
+	ErrorResourceExhausted:  "ResourceExhausted",
+	ErrorUnknownChannel:     "UnknownChannel",
+	ErrorInternal:           "Internal",
+	ErrorQueued:             "Queued",
+	ErrorTimedOut:           "TimedOut",
+	ErrorSizeExceeded:       "SizeExceeded",
+	ErrorIntegrity:          "Integrity",
+	ErrorInvalidSignature:   "InvalidSignature",
+}
+
+func (c ErrorCode) String() string {
+	if name, ok := ErrorCodes[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorCode(%d)", uint64(c))
+}
+
+// CodedError is an error with a code that tells the other peer why this node
+// rejected or cancelled a channel. Validators can return a CodedError to pick
+// the code sent to the initiator, eg ErrorResourceExhausted when the node is
+// too busy to serve the request. Other validation errors are sent as
+// ErrorValidationFailed.
+type CodedError struct {
+	Code ErrorCode
+	Err  error
+}
+
+// NewCodedError returns an error with the given code
+func NewCodedError(code ErrorCode, err error) *CodedError {
+	return &CodedError{Code: code, Err: err}
+}
+
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+// RemoteError is an error the other peer sent when it rejected or cancelled a
+// channel. A channel that was rejected with an error code fails with a
+// RemoteError, which matches ErrRejected with errors.Is.
+type RemoteError struct {
+	Code    ErrorCode
+	Message string
+	// Rejected is true if the peer rejected the request to open or restart
+	// the channel, and false if it cancelled the channel
+	Rejected bool
+}
+
+func (e *RemoteError) Error() string {
+	if e.Rejected {
+		return fmt.Sprintf("%s (%s): %s", ErrRejected, e.Code, e.Message)
+	}
+	return fmt.Sprintf("channel cancelled by peer (%s): %s", e.Code, e.Message)
+}
+
+// Is returns true for ErrRejected if the peer rejected the channel
+func (e *RemoteError) Is(target error) bool {
+	return e.Rejected && target == ErrRejected
+}
@@ -90,6 +90,51 @@ const (
 	// the remote peer. It is used to measure progress of how much of the total
 	// data has been received.
 	DataReceivedProgress
+
+	// Throttled is emitted when the transfer is paused locally because it
+	// exceeded a bandwidth limit
+	Throttled
+
+	// Unthrottled is emitted when a transfer that was paused because of a
+	// bandwidth limit resumes
+	Unthrottled
+
+	// Purged is emitted when a terminated channel is deleted according to the
+	// channel retention policy
+	Purged
+
+	// Resumed is emitted when a channel that was in progress when the manager
+	// started is restarted automatically
+	Resumed
+
+	// ResumeFailed is emitted when all attempts to automatically restart a
+	// channel that was in progress when the manager started have failed
+	ResumeFailed
+
+	// Enqueued is emitted when the responder queues a request because it is
+	// at its limit of channels in progress
+	Enqueued
+
+	// Admitted is emitted when the responder admits a queued request, and
+	// the channel starts transferring data
+	Admitted
+
+	// TotalSizeSet is emitted when the total size of the data is set after
+	// the channel was opened, eg when the sender confirms it
+	TotalSizeSet
+
+	// SizeExceeded is emitted when a channel has received more data than its
+	// total size allows
+	SizeExceeded
+
+	// SlowSubscriber is emitted when events are dispatched asynchronously and
+	// a subscriber's queue of events is full. It is sent to the other
+	// subscribers only, and is not recorded in the channel history.
+	SlowSubscriber
+
+	// Verified is emitted when the data of a channel initiated by this node
+	// matches the responder's receipt for it
+	Verified
 )
 
 // Events are human readable names for data transfer events
@@ -119,6 +164,17 @@ var Events = map[EventCode]string{
 	DataQueuedProgress:          "DataQueuedProgress",
 	DataSentProgress:            "DataSentProgress",
 	DataReceivedProgress:        "DataReceivedProgress",
+	Throttled:                   "Throttled",
+	Unthrottled:                 "Unthrottled",
+	Purged:                      "Purged",
+	Resumed:                     "Resumed",
+	ResumeFailed:                "ResumeFailed",
+	Enqueued:                    "Enqueued",
+	Admitted:                    "Admitted",
+	TotalSizeSet:                "TotalSizeSet",
+	SizeExceeded:                "SizeExceeded",
+	SlowSubscriber:              "SlowSubscriber",
+	Verified:                    "Verified",
 }
 
 // Event is a struct containing information about a data transfer event
@@ -126,6 +182,7 @@ type Event struct {
 	Code      EventCode // What type of event it is
 	Message   string    // Any clarifying information about the event
 	Timestamp time.Time // when the event happened
+	Seq       uint64    // sequence number in the event journal, or zero if the event is not in it
 }
 
 // Subscriber is a callback that is called when events are emitted
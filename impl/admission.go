@@ -0,0 +1,394 @@
+package impl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+)
+
+// AdmissionConfig limits the number of channels opened by other peers that
+// the manager serves at once. Requests over the limits are accepted but
+// queued, and admitted as channels in progress finish.
+type AdmissionConfig struct {
+	// MaxInProgress is the maximum number of channels in progress across all
+	// peers (zero means no limit)
+	MaxInProgress int
+	// MaxInProgressPerPeer is the maximum number of channels in progress with
+	// any one peer (zero means no limit)
+	MaxInProgressPerPeer int
+	// MaxQueued is the maximum number of queued requests. Requests beyond it
+	// are rejected with datatransfer.ErrorResourceExhausted (zero means no
+	// limit).
+	MaxQueued int
+	// Priority orders the queued requests, given the initiator and the
+	// voucher of the request. Requests with a higher priority are admitted
+	// first, and requests with the same priority in the order they arrived.
+	// If Priority is nil, requests are ordered by the priority the initiator
+	// set for the channel.
+	Priority func(initiator peer.ID, voucher datatransfer.Voucher) int
+}
+
+// AdmissionLimits limits the number of channels opened by other peers that
+// the manager serves at once. Requests over the limits are queued: the
+// channel moves to the Queued status, and the initiator is sent an accepted
+// but paused response with the datatransfer.ErrorQueued code. Requests are
+// only queued on transports that can pause; otherwise they are rejected with
+// datatransfer.ErrorResourceExhausted.
+func AdmissionLimits(cfg AdmissionConfig) DataTransferOption {
+	return func(m *manager) {
+		m.admission = newAdmission(cfg)
+	}
+}
+
+// readyAdmissionDelay is how long to wait before admitting a request that
+// there was capacity for by the time it was queued
+const readyAdmissionDelay = time.Second
+
+// queuedRequest is a request waiting for admission
+type queuedRequest struct {
+	chid     datatransfer.ChannelID
+	priority int
+	seq      uint64
+	// paused is true if the validator paused the channel when it accepted
+	// the request
+	paused bool
+	// ready is true once the channel has been recorded as queued, and can be
+	// admitted
+	ready bool
+}
+
+// admission tracks the channels opened by other peers that are in progress,
+// and the requests that are queued until there is capacity to serve them
+type admission struct {
+	cfg AdmissionConfig
+
+	lk         sync.Mutex
+	inProgress map[datatransfer.ChannelID]struct{}
+	perPeer    map[peer.ID]int
+	queue      []*queuedRequest
+	seq        uint64
+}
+
+func newAdmission(cfg AdmissionConfig) *admission {
+	return &admission{
+		cfg:        cfg,
+		inProgress: make(map[datatransfer.ChannelID]struct{}),
+		perPeer:    make(map[peer.ID]int),
+	}
+}
+
+// hasCapacity returns true if a channel with the given initiator is within
+// the limits
+func (a *admission) hasCapacity(initiator peer.ID) bool {
+	if a.cfg.MaxInProgress > 0 && len(a.inProgress) >= a.cfg.MaxInProgress {
+		return false
+	}
+	if a.cfg.MaxInProgressPerPeer > 0 && a.perPeer[initiator] >= a.cfg.MaxInProgressPerPeer {
+		return false
+	}
+	return true
+}
+
+func (a *admission) markInProgress(chid datatransfer.ChannelID) {
+	if _, ok := a.inProgress[chid]; ok {
+		return
+	}
+	a.inProgress[chid] = struct{}{}
+	a.perPeer[chid.Initiator]++
+}
+
+// indexOf returns the index of the channel in the queue, or -1 if it is not
+// queued
+func (a *admission) indexOf(chid datatransfer.ChannelID) int {
+	for i, req := range a.queue {
+		if req.chid == chid {
+			return i
+		}
+	}
+	return -1
+}
+
+// admitOrQueue admits the channel if it is within the limits, and otherwise
+// adds it to the queue if it can be queued. It returns the number of
+// requests ahead of the channel in the queue, and false if the channel was
+// admitted.
+func (a *admission) admitOrQueue(chid datatransfer.ChannelID, voucher datatransfer.Voucher, priority int, paused bool, canQueue bool) (int, bool, error) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	if i := a.indexOf(chid); i >= 0 {
+		return a.ahead(a.queue[i]), true, nil
+	}
+	if a.hasCapacity(chid.Initiator) {
+		a.markInProgress(chid)
+		return 0, false, nil
+	}
+	if !canQueue {
+		return 0, false, datatransfer.NewCodedError(datatransfer.ErrorResourceExhausted,
+			xerrors.New("too many channels in progress"))
+	}
+	if a.cfg.MaxQueued > 0 && len(a.queue) >= a.cfg.MaxQueued {
+		return 0, false, datatransfer.NewCodedError(datatransfer.ErrorResourceExhausted,
+			xerrors.Errorf("too many requests queued (%d)", len(a.queue)))
+	}
+
+	req := &queuedRequest{chid: chid, priority: priority, seq: a.seq, paused: paused}
+	a.seq++
+	if a.cfg.Priority != nil && voucher != nil {
+		req.priority = a.cfg.Priority(chid.Initiator, voucher)
+	}
+	a.queue = append(a.queue, req)
+	return a.ahead(req), true, nil
+}
+
+// ahead returns the number of queued requests that will be admitted before
+// the given one if capacity allows
+func (a *admission) ahead(req *queuedRequest) int {
+	n := 0
+	for _, other := range a.queue {
+		if other != req && before(other, req) {
+			n++
+		}
+	}
+	return n
+}
+
+// before returns true if a queued request is admitted before another
+func before(a, b *queuedRequest) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	return a.seq < b.seq
+}
+
+// next removes and returns the first queued request that is within the
+// limits, or nil if there is none
+func (a *admission) next() *queuedRequest {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	best := -1
+	for i, req := range a.queue {
+		if !req.ready || !a.hasCapacity(req.chid.Initiator) {
+			continue
+		}
+		if best < 0 || before(req, a.queue[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	req := a.queue[best]
+	a.queue = append(a.queue[:best], a.queue[best+1:]...)
+	a.markInProgress(req.chid)
+	return req
+}
+
+// setReady records that a queued channel can be admitted. It returns true if
+// there is capacity to admit it.
+func (a *admission) setReady(chid datatransfer.ChannelID) bool {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	i := a.indexOf(chid)
+	if i < 0 {
+		return false
+	}
+	a.queue[i].ready = true
+	return a.hasCapacity(chid.Initiator)
+}
+
+// release removes a channel that has finished from the channels in progress,
+// or from the queue. It returns true if there may now be capacity to admit a
+// queued request.
+func (a *admission) release(chid datatransfer.ChannelID) bool {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	if i := a.indexOf(chid); i >= 0 {
+		a.queue = append(a.queue[:i], a.queue[i+1:]...)
+		return false
+	}
+	if _, ok := a.inProgress[chid]; !ok {
+		return false
+	}
+	delete(a.inProgress, chid)
+	a.perPeer[chid.Initiator]--
+	if a.perPeer[chid.Initiator] == 0 {
+		delete(a.perPeer, chid.Initiator)
+	}
+	return len(a.queue) > 0
+}
+
+// queuedError is returned when a request is queued for admission
+type queuedError struct {
+	ahead int
+}
+
+func (e *queuedError) Error() string {
+	return fmt.Sprintf("%s behind %d other requests", datatransfer.ErrQueued, e.ahead)
+}
+
+// admit admits a new or restarted channel opened by another peer with the
+// given priority if it is within the admission limits, and otherwise queues
+// it and returns a queuedError
+func (m *manager) admit(chid datatransfer.ChannelID, transport datatransfer.TransportID, voucher datatransfer.Voucher, priority int, paused bool) error {
+	if m.admission == nil {
+		return nil
+	}
+	_, canQueue := m.transportByID(transport).(datatransfer.PauseableTransport)
+	ahead, queued, err := m.admission.admitOrQueue(chid, voucher, priority, paused, canQueue)
+	if err != nil || !queued {
+		return err
+	}
+	return &queuedError{ahead: ahead}
+}
+
+// queueReady records that a queued channel can be admitted. If a channel
+// finished while the request was being queued, there may already be capacity
+// to admit it, so the queue is checked again once the transport has had time
+// to pause the channel.
+func (m *manager) queueReady(chid datatransfer.ChannelID) {
+	if m.admission.setReady(chid) {
+		time.AfterFunc(readyAdmissionDelay, m.admitQueued)
+	}
+}
+
+// readmit accounts for a restarted channel opened by another peer. A channel
+// that was queued is queued again, unless there is now capacity to admit it,
+// and any other channel counts as in progress.
+func (m *manager) readmit(chst datatransfer.ChannelState, voucher datatransfer.Voucher, paused bool) error {
+	if m.admission == nil {
+		return nil
+	}
+	chid := chst.ChannelID()
+	if chst.Status() != datatransfer.Queued {
+		m.admission.lk.Lock()
+		m.admission.markInProgress(chid)
+		m.admission.lk.Unlock()
+		return nil
+	}
+
+	err := m.admit(chid, chst.Transport(), voucher, m.priorities.clamp(chst.Priority()), paused)
+	var queued *queuedError
+	if !xerrors.As(err, &queued) {
+		if err != nil {
+			return err
+		}
+		return m.channels.Admitted(chid)
+	}
+	if err := m.channels.Enqueued(chid, chst.Transport(), queued.Error()); err != nil {
+		m.releaseAdmission(chid)
+		return err
+	}
+	m.queueReady(chid)
+	return queued
+}
+
+// releaseAdmission frees the admission slot of a channel that has finished,
+// and admits the next queued requests
+func (m *manager) releaseAdmission(chid datatransfer.ChannelID) {
+	if m.admission == nil || chid.Responder != m.peerID {
+		return
+	}
+	if m.admission.release(chid) {
+		go m.admitQueued()
+	}
+}
+
+// admitQueued admits queued requests while there is capacity to serve them
+func (m *manager) admitQueued() {
+	for {
+		req := m.admission.next()
+		if req == nil {
+			return
+		}
+		if err := m.admitChannel(m.bgCtx, req); err != nil {
+			log.Warnf("channel %s: unable to admit queued request: %s", req.chid, err)
+			// the request was counted as in progress when it left the
+			// queue, so free its slot for the next request
+			m.admission.release(req.chid)
+		}
+	}
+}
+
+// admitChannel starts transferring data on a channel that was queued, and
+// tells the initiator it was admitted
+func (m *manager) admitChannel(ctx context.Context, req *queuedRequest) error {
+	chid := req.chid
+	log.Infof("channel %s: admitting queued request", chid)
+	chst, err := m.channels.GetByID(ctx, chid)
+	if err != nil {
+		return err
+	}
+	// the channel may have been cancelled before it was admitted, in which
+	// case its admission slot is released when it is cleaned up
+	if chst.Status() != datatransfer.Queued {
+		return xerrors.Errorf("channel is %s", datatransfer.Statuses[chst.Status()])
+	}
+	var pausable datatransfer.PauseableTransport
+	if !req.paused {
+		var ok bool
+		pausable, ok = m.transportFor(chid).(datatransfer.PauseableTransport)
+		if !ok {
+			return datatransfer.ErrUnsupported
+		}
+	}
+	if err := m.channels.Admitted(chid); err != nil {
+		return err
+	}
+	m.priorities.add(chid, chst.Priority())
+	if req.paused {
+		// the validator paused the channel, so it stays paused until the
+		// validator resumes it
+		if err := m.channels.PauseResponder(chid); err != nil {
+			return err
+		}
+		return m.sendMessage(ctx, chid, chid.Initiator, m.pauseMessage(chid))
+	}
+	return pausable.ResumeChannel(ctx, m.resumeMessage(chid), chid)
+}
+
+// receiveQueuedResponse records that the responder queued a channel this node
+// opened or restarted
+func (m *manager) receiveQueuedResponse(chid datatransfer.ChannelID, response datatransfer.Response) error {
+	log.Infof("channel %s: responder queued request: %s", chid, response.ErrorMessage())
+	transport, err := m.acceptedTransport(chid, response)
+	if err != nil {
+		return m.channels.Error(chid, err)
+	}
+	if response.IsRestart() {
+		if err := m.channels.Restart(chid); err != nil {
+			return err
+		}
+	}
+	return m.channels.Enqueued(chid, transport, response.ErrorMessage())
+}
+
+// receiveAdmission records that the responder admitted a channel this node
+// opened, if the channel was queued
+func (m *manager) receiveAdmission(chid datatransfer.ChannelID) error {
+	chst, err := m.channels.GetByID(context.TODO(), chid)
+	if err != nil {
+		return err
+	}
+	if chst.Status() != datatransfer.Queued {
+		return nil
+	}
+	log.Infof("channel %s: responder admitted queued request", chid)
+	return m.channels.Admitted(chid)
+}
+
+// queuedResponse marks a response to a queued request as paused because the
+// request was queued, and says how many requests are ahead of it
+func queuedResponse(response datatransfer.Response, err error) datatransfer.Response {
+	return message.WithResponseError(response, datatransfer.ErrorQueued, err.Error())
+}
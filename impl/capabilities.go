@@ -0,0 +1,132 @@
+package impl
+
+import (
+	"bytes"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+)
+
+// MaxMessageSize sets the size in bytes of the largest data transfer message
+// the manager advertises that it accepts. Peers that support capability
+// negotiation refuse to send larger messages.
+func MaxMessageSize(size uint64) DataTransferOption {
+	return func(m *manager) {
+		m.maxMessageSize = size
+	}
+}
+
+// Compression sets the names of the compression schemes the manager
+// advertises that this node can decode, eg because a transport it uses
+// decompresses data. The manager itself does not compress anything.
+func Compression(names ...string) DataTransferOption {
+	return func(m *manager) {
+		m.compression = append([]string(nil), names...)
+	}
+}
+
+// maxPeerCapabilities is the maximum number of peers whose capabilities are
+// remembered
+const maxPeerCapabilities = 4096
+
+// localCapabilities returns the capabilities the manager advertises to
+// other peers
+func (m *manager) localCapabilities() datatransfer.Capabilities {
+	caps := datatransfer.Capabilities{
+		Restart:        true,
+		Transports:     append([]datatransfer.TransportID(nil), m.transportIDs...),
+		Compression:    append([]string(nil), m.compression...),
+		MaxMessageSize: m.maxMessageSize,
+	}
+	for _, transport := range m.transports {
+		if _, ok := transport.(datatransfer.PauseableTransport); ok {
+			caps.Pause = true
+		}
+	}
+	return caps
+}
+
+// PeerCapabilities returns the capabilities the given peer advertised when it
+// last opened, restarted or responded to a channel with this node. It returns
+// false if the peer has not advertised any capabilities since the manager
+// started or since a channel with the peer disconnected, in which case
+// operations are attempted as with a legacy peer.
+func (m *manager) PeerCapabilities(p peer.ID) (datatransfer.Capabilities, bool) {
+	m.peerCapabilitiesLk.RLock()
+	defer m.peerCapabilitiesLk.RUnlock()
+	caps, ok := m.peerCapabilities[p]
+	return caps, ok
+}
+
+// recordPeerCapabilities remembers the capabilities advertised in a message
+// from the given peer. Once the capabilities of maxPeerCapabilities peers are
+// remembered, those of another peer are forgotten to make room.
+func (m *manager) recordPeerCapabilities(p peer.ID, msg datatransfer.Message) {
+	caps := msg.Capabilities()
+	if caps == nil {
+		return
+	}
+	m.peerCapabilitiesLk.Lock()
+	defer m.peerCapabilitiesLk.Unlock()
+	if _, ok := m.peerCapabilities[p]; !ok && len(m.peerCapabilities) >= maxPeerCapabilities {
+		for other := range m.peerCapabilities {
+			delete(m.peerCapabilities, other)
+			break
+		}
+	}
+	m.peerCapabilities[p] = *caps
+}
+
+// forgetPeerCapabilities forgets the capabilities of the given peer, eg
+// because the peer disconnected and may come back running another version
+func (m *manager) forgetPeerCapabilities(p peer.ID) {
+	m.peerCapabilitiesLk.Lock()
+	delete(m.peerCapabilities, p)
+	m.peerCapabilitiesLk.Unlock()
+}
+
+// checkPeerCanPause returns an error if the other peer on the channel
+// advertised that it cannot pause channels
+func (m *manager) checkPeerCanPause(chid datatransfer.ChannelID) error {
+	p := chid.OtherParty(m.peerID)
+	if caps, ok := m.PeerCapabilities(p); ok && !caps.Pause {
+		return xerrors.Errorf("peer %s cannot pause channels: %w", p, datatransfer.ErrUnsupported)
+	}
+	return nil
+}
+
+// checkPeerCanRestart returns an error if the given peer advertised that it
+// cannot restart channels
+func (m *manager) checkPeerCanRestart(p peer.ID) error {
+	if caps, ok := m.PeerCapabilities(p); ok && !caps.Restart {
+		return xerrors.Errorf("peer %s cannot restart channels: %w", p, datatransfer.ErrUnsupported)
+	}
+	return nil
+}
+
+// checkMessageSize returns an error if the given peer advertised that it does
+// not accept messages as large as msg
+func (m *manager) checkMessageSize(p peer.ID, msg datatransfer.Message) error {
+	caps, ok := m.PeerCapabilities(p)
+	if !ok || caps.MaxMessageSize == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := msg.ToNet(&buf); err != nil {
+		return err
+	}
+	if !caps.AllowsMessageSize(uint64(buf.Len())) {
+		return xerrors.Errorf("message of %d bytes exceeds the maximum message size of %d bytes of peer %s: %w",
+			buf.Len(), caps.MaxMessageSize, p, datatransfer.ErrUnsupported)
+	}
+	return nil
+}
+
+// withCapabilities advertises the capabilities of the manager in a request
+// that opens or restarts a channel
+func (m *manager) withCapabilities(req datatransfer.Request) datatransfer.Request {
+	return message.WithRequestCapabilities(req, m.localCapabilities())
+}
@@ -22,9 +22,17 @@ func (ce *channelEnvironment) ID() peer.ID {
 	return ce.m.dataTransferNetwork.ID()
 }
 
-func (ce *channelEnvironment) CleanupChannel(chid datatransfer.ChannelID) {
+func (ce *channelEnvironment) CleanupChannel(chid datatransfer.ChannelID, transport datatransfer.TransportID) {
 	ce.m.reconnectsLk.Lock()
 	delete(ce.m.reconnects, chid)
 	ce.m.reconnectsLk.Unlock()
-	ce.m.transport.CleanupChannel(chid)
+	ce.m.cleanupThrottle(chid)
+	ce.m.transportByID(transport).CleanupChannel(chid)
+	ce.m.forgetChannelTransport(chid)
+	ce.m.releaseAdmission(chid)
+	ce.m.priorities.remove(chid)
+	ce.m.stopChannelTimeout(chid)
+	ce.m.forgetExceededSize(chid)
+	ce.m.forgetVerification(chid)
+	ce.m.progress.remove(chid)
 }
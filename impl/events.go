@@ -9,12 +9,16 @@ import (
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/xerrors"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/channels"
 	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message"
 	"github.com/filecoin-project/go-data-transfer/registry"
+	"github.com/filecoin-project/go-data-transfer/tracing"
 )
 
 func (m *manager) OnChannelOpened(chid datatransfer.ChannelID) error {
@@ -35,6 +39,7 @@ func (m *manager) OnDataReceived(chid datatransfer.ChannelID, link ipld.Link, si
 	if err != nil {
 		return err
 	}
+	m.metricsRecorder.BytesReceived(m.receivingDirection(chid), size)
 
 	m.reconnectsLk.RLock()
 	reconnect, ok := m.reconnects[chid]
@@ -62,22 +67,26 @@ func (m *manager) OnDataReceived(chid datatransfer.ChannelID, link ipld.Link, si
 			return nil
 		})
 		if err != nil || result != nil {
+			// the revalidator decides whether the channel is paused, but the
+			// data still counts towards the bandwidth limits
+			m.reserveBandwidth(chid, size)
 			msg, err := m.processRevalidationResult(chid, result, err)
 			if msg != nil {
-				if err := m.dataTransferNetwork.SendMessage(context.TODO(), chid.Initiator, msg); err != nil {
+				if err := m.sendMessage(context.TODO(), chid, chid.Initiator, msg); err != nil {
 					return err
 				}
 			}
 			return err
 		}
 	}
-	return nil
+	return m.throttle(chid, size)
 }
 
 func (m *manager) OnDataQueued(chid datatransfer.ChannelID, link ipld.Link, size uint64) (datatransfer.Message, error) {
 	if err := m.channels.DataQueued(chid, link.(cidlink.Link).Cid, size); err != nil {
 		return nil, err
 	}
+	m.metricsRecorder.BytesQueued(m.sendingDirection(chid), size)
 	if chid.Initiator != m.peerID {
 		var result datatransfer.VoucherResult
 		var err error
@@ -91,11 +100,13 @@ func (m *manager) OnDataQueued(chid datatransfer.ChannelID, link ipld.Link, size
 			return nil
 		})
 		if err != nil || result != nil {
-			return m.processRevalidationResult(chid, result, err)
+			m.reserveBandwidth(chid, size)
+			msg, err := m.processRevalidationResult(chid, result, err)
+			return m.signMessage(chid, msg), err
 		}
 	}
 
-	return nil, nil
+	return nil, m.throttle(chid, size)
 }
 
 func (m *manager) OnDataSent(chid datatransfer.ChannelID, link ipld.Link, size uint64) error {
@@ -111,21 +122,52 @@ func (m *manager) OnDataSent(chid datatransfer.ChannelID, link ipld.Link, size u
 		close(reconnect)
 	}
 	m.reconnectsLk.RUnlock()
-	return m.channels.DataSent(chid, link.(cidlink.Link).Cid, size)
+	if err := m.channels.DataSent(chid, link.(cidlink.Link).Cid, size); err != nil {
+		return err
+	}
+	m.metricsRecorder.BytesSent(m.sendingDirection(chid), size)
+	return nil
 }
 
 func (m *manager) OnRequestReceived(chid datatransfer.ChannelID, request datatransfer.Request) (datatransfer.Response, error) {
+	response, err := m.onRequestReceived(chid, request, nil)
+	return m.signResponse(chid, response), err
+}
+
+// onRequestReceived processes a request, which was received on the given
+// transport or, if receivedOn is nil, from the data transfer network
+func (m *manager) onRequestReceived(chid datatransfer.ChannelID, request datatransfer.Request, receivedOn *datatransfer.TransportID) (datatransfer.Response, error) {
+	if err := m.verifySignature(chid, chid.Initiator, request); err != nil {
+		log.Warnf("channel %s: rejecting request from %s: %s", chid, chid.Initiator, err)
+		if !request.IsNew() && !request.IsRestart() {
+			return nil, err
+		}
+		err = withErrorCode(datatransfer.ErrorInvalidSignature, err)
+		msg, msgErr := m.response(request.IsRestart(), request.IsNew(), err, request.TransferID(), nil)
+		if msgErr != nil {
+			return nil, msgErr
+		}
+		return msg, err
+	}
+
+	if request.IsNew() || request.IsRestart() {
+		m.recordPeerCapabilities(chid.OtherParty(m.peerID), request)
+	}
+
 	if request.IsRestart() {
 		return m.receiveRestartRequest(chid, request)
 	}
 
 	if request.IsNew() {
-		return m.receiveNewRequest(chid.Initiator, request)
+		return m.receiveNewRequest(chid, request, receivedOn)
 	}
 	if request.IsCancel() {
 		log.Infof("channel %s: received cancel request, cleaning up channel", chid)
 
-		m.transport.CleanupChannel(chid)
+		m.transportFor(chid).CleanupChannel(chid)
+		if err := remoteError(request, false); err != nil {
+			return nil, m.channels.Error(chid, err)
+		}
 		return nil, m.channels.Cancel(chid)
 	}
 	if request.IsVoucher() {
@@ -150,10 +192,21 @@ func (m *manager) OnRequestReceived(chid datatransfer.ChannelID, request datatra
 }
 
 func (m *manager) OnResponseReceived(chid datatransfer.ChannelID, response datatransfer.Response) error {
+	if err := m.verifySignature(chid, chid.Responder, response); err != nil {
+		log.Warnf("channel %s: ignoring response from %s: %s", chid, chid.Responder, err)
+		return err
+	}
 	if response.IsCancel() {
+		if err := remoteError(response, false); err != nil {
+			log.Infof("channel %s: received cancel response with error, erroring out channel: %s", chid, err)
+			return m.channels.Error(chid, err)
+		}
 		log.Infof("channel %s: received cancel response, cancelling channel", chid)
 		return m.channels.Cancel(chid)
 	}
+	if response.IsNew() || response.IsRestart() {
+		m.recordPeerCapabilities(chid.OtherParty(m.peerID), response)
+	}
 	if response.IsVoucherResult() {
 		if !response.EmptyVoucherResult() {
 			vresult, err := m.decodeVoucherResult(response)
@@ -167,11 +220,21 @@ func (m *manager) OnResponseReceived(chid datatransfer.ChannelID, response datat
 		}
 		if !response.Accepted() {
 			log.Infof("channel %s: received rejected response, erroring out channel", chid)
+			if err := remoteError(response, true); err != nil {
+				return m.channels.Error(chid, err)
+			}
 			return m.channels.Error(chid, datatransfer.ErrRejected)
 		}
+		if response.ErrorCode() == datatransfer.ErrorQueued {
+			return m.receiveQueuedResponse(chid, response)
+		}
 		if response.IsNew() {
 			log.Infof("channel %s: received new response, accepting channel", chid)
-			err := m.channels.Accept(chid)
+			transport, err := m.acceptedTransport(chid, response)
+			if err != nil {
+				return m.channels.Error(chid, err)
+			}
+			err = m.channels.Accept(chid, transport)
 			if err != nil {
 				return err
 			}
@@ -186,19 +249,39 @@ func (m *manager) OnResponseReceived(chid datatransfer.ChannelID, response datat
 		}
 	}
 	if response.IsComplete() && response.Accepted() {
+		if response.TotalSize() > 0 {
+			if err := m.channels.TotalSizeSet(chid, response.TotalSize()); err != nil {
+				return err
+			}
+		}
 		if !response.IsPaused() {
-			log.Infof("channel %s: received complete response, completing channel", chid)
-			return m.channels.ResponderCompletes(chid)
+			return m.receiveReceipt(chid, response.Receipt(), func() error {
+				log.Infof("channel %s: received complete response, completing channel", chid)
+				return m.channels.ResponderCompletes(chid)
+			})
 		}
-		err := m.channels.ResponderBeginsFinalization(chid)
-		if err != nil {
-			return nil
+		return m.receiveReceipt(chid, response.Receipt(), func() error {
+			if err := m.channels.ResponderBeginsFinalization(chid); err != nil {
+				return nil
+			}
+			return m.pauseOther(chid)
+		})
+	}
+	if response.IsUpdate() {
+		if err := m.receiveAdmission(chid); err != nil {
+			return err
 		}
 	}
 	if response.IsPaused() {
 		return m.pauseOther(chid)
 	}
-	return m.resumeOther(chid)
+	if err := m.resumeOther(chid); err != nil {
+		return err
+	}
+	if response.IsNew() && response.Accepted() {
+		return m.pauseOpenedChannel(chid)
+	}
+	return nil
 }
 
 func (m *manager) OnRequestTimedOut(ctx context.Context, chid datatransfer.ChannelID) error {
@@ -249,6 +332,7 @@ func (m *manager) OnRequestDisconnected(ctx context.Context, chid datatransfer.C
 	if err != nil {
 		return err
 	}
+	m.forgetPeerCapabilities(chid.OtherParty(m.peerID))
 
 	m.reconnectsLk.Lock()
 	reconnect, ok := m.reconnects[chid]
@@ -286,7 +370,16 @@ func (m *manager) OnRequestDisconnected(ctx context.Context, chid datatransfer.C
 	return nil
 }
 
-func (m *manager) OnChannelCompleted(chid datatransfer.ChannelID, completeErr error) error {
+func (m *manager) OnChannelCompleted(chid datatransfer.ChannelID, completeErr error) (err error) {
+	ctx, span := m.startSpan(context.Background(), chid, "channelCompleted")
+	defer func() {
+		if completeErr != nil {
+			endSpan(span, completeErr)
+			return
+		}
+		endSpan(span, err)
+	}()
+
 	if completeErr == nil {
 		// If the channel was initiated by the other peer
 		if chid.Initiator != m.peerID {
@@ -294,26 +387,28 @@ func (m *manager) OnChannelCompleted(chid datatransfer.ChannelID, completeErr er
 			if err != nil {
 				return nil
 			}
-			if msg != nil {
-				// Send the other peer a message that the transfer has completed
-				log.Infof("channel %s: sending completion message to initiator", chid)
-				if err := m.dataTransferNetwork.SendMessage(context.Background(), chid.Initiator, msg); err != nil {
-					log.Warnf("channel %s: failed to send completion message to initiator: %s", chid, err)
-					return m.OnRequestDisconnected(context.TODO(), chid)
-				}
+			size, err := m.confirmTotalSize(chid)
+			if err != nil {
+				log.Warnf("channel %s: unable to confirm total size: %s", chid, err)
 			}
-			if msg.Accepted() {
-				if msg.IsPaused() {
-					return m.channels.BeginFinalizing(chid)
-				}
-				return m.channels.Complete(chid)
+			if msg != nil && size > 0 {
+				msg = message.WithResponseTotalSize(msg, size)
 			}
-			return m.channels.Error(chid, err)
+			if msg != nil && m.integrityLoader != nil {
+				m.sendReceipt(chid, msg)
+				return nil
+			}
+			return m.sendCompleteMessage(ctx, chid, msg)
 		}
 
 		// The channel was initiated by this node, so move to the finished state
 		log.Infof("channel %s: transfer initiated by local node is complete", chid)
-		return m.channels.FinishTransfer(chid)
+		if _, err := m.confirmTotalSize(chid); err != nil {
+			log.Warnf("channel %s: unable to confirm total size: %s", chid, err)
+		}
+		return m.finishVerification(chid, func() error {
+			return m.channels.FinishTransfer(chid)
+		})
 	}
 	chst, err := m.channels.GetByID(context.TODO(), chid)
 	if err != nil {
@@ -328,31 +423,94 @@ func (m *manager) OnChannelCompleted(chid datatransfer.ChannelID, completeErr er
 	return nil
 }
 
+// sendCompleteMessage sends the complete message for a channel initiated by
+// the other peer, and completes the channel
+func (m *manager) sendCompleteMessage(ctx context.Context, chid datatransfer.ChannelID, msg datatransfer.Response) error {
+	if msg != nil {
+		// Send the other peer a message that the transfer has completed
+		log.Infof("channel %s: sending completion message to initiator", chid)
+		if err := m.sendMessage(ctx, chid, chid.Initiator, msg); err != nil {
+			log.Warnf("channel %s: failed to send completion message to initiator: %s", chid, err)
+			return m.OnRequestDisconnected(context.TODO(), chid)
+		}
+	}
+	if msg.Accepted() {
+		if msg.IsPaused() {
+			return m.channels.BeginFinalizing(chid)
+		}
+		return m.channels.Complete(chid)
+	}
+	return m.channels.Error(chid, datatransfer.ErrRejected)
+}
+
 func (m *manager) receiveRestartRequest(chid datatransfer.ChannelID, incoming datatransfer.Request) (datatransfer.Response, error) {
 	log.Infof("channel %s: received restart request", chid)
 
-	result, err := m.restartRequest(chid, incoming)
+	// join the initiator's trace if the channel has no span yet, eg because
+	// this node restarted since the channel was opened
+	ctx := tracing.ExtractTraceContext(context.Background(), incoming.TraceCarrier())
+	ctx, _ = m.spansIndex.SpanByChannelID(ctx, chid)
+
+	result, err := m.restartRequest(ctx, chid, incoming)
+	// a queued request is accepted, but paused until it is admitted
+	queued, isQueued := err.(*queuedError)
+	if isQueued {
+		err = datatransfer.ErrPause
+	}
 	msg, msgErr := m.response(true, false, err, incoming.TransferID(), result)
 	if msgErr != nil {
 		return nil, msgErr
 	}
+	if isQueued {
+		msg = queuedResponse(msg, queued)
+	}
 	return msg, err
 }
 
 func (m *manager) receiveNewRequest(
-	initiator peer.ID,
-	incoming datatransfer.Request) (datatransfer.Response, error) {
-	log.Infof("received new channel request from %s", initiator)
+	chid datatransfer.ChannelID,
+	incoming datatransfer.Request,
+	receivedOn *datatransfer.TransportID) (datatransfer.Response, error) {
+	log.Infof("received new channel request from %s", chid.Initiator)
 
-	result, err := m.acceptRequest(initiator, incoming)
+	ctx := tracing.ExtractTraceContext(context.Background(), incoming.TraceCarrier())
+	ctx, span := m.spansIndex.SpanByChannelID(ctx, chid)
+
+	var result datatransfer.VoucherResult
+	transport, err := m.selectTransport(incoming, receivedOn)
+	if err == nil {
+		result, err = m.acceptRequest(ctx, chid, incoming, transport)
+	}
+	// a queued request is accepted, but paused until it is admitted
+	queued, isQueued := err.(*queuedError)
+	if isQueued {
+		err = datatransfer.ErrPause
+	}
+	if err != nil && err != datatransfer.ErrPause {
+		// if the request was rejected before the channel was created, there
+		// will be no channel events to end the span
+		if _, getErr := m.channels.GetByID(ctx, chid); getErr != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			m.spansIndex.EndChannelSpan(chid)
+		}
+	}
 	msg, msgErr := m.response(false, true, err, incoming.TransferID(), result)
 	if msgErr != nil {
 		return nil, msgErr
 	}
+	if isQueued {
+		msg = queuedResponse(msg, queued)
+	}
+	// the initiator of a push channel learns which of the offered transports
+	// was chosen from the response
+	if !incoming.IsPull() && msg.Accepted() {
+		msg = message.WithTransport(msg, transport)
+	}
 	return msg, err
 }
 
-func (m *manager) restartRequest(chid datatransfer.ChannelID,
+func (m *manager) restartRequest(ctx context.Context, chid datatransfer.ChannelID,
 	incoming datatransfer.Request) (datatransfer.VoucherResult, error) {
 
 	initiator := chid.Initiator
@@ -360,8 +518,9 @@ func (m *manager) restartRequest(chid datatransfer.ChannelID,
 		return nil, xerrors.New("initiator cannot be manager peer for a restart request")
 	}
 
-	if err := m.validateRestartRequest(context.Background(), initiator, chid, incoming); err != nil {
-		return nil, xerrors.Errorf("restart request for channel %s failed validation: %w", chid, err)
+	if err := m.validateRestartRequest(ctx, initiator, chid, incoming); err != nil {
+		return nil, xerrors.Errorf("restart request for channel %s failed validation: %w",
+			chid, withErrorCode(datatransfer.ErrorValidationFailed, err))
 	}
 
 	stor, err := incoming.Selector()
@@ -369,7 +528,7 @@ func (m *manager) restartRequest(chid datatransfer.ChannelID,
 		return nil, err
 	}
 
-	voucher, result, err := m.validateVoucher(initiator, incoming, incoming.IsPull(), incoming.BaseCid(), stor)
+	voucher, result, err := m.validateVoucher(ctx, chid, initiator, incoming, incoming.IsPull(), incoming.BaseCid(), stor)
 	if err != nil && err != datatransfer.ErrPause {
 		return result, xerrors.Errorf("failed to validate voucher: %w", err)
 	}
@@ -384,12 +543,18 @@ func (m *manager) restartRequest(chid datatransfer.ChannelID,
 	if err := m.channels.Restart(chid); err != nil {
 		return result, xerrors.Errorf("failed to restart channel %s: %w", chid, err)
 	}
-	processor, has := m.transportConfigurers.Processor(voucher.Type())
-	if has {
-		transportConfigurer := processor.(datatransfer.TransportConfigurer)
-		transportConfigurer(chid, voucher, m.transport)
-	}
+	transport := m.channelTransport(chid)
+	m.setChannelTransport(chid, transport)
+	m.configureTransport(chid, voucher, transport)
 	m.dataTransferNetwork.Protect(initiator, chid.String())
+	chst, err := m.channels.GetByID(ctx, chid)
+	if err != nil {
+		return result, err
+	}
+	if err := m.readmit(chst, voucher, voucherErr == datatransfer.ErrPause); err != nil {
+		return result, err
+	}
+	m.priorities.add(chid, chst.Priority())
 	if voucherErr == datatransfer.ErrPause {
 		err := m.channels.PauseResponder(chid)
 		if err != nil {
@@ -400,15 +565,18 @@ func (m *manager) restartRequest(chid datatransfer.ChannelID,
 }
 
 func (m *manager) acceptRequest(
-	initiator peer.ID,
-	incoming datatransfer.Request) (datatransfer.VoucherResult, error) {
+	ctx context.Context,
+	chid datatransfer.ChannelID,
+	incoming datatransfer.Request,
+	transport datatransfer.TransportID) (datatransfer.VoucherResult, error) {
+	initiator := chid.Initiator
 
 	stor, err := incoming.Selector()
 	if err != nil {
 		return nil, err
 	}
 
-	voucher, result, err := m.validateVoucher(initiator, incoming, incoming.IsPull(), incoming.BaseCid(), stor)
+	voucher, result, err := m.validateVoucher(ctx, chid, initiator, incoming, incoming.IsPull(), incoming.BaseCid(), stor)
 	if err != nil && err != datatransfer.ErrPause {
 		return result, err
 	}
@@ -423,25 +591,49 @@ func (m *manager) acceptRequest(
 		dataReceiver = m.peerID
 	}
 
-	chid, err := m.channels.CreateNew(m.peerID, incoming.TransferID(), incoming.BaseCid(), stor, voucher, initiator, dataSender, dataReceiver)
+	priority := m.priorities.clamp(incoming.Priority())
+	admitErr := m.admit(chid, transport, voucher, priority, voucherErr == datatransfer.ErrPause)
+	var queued *queuedError
+	if admitErr != nil && !xerrors.As(admitErr, &queued) {
+		return result, admitErr
+	}
+
+	chid, err = m.channels.CreateNew(m.peerID, incoming.TransferID(), incoming.BaseCid(), stor, voucher, initiator, dataSender, dataReceiver, transport,
+		datatransfer.ChannelOptions{Priority: priority, TotalSize: incoming.TotalSize()})
 	if err != nil {
+		m.releaseAdmission(chid)
 		return result, err
 	}
+	m.setChannelTransport(chid, transport)
 	if result != nil {
 		err := m.channels.NewVoucherResult(chid, result)
 		if err != nil {
+			m.releaseAdmission(chid)
 			return result, err
 		}
 	}
-	if err := m.channels.Accept(chid); err != nil {
-		return result, err
+	if queued != nil {
+		err = m.channels.Enqueued(chid, transport, queued.Error())
+	} else {
+		err = m.channels.Accept(chid, transport)
 	}
-	processor, has := m.transportConfigurers.Processor(voucher.Type())
-	if has {
-		transportConfigurer := processor.(datatransfer.TransportConfigurer)
-		transportConfigurer(chid, voucher, m.transport)
+	if err != nil {
+		m.releaseAdmission(chid)
+		return result, err
 	}
+	m.configureTransport(chid, voucher, transport)
 	m.dataTransferNetwork.Protect(initiator, chid.String())
+	if queued != nil {
+		m.queueReady(chid)
+		return result, queued
+	}
+	m.priorities.add(chid, priority)
+	// the initiator opened the channel paused
+	if incoming.IsPaused() {
+		if err := m.channels.PauseInitiator(chid); err != nil {
+			return result, err
+		}
+	}
 	if voucherErr == datatransfer.ErrPause {
 		err := m.channels.PauseResponder(chid)
 		if err != nil {
@@ -457,18 +649,36 @@ func (m *manager) acceptRequest(
 //   * reading voucher fails
 //   * deserialization of selector fails
 //   * validation fails
-func (m *manager) validateVoucher(sender peer.ID,
+func (m *manager) validateVoucher(
+	ctx context.Context,
+	chid datatransfer.ChannelID,
+	sender peer.ID,
 	incoming datatransfer.Request,
 	isPull bool,
 	baseCid cid.Cid,
-	stor ipld.Node) (datatransfer.Voucher, datatransfer.VoucherResult, error) {
+	stor ipld.Node) (_ datatransfer.Voucher, _ datatransfer.VoucherResult, err error) {
+	_, span := m.startSpan(ctx, chid, "validateVoucher",
+		attribute.String("voucherType", string(incoming.VoucherType())),
+		attribute.Bool("isPull", isPull),
+	)
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	vouch, err := m.decodeVoucher(incoming, m.validatedTypes)
 	if err != nil {
-		return nil, nil, err
+		m.metricsRecorder.ValidationRejected(incoming.VoucherType())
+		return nil, nil, withErrorCode(datatransfer.ErrorValidationFailed, err)
 	}
 	var validatorFunc func(peer.ID, datatransfer.Voucher, cid.Cid, ipld.Node) (datatransfer.VoucherResult, error)
 	processor, _ := m.validatedTypes.Processor(vouch.Type())
 	validator := processor.(datatransfer.RequestValidator)
+	if sigValidator, ok := validator.(datatransfer.SignatureValidator); ok && m.signing != nil {
+		if err := sigValidator.ValidateSignature(chid, sender, vouch, m.verifiedSignature(incoming)); err != nil {
+			m.metricsRecorder.ValidationRejected(vouch.Type())
+			return nil, nil, withErrorCode(datatransfer.ErrorInvalidSignature, err)
+		}
+	}
 	if isPull {
 		validatorFunc = validator.ValidatePull
 	} else {
@@ -476,6 +686,10 @@ func (m *manager) validateVoucher(sender peer.ID,
 	}
 
 	result, err := validatorFunc(sender, vouch, baseCid, stor)
+	if err != nil && err != datatransfer.ErrPause {
+		m.metricsRecorder.ValidationRejected(vouch.Type())
+		err = withErrorCode(datatransfer.ErrorValidationFailed, err)
+	}
 	return vouch, result, err
 }
 
@@ -514,6 +728,9 @@ func (m *manager) revalidationResponse(chid datatransfer.ChannelID, result datat
 	if err != nil {
 		return nil, err
 	}
+	if resultErr != nil && resultErr != datatransfer.ErrPause {
+		resultErr = withErrorCode(datatransfer.ErrorValidationFailed, resultErr)
+	}
 	if chst.Status() == datatransfer.Finalizing {
 		return m.completeResponse(resultErr, chid.ID, result)
 	}
@@ -568,6 +785,9 @@ func (m *manager) completeMessage(chid datatransfer.ChannelID) (datatransfer.Res
 			return nil, err
 		}
 	}
+	if resultErr != nil && resultErr != datatransfer.ErrPause {
+		resultErr = withErrorCode(datatransfer.ErrorValidationFailed, resultErr)
+	}
 
 	return m.completeResponse(resultErr, chid.ID, result)
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/hannahhoward/go-pubsub"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
@@ -19,13 +20,19 @@ import (
 	"github.com/filecoin-project/go-storedcounter"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/bandwidth"
+	"github.com/filecoin-project/go-data-transfer/channelmonitor"
 	"github.com/filecoin-project/go-data-transfer/channels"
 	"github.com/filecoin-project/go-data-transfer/cidlists"
 	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/journal"
 	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/metrics"
 	"github.com/filecoin-project/go-data-transfer/network"
+	"github.com/filecoin-project/go-data-transfer/pullchannelmonitor"
 	"github.com/filecoin-project/go-data-transfer/pushchannelmonitor"
 	"github.com/filecoin-project/go-data-transfer/registry"
+	"github.com/filecoin-project/go-data-transfer/tracing"
 )
 
 var log = logging.Logger("dt-impl")
@@ -36,36 +43,56 @@ type manager struct {
 	resultTypes           *registry.Registry
 	revalidators          *registry.Registry
 	transportConfigurers  *registry.Registry
-	pubSub                *pubsub.PubSub
+	subscriptions         *subscriptions
 	readySub              *pubsub.PubSub
 	channels              *channels.Channels
 	peerID                peer.ID
-	transport             datatransfer.Transport
+	transports            map[datatransfer.TransportID]datatransfer.Transport
+	transportIDs          []datatransfer.TransportID
+	voucherTransports     map[datatransfer.TypeIdentifier]datatransfer.TransportID
+	channelTransportsLk   sync.RWMutex
+	channelTransports     map[datatransfer.ChannelID]datatransfer.TransportID
 	storedCounter         *storedcounter.StoredCounter
 	channelRemoveTimeout  time.Duration
 	reconnectsLk          sync.RWMutex
 	reconnects            map[datatransfer.ChannelID]chan struct{}
 	cidLists              cidlists.CIDLists
-	pushChannelMonitor    *pushchannelmonitor.Monitor
-	pushChannelMonitorCfg *pushchannelmonitor.Config
-}
-
-type internalEvent struct {
-	evt   datatransfer.Event
-	state datatransfer.ChannelState
-}
-
-func dispatcher(evt pubsub.Event, subscriberFn pubsub.SubscriberFn) error {
-	ie, ok := evt.(internalEvent)
-	if !ok {
-		return errors.New("wrong type of event")
-	}
-	cb, ok := subscriberFn.(datatransfer.Subscriber)
-	if !ok {
-		return errors.New("wrong type of event")
-	}
-	cb(ie.evt, ie.state)
-	return nil
+	pushChannelMonitor    *channelmonitor.Monitor
+	pushChannelMonitorCfg *channelmonitor.Config
+	pullChannelMonitor    *channelmonitor.Monitor
+	pullChannelMonitorCfg *channelmonitor.Config
+	bandwidthLimiter      *bandwidth.Limiter
+	throttledLk           sync.Mutex
+	throttled             map[datatransfer.ChannelID]*time.Timer
+	priorities            *priorities
+	timeoutsLk            sync.Mutex
+	timeouts              map[datatransfer.ChannelID]*time.Timer
+	retentionPolicy       *channels.RetentionPolicy
+	sweepInterval         time.Duration
+	autoResumeCfg         *AutoResumeConfig
+	bgCtx                 context.Context
+	bgCancel              context.CancelFunc
+	metricsRecorder       metrics.Recorder
+	channelCounter        *metrics.ChannelCounter
+	spansIndex            *tracing.SpansIndex
+	propagateTraceContext bool
+	maxMessageSize        uint64
+	peerCapabilitiesLk    sync.RWMutex
+	peerCapabilities      map[peer.ID]datatransfer.Capabilities
+	compression           []string
+	admission             *admission
+	overSize              OverSizeConfig
+	exceededLk            sync.Mutex
+	exceeded              map[datatransfer.ChannelID]struct{}
+	progress              *progressTracker
+	journal               *journal.Journal
+	journalPolicy         *journal.RetentionPolicy
+	journalExcluded       map[datatransfer.EventCode]struct{}
+	journalTrimInterval   time.Duration
+	integrityLoader       ipld.Loader
+	verificationsLk       sync.Mutex
+	verifications         map[datatransfer.ChannelID]*verification
+	signing               *SigningConfig
 }
 
 func readyDispatcher(evt pubsub.Event, fn pubsub.SubscriberFn) error {
@@ -95,13 +122,73 @@ func ChannelRemoveTimeout(timeout time.Duration) DataTransferOption {
 // restarting push channels
 func PushChannelRestartConfig(cfg pushchannelmonitor.Config) DataTransferOption {
 	return func(m *manager) {
-		m.pushChannelMonitorCfg = &cfg
+		m.pushChannelMonitorCfg = cfg.MonitorConfig()
+	}
+}
+
+// PullChannelRestartConfig sets the configuration options for automatically
+// restarting pull channels
+func PullChannelRestartConfig(cfg pullchannelmonitor.Config) DataTransferOption {
+	return func(m *manager) {
+		m.pullChannelMonitorCfg = cfg.MonitorConfig()
+	}
+}
+
+// BandwidthLimiter sets the limiter used to keep data transfer within
+// global and per-peer bandwidth limits. The limits can be adjusted on the
+// limiter while the manager is running.
+func BandwidthLimiter(limiter *bandwidth.Limiter) DataTransferOption {
+	return func(m *manager) {
+		m.bandwidthLimiter = limiter
+	}
+}
+
+// ChannelRetentionPolicy enables purging of terminated channels according to
+// the given policy. The policy is applied when the manager starts, and then
+// at every sweep interval (or hourly if the interval is zero).
+func ChannelRetentionPolicy(policy channels.RetentionPolicy, sweepInterval time.Duration) DataTransferOption {
+	return func(m *manager) {
+		m.retentionPolicy = &policy
+		if sweepInterval > 0 {
+			m.sweepInterval = sweepInterval
+		}
+	}
+}
+
+// AutoResume enables restarting the channels that were in progress when the
+// manager starts, eg because the process restarted during a transfer
+func AutoResume(cfg AutoResumeConfig) DataTransferOption {
+	return func(m *manager) {
+		m.autoResumeCfg = &cfg
+	}
+}
+
+// MetricsRecorder sets the recorder that data transfer metrics are reported to
+func MetricsRecorder(recorder metrics.Recorder) DataTransferOption {
+	return func(m *manager) {
+		m.metricsRecorder = recorder
+	}
+}
+
+// PropagateTraceContext attaches the trace context of a channel to the requests
+// sent to open and restart the channel, so that the responder's spans join the
+// initiator's trace.
+// Only requests of the 1.2 protocol carry a trace context. Peers that speak
+// the 1.1 protocol (or older) do not get trace propagation: requests sent to
+// them carry no trace context, and their spans start a trace of their own.
+func PropagateTraceContext() DataTransferOption {
+	return func(m *manager) {
+		m.propagateTraceContext = true
 	}
 }
 
 const defaultChannelRemoveTimeout = 1 * time.Hour
 
-// NewDataTransfer initializes a new instance of a data transfer manager
+// NewDataTransfer initializes a new instance of a data transfer manager.
+// The given transport is the default transport, which is used by channels
+// unless the Transport option registers other transports that they select.
+// The CIDs received on channels are kept in the datastore; lists of them that
+// earlier versions kept in files in cidListsDir are moved to the datastore.
 func NewDataTransfer(ds datastore.Batching, cidListsDir string, dataTransferNetwork network.DataTransferNetwork, transport datatransfer.Transport, storedCounter *storedcounter.StoredCounter, options ...DataTransferOption) (datatransfer.Manager, error) {
 	m := &manager{
 		dataTransferNetwork:  dataTransferNetwork,
@@ -109,18 +196,40 @@ func NewDataTransfer(ds datastore.Batching, cidListsDir string, dataTransferNetw
 		resultTypes:          registry.NewRegistry(),
 		revalidators:         registry.NewRegistry(),
 		transportConfigurers: registry.NewRegistry(),
-		pubSub:               pubsub.New(dispatcher),
+		subscriptions:        newSubscriptions(),
 		readySub:             pubsub.New(readyDispatcher),
 		peerID:               dataTransferNetwork.ID(),
-		transport:            transport,
+		transports:           map[datatransfer.TransportID]datatransfer.Transport{datatransfer.DefaultTransport: transport},
+		transportIDs:         []datatransfer.TransportID{datatransfer.DefaultTransport},
+		voucherTransports:    make(map[datatransfer.TypeIdentifier]datatransfer.TransportID),
+		channelTransports:    make(map[datatransfer.ChannelID]datatransfer.TransportID),
 		storedCounter:        storedCounter,
 		channelRemoveTimeout: defaultChannelRemoveTimeout,
 		reconnects:           make(map[datatransfer.ChannelID]chan struct{}),
-	}
-
-	cidLists, err := cidlists.NewCIDLists(cidListsDir)
+		throttled:            make(map[datatransfer.ChannelID]*time.Timer),
+		priorities:           newPriorities(),
+		timeouts:             make(map[datatransfer.ChannelID]*time.Timer),
+		exceeded:             make(map[datatransfer.ChannelID]struct{}),
+		verifications:        make(map[datatransfer.ChannelID]*verification),
+		progress:             newProgressTracker(),
+		sweepInterval:        defaultSweepInterval,
+		journalTrimInterval:  defaultSweepInterval,
+		journalExcluded:      eventCodeSet(DefaultJournalExcludedEvents),
+		metricsRecorder:      metrics.NoopRecorder{},
+		spansIndex:           tracing.NewSpansIndex(),
+		peerCapabilities:     make(map[peer.ID]datatransfer.Capabilities),
+	}
+	m.bgCtx, m.bgCancel = context.WithCancel(context.Background())
+
+	// the lists of received cids used to be kept in files in cidListsDir, so
+	// move any that are left there to the datastore
+	cidLists := cidlists.NewDatastoreCIDLists(namespace.Wrap(ds, datastore.NewKey("cidlists")))
+	migrated, err := cidlists.MigrateFiles(cidListsDir, cidLists)
 	if err != nil {
-		return nil, err
+		return nil, xerrors.Errorf("migrating cid lists to datastore: %w", err)
+	}
+	if migrated > 0 {
+		log.Infof("migrated %d cid lists from %s to datastore", migrated, cidListsDir)
 	}
 	m.cidLists = cidLists
 	channels, err := channels.New(ds, cidLists, m.notifier, m.voucherDecoder, m.resultTypes.Decoder, &channelEnvironment{m}, dataTransferNetwork.ID())
@@ -133,28 +242,49 @@ func NewDataTransfer(ds datastore.Batching, cidListsDir string, dataTransferNetw
 	for _, option := range options {
 		option(m)
 	}
+	if err := m.checkTransports(); err != nil {
+		return nil, err
+	}
+	if m.journalPolicy != nil {
+		m.journal, err = journal.New(namespace.Wrap(ds, datastore.NewKey("event-journal")))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.channelCounter = metrics.NewChannelCounter(m.metricsRecorder)
 
-	// Start push channel monitor after applying config options as the config
-	// options may apply to the monitor
-	m.pushChannelMonitor = pushchannelmonitor.NewMonitor(m, m.pushChannelMonitorCfg)
+	// Start push and pull channel monitors after applying config options as
+	// the config options may apply to the monitors
+	m.pushChannelMonitor = channelmonitor.NewMonitor(m, channelmonitor.Push, m.pushChannelMonitorCfg)
 	m.pushChannelMonitor.Start()
+	m.pullChannelMonitor = channelmonitor.NewMonitor(m, channelmonitor.Pull, m.pullChannelMonitorCfg)
+	m.pullChannelMonitor.Start()
 
 	return m, nil
 }
 
 func (m *manager) voucherDecoder(voucherType datatransfer.TypeIdentifier) (encoding.Decoder, bool) {
 	decoder, has := m.validatedTypes.Decoder(voucherType)
-	if !has {
-		return m.revalidators.Decoder(voucherType)
+	if has {
+		return decoder, true
+	}
+	decoder, has = m.revalidators.Decoder(voucherType)
+	if has {
+		return decoder, true
 	}
-	return decoder, true
+	return m.transportConfigurers.Decoder(voucherType)
 }
 
 func (m *manager) notifier(evt datatransfer.Event, chst datatransfer.ChannelState) {
-	err := m.pubSub.Publish(internalEvent{evt, chst})
-	if err != nil {
-		log.Warnf("err publishing DT event: %s", err.Error())
-	}
+	m.recordEvent(&evt, chst)
+	m.recordEventMetrics(evt, chst)
+	m.traceEvent(evt, chst)
+	m.trackProgress(evt, chst)
+	if evt.Code == datatransfer.DataReceived {
+		m.checkReceivedSize(chst)
+	}
+	m.subscriptions.publish(evt, chst)
 }
 
 // Start initializes data transfer processing
@@ -165,6 +295,18 @@ func (m *manager) Start(ctx context.Context) error {
 		err := m.channels.Start(ctx)
 		if err != nil {
 			log.Errorf("Migrating data transfer state machines: %s", err.Error())
+		} else {
+			m.initChannelMetrics(ctx)
+			m.restoreChannelTimeouts()
+			if m.retentionPolicy != nil {
+				go m.sweepChannels()
+			}
+			if m.autoResumeCfg != nil {
+				go m.resumeChannels()
+			}
+			if m.journal != nil {
+				go m.trimEventJournal()
+			}
 		}
 		err = m.readySub.Publish(err)
 		if err != nil {
@@ -174,7 +316,12 @@ func (m *manager) Start(ctx context.Context) error {
 
 	dtReceiver := &receiver{m}
 	m.dataTransferNetwork.SetDelegate(dtReceiver)
-	return m.transport.SetEventHandler(m)
+	for _, id := range m.transportIDs {
+		if err := m.transports[id].SetEventHandler(&transportEvents{m, id}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // OnReady registers a listener for when the data transfer manager has finished starting up
@@ -186,7 +333,19 @@ func (m *manager) OnReady(ready datatransfer.ReadyFunc) {
 func (m *manager) Stop(ctx context.Context) error {
 	log.Info("stop data-transfer module")
 	m.pushChannelMonitor.Shutdown()
-	return m.transport.Shutdown(ctx)
+	m.pullChannelMonitor.Shutdown()
+	m.stopThrottling()
+	m.stopChannelTimeouts()
+	m.subscriptions.stop()
+	m.bgCancel()
+	m.spansIndex.EndAll()
+	var err error
+	for _, id := range m.transportIDs {
+		if shutdownErr := m.transports[id].Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
 }
 
 // RegisterVoucherType registers a validator for the given voucher type
@@ -205,26 +364,48 @@ func (m *manager) RegisterVoucherType(voucherType datatransfer.Voucher, validato
 // OpenPushDataChannel opens a data transfer that will send data to the recipient peer and
 // transfer parts of the piece that match the selector
 func (m *manager) OpenPushDataChannel(ctx context.Context, requestTo peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node) (datatransfer.ChannelID, error) {
+	return m.OpenPushDataChannelWithOptions(ctx, requestTo, voucher, baseCid, selector)
+}
+
+// OpenPushDataChannelWithOptions opens a push data transfer with the given
+// channel options
+func (m *manager) OpenPushDataChannelWithOptions(ctx context.Context, requestTo peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node, options ...datatransfer.ChannelOption) (datatransfer.ChannelID, error) {
 	log.Infof("open push channel to %s with base cid %s", requestTo, baseCid)
 
+	opts := channelOptions(options)
+	if len(opts.DoNotSendCids) > 0 {
+		return datatransfer.ChannelID{}, xerrors.New("do not send cids can only be set on pull channels")
+	}
+	transportID, err := m.preferredTransport(requestTo, voucher.Type(), opts)
+	if err != nil {
+		return datatransfer.ChannelID{}, err
+	}
+	if err := m.checkInitialPause(requestTo, transportID, opts); err != nil {
+		return datatransfer.ChannelID{}, err
+	}
+
 	req, err := m.newRequest(ctx, selector, false, voucher, baseCid, requestTo)
 	if err != nil {
 		return datatransfer.ChannelID{}, err
 	}
+	req = message.WithTransports(req, m.offeredTransports(requestTo, transportID))
+	req = withChannelOptions(req, opts)
 
 	chid, err := m.channels.CreateNew(m.peerID, req.TransferID(), baseCid, selector, voucher,
-		m.peerID, m.peerID, requestTo) // initiator = us, sender = us, receiver = them
+		m.peerID, m.peerID, requestTo, transportID, opts) // initiator = us, sender = us, receiver = them
 	if err != nil {
 		return chid, err
 	}
-	processor, has := m.transportConfigurers.Processor(voucher.Type())
-	if has {
-		transportConfigurer := processor.(datatransfer.TransportConfigurer)
-		transportConfigurer(chid, voucher, m.transport)
+	if err := m.applyChannelOptions(chid, opts); err != nil {
+		return chid, err
 	}
+	m.setChannelTransport(chid, transportID)
+	ctx, _ = m.spansIndex.SpanByChannelID(ctx, chid)
+	req = m.withTraceContext(ctx, req)
+	m.configureTransport(chid, voucher, transportID)
 	m.dataTransferNetwork.Protect(requestTo, chid.String())
 	monitoredChan := m.pushChannelMonitor.AddChannel(chid)
-	if err := m.dataTransferNetwork.SendMessage(ctx, requestTo, req); err != nil {
+	if err := m.sendMessage(ctx, chid, requestTo, req); err != nil {
 		err = fmt.Errorf("Unable to send request: %w", err)
 		_ = m.channels.Error(chid, err)
 
@@ -243,29 +424,62 @@ func (m *manager) OpenPushDataChannel(ctx context.Context, requestTo peer.ID, vo
 // OpenPullDataChannel opens a data transfer that will request data from the sending peer and
 // transfer parts of the piece that match the selector
 func (m *manager) OpenPullDataChannel(ctx context.Context, requestTo peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node) (datatransfer.ChannelID, error) {
+	return m.OpenPullDataChannelWithOptions(ctx, requestTo, voucher, baseCid, selector)
+}
+
+// OpenPullDataChannelWithOptions opens a pull data transfer with the given
+// channel options
+func (m *manager) OpenPullDataChannelWithOptions(ctx context.Context, requestTo peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node, options ...datatransfer.ChannelOption) (datatransfer.ChannelID, error) {
 	log.Infof("open pull channel to %s with base cid %s", requestTo, baseCid)
 
+	opts := channelOptions(options)
+	transportID, err := m.preferredTransport(requestTo, voucher.Type(), opts)
+	if err != nil {
+		return datatransfer.ChannelID{}, err
+	}
+	if err := m.checkInitialPause(requestTo, transportID, opts); err != nil {
+		return datatransfer.ChannelID{}, err
+	}
+
 	req, err := m.newRequest(ctx, selector, true, voucher, baseCid, requestTo)
 	if err != nil {
 		return datatransfer.ChannelID{}, err
 	}
+	req = withChannelOptions(req, opts)
 	// initiator = us, sender = them, receiver = us
 	chid, err := m.channels.CreateNew(m.peerID, req.TransferID(), baseCid, selector, voucher,
-		m.peerID, requestTo, m.peerID)
+		m.peerID, requestTo, m.peerID, transportID, opts)
 	if err != nil {
 		return chid, err
 	}
-	processor, has := m.transportConfigurers.Processor(voucher.Type())
-	if has {
-		transportConfigurer := processor.(datatransfer.TransportConfigurer)
-		transportConfigurer(chid, voucher, m.transport)
+	if err := m.applyChannelOptions(chid, opts); err != nil {
+		return chid, err
 	}
+	m.setChannelTransport(chid, transportID)
+	ctx, _ = m.spansIndex.SpanByChannelID(ctx, chid)
+	req = m.withTraceContext(ctx, req)
+	m.configureTransport(chid, voucher, transportID)
 	m.dataTransferNetwork.Protect(requestTo, chid.String())
-	if err := m.transport.OpenChannel(ctx, requestTo, chid, cidlink.Link{Cid: baseCid}, selector, nil, req); err != nil {
+	monitoredChan := m.pullChannelMonitor.AddChannel(chid)
+	if err := m.transportByID(transportID).OpenChannel(ctx, requestTo, chid, cidlink.Link{Cid: baseCid}, selector, opts.DoNotSendCids, m.signMessage(chid, req)); err != nil {
 		err = fmt.Errorf("Unable to send request: %w", err)
 		_ = m.channels.Error(chid, err)
+
+		// If pull channel monitoring is enabled, shutdown the monitor as it
+		// wasn't possible to start the data transfer
+		if monitoredChan != nil {
+			monitoredChan.Shutdown()
+		}
+
 		return chid, err
 	}
+	if opts.Paused {
+		// stop receiving data until the channel is resumed
+		pausable := m.transportByID(transportID).(datatransfer.PauseableTransport)
+		if err := pausable.PauseChannel(ctx, chid); err != nil {
+			log.Warnf("channel %s: unable to pause channel at transport level: %s", chid, err)
+		}
+	}
 	return chid, nil
 }
 
@@ -282,7 +496,11 @@ func (m *manager) SendVoucher(ctx context.Context, channelID datatransfer.Channe
 	if err != nil {
 		return err
 	}
-	if err := m.dataTransferNetwork.SendMessage(ctx, chst.OtherPeer(), updateRequest); err != nil {
+	// a voucher the other peer does not accept does not disconnect the channel
+	if err := m.checkMessageSize(chst.OtherPeer(), updateRequest); err != nil {
+		return err
+	}
+	if err := m.sendMessage(ctx, channelID, chst.OtherPeer(), updateRequest); err != nil {
 		err = fmt.Errorf("Unable to send request: %w", err)
 		_ = m.OnRequestDisconnected(ctx, channelID)
 		return err
@@ -300,14 +518,14 @@ func (m *manager) CloseDataTransferChannel(ctx context.Context, chid datatransfe
 	}
 
 	// Close the channel on the local transport
-	err = m.transport.CloseChannel(ctx, chid)
+	err = m.transportFor(chid).CloseChannel(ctx, chid)
 	if err != nil {
 		log.Warnf("unable to close channel %s: %s", chid, err)
 	}
 
 	// Send a cancel message to the remote peer
 	log.Infof("%s: sending cancel channel to %s for channel %s", m.peerID, chst.OtherPeer(), chid)
-	err = m.dataTransferNetwork.SendMessage(ctx, chst.OtherPeer(), m.cancelMessage(chid))
+	err = m.sendMessage(ctx, chid, chst.OtherPeer(), m.cancelMessage(chid))
 	if err != nil {
 		err = fmt.Errorf("unable to send cancel message for channel %s to peer %s: %w",
 			chid, m.peerID, err)
@@ -340,7 +558,7 @@ func (m *manager) CloseDataTransferChannelWithError(ctx context.Context, chid da
 	}
 
 	// Cancel the channel on the local transport
-	err = m.transport.CloseChannel(ctx, chid)
+	err = m.transportFor(chid).CloseChannel(ctx, chid)
 	if err != nil {
 		log.Warnf("unable to close channel %s: %s", chid, err)
 	}
@@ -350,7 +568,7 @@ func (m *manager) CloseDataTransferChannelWithError(ctx context.Context, chid da
 	// is already in an error state, which is probably because of connection
 	// issues, so if we cant send the message just log a warning.
 	log.Infof("%s: sending cancel channel to %s for channel %s", m.peerID, chst.OtherPeer(), chid)
-	err = m.dataTransferNetwork.SendMessage(ctx, chst.OtherPeer(), m.cancelMessage(chid))
+	err = m.sendMessage(ctx, chid, chst.OtherPeer(), m.cancelWithErrorMessage(chid, cherr))
 	if err != nil {
 		// Just log a warning here because it's important that we fire the
 		// error event with the original error so that it doesn't get masked
@@ -372,17 +590,20 @@ func (m *manager) CloseDataTransferChannelWithError(ctx context.Context, chid da
 func (m *manager) PauseDataTransferChannel(ctx context.Context, chid datatransfer.ChannelID) error {
 	log.Infof("pause channel %s", chid)
 
-	pausable, ok := m.transport.(datatransfer.PauseableTransport)
+	pausable, ok := m.transportFor(chid).(datatransfer.PauseableTransport)
 	if !ok {
 		return datatransfer.ErrUnsupported
 	}
+	if err := m.checkPeerCanPause(chid); err != nil {
+		return err
+	}
 
 	err := pausable.PauseChannel(ctx, chid)
 	if err != nil {
 		log.Warnf("Error attempting to pause at transport level: %s", err.Error())
 	}
 
-	if err := m.dataTransferNetwork.SendMessage(ctx, chid.OtherParty(m.peerID), m.pauseMessage(chid)); err != nil {
+	if err := m.sendMessage(ctx, chid, chid.OtherParty(m.peerID), m.pauseMessage(chid)); err != nil {
 		err = fmt.Errorf("Unable to send pause message: %w", err)
 		_ = m.OnRequestDisconnected(ctx, chid)
 		return err
@@ -395,10 +616,17 @@ func (m *manager) PauseDataTransferChannel(ctx context.Context, chid datatransfe
 func (m *manager) ResumeDataTransferChannel(ctx context.Context, chid datatransfer.ChannelID) error {
 	log.Infof("resume channel %s", chid)
 
-	pausable, ok := m.transport.(datatransfer.PauseableTransport)
+	pausable, ok := m.transportFor(chid).(datatransfer.PauseableTransport)
 	if !ok {
 		return datatransfer.ErrUnsupported
 	}
+	if err := m.checkPeerCanPause(chid); err != nil {
+		return err
+	}
+	// a queued channel is resumed when the responder admits it
+	if chst, err := m.channels.GetByID(ctx, chid); err == nil && chst.Status() == datatransfer.Queued {
+		return xerrors.Errorf("channel %s is queued for admission", chid)
+	}
 
 	err := pausable.ResumeChannel(ctx, m.resumeMessage(chid), chid)
 	if err != nil {
@@ -424,7 +652,17 @@ func (m *manager) TransferChannelStatus(ctx context.Context, chid datatransfer.C
 
 // get notified when certain types of events happen
 func (m *manager) SubscribeToEvents(subscriber datatransfer.Subscriber) datatransfer.Unsubscribe {
-	return datatransfer.Unsubscribe(m.pubSub.Subscribe(subscriber))
+	return m.subscriptions.subscribe(subscriber)
+}
+
+// SubscribeToChannelEvents gets notified of the events of a channel
+func (m *manager) SubscribeToChannelEvents(chid datatransfer.ChannelID, subscriber datatransfer.Subscriber) datatransfer.Unsubscribe {
+	return m.subscriptions.subscribeToChannel(chid, subscriber)
+}
+
+// SubscribeToEventCodes gets notified of the events with the given codes
+func (m *manager) SubscribeToEventCodes(codes []datatransfer.EventCode, subscriber datatransfer.Subscriber) datatransfer.Unsubscribe {
+	return m.subscriptions.subscribeToCodes(codes, subscriber)
 }
 
 // get all in progress transfers
@@ -432,6 +670,12 @@ func (m *manager) InProgressChannels(ctx context.Context) (map[datatransfer.Chan
 	return m.channels.InProgress()
 }
 
+// ListChannels returns the channels that match the given filter, sorted by
+// creation time
+func (m *manager) ListChannels(ctx context.Context, filter datatransfer.ChannelFilter) ([]datatransfer.ChannelState, error) {
+	return m.channels.List(ctx, filter)
+}
+
 // RegisterRevalidator registers a revalidator for the given voucher type
 // Note: this is the voucher type used to revalidate. It can share a name
 // with the initial validator type and CAN be the same type, or a different type.
@@ -466,9 +710,14 @@ func (m *manager) RegisterTransportConfigurer(voucherType datatransfer.Voucher,
 }
 
 // RestartDataTransferChannel restarts data transfer on the channel with the given channelId
-func (m *manager) RestartDataTransferChannel(ctx context.Context, chid datatransfer.ChannelID) error {
+func (m *manager) RestartDataTransferChannel(ctx context.Context, chid datatransfer.ChannelID) (err error) {
 	log.Infof("restart channel %s", chid)
 
+	ctx, span := m.startSpan(ctx, chid, "restartChannel")
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	channel, err := m.channels.GetByID(ctx, chid)
 	if err != nil {
 		return xerrors.Errorf("failed to fetch channel: %w", err)
@@ -485,6 +734,10 @@ func (m *manager) RestartDataTransferChannel(ctx context.Context, chid datatrans
 		return m.channels.CompleteCleanupOnRestart(channel.ChannelID())
 	}
 
+	if err := m.checkPeerCanRestart(channel.OtherPeer()); err != nil {
+		return err
+	}
+
 	// initiate restart
 	chType := m.channelDataTransferType(channel)
 	switch chType {
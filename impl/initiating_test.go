@@ -4,30 +4,50 @@ import (
 	"context"
 	"math/rand"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-graphsync/storeutil"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-merkledag"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-storedcounter"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/bandwidth"
 	"github.com/filecoin-project/go-data-transfer/channels"
 	. "github.com/filecoin-project/go-data-transfer/impl"
+	"github.com/filecoin-project/go-data-transfer/journal"
 	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/metrics"
 	"github.com/filecoin-project/go-data-transfer/testutil"
+	"github.com/filecoin-project/go-data-transfer/tracing"
 )
 
 func TestDataTransferInitiating(t *testing.T) {
 	// create network
 	ctx := context.Background()
+	metricsRecorder := testutil.NewFakeMetricsRecorder()
+	// a dag for the cases that verify the data of channels
+	integrityBs := bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	integrityLoader := storeutil.LoaderForBlockstore(integrityBs)
+	integrityLink, _ := testutil.LoadUnixFSFile(ctx, t, merkledag.NewDAGService(blockservice.New(integrityBs, offline.Exchange(integrityBs))), "lorem.txt")
+	integrityRoot := integrityLink.(cidlink.Link).Cid
 	testCases := map[string]struct {
 		expectedEvents []datatransfer.EventCode
 		options        []DataTransferOption
@@ -136,6 +156,99 @@ func TestDataTransferInitiating(t *testing.T) {
 				time.Sleep(1 * time.Second)
 			},
 		},
+		"Throttled request resumes": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.DataReceivedProgress, datatransfer.DataReceived, datatransfer.Throttled, datatransfer.Unthrottled},
+			options:        []DataTransferOption{BandwidthLimiter(bandwidth.NewLimiter(bandwidth.Limits{PeerBytesPerSecond: 10000}))},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				testCids := testutil.GenerateCids(1)
+				err = h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[0]}, uint64(12345))
+				require.EqualError(t, err, datatransfer.ErrPause.Error())
+
+				// need time for the throttle to expire
+				time.Sleep(1 * time.Second)
+				require.Len(t, h.transport.ResumedChannels, 1)
+				require.Equal(t, channelID, h.transport.ResumedChannels[0].ChannelID)
+				require.Nil(t, h.transport.ResumedChannels[0].Message)
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.False(t, chst.Throttled())
+			},
+		},
+		"Purges terminated channels": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Cancel, datatransfer.CleanupComplete, datatransfer.Purged},
+			options:        []DataTransferOption{ChannelRetentionPolicy(channels.RetentionPolicy{MaxAge: time.Nanosecond}, 10*time.Millisecond)},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				require.NoError(t, h.dt.CloseDataTransferChannel(h.ctx, channelID))
+
+				// need time for the channel to be purged
+				time.Sleep(100 * time.Millisecond)
+				_, err = h.dt.ChannelState(h.ctx, channelID)
+				require.Error(t, err)
+			},
+		},
+		"Records metrics": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept, datatransfer.ResumeResponder, datatransfer.DataReceivedProgress, datatransfer.DataReceived, datatransfer.PauseInitiator, datatransfer.ResumeInitiator},
+			options:        []DataTransferOption{MetricsRecorder(metricsRecorder)},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				require.NoError(t, h.transport.EventHandler.OnResponseReceived(channelID, response))
+
+				testCids := testutil.GenerateCids(1)
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[0]}, uint64(12345)))
+				require.Equal(t, uint64(12345), metricsRecorder.BytesReceivedFor(metrics.Pull))
+				require.Zero(t, metricsRecorder.BytesReceivedFor(metrics.Push))
+
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, channelID))
+				require.NoError(t, h.dt.ResumeDataTransferChannel(h.ctx, channelID))
+
+				// events are published asynchronously. The accept response also
+				// resumes the responder side of the channel.
+				require.Eventually(t, func() bool {
+					return metricsRecorder.ResumesFor(metrics.Pull) == 2
+				}, time.Second, 10*time.Millisecond)
+				require.Equal(t, 1, metricsRecorder.PausesFor(metrics.Pull))
+				require.Equal(t, int64(0), metricsRecorder.ChannelCountFor(datatransfer.Requested))
+				require.Equal(t, int64(1), metricsRecorder.ChannelCountFor(datatransfer.Ongoing))
+			},
+		},
+		"Propagates trace context": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open},
+			options:        []DataTransferOption{PropagateTraceContext()},
+			verify: func(t *testing.T, h *harness) {
+				sr := new(oteltest.SpanRecorder)
+				prevProvider := otel.GetTracerProvider()
+				otel.SetTracerProvider(oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr)))
+				defer otel.SetTracerProvider(prevProvider)
+
+				_, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				require.Len(t, h.network.SentMessages, 1)
+				request, ok := h.network.SentMessages[0].Message.(datatransfer.Request)
+				require.True(t, ok)
+
+				spans := make(map[string]*oteltest.Span)
+				for _, span := range sr.Started() {
+					spans[span.Name()] = span
+				}
+				channelSpan, ok := spans["transfer"]
+				require.True(t, ok)
+				sendSpan, ok := spans["sendMessage"]
+				require.True(t, ok)
+				require.Equal(t, channelSpan.SpanContext().SpanID(), sendSpan.ParentSpanID())
+
+				// the request carries the trace context of the channel span
+				remote := trace.SpanContextFromContext(tracing.ExtractTraceContext(context.Background(), request.TraceCarrier()))
+				require.Equal(t, channelSpan.SpanContext().TraceID(), remote.TraceID())
+				require.Equal(t, channelSpan.SpanContext().SpanID(), remote.SpanID())
+			},
+		},
 		"Disconnected request resumes, push": {
 			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept, datatransfer.ResumeResponder, datatransfer.Disconnected, datatransfer.DataSentProgress, datatransfer.DataSent},
 			options:        []DataTransferOption{ChannelRemoveTimeout(10 * time.Millisecond)},
@@ -346,6 +459,749 @@ func TestDataTransferInitiating(t *testing.T) {
 				require.Equal(t, cancelMessage.TransferID(), channelID.ID)
 			},
 		},
+		"rejected response fails channel with error code": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Error, datatransfer.CleanupComplete},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message.NewResponse(channelID.ID, false, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				response = message.WithResponseError(response, datatransfer.ErrorResourceExhausted, "too many transfers")
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.NoError(t, err)
+
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.ErrorResourceExhausted, chst.ErrorCode())
+				require.Equal(t, (&datatransfer.RemoteError{
+					Code:     datatransfer.ErrorResourceExhausted,
+					Message:  "too many transfers",
+					Rejected: true,
+				}).Error(), chst.Message())
+			},
+		},
+		"rejected response without error code fails channel with ErrRejected": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Error, datatransfer.CleanupComplete},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message.NewResponse(channelID.ID, false, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.NoError(t, err)
+
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.NoError, chst.ErrorCode())
+				require.Equal(t, datatransfer.ErrRejected.Error(), chst.Message())
+			},
+		},
+		"cancel response with error code fails channel": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept, datatransfer.ResumeResponder, datatransfer.Error, datatransfer.CleanupComplete},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.NoError(t, err)
+				cancel := message.WithResponseError(message.CancelResponse(channelID.ID), datatransfer.ErrorInternal, "disk full")
+				err = h.transport.EventHandler.OnResponseReceived(channelID, cancel)
+				require.NoError(t, err)
+
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.ErrorInternal, chst.ErrorCode())
+				require.Contains(t, chst.Message(), "disk full")
+			},
+		},
+		"close with error sends error code": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Error, datatransfer.CleanupComplete},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				closer, ok := h.dt.(interface {
+					CloseDataTransferChannelWithError(context.Context, datatransfer.ChannelID, error) error
+				})
+				require.True(t, ok)
+				err = closer.CloseDataTransferChannelWithError(h.ctx, channelID, xerrors.New("opening /var/lib/datastore: permission denied"))
+				require.NoError(t, err)
+				require.Len(t, h.network.SentMessages, 1)
+				cancelMessage := h.network.SentMessages[0].Message
+				require.True(t, cancelMessage.IsRequest())
+				require.True(t, cancelMessage.IsCancel())
+				require.Equal(t, datatransfer.ErrorInternal, cancelMessage.ErrorCode())
+				// the details of internal errors are not sent to the other peer
+				require.Equal(t, "internal error", cancelMessage.ErrorMessage())
+			},
+		},
+		"advertises capabilities and refuses operations the peer does not support": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept, datatransfer.ResumeResponder},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				require.Len(t, h.network.SentMessages, 1)
+				require.Equal(t, &datatransfer.Capabilities{
+					Restart:    true,
+					Pause:      true,
+					Transports: []datatransfer.TransportID{datatransfer.DefaultTransport},
+				}, h.network.SentMessages[0].Message.Capabilities())
+
+				_, known := h.dt.PeerCapabilities(h.peers[1])
+				require.False(t, known)
+				response, err := message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				peerCaps := datatransfer.Capabilities{Transports: []datatransfer.TransportID{datatransfer.DefaultTransport}}
+				response = message.WithResponseCapabilities(response, peerCaps)
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.NoError(t, err)
+				caps, known := h.dt.PeerCapabilities(h.peers[1])
+				require.True(t, known)
+				require.Equal(t, peerCaps, caps)
+
+				err = h.dt.PauseDataTransferChannel(h.ctx, channelID)
+				require.True(t, xerrors.Is(err, datatransfer.ErrUnsupported))
+				err = h.dt.ResumeDataTransferChannel(h.ctx, channelID)
+				require.True(t, xerrors.Is(err, datatransfer.ErrUnsupported))
+				err = h.dt.RestartDataTransferChannel(h.ctx, channelID)
+				require.True(t, xerrors.Is(err, datatransfer.ErrUnsupported))
+				require.Len(t, h.transport.PausedChannels, 0)
+				require.Len(t, h.network.SentMessages, 1)
+			},
+		},
+		"refuses messages larger than the peer accepts": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept, datatransfer.ResumeResponder},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				response = message.WithResponseCapabilities(response, datatransfer.Capabilities{Restart: true, Pause: true, MaxMessageSize: 10})
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.NoError(t, err)
+
+				err = h.dt.SendVoucher(h.ctx, channelID, h.voucher)
+				require.True(t, xerrors.Is(err, datatransfer.ErrUnsupported))
+				require.Len(t, h.network.SentMessages, 0)
+			},
+		},
+		"legacy peers imply their capabilities": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept, datatransfer.ResumeResponder, datatransfer.PauseInitiator},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message1_1.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.NoError(t, err)
+				caps, known := h.dt.PeerCapabilities(h.peers[1])
+				require.True(t, known)
+				require.Equal(t, datatransfer.LegacyCapabilities1_1, caps)
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, channelID))
+			},
+		},
+		"sends and records the channel priority": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Open},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithPriority(3))
+				require.NoError(t, err)
+				require.Len(t, h.transport.OpenedChannels, 1)
+				require.Equal(t, 3, h.transport.OpenedChannels[0].Message.(datatransfer.Request).Priority())
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, 3, chst.Priority())
+
+				channelID, err = h.dt.OpenPushDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithPriority(-1))
+				require.NoError(t, err)
+				messageReceived := h.network.SentMessages[0]
+				require.Equal(t, -1, messageReceived.Message.(datatransfer.Request).Priority())
+				chst, err = h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, -1, chst.Priority())
+			},
+		},
+		"opens channels with options": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open},
+			verify: func(t *testing.T, h *harness) {
+				doNotSend := testutil.GenerateCids(2)
+				channelID, err := h.dt.OpenPullDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor,
+					datatransfer.WithTotalSize(1000),
+					datatransfer.WithLabel("backup"),
+					datatransfer.WithMetadata(map[string]string{"deal": "1", "client": "a"}),
+					datatransfer.WithDoNotSendCids(doNotSend))
+				require.NoError(t, err)
+				require.Len(t, h.transport.OpenedChannels, 1)
+				require.Equal(t, doNotSend, h.transport.OpenedChannels[0].DoNotSendCids)
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, uint64(1000), chst.TotalSize())
+				require.Equal(t, "backup", chst.Label())
+				require.Equal(t, map[string]string{"deal": "1", "client": "a"}, chst.Metadata())
+				require.Equal(t, doNotSend, chst.DoNotSendCids())
+				require.True(t, chst.Deadline().IsZero())
+
+				// blocks the initiator already has only apply to pull channels
+				_, err = h.dt.OpenPushDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor,
+					datatransfer.WithDoNotSendCids(doNotSend))
+				require.Error(t, err)
+			},
+		},
+		"opens channels paused": {
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithInitialPause())
+				require.NoError(t, err)
+				require.True(t, h.transport.OpenedChannels[0].Message.(datatransfer.Request).IsPaused())
+				require.Equal(t, []datatransfer.ChannelID{channelID}, h.transport.PausedChannels)
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.InitiatorPaused, chst.Status())
+
+				channelID, err = h.dt.OpenPushDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithInitialPause())
+				require.NoError(t, err)
+				require.True(t, h.network.SentMessages[0].Message.(datatransfer.Request).IsPaused())
+				chst, err = h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.InitiatorPaused, chst.Status())
+
+				// the transport does not start sending data when the responder
+				// accepts the channel
+				response, err := message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.EqualError(t, err, datatransfer.ErrPause.Error())
+				chst, err = h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.InitiatorPaused, chst.Status())
+			},
+		},
+		"fails channels that time out": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Error, datatransfer.CleanupComplete},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithTimeout(50*time.Millisecond))
+				require.NoError(t, err)
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.False(t, chst.Deadline().IsZero())
+
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, channelID)
+					return err == nil && chst.Status() == datatransfer.Failed
+				}, time.Second, 10*time.Millisecond)
+				chst, err = h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.ErrTimedOut.Error(), chst.Message())
+				require.Len(t, h.network.SentMessages, 1)
+				cancel := h.network.SentMessages[0].Message.(datatransfer.Request)
+				require.True(t, cancel.IsCancel())
+				require.Equal(t, datatransfer.ErrorTimedOut, cancel.ErrorCode())
+			},
+		},
+		"declares the total size and records the size the sender confirms": {
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithTotalSize(30000))
+				require.NoError(t, err)
+				require.Equal(t, uint64(30000), h.transport.OpenedChannels[0].Message.(datatransfer.Request).TotalSize())
+				response, err := message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				require.NoError(t, h.transport.EventHandler.OnResponseReceived(channelID, response))
+				complete, err := message.CompleteResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				complete = message.WithResponseTotalSize(complete, 24690)
+				require.NoError(t, h.transport.EventHandler.OnResponseReceived(channelID, complete))
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, uint64(24690), chst.TotalSize())
+
+				// the initiator of a push channel confirms the size of the data it
+				// sent when the transfer finishes
+				channelID, err = h.dt.OpenPushDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithTotalSize(30000))
+				require.NoError(t, err)
+				require.Equal(t, uint64(30000), h.network.SentMessages[0].Message.(datatransfer.Request).TotalSize())
+				response, err = message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				require.NoError(t, h.transport.EventHandler.OnResponseReceived(channelID, response))
+				_, err = h.transport.EventHandler.OnDataQueued(channelID, cidlink.Link{Cid: testutil.GenerateCids(1)[0]}, 12345)
+				require.NoError(t, err)
+				require.NoError(t, h.transport.EventHandler.OnChannelCompleted(channelID, nil))
+				chst, err = h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, uint64(12345), chst.TotalSize())
+			},
+		},
+		"subscribes to the events of a channel or with event codes": {
+			verify: func(t *testing.T, h *harness) {
+				type event struct {
+					code datatransfer.EventCode
+					chid datatransfer.ChannelID
+				}
+				var lk sync.Mutex
+				var channelEvents, codeEvents []event
+				opened := make(chan struct{}, 2)
+				unsubOpen := h.dt.SubscribeToEventCodes([]datatransfer.EventCode{datatransfer.Open}, func(datatransfer.Event, datatransfer.ChannelState) {
+					opened <- struct{}{}
+				})
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				otherChannelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				for i := 0; i < 2; i++ {
+					select {
+					case <-opened:
+					case <-h.ctx.Done():
+						t.Fatal("channels not opened")
+					}
+				}
+				unsubOpen()
+
+				unsubChannel := h.dt.SubscribeToChannelEvents(channelID, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+					lk.Lock()
+					defer lk.Unlock()
+					channelEvents = append(channelEvents, event{evt.Code, chst.ChannelID()})
+				})
+				unsubCodes := h.dt.SubscribeToEventCodes([]datatransfer.EventCode{datatransfer.PauseInitiator, datatransfer.ResumeInitiator},
+					func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+						lk.Lock()
+						defer lk.Unlock()
+						codeEvents = append(codeEvents, event{evt.Code, chst.ChannelID()})
+					})
+
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, otherChannelID))
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, channelID))
+				require.NoError(t, h.dt.ResumeDataTransferChannel(h.ctx, channelID))
+				require.Eventually(t, func() bool {
+					lk.Lock()
+					defer lk.Unlock()
+					return len(codeEvents) == 3
+				}, time.Second, 10*time.Millisecond)
+				lk.Lock()
+				require.Equal(t, []event{
+					{datatransfer.PauseInitiator, channelID},
+					{datatransfer.ResumeInitiator, channelID},
+				}, channelEvents)
+				// events of different channels may be delivered in any order
+				require.ElementsMatch(t, []event{
+					{datatransfer.PauseInitiator, otherChannelID},
+					{datatransfer.PauseInitiator, channelID},
+					{datatransfer.ResumeInitiator, channelID},
+				}, codeEvents)
+				lk.Unlock()
+
+				// unsubscribed subscribers are not notified
+				unsubChannel()
+				unsubCodes()
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, channelID))
+				_, err = h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				time.Sleep(50 * time.Millisecond)
+				lk.Lock()
+				require.Len(t, channelEvents, 2)
+				require.Len(t, codeEvents, 3)
+				lk.Unlock()
+			},
+		},
+		"dispatches events asynchronously in order for each channel": {
+			options: []DataTransferOption{AsyncEventDispatch(EventDispatchConfig{QueueSize: 4})},
+			verify: func(t *testing.T, h *harness) {
+				var lk sync.Mutex
+				received := make(map[datatransfer.ChannelID][]uint64)
+				slowEvents := 0
+				h.dt.SubscribeToEventCodes([]datatransfer.EventCode{datatransfer.SlowSubscriber}, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+					lk.Lock()
+					defer lk.Unlock()
+					slowEvents++
+				})
+				h.dt.SubscribeToEventCodes([]datatransfer.EventCode{datatransfer.DataReceived}, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+					time.Sleep(time.Millisecond)
+					lk.Lock()
+					defer lk.Unlock()
+					received[chst.ChannelID()] = append(received[chst.ChannelID()], chst.Received())
+				})
+
+				const blocks = 20
+				var chids []datatransfer.ChannelID
+				for i := 0; i < 2; i++ {
+					chid, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					chids = append(chids, chid)
+				}
+				testCids := testutil.GenerateCids(blocks)
+				for _, c := range testCids {
+					for _, chid := range chids {
+						require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: c}, 100))
+					}
+				}
+
+				// every event is delivered, in the order it happened for each
+				// channel, though the subscriber was too slow to keep up
+				require.Eventually(t, func() bool {
+					lk.Lock()
+					defer lk.Unlock()
+					return len(received[chids[0]]) == blocks && len(received[chids[1]]) == blocks
+				}, 5*time.Second, 10*time.Millisecond)
+				lk.Lock()
+				defer lk.Unlock()
+				for _, chid := range chids {
+					for i, r := range received[chid] {
+						require.Equal(t, uint64(100*(i+1)), r)
+					}
+				}
+				require.NotZero(t, slowEvents)
+			},
+		},
+		"drops events for slow subscribers when dispatching events asynchronously": {
+			options: []DataTransferOption{AsyncEventDispatch(EventDispatchConfig{QueueSize: 1, DropWhenFull: true})},
+			verify: func(t *testing.T, h *harness) {
+				var lk sync.Mutex
+				var received []uint64
+				var slowEvents []datatransfer.Event
+				release := make(chan struct{})
+				h.dt.SubscribeToEventCodes([]datatransfer.EventCode{datatransfer.SlowSubscriber}, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+					lk.Lock()
+					defer lk.Unlock()
+					slowEvents = append(slowEvents, evt)
+				})
+				h.dt.SubscribeToEventCodes([]datatransfer.EventCode{datatransfer.DataReceived}, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+					<-release
+					lk.Lock()
+					defer lk.Unlock()
+					received = append(received, chst.Received())
+				})
+
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				for _, c := range testutil.GenerateCids(10) {
+					require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: c}, 100))
+				}
+				// publishing is not held up by the subscriber
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, channelID)
+					return err == nil && chst.Received() == 1000
+				}, time.Second, 10*time.Millisecond)
+				require.Eventually(t, func() bool {
+					lk.Lock()
+					defer lk.Unlock()
+					return len(slowEvents) == 1
+				}, time.Second, 10*time.Millisecond)
+				close(release)
+
+				require.Eventually(t, func() bool {
+					lk.Lock()
+					defer lk.Unlock()
+					return len(received) > 0
+				}, time.Second, 10*time.Millisecond)
+				time.Sleep(50 * time.Millisecond)
+				lk.Lock()
+				defer lk.Unlock()
+				// the slow subscriber is only warned about once, and the events it
+				// did get are in order
+				require.Len(t, slowEvents, 1)
+				require.Less(t, len(received), 10)
+				for i := 1; i < len(received); i++ {
+					require.Greater(t, received[i], received[i-1])
+				}
+			},
+		},
+		"holds up publishing for slow subscribers until their queue has room": {
+			options: []DataTransferOption{AsyncEventDispatch(EventDispatchConfig{QueueSize: 1})},
+			verify: func(t *testing.T, h *harness) {
+				var lk sync.Mutex
+				var slowReceived, fastReceived []uint64
+				release := make(chan struct{})
+				h.dt.SubscribeToEventCodes([]datatransfer.EventCode{datatransfer.DataReceived}, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+					<-release
+					lk.Lock()
+					defer lk.Unlock()
+					slowReceived = append(slowReceived, chst.Received())
+				})
+				h.dt.SubscribeToEventCodes([]datatransfer.EventCode{datatransfer.DataReceived}, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+					lk.Lock()
+					defer lk.Unlock()
+					fastReceived = append(fastReceived, chst.Received())
+				})
+
+				const blocks = 10
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				for _, c := range testutil.GenerateCids(blocks) {
+					require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: c}, 100))
+				}
+
+				// the slow subscriber is handling the first event and has the
+				// second queued, so publishing the third waits for it, and the
+				// subscribers after it do not hear about any later events
+				require.Eventually(t, func() bool {
+					lk.Lock()
+					defer lk.Unlock()
+					return len(fastReceived) == 2
+				}, time.Second, 10*time.Millisecond)
+				time.Sleep(50 * time.Millisecond)
+				lk.Lock()
+				require.Len(t, fastReceived, 2)
+				require.Empty(t, slowReceived)
+				lk.Unlock()
+				close(release)
+
+				// once the slow subscriber catches up, no events are dropped and
+				// every subscriber gets them in order
+				require.Eventually(t, func() bool {
+					lk.Lock()
+					defer lk.Unlock()
+					return len(slowReceived) == blocks && len(fastReceived) == blocks
+				}, 5*time.Second, 10*time.Millisecond)
+				lk.Lock()
+				defer lk.Unlock()
+				for i := 0; i < blocks; i++ {
+					require.Equal(t, uint64(100*(i+1)), slowReceived[i])
+					require.Equal(t, uint64(100*(i+1)), fastReceived[i])
+				}
+			},
+		},
+		"replays events from the event journal": {
+			options: []DataTransferOption{EventJournal(journal.RetentionPolicy{MaxEntries: 100}, time.Hour)},
+			verify: func(t *testing.T, h *harness) {
+				type event struct {
+					seq  uint64
+					code datatransfer.EventCode
+				}
+				var lk sync.Mutex
+				var received []event
+				subscriber := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+					lk.Lock()
+					defer lk.Unlock()
+					received = append(received, event{evt.Seq, evt.Code})
+				}
+
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, channelID))
+				require.NoError(t, h.dt.ResumeDataTransferChannel(h.ctx, channelID))
+
+				// every event is recorded with the next sequence number
+				var journaled []event
+				require.Eventually(t, func() bool {
+					lk.Lock()
+					received = nil
+					lk.Unlock()
+					unsub, err := h.dt.SubscribeToEventsFrom(1, subscriber)
+					require.NoError(t, err)
+					unsub()
+					lk.Lock()
+					defer lk.Unlock()
+					journaled = received
+					received = nil
+					return len(journaled) > 0 && journaled[len(journaled)-1].code == datatransfer.ResumeInitiator
+				}, time.Second, 10*time.Millisecond)
+				for i, evt := range journaled {
+					require.Equal(t, uint64(i+1), evt.seq)
+				}
+				require.Equal(t, datatransfer.Open, journaled[0].code)
+				pauseSeq := journaled[len(journaled)-2].seq
+
+				// a subscriber that missed events replays them, then gets the
+				// events that happen after it subscribes
+				unsub, err := h.dt.SubscribeToEventsFrom(pauseSeq, subscriber)
+				require.NoError(t, err)
+				defer unsub()
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, channelID))
+				require.Eventually(t, func() bool {
+					lk.Lock()
+					defer lk.Unlock()
+					return len(received) == 3
+				}, time.Second, 10*time.Millisecond)
+				lk.Lock()
+				require.Equal(t, []event{
+					{pauseSeq, datatransfer.PauseInitiator},
+					{pauseSeq + 1, datatransfer.ResumeInitiator},
+					{pauseSeq + 2, datatransfer.PauseInitiator},
+				}, received)
+				lk.Unlock()
+			},
+		},
+		"does not record per-block events in the event journal": {
+			options: []DataTransferOption{EventJournal(journal.RetentionPolicy{MaxEntries: 100}, time.Hour)},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				testCids := testutil.GenerateCids(1)
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[0]}, 12345))
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, channelID))
+
+				var journaled []datatransfer.EventCode
+				require.Eventually(t, func() bool {
+					var lk sync.Mutex
+					var codes []datatransfer.EventCode
+					unsub, err := h.dt.SubscribeToEventsFrom(1, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+						lk.Lock()
+						defer lk.Unlock()
+						codes = append(codes, evt.Code)
+					})
+					require.NoError(t, err)
+					unsub()
+					lk.Lock()
+					defer lk.Unlock()
+					journaled = codes
+					return len(codes) > 0 && codes[len(codes)-1] == datatransfer.PauseInitiator
+				}, time.Second, 10*time.Millisecond)
+				require.Equal(t, []datatransfer.EventCode{datatransfer.Open, datatransfer.PauseInitiator}, journaled)
+			},
+		},
+		"records the configured events in the event journal": {
+			options: []DataTransferOption{EventJournal(journal.RetentionPolicy{MaxEntries: 100}, time.Hour), EventJournalExclude(datatransfer.DataReceived)},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				testCids := testutil.GenerateCids(1)
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[0]}, 12345))
+				require.NoError(t, h.dt.PauseDataTransferChannel(h.ctx, channelID))
+
+				var journaled []datatransfer.EventCode
+				require.Eventually(t, func() bool {
+					var lk sync.Mutex
+					var codes []datatransfer.EventCode
+					unsub, err := h.dt.SubscribeToEventsFrom(1, func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+						lk.Lock()
+						defer lk.Unlock()
+						codes = append(codes, evt.Code)
+					})
+					require.NoError(t, err)
+					unsub()
+					lk.Lock()
+					defer lk.Unlock()
+					journaled = codes
+					return len(codes) > 0 && codes[len(codes)-1] == datatransfer.PauseInitiator
+				}, time.Second, 10*time.Millisecond)
+				require.Equal(t, []datatransfer.EventCode{datatransfer.Open, datatransfer.DataReceivedProgress, datatransfer.PauseInitiator}, journaled)
+			},
+		},
+		"does not replay events without an event journal": {
+			verify: func(t *testing.T, h *harness) {
+				_, err := h.dt.SubscribeToEventsFrom(1, func(datatransfer.Event, datatransfer.ChannelState) {})
+				require.Error(t, err)
+			},
+		},
+		"reports the progress of channels": {
+			options: []DataTransferOption{ProgressRateWindows(time.Minute, time.Second)},
+			verify: func(t *testing.T, h *harness) {
+				updates := make(chan datatransfer.Progress, 10)
+				unsub := h.dt.SubscribeToProgress(50*time.Millisecond, func(progress datatransfer.Progress) {
+					updates <- progress
+				})
+				defer unsub()
+
+				channelID, err := h.dt.OpenPullDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithTotalSize(100000))
+				require.NoError(t, err)
+				progress, err := h.dt.ChannelProgress(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, channelID, progress.ChannelID)
+				require.Zero(t, progress.Transferred)
+				require.Zero(t, progress.PercentComplete)
+				require.Zero(t, progress.ETA)
+				require.Equal(t, []datatransfer.ProgressRate{{Window: time.Second}, {Window: time.Minute}}, progress.Rates)
+
+				testCids := testutil.GenerateCids(3)
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[0]}, 12345))
+				time.Sleep(200 * time.Millisecond)
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[1]}, 12345))
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[2]}, 12345))
+				require.Eventually(t, func() bool {
+					progress, err = h.dt.ChannelProgress(h.ctx, channelID)
+					return err == nil && progress.Transferred == 37035
+				}, time.Second, 10*time.Millisecond)
+				require.Equal(t, uint64(100000), progress.TotalSize)
+				require.InDelta(t, 37.035, progress.PercentComplete, 0.001)
+				require.Len(t, progress.Rates, 2)
+				require.Greater(t, progress.Rates[0].BytesPerSecond, float64(0))
+				require.Greater(t, progress.Rates[1].BytesPerSecond, float64(0))
+				require.Greater(t, progress.ETA, time.Duration(0))
+
+				// the subscriber gets at most one update per channel per interval,
+				// rather than one per block
+				var last datatransfer.Progress
+				timeout := time.After(time.Second)
+				for last.Transferred != 37035 {
+					select {
+					case last = <-updates:
+						require.Equal(t, channelID, last.ChannelID)
+					case <-timeout:
+						t.Fatal("did not receive progress update")
+					}
+				}
+				require.LessOrEqual(t, len(updates), 1)
+			},
+		},
+		"fails channels that receive more data than their total size by policy": {
+			options: []DataTransferOption{OverSizePolicy(OverSizeConfig{Fail: true})},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannelWithOptions(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor, datatransfer.WithTotalSize(20000))
+				require.NoError(t, err)
+				testCids := testutil.GenerateCids(2)
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[0]}, 12345))
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(channelID, cidlink.Link{Cid: testCids[1]}, 12345))
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, channelID)
+					return err == nil && chst.Status() == datatransfer.Failed
+				}, time.Second, 10*time.Millisecond)
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.ErrSizeExceeded.Error(), chst.Message())
+				require.Len(t, h.network.SentMessages, 1)
+				cancel := h.network.SentMessages[0].Message.(datatransfer.Request)
+				require.True(t, cancel.IsCancel())
+				require.Equal(t, datatransfer.ErrorSizeExceeded, cancel.ErrorCode())
+			},
+		},
+		"fails channels whose data does not match the responder's receipt": {
+			options: []DataTransferOption{VerifyIntegrity(integrityLoader)},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, integrityRoot, h.stor)
+				require.NoError(t, err)
+				response, err := message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				require.NoError(t, h.transport.EventHandler.OnResponseReceived(channelID, response))
+				require.NoError(t, h.transport.EventHandler.OnChannelCompleted(channelID, nil))
+
+				complete, err := message.CompleteResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				complete = message.WithResponseReceipt(complete, datatransfer.Receipt{Blocks: 1, Bytes: 100, Hash: []byte("not the receipt")})
+				require.NoError(t, h.transport.EventHandler.OnResponseReceived(channelID, complete))
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, channelID)
+					return err == nil && chst.Status() == datatransfer.Failed
+				}, time.Second, 10*time.Millisecond)
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.ErrIntegrity.Error(), chst.Message())
+				require.Eventually(t, func() bool {
+					return len(h.network.Sent()) == 2
+				}, time.Second, 10*time.Millisecond)
+				cancel := h.network.Sent()[1].Message.(datatransfer.Request)
+				require.True(t, cancel.IsCancel())
+				require.Equal(t, datatransfer.ErrorIntegrity, cancel.ErrorCode())
+			},
+		},
+		"queued response waits for admission": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Enqueued, datatransfer.Admitted, datatransfer.ResumeResponder},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPullDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message.NewResponse(channelID.ID, true, true, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				response = message.WithResponseError(response, datatransfer.ErrorQueued, "request queued for admission behind 2 other requests")
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.NoError(t, err)
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Queued, chst.Status())
+				require.Equal(t, "request queued for admission behind 2 other requests", chst.Message())
+
+				err = h.transport.EventHandler.OnResponseReceived(channelID, message.UpdateResponse(channelID.ID, false))
+				require.NoError(t, err)
+				chst, err = h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Ongoing, chst.Status())
+				require.Empty(t, chst.Message())
+			},
+		},
 		"customizing push transfer": {
 			expectedEvents: []datatransfer.EventCode{datatransfer.Open},
 			verify: func(t *testing.T, h *harness) {
@@ -735,3 +1591,254 @@ func (e eventVerifier) verify(ctx context.Context, t *testing.T) {
 		require.Equal(t, e.expectedEvents, receivedEvents)
 	}
 }
+
+func TestDataTransferRestartSelectedTransport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	peers := testutil.GeneratePeers(2)
+	network := testutil.NewFakeNetwork(peers[0])
+	defaultTransport := testutil.NewFakeTransport()
+	otherTransport := testutil.NewFakeTransport()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	storedCounter := storedcounter.New(ds, datastore.NewKey("counter"))
+
+	dt, err := NewDataTransfer(ds, os.TempDir(), network, defaultTransport, storedCounter,
+		Transport("other", otherTransport))
+	require.NoError(t, err)
+	testutil.StartAndWaitForReady(ctx, t, dt)
+
+	voucher := testutil.NewFakeDTType()
+	require.NoError(t, dt.RegisterVoucherType(voucher, testutil.NewStubbedValidator()))
+	baseCid := testutil.GenerateCids(1)[0]
+
+	// open a pull channel over the selected transport
+	chid, err := dt.OpenPullDataChannelWithOptions(ctx, peers[1], voucher, baseCid, testutil.AllSelector(),
+		datatransfer.UseTransport("other"))
+	require.NoError(t, err)
+	require.Len(t, defaultTransport.OpenedChannels, 0)
+	require.Len(t, otherTransport.OpenedChannels, 1)
+
+	chst, err := dt.ChannelState(ctx, chid)
+	require.NoError(t, err)
+	require.Equal(t, datatransfer.TransportID("other"), chst.Transport())
+
+	// the restart uses the same transport
+	require.NoError(t, dt.RestartDataTransferChannel(ctx, chid))
+	require.Len(t, defaultTransport.OpenedChannels, 0)
+	require.Len(t, otherTransport.OpenedChannels, 2)
+	receivedRequest, ok := otherTransport.OpenedChannels[1].Message.(datatransfer.Request)
+	require.True(t, ok)
+	require.True(t, receivedRequest.IsRestart())
+
+	// pausing and closing the channel also use the same transport
+	require.NoError(t, dt.PauseDataTransferChannel(ctx, chid))
+	require.Len(t, otherTransport.PausedChannels, 1)
+	require.Len(t, defaultTransport.PausedChannels, 0)
+	require.NoError(t, dt.CloseDataTransferChannel(ctx, chid))
+	require.Len(t, otherTransport.ClosedChannels, 1)
+	require.Len(t, defaultTransport.ClosedChannels, 0)
+}
+
+func TestPeerTransportCapabilities(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	peers := testutil.GeneratePeers(2)
+	network := testutil.NewFakeNetwork(peers[0])
+	defaultTransport := testutil.NewFakeTransport()
+	otherTransport := testutil.NewFakeTransport()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	storedCounter := storedcounter.New(ds, datastore.NewKey("counter"))
+
+	voucher := testutil.NewFakeDTType()
+	dt, err := NewDataTransfer(ds, os.TempDir(), network, defaultTransport, storedCounter,
+		Transport("other", otherTransport), TransportForVoucherType(voucher.Type(), "other"))
+	require.NoError(t, err)
+	testutil.StartAndWaitForReady(ctx, t, dt)
+	require.NoError(t, dt.RegisterVoucherType(voucher, testutil.NewStubbedValidator()))
+	baseCid := testutil.GenerateCids(1)[0]
+
+	// until the peer advertises its capabilities, channels use the transport
+	// selected for the voucher type
+	chid, err := dt.OpenPullDataChannel(ctx, peers[1], voucher, baseCid, testutil.AllSelector())
+	require.NoError(t, err)
+	require.Len(t, otherTransport.OpenedChannels, 1)
+	response, err := message.NewResponse(chid.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+	require.NoError(t, err)
+	response = message.WithResponseCapabilities(response, datatransfer.Capabilities{
+		Restart:    true,
+		Pause:      true,
+		Transports: []datatransfer.TransportID{datatransfer.DefaultTransport},
+	})
+	require.NoError(t, otherTransport.EventHandler.OnResponseReceived(chid, response))
+
+	// the peer does not support the transport selected for the voucher type,
+	// so new channels use a transport it supports
+	chid, err = dt.OpenPullDataChannel(ctx, peers[1], voucher, baseCid, testutil.AllSelector())
+	require.NoError(t, err)
+	require.Len(t, defaultTransport.OpenedChannels, 1)
+	chst, err := dt.ChannelState(ctx, chid)
+	require.NoError(t, err)
+	require.Equal(t, datatransfer.DefaultTransport, chst.Transport())
+
+	// a transport selected for the channel is not replaced
+	_, err = dt.OpenPullDataChannelWithOptions(ctx, peers[1], voucher, baseCid, testutil.AllSelector(),
+		datatransfer.UseTransport("other"))
+	require.True(t, xerrors.Is(err, datatransfer.ErrUnsupported))
+	require.Len(t, otherTransport.OpenedChannels, 1)
+}
+
+func TestAutoResume(t *testing.T) {
+	testCases := map[string]struct {
+		connectErr        error
+		expectedEvent     datatransfer.EventCode
+		expectedConnects  int
+		expectedRestarted bool
+	}{
+		"resumes in progress channels": {
+			expectedEvent:     datatransfer.Resumed,
+			expectedConnects:  2,
+			expectedRestarted: true,
+		},
+		"reports channels that cannot be resumed": {
+			connectErr:       xerrors.New("no route to peer"),
+			expectedEvent:    datatransfer.ResumeFailed,
+			expectedConnects: 6,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			peers := testutil.GeneratePeers(2)
+			ds := dss.MutexWrap(datastore.NewMapDatastore())
+			storedCounter := storedcounter.New(ds, datastore.NewKey("counter"))
+			voucher := testutil.NewFakeDTType()
+			baseCid := testutil.GenerateCids(1)[0]
+
+			// open a push and a pull channel that are accepted, a channel
+			// that is paused, a channel opened by the other peer and a
+			// channel that is not yet accepted, then abandon the manager as
+			// if the process had stopped
+			oldNetwork := testutil.NewFakeNetwork(peers[0])
+			oldTransport := testutil.NewFakeTransport()
+			dt, err := NewDataTransfer(ds, os.TempDir(), oldNetwork, oldTransport, storedCounter)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt)
+			validator := testutil.NewStubbedValidator()
+			validator.ExpectSuccessPush()
+			require.NoError(t, dt.RegisterVoucherType(voucher, validator))
+			require.NoError(t, dt.RegisterVoucherResultType(voucher))
+			// the channels to resume are found through the channel index,
+			// which is updated after the channel state, so wait for the index
+			waitForStatus := func(chid datatransfer.ChannelID, status datatransfer.Status) {
+				require.Eventually(t, func() bool {
+					chsts, err := dt.ListChannels(ctx, datatransfer.ChannelFilter{Statuses: []datatransfer.Status{status}})
+					require.NoError(t, err)
+					for _, chst := range chsts {
+						if chst.ChannelID() == chid {
+							return true
+						}
+					}
+					return false
+				}, time.Second, 10*time.Millisecond)
+			}
+			accept := func(chid datatransfer.ChannelID, status datatransfer.Status) {
+				response, err := message.NewResponse(chid.ID, true, false, voucher.Type(), voucher)
+				require.NoError(t, err)
+				require.NoError(t, oldTransport.EventHandler.OnResponseReceived(chid, response))
+				waitForStatus(chid, status)
+			}
+			pushChid, err := dt.OpenPushDataChannel(ctx, peers[1], voucher, baseCid, testutil.AllSelector())
+			require.NoError(t, err)
+			accept(pushChid, datatransfer.Ongoing)
+			pullChid, err := dt.OpenPullDataChannel(ctx, peers[1], voucher, baseCid, testutil.AllSelector())
+			require.NoError(t, err)
+			accept(pullChid, datatransfer.Ongoing)
+			pausedChid, err := dt.OpenPullDataChannel(ctx, peers[1], voucher, baseCid, testutil.AllSelector())
+			require.NoError(t, err)
+			accept(pausedChid, datatransfer.Ongoing)
+			require.NoError(t, dt.PauseDataTransferChannel(ctx, pausedChid))
+			waitForStatus(pausedChid, datatransfer.InitiatorPaused)
+			respondingChid := datatransfer.ChannelID{Initiator: peers[1], Responder: peers[0], ID: datatransfer.TransferID(rand.Uint32())}
+			request, err := message.NewRequest(respondingChid.ID, false, false, voucher.Type(), voucher, baseCid, testutil.AllSelector())
+			require.NoError(t, err)
+			_, err = oldTransport.EventHandler.OnRequestReceived(respondingChid, request)
+			require.NoError(t, err)
+			_, err = dt.OpenPushDataChannel(ctx, peers[1], voucher, baseCid, testutil.AllSelector())
+			require.NoError(t, err)
+
+			// start a new manager on the same datastore with auto resume
+			network := testutil.NewFakeNetwork(peers[0])
+			network.ConnectErr = data.connectErr
+			transport := testutil.NewFakeTransport()
+			dt, err = NewDataTransfer(ds, os.TempDir(), network, transport, storedCounter, AutoResume(AutoResumeConfig{
+				MaxConcurrent: 1,
+				MaxAttempts:   3,
+				MinBackoff:    time.Millisecond,
+			}))
+			require.NoError(t, err)
+			require.NoError(t, dt.RegisterVoucherType(voucher, testutil.NewStubbedValidator()))
+
+			resumed := make(chan datatransfer.ChannelState, 2)
+			unsub := dt.SubscribeToEvents(func(event datatransfer.Event, chst datatransfer.ChannelState) {
+				if event.Code == datatransfer.Resumed || event.Code == datatransfer.ResumeFailed {
+					require.Equal(t, data.expectedEvent, event.Code)
+					resumed <- chst
+				}
+			})
+			// the manager keeps running after the test, so stop listening
+			// for the events it publishes once the test is done
+			defer unsub()
+			testutil.StartAndWaitForReady(ctx, t, dt)
+
+			resumedChids := make(map[datatransfer.ChannelID]struct{})
+			for len(resumedChids) < 2 {
+				select {
+				case <-ctx.Done():
+					t.Fatal("did not resume channels")
+				case chst := <-resumed:
+					resumedChids[chst.ChannelID()] = struct{}{}
+					if data.connectErr != nil {
+						require.Contains(t, chst.Message(), data.connectErr.Error())
+					}
+				}
+			}
+			require.Contains(t, resumedChids, pushChid)
+			require.Contains(t, resumedChids, pullChid)
+			require.Equal(t, data.expectedConnects, len(network.ConnectedPeers()))
+
+			// the other channels are left alone
+			select {
+			case chst := <-resumed:
+				t.Fatalf("resumed channel %s with status %s", chst.ChannelID(), datatransfer.Statuses[chst.Status()])
+			case <-time.After(100 * time.Millisecond):
+			}
+			for chid, status := range map[datatransfer.ChannelID]datatransfer.Status{
+				pausedChid:     datatransfer.InitiatorPaused,
+				respondingChid: datatransfer.Ongoing,
+			} {
+				chst, err := dt.ChannelState(ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, status, chst.Status())
+			}
+
+			if data.expectedRestarted {
+				// the pull channel is restarted over the transport
+				require.Len(t, transport.OpenedChannels, 1)
+				require.Equal(t, pullChid, transport.OpenedChannels[0].ChannelID)
+				require.True(t, transport.OpenedChannels[0].Message.(datatransfer.Request).IsRestart())
+
+				// the push channel is restarted with a message
+				require.Len(t, network.SentMessages, 1)
+				require.True(t, network.SentMessages[0].Message.(datatransfer.Request).IsRestart())
+				require.Equal(t, pushChid.ID, network.SentMessages[0].Message.TransferID())
+			} else {
+				require.Empty(t, transport.OpenedChannels)
+				require.Empty(t, network.SentMessages)
+			}
+		})
+	}
+}
@@ -3,12 +3,17 @@ package impl_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"math/rand"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
 	dss "github.com/ipfs/go-datastore/sync"
@@ -23,6 +28,7 @@ import (
 	"github.com/ipfs/go-merkledag"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/protocol"
@@ -40,6 +46,7 @@ import (
 	"github.com/filecoin-project/go-data-transfer/testutil"
 	tp "github.com/filecoin-project/go-data-transfer/transport/graphsync"
 	"github.com/filecoin-project/go-data-transfer/transport/graphsync/extension"
+	"github.com/filecoin-project/go-data-transfer/transport/stream"
 )
 
 const loremFile = "lorem.txt"
@@ -47,17 +54,24 @@ const loremFile = "lorem.txt"
 // nil means use the default protocols
 // tests data transfer for the following protocol combinations:
 // default protocol -> default protocols
+// 1.1 protocols -> default protocols
+// default protocols -> 1.1 protocols
 // old protocol -> default protocols
 // default protocols -> old protocol
 var protocolsForTest = map[string]struct {
 	host1Protocols []protocol.ID
 	host2Protocols []protocol.ID
 }{
-	"(new -> new)":      {nil, nil},
-	"(old -> new, old)": {[]protocol.ID{datatransfer.ProtocolDataTransfer1_0}, nil},
-	"(new, old -> old)": {nil, []protocol.ID{datatransfer.ProtocolDataTransfer1_0}},
+	"(new -> new)":           {nil, nil},
+	"(1.1, old -> new, old)": {protocols1_1, nil},
+	"(new, old -> 1.1, old)": {nil, protocols1_1},
+	"(old -> new, old)":      {[]protocol.ID{datatransfer.ProtocolDataTransfer1_0}, nil},
+	"(new, old -> old)":      {nil, []protocol.ID{datatransfer.ProtocolDataTransfer1_0}},
 }
 
+// protocols1_1 are the protocols of peers that predate the 1.2 protocol
+var protocols1_1 = []protocol.ID{datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0}
+
 func TestRoundTrip(t *testing.T) {
 	ctx := context.Background()
 	testCases := map[string]struct {
@@ -1151,14 +1165,14 @@ func TestUnrecognizedVoucherRoundTrip(t *testing.T) {
 			testutil.StartAndWaitForReady(ctx, t, dt2)
 
 			finished := make(chan struct{}, 2)
-			errChan := make(chan string, 2)
+			errChan := make(chan datatransfer.ChannelState, 2)
 			opened := make(chan struct{}, 2)
 			var subscriber datatransfer.Subscriber = func(event datatransfer.Event, channelState datatransfer.ChannelState) {
 				if channelState.Status() == datatransfer.Failed {
 					finished <- struct{}{}
 				}
 				if event.Code == datatransfer.Error {
-					errChan <- channelState.Message()
+					errChan <- channelState
 				}
 				if event.Code == datatransfer.Open {
 					opened <- struct{}{}
@@ -1188,8 +1202,12 @@ func TestUnrecognizedVoucherRoundTrip(t *testing.T) {
 					finishes++
 				case <-opened:
 					opens++
-				case errMessage := <-errChan:
-					require.Equal(t, errMessage, datatransfer.ErrRejected.Error())
+				case errState := <-errChan:
+					// the responder says why it rejected the request
+					errMessage := errState.Message()
+					require.True(t, strings.HasPrefix(errMessage, datatransfer.ErrRejected.Error()))
+					require.Contains(t, errMessage, "unknown voucher type")
+					require.Equal(t, datatransfer.ErrorUnknownVoucherType, errState.ErrorCode())
 					errMessages = append(errMessages, errMessage)
 					if len(errMessages) > 1 {
 						t.Fatal("too many errors")
@@ -1200,6 +1218,385 @@ func TestUnrecognizedVoucherRoundTrip(t *testing.T) {
 	}
 }
 
+func TestRejectionErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	testCases := map[string]struct {
+		host2Protocols    []protocol.ID
+		validationErr     error
+		expectedErrorCode datatransfer.ErrorCode
+	}{
+		"validation failed": {
+			validationErr:     errors.New("invalid voucher"),
+			expectedErrorCode: datatransfer.ErrorValidationFailed,
+		},
+		"code chosen by validator": {
+			validationErr:     datatransfer.NewCodedError(datatransfer.ErrorResourceExhausted, errors.New("too many transfers")),
+			expectedErrorCode: datatransfer.ErrorResourceExhausted,
+		},
+		"responder without error codes": {
+			host2Protocols:    protocols1_1,
+			validationErr:     datatransfer.NewCodedError(datatransfer.ErrorResourceExhausted, errors.New("too many transfers")),
+			expectedErrorCode: datatransfer.NoError,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, data.host2Protocols)
+			host2 := gsData.Host2
+
+			tp1 := gsData.SetupGSTransportHost1()
+			tp2 := gsData.SetupGSTransportHost2()
+
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1, gsData.StoredCounter1)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2, gsData.StoredCounter2)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+			validator := &fakeErrorValidator{err: data.validationErr}
+			require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, validator))
+
+			errChan := make(chan datatransfer.ChannelState, 1)
+			dt1.SubscribeToEvents(func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+				if event.Code == datatransfer.Error {
+					errChan <- channelState
+				}
+			})
+
+			voucher := testutil.FakeDTType{Data: "applesauce"}
+			_, err = dt1.OpenPushDataChannel(ctx, host2.ID(), &voucher, testutil.GenerateCids(1)[0], gsData.AllSelector)
+			require.NoError(t, err)
+
+			select {
+			case <-ctx.Done():
+				t.Fatal("channel was not rejected")
+			case errState := <-errChan:
+				require.Equal(t, data.expectedErrorCode, errState.ErrorCode())
+				require.True(t, strings.HasPrefix(errState.Message(), datatransfer.ErrRejected.Error()))
+				if data.expectedErrorCode != datatransfer.NoError {
+					require.Contains(t, errState.Message(), data.validationErr.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestIntegrityVerification(t *testing.T) {
+	ctx := context.Background()
+	testCases := map[string]struct {
+		isPull         bool
+		host1Protocols []protocol.ID
+		// missingLeaves is true if the receiver should be missing the leaves
+		// of the data when it computes its receipt
+		missingLeaves bool
+		// customStores is true if the peers should use a store of their own
+		// for the channel, rather than the one graphsync was set up with
+		customStores bool
+	}{
+		"push": {},
+		"pull": {
+			isPull: true,
+		},
+		"push, peers use stores of their own": {
+			customStores: true,
+		},
+		"pull, peers use stores of their own": {
+			isPull:       true,
+			customStores: true,
+		},
+		"push, receiver is missing blocks": {
+			missingLeaves: true,
+		},
+		"pull, responder without receipts": {
+			isPull:         true,
+			host1Protocols: protocols1_1,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, data.host1Protocols, nil)
+			host1 := gsData.Host1 // data sender
+			host2 := gsData.Host2 // data recipient
+
+			tp1 := gsData.SetupGSTransportHost1()
+			tp2 := gsData.SetupGSTransportHost2()
+
+			loader2 := gsData.Loader2
+			if data.missingLeaves {
+				loader2 = func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+					if lnk.(cidlink.Link).Cid.Prefix().Codec == cid.Raw {
+						return nil, errors.New("block not found")
+					}
+					return gsData.Loader2(lnk, lnkCtx)
+				}
+			}
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1, gsData.StoredCounter1, VerifyIntegrity(gsData.Loader1))
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2, gsData.StoredCounter2, VerifyIntegrity(loader2))
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			sourceDagService, destDagService := gsData.DagService1, gsData.DagService2
+			if data.customStores {
+				sourceDagService = useChannelStore(t, dt1)
+				destDagService = useChannelStore(t, dt2)
+			}
+			root, origBytes := testutil.LoadUnixFSFile(ctx, t, sourceDagService, loremFile)
+			rootCid := root.(cidlink.Link).Cid
+			voucher := testutil.FakeDTType{Data: "applesauce"}
+			sv := testutil.NewStubbedValidator()
+
+			var initiator, responder datatransfer.Manager
+			var chid datatransfer.ChannelID
+			if data.isPull {
+				initiator, responder = dt2, dt1
+				sv.ExpectSuccessPull()
+				require.NoError(t, dt1.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+				chid, err = dt2.OpenPullDataChannel(ctx, host1.ID(), &voucher, rootCid, gsData.AllSelector)
+			} else {
+				initiator, responder = dt1, dt2
+				sv.ExpectSuccessPush()
+				require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+				chid, err = dt1.OpenPushDataChannel(ctx, host2.ID(), &voucher, rootCid, gsData.AllSelector)
+			}
+			require.NoError(t, err)
+
+			if !data.missingLeaves {
+				for _, dt := range []datatransfer.Manager{initiator, responder} {
+					require.Eventually(t, func() bool {
+						chst, err := dt.ChannelState(ctx, chid)
+						require.NoError(t, err)
+						require.NotEqual(t, datatransfer.Failed, chst.Status(), chst.Message())
+						return chst.Status() == datatransfer.Completed
+					}, 5*time.Second, 10*time.Millisecond)
+				}
+				testutil.VerifyHasFile(ctx, t, destDagService, root, origBytes)
+				if data.host1Protocols == nil {
+					chst, err := initiator.ChannelState(ctx, chid)
+					require.NoError(t, err)
+					var verified bool
+					for _, entry := range chst.History() {
+						verified = verified || entry.Code == datatransfer.Verified
+					}
+					require.True(t, verified)
+				}
+				return
+			}
+
+			// the receiver finds it is missing blocks when it computes its
+			// receipt, fails the channel, and cancels it with the sender
+			require.Eventually(t, func() bool {
+				chst, err := responder.ChannelState(ctx, chid)
+				require.NoError(t, err)
+				return chst.Status() == datatransfer.Failed
+			}, 5*time.Second, 10*time.Millisecond)
+			chst, err := responder.ChannelState(ctx, chid)
+			require.NoError(t, err)
+			require.Contains(t, chst.Message(), datatransfer.ErrIntegrity.Error())
+			require.Eventually(t, func() bool {
+				chst, err := initiator.ChannelState(ctx, chid)
+				require.NoError(t, err)
+				return chst.ErrorCode() == datatransfer.ErrorIntegrity
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+// useChannelStore makes the graphsync transport of a manager use a new
+// blockstore for its channels, and returns the DAG service for the blockstore
+func useChannelStore(t *testing.T, dt datatransfer.Manager) ipldformat.DAGService {
+	bs := bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	loader := storeutil.LoaderForBlockstore(bs)
+	storer := storeutil.StorerForBlockstore(bs)
+	err := dt.RegisterTransportConfigurer(&testutil.FakeDTType{}, func(channelID datatransfer.ChannelID, testVoucher datatransfer.Voucher, transport datatransfer.Transport) {
+		gsTransport, ok := transport.(*tp.Transport)
+		if ok {
+			require.NoError(t, gsTransport.UseStore(channelID, loader, storer))
+		}
+	})
+	require.NoError(t, err)
+	return merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+}
+
+func TestSignedMessages(t *testing.T) {
+	ctx := context.Background()
+	testCases := map[string]struct {
+		isPull            bool
+		initiatorSigns    bool
+		responderSigns    bool
+		requireSignatures bool
+		// wrongKey is true if the initiator should sign with a key the
+		// responder doesn't know it by
+		wrongKey          bool
+		expectedErrorCode datatransfer.ErrorCode
+	}{
+		"push": {
+			initiatorSigns:    true,
+			responderSigns:    true,
+			requireSignatures: true,
+		},
+		"pull": {
+			isPull:            true,
+			initiatorSigns:    true,
+			responderSigns:    true,
+			requireSignatures: true,
+		},
+		"push, unsigned request": {
+			responderSigns:    true,
+			requireSignatures: true,
+			expectedErrorCode: datatransfer.ErrorInvalidSignature,
+		},
+		"pull, request signed with another key": {
+			isPull:            true,
+			initiatorSigns:    true,
+			responderSigns:    true,
+			wrongKey:          true,
+			expectedErrorCode: datatransfer.ErrorInvalidSignature,
+		},
+		"push, validator requires signed vouchers": {
+			responderSigns:    true,
+			expectedErrorCode: datatransfer.ErrorInvalidSignature,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+			host1 := gsData.Host1 // data sender
+			host2 := gsData.Host2 // data recipient
+
+			tp1 := gsData.SetupGSTransportHost1()
+			tp2 := gsData.SetupGSTransportHost2()
+
+			// the mock hosts have keys that can't sign, so the peers sign
+			// with keys of their own
+			keys := make(map[peer.ID]crypto.PrivKey)
+			for _, p := range []peer.ID{host1.ID(), host2.ID()} {
+				key, _, err := crypto.GenerateEd25519Key(rand.New(rand.NewSource(rand.Int63())))
+				require.NoError(t, err)
+				keys[p] = key
+			}
+			publicKey := func(p peer.ID) (crypto.PubKey, error) {
+				return keys[p].GetPublic(), nil
+			}
+
+			initiatorHost, responderHost := host1, host2
+			if data.isPull {
+				initiatorHost, responderHost = host2, host1
+			}
+			initiatorCfg := SigningConfig{RequireSignatures: data.responderSigns, PublicKey: publicKey}
+			if data.initiatorSigns {
+				initiatorCfg.Key = keys[initiatorHost.ID()]
+				if data.wrongKey {
+					key, _, err := crypto.GenerateEd25519Key(rand.New(rand.NewSource(rand.Int63())))
+					require.NoError(t, err)
+					initiatorCfg.Key = key
+				}
+			}
+			responderCfg := SigningConfig{RequireSignatures: data.requireSignatures, PublicKey: publicKey}
+			if data.responderSigns {
+				responderCfg.Key = keys[responderHost.ID()]
+			}
+			cfg1, cfg2 := initiatorCfg, responderCfg
+			if data.isPull {
+				cfg1, cfg2 = responderCfg, initiatorCfg
+			}
+
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1, gsData.StoredCounter1, MessageSigning(cfg1))
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2, gsData.StoredCounter2, MessageSigning(cfg2))
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			root, _ := testutil.LoadUnixFSFile(ctx, t, gsData.DagService1, loremFile)
+			rootCid := root.(cidlink.Link).Cid
+			voucher := testutil.FakeDTType{Data: "applesauce"}
+			sv := &signatureValidator{StubbedValidator: testutil.NewStubbedValidator()}
+
+			var initiator, responder datatransfer.Manager
+			var chid datatransfer.ChannelID
+			if data.isPull {
+				initiator, responder = dt2, dt1
+				sv.StubSuccessPull()
+				require.NoError(t, dt1.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+				chid, err = dt2.OpenPullDataChannel(ctx, host1.ID(), &voucher, rootCid, gsData.AllSelector)
+			} else {
+				initiator, responder = dt1, dt2
+				sv.StubSuccessPush()
+				require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+				chid, err = dt1.OpenPushDataChannel(ctx, host2.ID(), &voucher, rootCid, gsData.AllSelector)
+			}
+			require.NoError(t, err)
+
+			if data.expectedErrorCode != datatransfer.NoError {
+				require.Eventually(t, func() bool {
+					chst, err := initiator.ChannelState(ctx, chid)
+					require.NoError(t, err)
+					return chst.Status() == datatransfer.Failed
+				}, 5*time.Second, 10*time.Millisecond)
+				chst, err := initiator.ChannelState(ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, data.expectedErrorCode, chst.ErrorCode())
+				return
+			}
+
+			for _, dt := range []datatransfer.Manager{initiator, responder} {
+				require.Eventually(t, func() bool {
+					chst, err := dt.ChannelState(ctx, chid)
+					require.NoError(t, err)
+					require.NotEqual(t, datatransfer.Failed, chst.Status(), chst.Message())
+					return chst.Status() == datatransfer.Completed
+				}, 5*time.Second, 10*time.Millisecond)
+			}
+			sv.lk.Lock()
+			defer sv.lk.Unlock()
+			require.Len(t, sv.signatures, 1)
+			require.NotEmpty(t, sv.signatures[0])
+		})
+	}
+}
+
+// signatureValidator only accepts vouchers sent in signed requests, and
+// records their signatures
+type signatureValidator struct {
+	*testutil.StubbedValidator
+	lk         sync.Mutex
+	signatures [][]byte
+}
+
+func (sv *signatureValidator) ValidateSignature(chid datatransfer.ChannelID, sender peer.ID, voucher datatransfer.Voucher, signature []byte) error {
+	sv.lk.Lock()
+	defer sv.lk.Unlock()
+	if len(signature) == 0 {
+		return errors.New("voucher was not sent in a signed request")
+	}
+	sv.signatures = append(sv.signatures, signature)
+	return nil
+}
+
+// fakeErrorValidator rejects every request with the same error
+type fakeErrorValidator struct {
+	err error
+}
+
+func (v *fakeErrorValidator) ValidatePush(peer.ID, datatransfer.Voucher, cid.Cid, ipld.Node) (datatransfer.VoucherResult, error) {
+	return nil, v.err
+}
+
+func (v *fakeErrorValidator) ValidatePull(peer.ID, datatransfer.Voucher, cid.Cid, ipld.Node) (datatransfer.VoucherResult, error) {
+	return nil, v.err
+}
+
 func TestDataTransferSubscribing(t *testing.T) {
 	// create network
 	ctx := context.Background()
@@ -1379,7 +1776,7 @@ func TestRespondingToPushGraphsyncRequests(t *testing.T) {
 		extData := buf.Bytes()
 
 		request := gsmsg.NewRequest(graphsync.RequestID(rand.Int31()), link.(cidlink.Link).Cid, gsData.AllSelector, graphsync.Priority(rand.Int31()), graphsync.ExtensionData{
-			Name: extension.ExtensionDataTransfer1_1,
+			Name: extension.ExtensionDataTransfer1_2,
 			Data: extData,
 		})
 		builder := gsmsg.NewBuilder(0)
@@ -1401,7 +1798,7 @@ func TestRespondingToPushGraphsyncRequests(t *testing.T) {
 		extData := buf.Bytes()
 
 		request := gsmsg.NewRequest(graphsync.RequestID(rand.Int31()), link.(cidlink.Link).Cid, gsData.AllSelector, graphsync.Priority(rand.Int31()), graphsync.ExtensionData{
-			Name: extension.ExtensionDataTransfer1_1,
+			Name: extension.ExtensionDataTransfer1_2,
 			Data: extData,
 		})
 		builder := gsmsg.NewBuilder(0)
@@ -1497,7 +1894,7 @@ func TestRespondingToPullGraphsyncRequests(t *testing.T) {
 				extData := buf.Bytes()
 
 				gsRequest := gsmsg.NewRequest(graphsync.RequestID(rand.Int31()), link.(cidlink.Link).Cid, gsData.AllSelector, graphsync.Priority(rand.Int31()), graphsync.ExtensionData{
-					Name: extension.ExtensionDataTransfer1_1,
+					Name: extension.ExtensionDataTransfer1_2,
 					Data: extData,
 				})
 
@@ -1528,7 +1925,7 @@ func TestRespondingToPullGraphsyncRequests(t *testing.T) {
 				require.NoError(t, err)
 				extData := buf.Bytes()
 				request := gsmsg.NewRequest(graphsync.RequestID(rand.Int31()), link.(cidlink.Link).Cid, gsData.AllSelector, graphsync.Priority(rand.Int31()), graphsync.ExtensionData{
-					Name: extension.ExtensionDataTransfer1_1,
+					Name: extension.ExtensionDataTransfer1_2,
 					Data: extData,
 				})
 				builder := gsmsg.NewBuilder(0)
@@ -1617,3 +2014,217 @@ func (r *receiver) ReceiveRestartExistingChannelRequest(ctx context.Context,
 //	_ = logging.SetLogLevel("data_transfer", "debug")
 //	_ = logging.SetLogLevel("data_transfer_network", "debug")
 //}
+
+func TestStreamTransportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, isPull := range []bool{false, true} {
+		name := "push"
+		if isPull {
+			name = "pull"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+			host1 := gsData.Host1 // initiator, data sender
+			host2 := gsData.Host2 // data recipient
+
+			tp1 := stream.NewTransport(host1, gsData.Loader1, gsData.Storer1)
+			tp2 := stream.NewTransport(host2, gsData.Loader2, gsData.Storer2)
+
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1, gsData.StoredCounter1)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2, gsData.StoredCounter2)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			finished := make(chan struct{}, 2)
+			errChan := make(chan string, 2)
+			var subscriber datatransfer.Subscriber = func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+				if channelState.Status() == datatransfer.Completed {
+					finished <- struct{}{}
+				}
+				if event.Code == datatransfer.Error {
+					errChan <- event.Message
+				}
+			}
+			dt1.SubscribeToEvents(subscriber)
+			dt2.SubscribeToEvents(subscriber)
+
+			root := gsData.LoadUnixFSFile(t, false)
+			rootCid := root.(cidlink.Link).Cid
+			voucher := testutil.FakeDTType{Data: "applesauce"}
+			sv := testutil.NewStubbedValidator()
+
+			if isPull {
+				sv.ExpectSuccessPull()
+				require.NoError(t, dt1.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+				_, err = dt2.OpenPullDataChannel(ctx, host1.ID(), &voucher, rootCid, gsData.AllSelector)
+			} else {
+				sv.ExpectSuccessPush()
+				require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+				_, err = dt1.OpenPushDataChannel(ctx, host2.ID(), &voucher, rootCid, gsData.AllSelector)
+			}
+			require.NoError(t, err)
+
+			completes := 0
+			for completes < 2 {
+				select {
+				case <-ctx.Done():
+					t.Fatal("Did not complete successful data transfer")
+				case <-finished:
+					completes++
+				case msg := <-errChan:
+					t.Fatalf("received error on data transfer: %s", msg)
+				}
+			}
+			gsData.VerifyFileTransferred(t, root, true)
+		})
+	}
+}
+
+func TestMultipleTransports(t *testing.T) {
+	ctx := context.Background()
+	testCases := map[string]struct {
+		isPull                bool
+		options               []datatransfer.ChannelOption
+		voucherTransport      bool
+		responderNoStream     bool
+		host2Protocols        []protocol.ID
+		expectedTransport     datatransfer.TransportID
+		expectedRespTransport datatransfer.TransportID
+	}{
+		"push over default transport": {
+			expectedTransport:     datatransfer.DefaultTransport,
+			expectedRespTransport: datatransfer.DefaultTransport,
+		},
+		"push over selected transport": {
+			options:               []datatransfer.ChannelOption{datatransfer.UseTransport(stream.TransportID)},
+			expectedTransport:     stream.TransportID,
+			expectedRespTransport: stream.TransportID,
+		},
+		"pull over selected transport": {
+			isPull:                true,
+			options:               []datatransfer.ChannelOption{datatransfer.UseTransport(stream.TransportID)},
+			expectedTransport:     stream.TransportID,
+			expectedRespTransport: stream.TransportID,
+		},
+		"pull over transport for voucher type": {
+			isPull:                true,
+			voucherTransport:      true,
+			expectedTransport:     stream.TransportID,
+			expectedRespTransport: stream.TransportID,
+		},
+		"push falls back to transport supported by responder": {
+			options:               []datatransfer.ChannelOption{datatransfer.UseTransport(stream.TransportID)},
+			responderNoStream:     true,
+			expectedTransport:     datatransfer.DefaultTransport,
+			expectedRespTransport: datatransfer.DefaultTransport,
+		},
+		"push to responder without transport selection": {
+			options:               []datatransfer.ChannelOption{datatransfer.UseTransport(stream.TransportID)},
+			host2Protocols:        protocols1_1,
+			expectedTransport:     datatransfer.DefaultTransport,
+			expectedRespTransport: datatransfer.DefaultTransport,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, data.host2Protocols)
+			host1 := gsData.Host1 // initiator
+			host2 := gsData.Host2 // responder
+
+			voucher := testutil.FakeDTType{Data: "applesauce"}
+
+			initiatorOpts := []DataTransferOption{
+				Transport(stream.TransportID, stream.NewTransport(host1, gsData.Loader1, gsData.Storer1)),
+			}
+			if data.voucherTransport {
+				initiatorOpts = append(initiatorOpts, TransportForVoucherType(voucher.Type(), stream.TransportID))
+			}
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, gsData.SetupGSTransportHost1(), gsData.StoredCounter1, initiatorOpts...)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+
+			var responderOpts []DataTransferOption
+			if !data.responderNoStream {
+				responderOpts = append(responderOpts, Transport(stream.TransportID, stream.NewTransport(host2, gsData.Loader2, gsData.Storer2)))
+			}
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, gsData.SetupGSTransportHost2(), gsData.StoredCounter2, responderOpts...)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			finished := make(chan datatransfer.ChannelState, 2)
+			errChan := make(chan string, 2)
+			var subscriber datatransfer.Subscriber = func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+				if channelState.Status() == datatransfer.Completed {
+					finished <- channelState
+				}
+				if event.Code == datatransfer.Error {
+					errChan <- event.Message
+				}
+			}
+			dt1.SubscribeToEvents(subscriber)
+			dt2.SubscribeToEvents(subscriber)
+
+			sv := testutil.NewStubbedValidator()
+			require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+
+			var root ipld.Link
+			if data.isPull {
+				sv.ExpectSuccessPull()
+				// the responder sends the data
+				root = gsData.LoadUnixFSFile(t, true)
+				_, err = dt1.OpenPullDataChannelWithOptions(ctx, host2.ID(), &voucher, root.(cidlink.Link).Cid, gsData.AllSelector, data.options...)
+			} else {
+				sv.ExpectSuccessPush()
+				root = gsData.LoadUnixFSFile(t, false)
+				_, err = dt1.OpenPushDataChannelWithOptions(ctx, host2.ID(), &voucher, root.(cidlink.Link).Cid, gsData.AllSelector, data.options...)
+			}
+			require.NoError(t, err)
+
+			for completes := 0; completes < 2; completes++ {
+				select {
+				case <-ctx.Done():
+					t.Fatal("Did not complete successful data transfer")
+				case chst := <-finished:
+					if chst.SelfPeer() == host1.ID() {
+						require.Equal(t, data.expectedTransport, chst.Transport())
+					} else {
+						require.Equal(t, data.expectedRespTransport, chst.Transport())
+					}
+				case msg := <-errChan:
+					t.Fatalf("received error on data transfer: %s", msg)
+				}
+			}
+			gsData.VerifyFileTransferred(t, root, !data.isPull)
+		})
+	}
+}
+
+func TestUnregisteredTransport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+	voucher := testutil.FakeDTType{Data: "applesauce"}
+
+	// a voucher type cannot select a transport that is not registered
+	_, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, gsData.SetupGSTransportHost1(), gsData.StoredCounter1,
+		TransportForVoucherType(voucher.Type(), stream.TransportID))
+	require.Error(t, err)
+
+	// nor can a channel
+	dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, gsData.SetupGSTransportHost1(), gsData.StoredCounter1)
+	require.NoError(t, err)
+	testutil.StartAndWaitForReady(ctx, t, dt1)
+	root := gsData.LoadUnixFSFile(t, false)
+	_, err = dt1.OpenPushDataChannelWithOptions(ctx, gsData.Host2.ID(), &voucher, root.(cidlink.Link).Cid, gsData.AllSelector,
+		datatransfer.UseTransport(stream.TransportID))
+	require.Error(t, err)
+}
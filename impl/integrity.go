@@ -0,0 +1,262 @@
+package impl
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipld/go-ipld-prime"
+	dagpb "github.com/ipld/go-ipld-prime-proto"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+)
+
+// VerifyIntegrity makes the manager check that both peers hold the same data
+// for a channel once it has been transferred. The responder traverses the
+// channel's selector over the blocks it has, which it loads with the loader
+// the channel's transport uses for the channel, or else with the given loader,
+// and sends the initiator a receipt for them in the complete message.
+// The initiator computes the receipt for its own blocks and fails the channel
+// with datatransfer.ErrIntegrity if they differ. A receiver that is missing
+// blocks of the data fails the channel too.
+// The data is only verified when both peers have the option and support the
+// 1.2 protocol.
+func VerifyIntegrity(loader ipld.Loader) DataTransferOption {
+	return func(m *manager) {
+		m.integrityLoader = loader
+	}
+}
+
+var receiptChooser traversal.LinkTargetNodePrototypeChooser = dagpb.AddDagPBSupportToChooser(func(ipld.Link, ipld.LinkContext) (ipld.NodePrototype, error) {
+	return basicnode.Prototype.Any, nil
+})
+
+// verification is the state of the verification of a channel initiated by
+// this node, which can only happen once the responder's receipt has arrived
+// and this node has finished the transfer
+type verification struct {
+	receipt  *datatransfer.Receipt
+	finished bool
+	verified bool
+}
+
+// computeReceipt traverses the selector from the root over the blocks the
+// loader loads, and returns the receipt for the blocks it loaded
+func computeReceipt(ctx context.Context, loader ipld.Loader, root cid.Cid, stor ipld.Node) (datatransfer.Receipt, error) {
+	sel, err := selector.ParseSelector(stor)
+	if err != nil {
+		return datatransfer.Receipt{}, xerrors.Errorf("parsing selector: %w", err)
+	}
+
+	hash := sha256.New()
+	_, _ = hash.Write(root.Bytes())
+	if err := dagcbor.Encoder(stor, hash); err != nil {
+		return datatransfer.Receipt{}, xerrors.Errorf("encoding selector: %w", err)
+	}
+
+	var receipt datatransfer.Receipt
+	countingLoader := func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+		asCidLink, ok := lnk.(cidlink.Link)
+		if !ok {
+			return nil, xerrors.Errorf("unsupported link type %T", lnk)
+		}
+		r, err := loader(lnk, lnkCtx)
+		if err != nil {
+			return nil, xerrors.Errorf("loading block %s: %w", asCidLink.Cid, err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, xerrors.Errorf("reading block %s: %w", asCidLink.Cid, err)
+		}
+		receipt.Blocks++
+		receipt.Bytes += uint64(len(data))
+		_, _ = hash.Write(asCidLink.Cid.Bytes())
+		return bytes.NewReader(data), nil
+	}
+
+	rootLink := cidlink.Link{Cid: root}
+	proto, err := receiptChooser(rootLink, ipld.LinkContext{})
+	if err != nil {
+		return datatransfer.Receipt{}, err
+	}
+	nb := proto.NewBuilder()
+	if err := rootLink.Load(ctx, ipld.LinkContext{}, nb, countingLoader); err != nil {
+		return datatransfer.Receipt{}, err
+	}
+	err = traversal.Progress{
+		Cfg: &traversal.Config{
+			Ctx:                            ctx,
+			LinkLoader:                     countingLoader,
+			LinkTargetNodePrototypeChooser: receiptChooser,
+		},
+	}.WalkAdv(nb.Build(), sel, func(traversal.Progress, ipld.Node, traversal.VisitReason) error {
+		return nil
+	})
+	if err != nil {
+		return datatransfer.Receipt{}, err
+	}
+	receipt.Hash = hash.Sum(nil)
+	return receipt, nil
+}
+
+// receiptLoader returns the loader for the blocks of a channel, which is the
+// loader of the store its transport uses for it if the transport knows it
+func (m *manager) receiptLoader(chid datatransfer.ChannelID) ipld.Loader {
+	if lt, ok := m.transportFor(chid).(datatransfer.LoaderTransport); ok {
+		if loader := lt.ChannelLoader(chid); loader != nil {
+			return loader
+		}
+	}
+	return m.integrityLoader
+}
+
+// channelReceipt computes the receipt for the data of a channel from the
+// blocks the loader loads
+func (m *manager) channelReceipt(ctx context.Context, chid datatransfer.ChannelID, loader ipld.Loader) (datatransfer.Receipt, error) {
+	chst, err := m.channels.GetByID(ctx, chid)
+	if err != nil {
+		return datatransfer.Receipt{}, err
+	}
+	return computeReceipt(ctx, loader, chst.BaseCID(), chst.Selector())
+}
+
+// sendReceipt computes the receipt for the data of a channel initiated by the
+// other peer in the background, as the selector traversal can take a while,
+// and then sends the complete message with the receipt
+func (m *manager) sendReceipt(chid datatransfer.ChannelID, msg datatransfer.Response) {
+	// the store of the channel is resolved now, before the transport can
+	// forget it
+	loader := m.receiptLoader(chid)
+	go func() {
+		receipt, err := m.channelReceipt(m.bgCtx, chid, loader)
+		if err != nil {
+			log.Warnf("channel %s: unable to compute receipt: %s", chid, err)
+			if err := m.failIntegrity(chid, fmt.Errorf("%w: %s", datatransfer.ErrIntegrity, err)); err != nil {
+				log.Warnf("channel %s: unable to fail channel: %s", chid, err)
+			}
+			return
+		}
+		if err := m.sendCompleteMessage(m.bgCtx, chid, message.WithResponseReceipt(msg, receipt)); err != nil {
+			log.Warnf("channel %s: unable to complete channel: %s", chid, err)
+		}
+	}()
+}
+
+// receiveReceipt records the receipt in the complete message of a channel
+// initiated by this node, and verifies the channel if this node has finished
+// the transfer. The then function is called once the channel is verified, or
+// right away if it is not verified yet.
+func (m *manager) receiveReceipt(chid datatransfer.ChannelID, receipt *datatransfer.Receipt, then func() error) error {
+	if m.integrityLoader == nil || receipt == nil {
+		return then()
+	}
+	return m.updateVerification(chid, func(v *verification) {
+		v.receipt = receipt
+	}, then)
+}
+
+// finishVerification records that this node has finished the transfer for a
+// channel it initiated, and verifies the channel if the responder's receipt
+// has arrived. The then function is called once the channel is verified, or
+// right away if it is not verified yet.
+func (m *manager) finishVerification(chid datatransfer.ChannelID, then func() error) error {
+	if m.integrityLoader == nil {
+		return then()
+	}
+	return m.updateVerification(chid, func(v *verification) {
+		v.finished = true
+	}, then)
+}
+
+// updateVerification updates the state of the verification of a channel. The
+// first time both the receipt has arrived and the transfer has finished, it
+// verifies the channel in the background, as the selector traversal can take
+// a while, and calls the then function if the channel passes. Otherwise it
+// calls the then function right away.
+func (m *manager) updateVerification(chid datatransfer.ChannelID, update func(*verification), then func() error) error {
+	m.verificationsLk.Lock()
+	v, ok := m.verifications[chid]
+	if !ok {
+		v = &verification{}
+		m.verifications[chid] = v
+	}
+	update(v)
+	ready := !v.verified && v.finished && v.receipt != nil
+	if ready {
+		v.verified = true
+	}
+	receipt := v.receipt
+	m.verificationsLk.Unlock()
+	if !ready {
+		return then()
+	}
+
+	loader := m.receiptLoader(chid)
+	go func() {
+		if err := m.verifyReceipt(chid, receipt, loader); err != nil {
+			log.Warnf("channel %s: %s", chid, err)
+			return
+		}
+		if err := then(); err != nil {
+			log.Warnf("channel %s: %s", chid, err)
+		}
+	}()
+	return nil
+}
+
+// verifyReceipt compares the receipt the responder sent for a channel with
+// the receipt for the blocks this node has, and fails the channel if they
+// differ. It returns an error if the channel was not verified.
+func (m *manager) verifyReceipt(chid datatransfer.ChannelID, receipt *datatransfer.Receipt, loader ipld.Loader) error {
+	local, err := m.channelReceipt(m.bgCtx, chid, loader)
+	if err != nil {
+		log.Warnf("channel %s: unable to compute receipt: %s", chid, err)
+		if failErr := m.failIntegrity(chid, fmt.Errorf("%w: %s", datatransfer.ErrIntegrity, err)); failErr != nil {
+			return failErr
+		}
+		return datatransfer.ErrIntegrity
+	}
+	if !local.Equals(*receipt) {
+		log.Warnf("channel %s: responder's receipt for %d blocks (%d bytes) does not match receipt for %d blocks (%d bytes)",
+			chid, receipt.Blocks, receipt.Bytes, local.Blocks, local.Bytes)
+		if failErr := m.failIntegrity(chid, datatransfer.ErrIntegrity); failErr != nil {
+			return failErr
+		}
+		return datatransfer.ErrIntegrity
+	}
+	log.Infof("channel %s: verified %d blocks (%d bytes) against responder's receipt", chid, local.Blocks, local.Bytes)
+	return m.channels.Verified(chid)
+}
+
+// failIntegrity fails a channel whose data could not be verified, and
+// cancels it with the other peer
+func (m *manager) failIntegrity(chid datatransfer.ChannelID, err error) error {
+	cherr := datatransfer.NewCodedError(datatransfer.ErrorIntegrity, err)
+	// the cancel message is sent in the background as events for the channel
+	// are still being processed
+	go func() {
+		if err := m.sendMessage(m.bgCtx, chid, chid.OtherParty(m.peerID), m.cancelWithErrorMessage(chid, cherr)); err != nil {
+			log.Warnf("channel %s: unable to send cancel message for failed verification: %s", chid, err)
+		}
+	}()
+	return m.channels.Error(chid, cherr)
+}
+
+// forgetVerification forgets the state of the verification of a channel
+func (m *manager) forgetVerification(chid datatransfer.ChannelID) {
+	m.verificationsLk.Lock()
+	defer m.verificationsLk.Unlock()
+
+	delete(m.verifications, chid)
+}
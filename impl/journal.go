@@ -0,0 +1,171 @@
+package impl
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/journal"
+)
+
+// EventJournal records the events of channels in a journal in the datastore,
+// which gives each event a sequence number, so that subscribers can replay
+// the events they missed with SubscribeToEventsFrom. Events are trimmed from
+// the journal according to the retention policy when the manager starts, and
+// then at every trim interval (or hourly if the interval is zero).
+func EventJournal(policy journal.RetentionPolicy, trimInterval time.Duration) DataTransferOption {
+	return func(m *manager) {
+		m.journalPolicy = &policy
+		if trimInterval > 0 {
+			m.journalTrimInterval = trimInterval
+		}
+	}
+}
+
+// DefaultJournalExcludedEvents are the events that are not recorded in the
+// event journal by default: the events fired for every block, which would
+// fill the journal without saying much about the channel when replayed
+var DefaultJournalExcludedEvents = []datatransfer.EventCode{
+	datatransfer.DataQueued,
+	datatransfer.DataQueuedProgress,
+	datatransfer.DataSent,
+	datatransfer.DataSentProgress,
+	datatransfer.DataReceived,
+	datatransfer.DataReceivedProgress,
+}
+
+// EventJournalExclude sets the events that are not recorded in the event
+// journal, in place of DefaultJournalExcludedEvents. Events that are not
+// recorded have no sequence number and are not replayed. With no codes,
+// every event is recorded.
+func EventJournalExclude(codes ...datatransfer.EventCode) DataTransferOption {
+	return func(m *manager) {
+		m.journalExcluded = eventCodeSet(codes)
+	}
+}
+
+func eventCodeSet(codes []datatransfer.EventCode) map[datatransfer.EventCode]struct{} {
+	set := make(map[datatransfer.EventCode]struct{}, len(codes))
+	for _, code := range codes {
+		set[code] = struct{}{}
+	}
+	return set
+}
+
+// recordEvent records an event in the journal, if there is one and the event
+// is not excluded from it, and sets the sequence number of the event
+func (m *manager) recordEvent(evt *datatransfer.Event, chst datatransfer.ChannelState) {
+	if m.journal == nil {
+		return
+	}
+	if _, ok := m.journalExcluded[evt.Code]; ok {
+		return
+	}
+	seq, err := m.journal.Append(chst.ChannelID(), *evt)
+	if err != nil {
+		log.Errorf("channel %s: recording %s event in event journal: %s", chst.ChannelID(), datatransfer.Events[evt.Code], err)
+		return
+	}
+	evt.Seq = seq
+}
+
+// trimEventJournal periodically trims the event journal according to its
+// retention policy, until the manager is stopped
+func (m *manager) trimEventJournal() {
+	ticker := time.NewTicker(m.journalTrimInterval)
+	defer ticker.Stop()
+
+	for {
+		trimmed, err := m.journal.Trim(*m.journalPolicy)
+		if err != nil {
+			log.Errorf("trimming event journal: %s", err)
+		}
+		if trimmed > 0 {
+			log.Infof("trimmed %d events from event journal", trimmed)
+		}
+
+		select {
+		case <-m.bgCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replaySubscriber holds back the events published while a subscriber is
+// replaying events from the journal, and skips the ones it replayed
+type replaySubscriber struct {
+	fn datatransfer.Subscriber
+
+	lk         sync.Mutex
+	replaying  bool
+	replayedTo uint64
+	held       []queuedEvent
+}
+
+func (rs *replaySubscriber) receive(evt datatransfer.Event, chst datatransfer.ChannelState) {
+	rs.lk.Lock()
+	defer rs.lk.Unlock()
+
+	if rs.replaying {
+		rs.held = append(rs.held, queuedEvent{evt, chst})
+		return
+	}
+	rs.deliver(evt, chst)
+}
+
+func (rs *replaySubscriber) deliver(evt datatransfer.Event, chst datatransfer.ChannelState) {
+	if evt.Seq != 0 && evt.Seq <= rs.replayedTo {
+		return
+	}
+	rs.fn(evt, chst)
+}
+
+// finishReplay delivers the events held back while replaying
+func (rs *replaySubscriber) finishReplay() {
+	rs.lk.Lock()
+	defer rs.lk.Unlock()
+
+	for _, qe := range rs.held {
+		rs.deliver(qe.evt, qe.chst)
+	}
+	rs.held = nil
+	rs.replaying = false
+}
+
+// SubscribeToEventsFrom calls the subscriber with the events in the journal
+// that have a sequence number of at least seq, and then with events as they
+// happen. Replayed events are passed the current state of their channel, and
+// events of channels that have since been purged are skipped.
+func (m *manager) SubscribeToEventsFrom(seq uint64, subscriber datatransfer.Subscriber) (datatransfer.Unsubscribe, error) {
+	if m.journal == nil {
+		return nil, xerrors.New("the event journal is not enabled")
+	}
+
+	rs := &replaySubscriber{fn: subscriber, replaying: true}
+	unsub := m.subscriptions.subscribe(rs.receive)
+	// events up to the last one in the journal are replayed, and any later
+	// events are published to the subscriber
+	rs.replayedTo = m.journal.LastSeq()
+	err := m.journal.ForEach(seq, rs.replayedTo, func(entry *journal.Entry) error {
+		chst, err := m.channels.GetByID(m.bgCtx, entry.ChannelID)
+		if err != nil {
+			var notFound *channels.ErrNotFound
+			if xerrors.As(err, &notFound) {
+				return nil
+			}
+			return err
+		}
+		subscriber(entry.Event(), chst)
+		return nil
+	})
+	if err != nil {
+		unsub()
+		return nil, xerrors.Errorf("replaying events from event journal: %w", err)
+	}
+	rs.finishReplay()
+	return unsub, nil
+}
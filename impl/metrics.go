@@ -0,0 +1,60 @@
+package impl
+
+import (
+	"context"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/metrics"
+)
+
+// initChannelMetrics starts counting the channels that existed before the
+// manager started
+func (m *manager) initChannelMetrics(ctx context.Context) {
+	statuses, err := m.channels.Statuses(ctx)
+	if err != nil {
+		log.Warnf("unable to count channels for metrics: %s", err)
+		return
+	}
+	m.channelCounter.Init(statuses, channels.IsChannelTerminated)
+}
+
+// recordEventMetrics records metrics for a channel event
+func (m *manager) recordEventMetrics(evt datatransfer.Event, chst datatransfer.ChannelState) {
+	if evt.Code == datatransfer.Purged {
+		m.channelCounter.Remove(chst.ChannelID(), chst.Status())
+		return
+	}
+	if channels.IsChannelTerminated(chst.Status()) {
+		m.channelCounter.Finish(chst.ChannelID(), chst.Status())
+	} else {
+		m.channelCounter.Update(chst.ChannelID(), chst.Status())
+	}
+
+	switch evt.Code {
+	case datatransfer.Restart:
+		m.metricsRecorder.ChannelRestarted(metrics.DirectionOf(chst))
+	case datatransfer.PauseInitiator, datatransfer.PauseResponder:
+		m.metricsRecorder.ChannelPaused(metrics.DirectionOf(chst))
+	case datatransfer.ResumeInitiator, datatransfer.ResumeResponder:
+		m.metricsRecorder.ChannelResumed(metrics.DirectionOf(chst))
+	}
+}
+
+// sendingDirection returns the direction of a channel on which the local
+// peer is sending data
+func (m *manager) sendingDirection(chid datatransfer.ChannelID) metrics.Direction {
+	if chid.Initiator == m.peerID {
+		return metrics.Push
+	}
+	return metrics.Pull
+}
+
+// receivingDirection returns the direction of a channel on which the local
+// peer is receiving data
+func (m *manager) receivingDirection(chid datatransfer.ChannelID) metrics.Direction {
+	if chid.Initiator == m.peerID {
+		return metrics.Pull
+	}
+	return metrics.Push
+}
@@ -0,0 +1,72 @@
+package impl
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+)
+
+// channelOptions applies the given options to the default channel options
+func channelOptions(options []datatransfer.ChannelOption) datatransfer.ChannelOptions {
+	var opts datatransfer.ChannelOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	return opts
+}
+
+// checkInitialPause returns an error if a channel is to be opened paused,
+// but the transport or the other peer cannot pause channels
+func (m *manager) checkInitialPause(to peer.ID, transport datatransfer.TransportID, opts datatransfer.ChannelOptions) error {
+	if !opts.Paused {
+		return nil
+	}
+	if _, ok := m.transportByID(transport).(datatransfer.PauseableTransport); !ok {
+		return xerrors.Errorf("transport %q cannot pause channels: %w", transport, datatransfer.ErrUnsupported)
+	}
+	if caps, ok := m.PeerCapabilities(to); ok && !caps.Pause {
+		return xerrors.Errorf("peer %s cannot pause channels: %w", to, datatransfer.ErrUnsupported)
+	}
+	return nil
+}
+
+// withChannelOptions sets the options of a channel that are sent to the
+// responder on the request that opens it
+func withChannelOptions(req datatransfer.Request, opts datatransfer.ChannelOptions) datatransfer.Request {
+	req = message.WithRequestPriority(req, opts.Priority)
+	req = message.WithRequestTotalSize(req, opts.TotalSize)
+	if opts.Paused {
+		req = message.WithRequestPaused(req)
+	}
+	return req
+}
+
+// applyChannelOptions applies the options of a channel this node opened
+// once the channel has been created
+func (m *manager) applyChannelOptions(chid datatransfer.ChannelID, opts datatransfer.ChannelOptions) error {
+	if opts.Paused {
+		if err := m.channels.PauseInitiator(chid); err != nil {
+			return err
+		}
+	}
+	if opts.Timeout > 0 {
+		m.startChannelTimeout(chid, opts.Timeout)
+	}
+	return nil
+}
+
+// pauseOpenedChannel returns datatransfer.ErrPause if this node opened a
+// push channel paused, so that the transport does not start sending data
+// when the responder accepts the channel
+func (m *manager) pauseOpenedChannel(chid datatransfer.ChannelID) error {
+	chst, err := m.channels.GetByID(m.bgCtx, chid)
+	if err != nil {
+		return err
+	}
+	if chst.IsPull() || !m.pausedBySelf(chst) {
+		return nil
+	}
+	return datatransfer.ErrPause
+}
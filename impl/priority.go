@@ -0,0 +1,161 @@
+package impl
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// maxPriorityDelayFactor is the most times longer a throttled channel waits
+// to transfer more data than a channel with the highest priority
+const maxPriorityDelayFactor = 4
+
+// The default range of the priorities other peers can set on the channels
+// they open
+const (
+	defaultMinPriority = -1000
+	defaultMaxPriority = 1000
+)
+
+// PriorityRange limits the priorities other peers can set on the channels
+// they open to the range from min to max. Priorities outside the range are
+// clamped to it (defaults to -1000 to 1000).
+func PriorityRange(min, max int) DataTransferOption {
+	return func(m *manager) {
+		if min > max {
+			min, max = max, min
+		}
+		m.priorities.min = min
+		m.priorities.max = max
+	}
+}
+
+// transferringWindow is how recently a channel must have transferred data
+// to count as transferring
+const transferringWindow = time.Second
+
+// trackedChannel is a channel opened by another peer that is in progress
+type trackedChannel struct {
+	priority int
+	lastData time.Time
+}
+
+// priorities tracks the priorities of the channels opened by other peers
+// that are in progress, so that channels with a higher priority get more of
+// the bandwidth when the manager is short of it
+type priorities struct {
+	min int
+	max int
+
+	lk       sync.Mutex
+	now      func() time.Time
+	channels map[datatransfer.ChannelID]*trackedChannel
+}
+
+func newPriorities() *priorities {
+	return &priorities{
+		min:      defaultMinPriority,
+		max:      defaultMaxPriority,
+		now:      time.Now,
+		channels: make(map[datatransfer.ChannelID]*trackedChannel),
+	}
+}
+
+// clamp limits a priority set by another peer to the configured range
+func (p *priorities) clamp(priority int) int {
+	if priority < p.min {
+		return p.min
+	}
+	if priority > p.max {
+		return p.max
+	}
+	return priority
+}
+
+// add starts tracking a channel that is in progress. The priority is clamped
+// to the configured range, as it may have been stored before the range was.
+func (p *priorities) add(chid datatransfer.ChannelID, priority int) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if _, ok := p.channels[chid]; ok {
+		return
+	}
+	p.channels[chid] = &trackedChannel{priority: p.clamp(priority)}
+}
+
+// remove stops tracking a channel
+func (p *priorities) remove(chid datatransfer.ChannelID) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	delete(p.channels, chid)
+}
+
+// transferred records that a channel transferred data
+func (p *priorities) transferred(chid datatransfer.ChannelID) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if ch, ok := p.channels[chid]; ok {
+		ch.lastData = p.now()
+	}
+}
+
+// transferring returns true if the channel transferred data recently
+func (p *priorities) transferring(ch *trackedChannel, now time.Time) bool {
+	return !ch.lastData.IsZero() && now.Sub(ch.lastData) < transferringWindow
+}
+
+// lowerPriority returns the channels that have a lower priority than the
+// given channel and are transferring data, lowest priority first. It
+// returns nil if the channel is not tracked.
+func (p *priorities) lowerPriority(chid datatransfer.ChannelID) []datatransfer.ChannelID {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	ch, ok := p.channels[chid]
+	if !ok {
+		return nil
+	}
+	now := p.now()
+	var lower []datatransfer.ChannelID
+	for other, och := range p.channels {
+		if och.priority < ch.priority && p.transferring(och, now) {
+			lower = append(lower, other)
+		}
+	}
+	sort.Slice(lower, func(i, j int) bool {
+		return p.channels[lower[i]].priority < p.channels[lower[j]].priority
+	})
+	return lower
+}
+
+// throttleDelay scales the time a throttled channel waits to transfer more
+// data, so that the further its priority is below the highest priority of
+// the channels transferring data, the longer it waits
+func (p *priorities) throttleDelay(chid datatransfer.ChannelID, delay time.Duration) time.Duration {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	ch, ok := p.channels[chid]
+	if !ok {
+		return delay
+	}
+	now := p.now()
+	highest := ch.priority
+	for _, och := range p.channels {
+		if och.priority > highest && p.transferring(och, now) {
+			highest = och.priority
+		}
+	}
+	// highest is at least the priority of the channel, so the difference
+	// is only negative if it overflows, in which case it is saturated
+	factor := int64(maxPriorityDelayFactor)
+	if diff := int64(highest) - int64(ch.priority); diff >= 0 && diff < maxPriorityDelayFactor-1 {
+		factor = 1 + diff
+	}
+	return delay * time.Duration(factor)
+}
@@ -0,0 +1,277 @@
+package impl
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// defaultProgressRateWindows are the windows the transfer rates of channels
+// are measured over by default
+var defaultProgressRateWindows = []time.Duration{10 * time.Second, time.Minute}
+
+// defaultProgressInterval is how often progress is sent to subscribers that
+// do not set a valid interval
+const defaultProgressInterval = time.Second
+
+// progressSampleInterval is the shortest time between the samples of the
+// data transferred that rates are measured from
+const progressSampleInterval = 100 * time.Millisecond
+
+// ProgressRateWindows sets the windows of time the transfer rates of channels
+// are measured over. The estimated time for a channel to finish uses the rate
+// over the longest window.
+func ProgressRateWindows(windows ...time.Duration) DataTransferOption {
+	return func(m *manager) {
+		sorted := append([]time.Duration(nil), windows...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		m.progress.windows = sorted
+	}
+}
+
+// progressSample is the amount of data a channel had transferred at a time
+type progressSample struct {
+	at          time.Time
+	transferred uint64
+}
+
+// channelProgress is the progress of a channel that is transferring data
+type channelProgress struct {
+	transferred uint64
+	totalSize   uint64
+	lastData    time.Time
+	samples     []progressSample
+}
+
+// progressTracker tracks how much data the channels that are transferring
+// data have transferred over time, to measure their transfer rates
+type progressTracker struct {
+	lk       sync.Mutex
+	now      func() time.Time
+	windows  []time.Duration
+	channels map[datatransfer.ChannelID]*channelProgress
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{
+		now:      time.Now,
+		windows:  defaultProgressRateWindows,
+		channels: make(map[datatransfer.ChannelID]*channelProgress),
+	}
+}
+
+// record records the amount of data a channel has transferred so far
+func (p *progressTracker) record(chid datatransfer.ChannelID, transferred uint64, totalSize uint64) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	now := p.now()
+	cp, ok := p.channels[chid]
+	if !ok {
+		cp = &channelProgress{}
+		p.channels[chid] = cp
+	}
+	cp.transferred = transferred
+	cp.totalSize = totalSize
+	cp.lastData = now
+
+	// samples close together are merged, except the first one, which rates
+	// are measured from until the channel has transferred data for a window
+	last := len(cp.samples) - 1
+	if last > 0 && now.Sub(cp.samples[last].at) < progressSampleInterval {
+		cp.samples[last].transferred = transferred
+	} else {
+		cp.samples = append(cp.samples, progressSample{at: now, transferred: transferred})
+	}
+
+	// keep the samples within the longest window, and the last one before it
+	// to measure from
+	if len(p.windows) == 0 {
+		return
+	}
+	cutoff := now.Add(-p.windows[len(p.windows)-1])
+	keepFrom := 0
+	for i := 1; i < len(cp.samples) && !cp.samples[i].at.After(cutoff); i++ {
+		keepFrom = i
+	}
+	cp.samples = cp.samples[keepFrom:]
+}
+
+// setTotalSize updates the total size of a channel that is tracked
+func (p *progressTracker) setTotalSize(chid datatransfer.ChannelID, totalSize uint64) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if cp, ok := p.channels[chid]; ok {
+		cp.totalSize = totalSize
+	}
+}
+
+// remove stops tracking a channel
+func (p *progressTracker) remove(chid datatransfer.ChannelID) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	delete(p.channels, chid)
+}
+
+// progress returns the progress of a channel, and false if it is not tracked
+func (p *progressTracker) progress(chid datatransfer.ChannelID) (datatransfer.Progress, bool) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	cp, ok := p.channels[chid]
+	if !ok {
+		return datatransfer.Progress{}, false
+	}
+	return p.snapshot(chid, cp, p.now()), true
+}
+
+// updatedSince returns the progress of the channels that transferred data
+// after the given time, and the time the progress was measured at
+func (p *progressTracker) updatedSince(since time.Time) ([]datatransfer.Progress, time.Time) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	now := p.now()
+	var updated []datatransfer.Progress
+	for chid, cp := range p.channels {
+		if cp.lastData.After(since) {
+			updated = append(updated, p.snapshot(chid, cp, now))
+		}
+	}
+	return updated, now
+}
+
+// snapshot measures the progress of a channel at the given time
+func (p *progressTracker) snapshot(chid datatransfer.ChannelID, cp *channelProgress, now time.Time) datatransfer.Progress {
+	rates := make([]datatransfer.ProgressRate, 0, len(p.windows))
+	for _, window := range p.windows {
+		rates = append(rates, datatransfer.ProgressRate{
+			Window:         window,
+			BytesPerSecond: cp.rate(window, now),
+		})
+	}
+	progress := newProgress(chid, cp.transferred, cp.totalSize, rates, now)
+	if len(rates) > 0 && cp.totalSize > cp.transferred {
+		if rate := rates[len(rates)-1].BytesPerSecond; rate > 0 {
+			progress.ETA = time.Duration(float64(cp.totalSize-cp.transferred) / rate * float64(time.Second))
+		}
+	}
+	return progress
+}
+
+// rate is the average number of bytes per second the channel transferred
+// over the window, measured from the last sample before the window, or the
+// first sample if the channel started transferring data within it
+func (cp *channelProgress) rate(window time.Duration, now time.Time) float64 {
+	if len(cp.samples) == 0 {
+		return 0
+	}
+	cutoff := now.Add(-window)
+	from := cp.samples[0]
+	for _, sample := range cp.samples[1:] {
+		if sample.at.After(cutoff) {
+			break
+		}
+		from = sample
+	}
+	elapsed := now.Sub(from.at)
+	if elapsed <= 0 || cp.transferred < from.transferred {
+		return 0
+	}
+	return float64(cp.transferred-from.transferred) / elapsed.Seconds()
+}
+
+// newProgress returns the progress of a channel with the given amounts of
+// data transferred
+func newProgress(chid datatransfer.ChannelID, transferred uint64, totalSize uint64, rates []datatransfer.ProgressRate, now time.Time) datatransfer.Progress {
+	progress := datatransfer.Progress{
+		ChannelID:   chid,
+		Transferred: transferred,
+		TotalSize:   totalSize,
+		Rates:       rates,
+		Timestamp:   now,
+	}
+	if totalSize > 0 {
+		progress.PercentComplete = float64(transferred) / float64(totalSize) * 100
+	}
+	return progress
+}
+
+// transferred returns the amount of data this node has sent for a channel, if
+// it is the sender, or received, if it is the receiver
+func transferred(chst datatransfer.ChannelState) uint64 {
+	if chst.Sender() == chst.SelfPeer() {
+		return chst.Sent()
+	}
+	return chst.Received()
+}
+
+// trackProgress updates the progress of a channel when it transfers data
+func (m *manager) trackProgress(evt datatransfer.Event, chst datatransfer.ChannelState) {
+	switch evt.Code {
+	case datatransfer.DataSent, datatransfer.DataReceived:
+		m.progress.record(chst.ChannelID(), transferred(chst), chst.TotalSize())
+	case datatransfer.TotalSizeSet:
+		m.progress.setTotalSize(chst.ChannelID(), chst.TotalSize())
+	}
+}
+
+// ChannelProgress returns the progress of a channel. The transfer rates of
+// channels that have not transferred data since the manager started are
+// zero.
+func (m *manager) ChannelProgress(ctx context.Context, chid datatransfer.ChannelID) (datatransfer.Progress, error) {
+	if progress, ok := m.progress.progress(chid); ok {
+		return progress, nil
+	}
+	chst, err := m.channels.GetByID(ctx, chid)
+	if err != nil {
+		return datatransfer.Progress{}, err
+	}
+	rates := make([]datatransfer.ProgressRate, 0, len(m.progress.windows))
+	for _, window := range m.progress.windows {
+		rates = append(rates, datatransfer.ProgressRate{Window: window})
+	}
+	return newProgress(chid, transferred(chst), chst.TotalSize(), rates, time.Now()), nil
+}
+
+// SubscribeToProgress calls the subscriber with the progress of each channel
+// that transferred data since the last interval, once per interval, until it
+// unsubscribes or the manager stops
+func (m *manager) SubscribeToProgress(interval time.Duration, subscriber datatransfer.ProgressSubscriber) datatransfer.Unsubscribe {
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		since := m.progress.now()
+		for {
+			select {
+			case <-m.bgCtx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			var updated []datatransfer.Progress
+			updated, since = m.progress.updatedSince(since)
+			for _, progress := range updated {
+				subscriber(progress)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
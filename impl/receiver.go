@@ -3,7 +3,6 @@ package impl
 import (
 	"context"
 
-	"github.com/ipfs/go-cid"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p-core/peer"
 
@@ -15,8 +14,8 @@ type receiver struct {
 	manager *manager
 }
 
-// ReceiveRequest takes an incoming data transfer request, validates the voucher and
-// processes the message.
+// ReceiveRequest takes an incoming data transfer request, checks its signature,
+// validates the voucher and processes the message.
 func (r *receiver) ReceiveRequest(
 	ctx context.Context,
 	initiator peer.ID,
@@ -37,39 +36,40 @@ func (r *receiver) receiveRequest(ctx context.Context, initiator peer.ID, incomi
 			return err
 		}
 		if resumeTransportStatesResponder.Contains(chst.Status()) {
-			return r.manager.transport.(datatransfer.PauseableTransport).ResumeChannel(ctx, response, chid)
+			return r.manager.transportFor(chid).(datatransfer.PauseableTransport).ResumeChannel(ctx, response, chid)
 		}
 		receiveErr = nil
 	}
 
 	if response != nil {
 		if (response.IsNew() || response.IsRestart()) && response.Accepted() && !incoming.IsPull() {
-			var doNotSendCids []cid.Cid
+			stor, _ := incoming.Selector()
+			root := cidlink.Link{Cid: incoming.BaseCid()}
+			msg := r.manager.signMessage(chid, response)
 			if response.IsRestart() {
 				channel, err := r.manager.channels.GetByID(ctx, chid)
 				if err != nil {
 					return err
 				}
-				doNotSendCids = channel.ReceivedCids()
-			}
-
-			stor, _ := incoming.Selector()
-			if err := r.manager.transport.OpenChannel(ctx, initiator, chid, cidlink.Link{Cid: incoming.BaseCid()}, stor, doNotSendCids, response); err != nil {
+				if err := r.manager.reopenChannel(ctx, r.manager.transportFor(chid), initiator, channel, root, stor, nil, msg); err != nil {
+					return err
+				}
+			} else if err := r.manager.transportFor(chid).OpenChannel(ctx, initiator, chid, root, stor, nil, msg); err != nil {
 				return err
 			}
 		} else {
-			if err := r.manager.dataTransferNetwork.SendMessage(ctx, initiator, response); err != nil {
+			if err := r.manager.sendMessage(ctx, chid, initiator, response); err != nil {
 				return err
 			}
 		}
 	}
 
 	if receiveErr == datatransfer.ErrPause {
-		return r.manager.transport.(datatransfer.PauseableTransport).PauseChannel(ctx, chid)
+		return r.manager.transportFor(chid).(datatransfer.PauseableTransport).PauseChannel(ctx, chid)
 	}
 
 	if receiveErr != nil {
-		_ = r.manager.transport.CloseChannel(ctx, chid)
+		_ = r.manager.transportFor(chid).CloseChannel(ctx, chid)
 		return receiveErr
 	}
 
@@ -77,7 +77,9 @@ func (r *receiver) receiveRequest(ctx context.Context, initiator peer.ID, incomi
 }
 
 // ReceiveResponse handles responses to our  Push or Pull data transfer request.
-// It schedules a transfer only if our Pull Request is accepted.
+// It schedules a transfer only if our Pull Request is accepted. Responses
+// without a valid signature of the responder are ignored when the manager
+// checks signatures.
 func (r *receiver) ReceiveResponse(
 	ctx context.Context,
 	sender peer.ID,
@@ -94,13 +96,13 @@ func (r *receiver) receiveResponse(
 	chid := datatransfer.ChannelID{Initiator: r.manager.peerID, Responder: sender, ID: incoming.TransferID()}
 	err := r.manager.OnResponseReceived(chid, incoming)
 	if err == datatransfer.ErrPause {
-		return r.manager.transport.(datatransfer.PauseableTransport).PauseChannel(ctx, chid)
+		return r.manager.transportFor(chid).(datatransfer.PauseableTransport).PauseChannel(ctx, chid)
 	}
 	if err != nil {
 		log.Warnf("closing channel %s after getting error processing response from %s: %s",
 			chid, sender, err)
 
-		_ = r.manager.transport.CloseChannel(ctx, chid)
+		_ = r.manager.transportFor(chid).CloseChannel(ctx, chid)
 		return err
 	}
 	return nil
@@ -141,6 +143,11 @@ func (r *receiver) ReceiveRestartExistingChannelRequest(ctx context.Context,
 		return
 	}
 
+	if err := r.manager.verifySignature(ch, sender, incoming); err != nil {
+		log.Errorf("cannot restart channel %s: %s", ch, err)
+		return
+	}
+
 	// channel should NOT be terminated
 	if channels.IsChannelTerminated(channel.Status()) {
 		log.Error("cannot restart channel %s: channel already terminated", ch)
@@ -2,7 +2,9 @@ package impl_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"testing"
@@ -16,22 +18,35 @@ import (
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/oteltest"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-storedcounter"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/bandwidth"
 	"github.com/filecoin-project/go-data-transfer/channels"
 	. "github.com/filecoin-project/go-data-transfer/impl"
 	"github.com/filecoin-project/go-data-transfer/message"
 	"github.com/filecoin-project/go-data-transfer/testutil"
+	"github.com/filecoin-project/go-data-transfer/tracing"
 )
 
 func TestDataTransferResponding(t *testing.T) {
 	// create network
 	ctx := context.Background()
+	metricsRecorder := testutil.NewFakeMetricsRecorder()
+	// a loader for the blocks of verified channels that waits to be released,
+	// and then has no blocks
+	releaseLoader := make(chan struct{})
+	blockingLoader := func(ipld.Link, ipld.LinkContext) (io.Reader, error) {
+		<-releaseLoader
+		return nil, errors.New("block not found")
+	}
 	testCases := map[string]struct {
 		expectedEvents       []datatransfer.EventCode
+		options              []DataTransferOption
 		configureValidator   func(sv *testutil.StubbedValidator)
 		configureRevalidator func(sv *testutil.StubbedRevalidator)
 		verify               func(t *testing.T, h *receiverHarness)
@@ -89,6 +104,78 @@ func TestDataTransferResponding(t *testing.T) {
 				require.False(t, response.IsPaused())
 				require.True(t, response.IsNew())
 				require.True(t, response.IsVoucherResult())
+				require.Equal(t, datatransfer.ErrorValidationFailed, response.ErrorCode())
+				require.Equal(t, "something went wrong", response.ErrorMessage())
+			},
+		},
+		"new pull request rejected with error code": {
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectCodedErrorPull(datatransfer.ErrorResourceExhausted)
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				response, err := h.transport.EventHandler.OnRequestReceived(channelID(h.id, h.peers), h.pullRequest)
+				require.Error(t, err)
+				require.False(t, response.Accepted())
+				require.Equal(t, datatransfer.ErrorResourceExhausted, response.ErrorCode())
+				require.Equal(t, "something went wrong", response.ErrorMessage())
+			},
+		},
+		"new push request with unknown voucher type is rejected": {
+			verify: func(t *testing.T, h *receiverHarness) {
+				request, err := message.NewRequest(h.id, false, false, "rand", h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], request)
+				require.Len(t, h.network.SentMessages, 1)
+				response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+				require.True(t, ok)
+				require.False(t, response.Accepted())
+				require.Equal(t, datatransfer.ErrorUnknownVoucherType, response.ErrorCode())
+				require.Equal(t, "unknown voucher type: rand", response.ErrorMessage())
+			},
+		},
+		"new push request errors records rejection": {
+			options: []DataTransferOption{MetricsRecorder(metricsRecorder)},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectErrorPush()
+				sv.StubResult(testutil.NewFakeDTType())
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], h.pushRequest)
+				require.Len(t, h.network.SentMessages, 1)
+				require.Equal(t, 1, metricsRecorder.ValidationRejectedFor(h.voucher.Type()))
+			},
+		},
+		"new push request joins initiator trace": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.NewVoucherResult, datatransfer.Accept},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+				sv.StubResult(testutil.NewFakeDTType())
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				sr := new(oteltest.SpanRecorder)
+				prevProvider := otel.GetTracerProvider()
+				otel.SetTracerProvider(oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr)))
+				defer otel.SetTracerProvider(prevProvider)
+
+				initiatorCtx, initiatorSpan := otel.Tracer("initiator").Start(h.ctx, "transfer")
+				request := message.WithTraceCarrier(h.pushRequest, tracing.InjectTraceContext(initiatorCtx))
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], request)
+				require.Len(t, h.transport.OpenedChannels, 1)
+
+				spans := make(map[string]*oteltest.Span)
+				for _, span := range sr.Started() {
+					if span != initiatorSpan {
+						spans[span.Name()] = span
+					}
+				}
+				channelSpan, ok := spans["transfer"]
+				require.True(t, ok)
+				require.Equal(t, initiatorSpan.SpanContext().TraceID(), channelSpan.SpanContext().TraceID())
+				require.Equal(t, initiatorSpan.SpanContext().SpanID(), channelSpan.ParentSpanID())
+				validateSpan, ok := spans["validateVoucher"]
+				require.True(t, ok)
+				require.Equal(t, channelSpan.SpanContext().SpanID(), validateSpan.ParentSpanID())
+				require.True(t, validateSpan.Ended())
 			},
 		},
 		"new push request pauses": {
@@ -143,6 +230,545 @@ func TestDataTransferResponding(t *testing.T) {
 				require.True(t, response.IsVoucherResult())
 			},
 		},
+		"new pull request negotiates capabilities": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				initiatorCaps := datatransfer.Capabilities{Restart: true, Compression: []string{"gzip"}, MaxMessageSize: 1 << 20}
+				request := message.WithRequestCapabilities(h.pullRequest, initiatorCaps)
+				response, err := h.transport.EventHandler.OnRequestReceived(channelID(h.id, h.peers), request)
+				require.NoError(t, err)
+				require.True(t, response.Accepted())
+				require.Equal(t, &datatransfer.Capabilities{
+					Restart:    true,
+					Pause:      true,
+					Transports: []datatransfer.TransportID{datatransfer.DefaultTransport},
+				}, response.Capabilities())
+
+				caps, known := h.dt.PeerCapabilities(h.peers[1])
+				require.True(t, known)
+				require.Equal(t, initiatorCaps, caps)
+				require.False(t, caps.SupportsCompression("zstd"))
+			},
+		},
+		"new pull request advertises configured compression": {
+			options: []DataTransferOption{Compression("gzip")},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				request := message.WithRequestCapabilities(h.pullRequest, datatransfer.Capabilities{Restart: true})
+				response, err := h.transport.EventHandler.OnRequestReceived(channelID(h.id, h.peers), request)
+				require.NoError(t, err)
+				require.NotNil(t, response.Capabilities())
+				require.Equal(t, []string{"gzip"}, response.Capabilities().Compression)
+				require.True(t, response.Capabilities().SupportsCompression("gzip"))
+			},
+		},
+		"peer capabilities are forgotten when a channel disconnects": {
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				chid := channelID(h.id, h.peers)
+				request := message.WithRequestCapabilities(h.pullRequest, datatransfer.Capabilities{Restart: true})
+				_, err := h.transport.EventHandler.OnRequestReceived(chid, request)
+				require.NoError(t, err)
+				_, known := h.dt.PeerCapabilities(h.peers[1])
+				require.True(t, known)
+
+				require.NoError(t, h.transport.EventHandler.OnRequestDisconnected(h.ctx, chid))
+				_, known = h.dt.PeerCapabilities(h.peers[1])
+				require.False(t, known)
+			},
+		},
+		"pull requests over the admission limit are queued and admitted in order": {
+			options: []DataTransferOption{AdmissionLimits(AdmissionConfig{MaxInProgress: 1})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				first := channelID(h.id, h.peers)
+				response, err := h.transport.EventHandler.OnRequestReceived(first, h.pullRequest)
+				require.NoError(t, err)
+				require.True(t, response.Accepted())
+				require.False(t, response.IsPaused())
+
+				queuedIDs := []datatransfer.ChannelID{channelID(h.id+1, h.peers), channelID(h.id+2, h.peers)}
+				for ahead, chid := range queuedIDs {
+					request, err := message.NewRequest(chid.ID, false, true, h.voucher.Type(), h.voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					response, err := h.transport.EventHandler.OnRequestReceived(chid, request)
+					require.Equal(t, datatransfer.ErrPause, err)
+					require.True(t, response.Accepted())
+					require.True(t, response.IsPaused())
+					require.Equal(t, datatransfer.ErrorQueued, response.ErrorCode())
+					require.Equal(t, fmt.Sprintf("%s behind %d other requests", datatransfer.ErrQueued, ahead), response.ErrorMessage())
+					chst, err := h.dt.ChannelState(h.ctx, chid)
+					require.NoError(t, err)
+					require.Equal(t, datatransfer.Queued, chst.Status())
+				}
+
+				// resuming a queued channel does not bypass the queue
+				require.Error(t, h.dt.ResumeDataTransferChannel(h.ctx, queuedIDs[0]))
+
+				// when the channel in progress finishes, the first queued
+				// request is admitted
+				_, err = h.transport.EventHandler.OnRequestReceived(first, message.CancelRequest(first.ID))
+				require.NoError(t, err)
+				requireStatus(t, h, queuedIDs[0], datatransfer.Ongoing)
+				require.Eventually(t, func() bool { return len(h.transport.Resumed()) == 1 }, time.Second, 10*time.Millisecond)
+				resumed := h.transport.Resumed()[0]
+				require.Equal(t, queuedIDs[0], resumed.ChannelID)
+				require.True(t, resumed.Message.IsUpdate())
+				require.False(t, resumed.Message.IsPaused())
+				chst, err := h.dt.ChannelState(h.ctx, queuedIDs[1])
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Queued, chst.Status())
+
+				// a queued request that is cancelled leaves the queue
+				_, err = h.transport.EventHandler.OnRequestReceived(queuedIDs[1], message.CancelRequest(queuedIDs[1].ID))
+				require.NoError(t, err)
+				_, err = h.transport.EventHandler.OnRequestReceived(queuedIDs[0], message.CancelRequest(queuedIDs[0].ID))
+				require.NoError(t, err)
+				requireStatus(t, h, queuedIDs[1], datatransfer.Cancelled)
+				require.Len(t, h.transport.Resumed(), 1)
+			},
+		},
+		"queued requests are resumed on the transport when they are admitted": {
+			options: []DataTransferOption{AdmissionLimits(AdmissionConfig{MaxInProgress: 1})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				inProgress := channelID(h.id, h.peers)
+				_, err := h.transport.EventHandler.OnRequestReceived(inProgress, h.pullRequest)
+				require.NoError(t, err)
+
+				const queuedCount = 20
+				var queuedIDs []datatransfer.ChannelID
+				for i := 1; i <= queuedCount; i++ {
+					chid := channelID(h.id+datatransfer.TransferID(i), h.peers)
+					request, err := message.NewRequest(chid.ID, false, true, h.voucher.Type(), h.voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					_, err = h.transport.EventHandler.OnRequestReceived(chid, request)
+					require.Equal(t, datatransfer.ErrPause, err)
+					queuedIDs = append(queuedIDs, chid)
+				}
+
+				// every queued channel is resumed on the transport as soon as
+				// it is admitted, and admission waits for it to finish
+				for i, chid := range queuedIDs {
+					_, err = h.transport.EventHandler.OnRequestReceived(inProgress, message.CancelRequest(inProgress.ID))
+					require.NoError(t, err)
+					require.Eventually(t, func() bool { return len(h.transport.Resumed()) == i+1 }, time.Second, time.Millisecond)
+					require.Equal(t, chid, h.transport.Resumed()[i].ChannelID)
+					requireStatus(t, h, chid, datatransfer.Ongoing)
+					inProgress = chid
+				}
+			},
+		},
+		"queued requests that fail to be admitted free their admission slot": {
+			options: []DataTransferOption{AdmissionLimits(AdmissionConfig{MaxInProgress: 1})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				first := channelID(h.id, h.peers)
+				_, err := h.transport.EventHandler.OnRequestReceived(first, h.pullRequest)
+				require.NoError(t, err)
+
+				queuedIDs := []datatransfer.ChannelID{channelID(h.id+1, h.peers), channelID(h.id+2, h.peers)}
+				for _, chid := range queuedIDs {
+					request, err := message.NewRequest(chid.ID, false, true, h.voucher.Type(), h.voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					_, err = h.transport.EventHandler.OnRequestReceived(chid, request)
+					require.Equal(t, datatransfer.ErrPause, err)
+				}
+
+				// the transport fails to resume the first queued channel, so
+				// the next queued request is admitted in its place
+				h.transport.ResumeChannelErr = errors.New("something went wrong")
+				_, err = h.transport.EventHandler.OnRequestReceived(first, message.CancelRequest(first.ID))
+				require.NoError(t, err)
+				require.Eventually(t, func() bool { return len(h.transport.Resumed()) == 2 }, time.Second, 10*time.Millisecond)
+				require.Equal(t, queuedIDs[0], h.transport.Resumed()[0].ChannelID)
+				require.Equal(t, queuedIDs[1], h.transport.Resumed()[1].ChannelID)
+			},
+		},
+		"admission limits apply per peer and queued requests are admitted by priority": {
+			options: []DataTransferOption{AdmissionLimits(AdmissionConfig{
+				MaxInProgress:        2,
+				MaxInProgressPerPeer: 1,
+				Priority: func(initiator peer.ID, voucher datatransfer.Voucher) int {
+					if voucher.(*testutil.FakeDTType).Data == "urgent" {
+						return 1
+					}
+					return 0
+				},
+			})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				otherPeer := testutil.GeneratePeers(1)[0]
+				open := func(initiator peer.ID, id datatransfer.TransferID, data string) (datatransfer.ChannelID, datatransfer.Response) {
+					chid := datatransfer.ChannelID{ID: id, Initiator: initiator, Responder: h.peers[0]}
+					voucher := &testutil.FakeDTType{Data: data}
+					request, err := message.NewRequest(id, false, true, voucher.Type(), voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					response, _ := h.transport.EventHandler.OnRequestReceived(chid, request)
+					return chid, response
+				}
+
+				first, response := open(h.peers[1], h.id, "")
+				require.False(t, response.IsPaused())
+				// the other peer is within its own limit
+				_, response = open(otherPeer, h.id, "")
+				require.False(t, response.IsPaused())
+
+				normal, response := open(h.peers[1], h.id+1, "")
+				require.Equal(t, datatransfer.ErrorQueued, response.ErrorCode())
+				urgent, response := open(h.peers[1], h.id+2, "urgent")
+				require.Equal(t, datatransfer.ErrorQueued, response.ErrorCode())
+				require.Contains(t, response.ErrorMessage(), "behind 0 other requests")
+
+				_, err := h.transport.EventHandler.OnRequestReceived(first, message.CancelRequest(first.ID))
+				require.NoError(t, err)
+				requireStatus(t, h, urgent, datatransfer.Ongoing)
+				chst, err := h.dt.ChannelState(h.ctx, normal)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Queued, chst.Status())
+			},
+		},
+		"queued requests are admitted by the priority the initiator set": {
+			options: []DataTransferOption{AdmissionLimits(AdmissionConfig{MaxInProgress: 1})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				open := func(id datatransfer.TransferID, priority int) (datatransfer.ChannelID, datatransfer.Response) {
+					chid := datatransfer.ChannelID{ID: id, Initiator: h.peers[1], Responder: h.peers[0]}
+					request, err := message.NewRequest(id, false, true, h.voucher.Type(), h.voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					request = message.WithRequestPriority(request, priority)
+					response, _ := h.transport.EventHandler.OnRequestReceived(chid, request)
+					return chid, response
+				}
+
+				first, response := open(h.id, 0)
+				require.False(t, response.IsPaused())
+				normal, response := open(h.id+1, 0)
+				require.Equal(t, datatransfer.ErrorQueued, response.ErrorCode())
+				urgent, response := open(h.id+2, 2)
+				require.Equal(t, datatransfer.ErrorQueued, response.ErrorCode())
+				require.Contains(t, response.ErrorMessage(), "behind 0 other requests")
+
+				chst, err := h.dt.ChannelState(h.ctx, urgent)
+				require.NoError(t, err)
+				require.Equal(t, 2, chst.Priority())
+
+				_, err = h.transport.EventHandler.OnRequestReceived(first, message.CancelRequest(first.ID))
+				require.NoError(t, err)
+				requireStatus(t, h, urgent, datatransfer.Ongoing)
+				chst, err = h.dt.ChannelState(h.ctx, normal)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Queued, chst.Status())
+			},
+		},
+		"lower priority channels are throttled in favor of higher priority channels": {
+			options: []DataTransferOption{BandwidthLimiter(bandwidth.NewLimiter(bandwidth.Limits{GlobalBytesPerSecond: 100000}))},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				otherPeer := testutil.GeneratePeers(1)[0]
+				open := func(initiator peer.ID, priority int) datatransfer.ChannelID {
+					chid := datatransfer.ChannelID{ID: h.id, Initiator: initiator, Responder: h.peers[0]}
+					request, err := message.NewRequest(h.id, false, true, h.voucher.Type(), h.voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					request = message.WithRequestPriority(request, priority)
+					_, err = h.transport.EventHandler.OnRequestReceived(chid, request)
+					require.NoError(t, err)
+					return chid
+				}
+				low := open(h.peers[1], 0)
+				high := open(otherPeer, 1)
+				testCids := testutil.GenerateCids(2)
+
+				_, err := h.transport.EventHandler.OnDataQueued(low, cidlink.Link{Cid: testCids[0]}, 1000)
+				require.NoError(t, err)
+				// the high priority channel exceeds the limit, so the low
+				// priority channel is paused instead
+				_, err = h.transport.EventHandler.OnDataQueued(high, cidlink.Link{Cid: testCids[1]}, 200000)
+				require.NoError(t, err)
+				require.Eventually(t, func() bool {
+					return len(h.transport.PausedChannels) == 1
+				}, time.Second, 10*time.Millisecond)
+				require.Equal(t, low, h.transport.PausedChannels[0])
+				chst, err := h.dt.ChannelState(h.ctx, low)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.ErrThrottled.Error(), chst.Message())
+				require.True(t, chst.Throttled())
+
+				// with no lower priority channels left to pause, the high
+				// priority channel is paused itself
+				_, err = h.transport.EventHandler.OnDataQueued(high, cidlink.Link{Cid: testCids[1]}, 1000)
+				require.EqualError(t, err, datatransfer.ErrPause.Error())
+			},
+		},
+		"priorities set by other peers are clamped to the configured range": {
+			options: []DataTransferOption{PriorityRange(-10, 10)},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				for i, priority := range map[int]int{maxInt: 10, -maxInt - 1: -10, 5: 5} {
+					chid := channelID(h.id+datatransfer.TransferID(i), h.peers)
+					request, err := message.NewRequest(chid.ID, false, true, h.voucher.Type(), h.voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					request = message.WithRequestPriority(request, i)
+					_, err = h.transport.EventHandler.OnRequestReceived(chid, request)
+					require.NoError(t, err)
+					chst, err := h.dt.ChannelState(h.ctx, chid)
+					require.NoError(t, err)
+					require.Equal(t, priority, chst.Priority())
+				}
+			},
+		},
+		"throttling channels with the most distant priorities does not overflow": {
+			options: []DataTransferOption{
+				BandwidthLimiter(bandwidth.NewLimiter(bandwidth.Limits{GlobalBytesPerSecond: 100000})),
+				PriorityRange(-maxInt-1, maxInt),
+			},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				open := func(id datatransfer.TransferID, priority int) datatransfer.ChannelID {
+					chid := channelID(id, h.peers)
+					request, err := message.NewRequest(id, false, true, h.voucher.Type(), h.voucher, h.baseCid, h.stor)
+					require.NoError(t, err)
+					request = message.WithRequestPriority(request, priority)
+					_, err = h.transport.EventHandler.OnRequestReceived(chid, request)
+					require.NoError(t, err)
+					return chid
+				}
+				low := open(h.id, -maxInt-1)
+				high := open(h.id+1, maxInt)
+				testCids := testutil.GenerateCids(2)
+
+				_, err := h.transport.EventHandler.OnDataQueued(low, cidlink.Link{Cid: testCids[0]}, 1000)
+				require.NoError(t, err)
+				_, err = h.transport.EventHandler.OnDataQueued(high, cidlink.Link{Cid: testCids[1]}, 200000)
+				require.NoError(t, err)
+				require.Eventually(t, func() bool {
+					return len(h.transport.PausedChannels) == 1
+				}, time.Second, 10*time.Millisecond)
+				require.Equal(t, low, h.transport.PausedChannels[0])
+
+				// the low priority channel waits the longest delay, rather
+				// than being resumed straight away
+				time.Sleep(200 * time.Millisecond)
+				require.Empty(t, h.transport.ResumedChannels)
+			},
+		},
+		"new pull request opened paused by the initiator": {
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				request := message.WithRequestPaused(h.pullRequest)
+				response, err := h.transport.EventHandler.OnRequestReceived(channelID(h.id, h.peers), request)
+				require.NoError(t, err)
+				require.True(t, response.Accepted())
+				require.False(t, response.IsPaused())
+				chst, err := h.dt.ChannelState(h.ctx, channelID(h.id, h.peers))
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.InitiatorPaused, chst.Status())
+			},
+		},
+		"pull request computes its receipt in the background when it completes": {
+			options: []DataTransferOption{VerifyIntegrity(blockingLoader)},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				chid := channelID(h.id, h.peers)
+				_, err := h.transport.EventHandler.OnRequestReceived(chid, h.pullRequest)
+				require.NoError(t, err)
+
+				// completing the channel does not wait for the selector traversal
+				require.NoError(t, h.transport.EventHandler.OnChannelCompleted(chid, nil))
+				chst, err := h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Ongoing, chst.Status())
+				require.Empty(t, h.network.Sent())
+
+				close(releaseLoader)
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, chid)
+					return err == nil && chst.Status() == datatransfer.Failed
+				}, time.Second, 10*time.Millisecond)
+				chst, err = h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Contains(t, chst.Message(), datatransfer.ErrIntegrity.Error())
+				require.Eventually(t, func() bool {
+					return len(h.network.Sent()) == 1
+				}, time.Second, 10*time.Millisecond)
+				cancel := h.network.Sent()[0].Message.(datatransfer.Response)
+				require.True(t, cancel.IsCancel())
+				require.Equal(t, datatransfer.ErrorIntegrity, cancel.ErrorCode())
+			},
+		},
+		"pull request with a total size sends the size of the data when it completes": {
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				chid := channelID(h.id, h.peers)
+				request := message.WithRequestTotalSize(h.pullRequest, 30000)
+				_, err := h.transport.EventHandler.OnRequestReceived(chid, request)
+				require.NoError(t, err)
+				chst, err := h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, uint64(30000), chst.TotalSize())
+
+				testCids := testutil.GenerateCids(2)
+				_, err = h.transport.EventHandler.OnDataQueued(chid, cidlink.Link{Cid: testCids[0]}, 12345)
+				require.NoError(t, err)
+				_, err = h.transport.EventHandler.OnDataQueued(chid, cidlink.Link{Cid: testCids[1]}, 12345)
+				require.NoError(t, err)
+				require.NoError(t, h.transport.EventHandler.OnChannelCompleted(chid, nil))
+				require.Len(t, h.network.SentMessages, 1)
+				response := h.network.SentMessages[0].Message.(datatransfer.Response)
+				require.True(t, response.IsComplete())
+				require.Equal(t, uint64(24690), response.TotalSize())
+				chst, err = h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, uint64(24690), chst.TotalSize())
+			},
+		},
+		"push request that receives more data than its total size": {
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				chid := channelID(h.id, h.peers)
+				request := message.WithRequestTotalSize(h.pushRequest, 20000)
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], request)
+				testCids := testutil.GenerateCids(3)
+				for _, c := range testCids {
+					require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: c}, 12345))
+				}
+				// the transfer continues by default
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, chid)
+					return err == nil && chst.Message() == datatransfer.ErrSizeExceeded.Error()
+				}, time.Second, 10*time.Millisecond)
+				chst, err := h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, uint64(20000), chst.TotalSize())
+				require.Equal(t, uint64(37035), chst.Received())
+				require.Equal(t, datatransfer.Ongoing, chst.Status())
+				require.Empty(t, h.network.SentMessages)
+			},
+		},
+		"push request that receives more data than its total size fails by policy": {
+			options: []DataTransferOption{OverSizePolicy(OverSizeConfig{ThresholdPercent: 50, Fail: true})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				chid := channelID(h.id, h.peers)
+				request := message.WithRequestTotalSize(h.pushRequest, 20000)
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], request)
+				testCids := testutil.GenerateCids(3)
+				// within the threshold
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: testCids[0]}, 12345))
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: testCids[1]}, 12345))
+				chst, err := h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Ongoing, chst.Status())
+
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: testCids[2]}, 12345))
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, chid)
+					return err == nil && chst.Status() == datatransfer.Failed
+				}, time.Second, 10*time.Millisecond)
+				chst, err = h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.ErrSizeExceeded.Error(), chst.Message())
+				require.Len(t, h.network.SentMessages, 1)
+				cancel := h.network.SentMessages[0].Message.(datatransfer.Response)
+				require.True(t, cancel.IsCancel())
+				require.Equal(t, datatransfer.ErrorSizeExceeded, cancel.ErrorCode())
+			},
+		},
+		"push request without a total size fails when it receives more than the maximum size": {
+			options: []DataTransferOption{OverSizePolicy(OverSizeConfig{MaxSize: 20000, Fail: true})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				chid := channelID(h.id, h.peers)
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], h.pushRequest)
+				testCids := testutil.GenerateCids(2)
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: testCids[0]}, 12345))
+				chst, err := h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Zero(t, chst.TotalSize())
+				require.Equal(t, datatransfer.Ongoing, chst.Status())
+
+				require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: testCids[1]}, 12345))
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, chid)
+					return err == nil && chst.Status() == datatransfer.Failed
+				}, time.Second, 10*time.Millisecond)
+			},
+		},
+		"push request that declares a total size over the maximum size is held to the maximum size": {
+			options: []DataTransferOption{OverSizePolicy(OverSizeConfig{ThresholdPercent: 50, MaxSize: 20000})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				chid := channelID(h.id, h.peers)
+				request := message.WithRequestTotalSize(h.pushRequest, 1<<40)
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], request)
+				for _, c := range testutil.GenerateCids(2) {
+					require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: c}, 12345))
+				}
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, chid)
+					return err == nil && chst.Message() == datatransfer.ErrSizeExceeded.Error()
+				}, time.Second, 10*time.Millisecond)
+			},
+		},
+		"push request with a total size that overflows the threshold is not failed": {
+			options: []DataTransferOption{OverSizePolicy(OverSizeConfig{ThresholdPercent: 100, Fail: true})},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				chid := channelID(h.id, h.peers)
+				// the total size plus the threshold wraps around to a limit of
+				// two bytes without the overflow check
+				request := message.WithRequestTotalSize(h.pushRequest, 18354510353341003859)
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], request)
+				for _, c := range testutil.GenerateCids(2) {
+					require.NoError(t, h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: c}, 12345))
+				}
+				time.Sleep(50 * time.Millisecond)
+				chst, err := h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Ongoing, chst.Status())
+				require.Empty(t, chst.Message())
+				require.Empty(t, h.network.SentMessages)
+			},
+		},
 		"new pull request errors": {
 			configureValidator: func(sv *testutil.StubbedValidator) {
 				sv.ExpectErrorPull()
@@ -311,6 +937,38 @@ func TestDataTransferResponding(t *testing.T) {
 				require.False(t, response.EmptyVoucherResult())
 			},
 		},
+		"data received on a revalidated channel counts towards the bandwidth limits": {
+			options: []DataTransferOption{BandwidthLimiter(bandwidth.NewLimiter(bandwidth.Limits{PeerBytesPerSecond: 10000}))},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+				sv.StubResult(testutil.NewFakeDTType())
+			},
+			configureRevalidator: func(srv *testutil.StubbedRevalidator) {
+				srv.ExpectPausePushCheck()
+				srv.StubRevalidationResult(testutil.NewFakeDTType())
+				srv.ExpectSuccessRevalidation()
+				srv.StubCheckResult(testutil.NewFakeDTType())
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], h.pushRequest)
+				chid := channelID(h.id, h.peers)
+				err := h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: testutil.GenerateCids(1)[0]}, 12345)
+				require.EqualError(t, err, datatransfer.ErrPause.Error())
+				_, err = h.transport.EventHandler.OnRequestReceived(chid, h.voucherUpdate)
+				require.EqualError(t, err, datatransfer.ErrResume.Error())
+
+				// the bytes received while the revalidator paused the channel
+				// were charged, so the next block exceeds the limit
+				h.srv.StubSuccessPushCheck()
+				h.srv.StubRevalidationResult(nil)
+				err = h.transport.EventHandler.OnDataReceived(chid, cidlink.Link{Cid: testutil.GenerateCids(1)[0]}, 1)
+				require.EqualError(t, err, datatransfer.ErrPause.Error())
+				chst, err := h.dt.ChannelState(h.ctx, chid)
+				require.NoError(t, err)
+				require.True(t, chst.Throttled())
+				require.Equal(t, datatransfer.ErrThrottled.Error(), chst.Message())
+			},
+		},
 		"validate and revalidate with err": {
 			expectedEvents: []datatransfer.EventCode{
 				datatransfer.Open,
@@ -567,7 +1225,7 @@ func TestDataTransferResponding(t *testing.T) {
 			h.transport = testutil.NewFakeTransport()
 			h.ds = dss.MutexWrap(datastore.NewMapDatastore())
 			h.storedCounter = storedcounter.New(h.ds, datastore.NewKey("counter"))
-			dt, err := NewDataTransfer(h.ds, os.TempDir(), h.network, h.transport, h.storedCounter)
+			dt, err := NewDataTransfer(h.ds, os.TempDir(), h.network, h.transport, h.storedCounter, verify.options...)
 			require.NoError(t, err)
 			testutil.StartAndWaitForReady(ctx, t, dt)
 			h.dt = dt
@@ -756,8 +1414,10 @@ func TestDataTransferRestartResponding(t *testing.T) {
 				require.NoError(t, err)
 				p := testutil.GeneratePeers(1)[0]
 				chid := datatransfer.ChannelID{ID: h.pullRequest.TransferID(), Initiator: p, Responder: h.peers[0]}
-				_, err = h.transport.EventHandler.OnRequestReceived(chid, restartReq)
+				response, err := h.transport.EventHandler.OnRequestReceived(chid, restartReq)
 				require.True(t, xerrors.As(err, new(*channels.ErrNotFound)))
+				require.False(t, response.Accepted())
+				require.Equal(t, datatransfer.ErrorUnknownChannel, response.ErrorCode())
 			},
 		},
 		"restart request fails if voucher validation fails": {
@@ -799,8 +1459,9 @@ func TestDataTransferRestartResponding(t *testing.T) {
 				randCid := testutil.GenerateCids(1)[0]
 				restartReq, err := message.NewRequest(h.id, true, true, h.voucher.Type(), h.voucher, randCid, h.stor)
 				require.NoError(t, err)
-				_, err = h.transport.EventHandler.OnRequestReceived(chid, restartReq)
+				response, err := h.transport.EventHandler.OnRequestReceived(chid, restartReq)
 				require.EqualError(t, err, fmt.Sprintf("restart request for channel %s failed validation: base cid does not match", chid))
+				require.Equal(t, datatransfer.ErrorValidationFailed, response.ErrorCode())
 			},
 		},
 		"restart request fails if voucher type is not decodable": {
@@ -822,8 +1483,9 @@ func TestDataTransferRestartResponding(t *testing.T) {
 
 				restartReq, err := message.NewRequest(h.id, true, true, "rand", h.voucher, h.baseCid, h.stor)
 				require.NoError(t, err)
-				_, err = h.transport.EventHandler.OnRequestReceived(chid, restartReq)
+				response, err := h.transport.EventHandler.OnRequestReceived(chid, restartReq)
 				require.EqualError(t, err, fmt.Sprintf("restart request for channel %s failed validation: failed to decode request voucher: unknown voucher type: rand", chid))
+				require.Equal(t, datatransfer.ErrorUnknownVoucherType, response.ErrorCode())
 			},
 		},
 		"restart request fails if voucher does not match": {
@@ -1043,6 +1705,16 @@ type receiverHarness struct {
 	baseCid       cid.Cid
 }
 
+// requireStatus waits for the channel to reach the given status
+func requireStatus(t *testing.T, h *receiverHarness, chid datatransfer.ChannelID, status datatransfer.Status) {
+	require.Eventually(t, func() bool {
+		chst, err := h.dt.ChannelState(h.ctx, chid)
+		return err == nil && chst.Status() == status
+	}, time.Second, 10*time.Millisecond)
+}
+
 func channelID(id datatransfer.TransferID, peers []peer.ID) datatransfer.ChannelID {
 	return datatransfer.ChannelID{ID: id, Initiator: peers[1], Responder: peers[0]}
 }
+
+const maxInt = int(^uint(0) >> 1)
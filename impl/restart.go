@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"golang.org/x/xerrors"
@@ -32,14 +34,14 @@ const (
 )
 
 func (m *manager) restartManagerPeerReceivePush(ctx context.Context, channel datatransfer.ChannelState) error {
-	if err := m.validateRestartVoucher(channel, false); err != nil {
+	if err := m.validateRestartVoucher(ctx, channel, false); err != nil {
 		return xerrors.Errorf("failed to restart channel, validation error: %w", err)
 	}
 
 	// send a libp2p message to the other peer asking to send a "restart push request"
-	req := message.RestartExistingChannelRequest(channel.ChannelID())
+	req := m.withTraceContext(ctx, message.RestartExistingChannelRequest(channel.ChannelID()))
 
-	if err := m.dataTransferNetwork.SendMessage(ctx, channel.OtherPeer(), req); err != nil {
+	if err := m.sendMessage(ctx, channel.ChannelID(), channel.OtherPeer(), req); err != nil {
 		return xerrors.Errorf("unable to send restart request: %w", err)
 	}
 
@@ -47,21 +49,21 @@ func (m *manager) restartManagerPeerReceivePush(ctx context.Context, channel dat
 }
 
 func (m *manager) restartManagerPeerReceivePull(ctx context.Context, channel datatransfer.ChannelState) error {
-	if err := m.validateRestartVoucher(channel, true); err != nil {
+	if err := m.validateRestartVoucher(ctx, channel, true); err != nil {
 		return xerrors.Errorf("failed to restart channel, validation error: %w", err)
 	}
 
-	req := message.RestartExistingChannelRequest(channel.ChannelID())
+	req := m.withTraceContext(ctx, message.RestartExistingChannelRequest(channel.ChannelID()))
 
 	// send a libp2p message to the other peer asking to send a "restart pull request"
-	if err := m.dataTransferNetwork.SendMessage(ctx, channel.OtherPeer(), req); err != nil {
+	if err := m.sendMessage(ctx, channel.ChannelID(), channel.OtherPeer(), req); err != nil {
 		return xerrors.Errorf("unable to send restart request: %w", err)
 	}
 
 	return nil
 }
 
-func (m *manager) validateRestartVoucher(channel datatransfer.ChannelState, isPull bool) error {
+func (m *manager) validateRestartVoucher(ctx context.Context, channel datatransfer.ChannelState, isPull bool) error {
 	// re-validate the original voucher received for safety
 	chid := channel.ChannelID()
 
@@ -73,7 +75,7 @@ func (m *manager) validateRestartVoucher(channel datatransfer.ChannelState, isPu
 	}
 
 	// revalidate the voucher by reconstructing the request that would have led to the creation of this channel
-	if _, _, err := m.validateVoucher(channel.OtherPeer(), req, isPull, channel.BaseCID(), channel.Selector()); err != nil {
+	if _, _, err := m.validateVoucher(ctx, chid, channel.OtherPeer(), req, isPull, channel.BaseCID(), channel.Selector()); err != nil {
 		return err
 	}
 
@@ -91,16 +93,18 @@ func (m *manager) openPushRestartChannel(ctx context.Context, channel datatransf
 	if err != nil {
 		return err
 	}
+	req = message.WithRequestPriority(req, channel.Priority())
+	req = m.withTraceContext(ctx, m.withCapabilities(req))
 
-	processor, has := m.transportConfigurers.Processor(voucher.Type())
-	if has {
-		transportConfigurer := processor.(datatransfer.TransportConfigurer)
-		transportConfigurer(chid, voucher, m.transport)
+	if _, ok := m.transports[channel.Transport()]; !ok {
+		return xerrors.Errorf("channel %s uses transport %q, which is not registered", chid, channel.Transport())
 	}
+	m.setChannelTransport(chid, channel.Transport())
+	m.configureTransport(chid, voucher, channel.Transport())
 	m.dataTransferNetwork.Protect(requestTo, chid.String())
 
 	log.Infof("sending push restart channel to %s for channel %s", requestTo, chid)
-	if err := m.dataTransferNetwork.SendMessage(ctx, requestTo, req); err != nil {
+	if err := m.sendMessage(ctx, chid, requestTo, req); err != nil {
 		return xerrors.Errorf("Unable to send restart request: %w", err)
 	}
 
@@ -118,26 +122,68 @@ func (m *manager) openPullRestartChannel(ctx context.Context, channel datatransf
 	if err != nil {
 		return err
 	}
+	req = message.WithRequestPriority(req, channel.Priority())
+	req = m.withTraceContext(ctx, m.withCapabilities(req))
 
-	processor, has := m.transportConfigurers.Processor(voucher.Type())
-	if has {
-		transportConfigurer := processor.(datatransfer.TransportConfigurer)
-		transportConfigurer(chid, voucher, m.transport)
+	transport, ok := m.transports[channel.Transport()]
+	if !ok {
+		return xerrors.Errorf("channel %s uses transport %q, which is not registered", chid, channel.Transport())
 	}
+	m.setChannelTransport(chid, channel.Transport())
+	m.configureTransport(chid, voucher, channel.Transport())
 	m.dataTransferNetwork.Protect(requestTo, chid.String())
 
 	log.Infof("sending open channel to %s to restart channel %s", requestTo, chid)
-	if err := m.transport.OpenChannel(ctx, requestTo, chid, cidlink.Link{Cid: baseCid}, selector, channel.ReceivedCids(), req); err != nil {
+	if err := m.reopenChannel(ctx, transport, requestTo, channel, cidlink.Link{Cid: baseCid}, selector, channel.DoNotSendCids(), m.signMessage(chid, req)); err != nil {
 		return xerrors.Errorf("Unable to send open channel restart request: %w", err)
 	}
 
 	return nil
 }
 
+// reopenChannel opens a channel that has received blocks before with the
+// transport, telling the sender not to send the blocks the channel received
+// and the given blocks. The received blocks are only read if the transport
+// needs the list of them.
+func (m *manager) reopenChannel(ctx context.Context, transport datatransfer.Transport, dataSender peer.ID, channel datatransfer.ChannelState, root ipld.Link, stor ipld.Node, doNotSendCids []cid.Cid, msg datatransfer.Message) error {
+	doNotSend := receivedCids{channel: channel, extra: doNotSendCids}
+	if restartable, ok := transport.(datatransfer.RestartableTransport); ok {
+		return restartable.RestartChannel(ctx, dataSender, channel.ChannelID(), root, stor, doNotSend, msg)
+	}
+	return transport.OpenChannel(ctx, dataSender, channel.ChannelID(), root, stor, append(channel.ReceivedCids(), doNotSendCids...), msg)
+}
+
+// receivedCids reads the blocks a channel has received from the channel
+// state, followed by some extra blocks
+type receivedCids struct {
+	channel datatransfer.ChannelState
+	extra   []cid.Cid
+}
+
+func (rc receivedCids) Len() int {
+	return rc.channel.ReceivedCidsLen() + len(rc.extra)
+}
+
+func (rc receivedCids) ForEach(cb func(cid.Cid) error) error {
+	if err := rc.channel.ForEachReceivedCid(cb); err != nil {
+		return err
+	}
+	for _, c := range rc.extra {
+		if err := cb(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *manager) validateRestartRequest(ctx context.Context, otherPeer peer.ID, chid datatransfer.ChannelID, req datatransfer.Request) error {
 	// channel should exist
 	channel, err := m.channels.GetByID(ctx, chid)
 	if err != nil {
+		var notFound *channels.ErrNotFound
+		if xerrors.As(err, &notFound) {
+			return datatransfer.NewCodedError(datatransfer.ErrorUnknownChannel, err)
+		}
 		return err
 	}
 
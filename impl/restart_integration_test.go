@@ -2,6 +2,7 @@ package impl_test
 
 import (
 	"context"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -18,6 +19,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	. "github.com/filecoin-project/go-data-transfer/impl"
 	"github.com/filecoin-project/go-data-transfer/testutil"
+	tp "github.com/filecoin-project/go-data-transfer/transport/graphsync"
 )
 
 const totalIncrements = 204
@@ -84,7 +86,7 @@ func TestRestartPush(t *testing.T) {
 	for name, tc := range tcs {
 		t.Run(name, func(t *testing.T) {
 			// CREATE HARNESS
-			rh := newRestartHarness(t)
+			rh := newRestartHarness(t, false)
 			defer rh.cancel()
 
 			// START DATA TRANSFER INSTANCES
@@ -239,9 +241,10 @@ func TestRestartPush(t *testing.T) {
 
 func TestRestartPull(t *testing.T) {
 	tcs := map[string]struct {
-		stopAt    int
-		openPullF func(rh *restartHarness) datatransfer.ChannelID
-		restartF  func(rh *restartHarness, chId datatransfer.ChannelID, subFnc datatransfer.Subscriber)
+		stopAt       int
+		restartHints bool
+		openPullF    func(rh *restartHarness) datatransfer.ChannelID
+		restartF     func(rh *restartHarness, chId datatransfer.ChannelID, subFnc datatransfer.Subscriber)
 	}{
 		"Restart peer create pull": {
 			stopAt: 40,
@@ -285,12 +288,34 @@ func TestRestartPull(t *testing.T) {
 				require.NoError(rh.t, rh.dt1.RestartDataTransferChannel(rh.testCtx, chId))
 			},
 		},
+		"Restart peer create pull with restart hints": {
+			stopAt:       40,
+			restartHints: true,
+			openPullF: func(rh *restartHarness) datatransfer.ChannelID {
+				voucher := testutil.FakeDTType{Data: "applesauce"}
+				chid, err := rh.dt2.OpenPullDataChannel(rh.testCtx, rh.peer1, &voucher, rh.rootCid, rh.gsData.AllSelector)
+				require.NoError(rh.t, err)
+				return chid
+			},
+			restartF: func(rh *restartHarness, chId datatransfer.ChannelID, subscriber datatransfer.Subscriber) {
+				var err error
+				require.NoError(t, rh.dt2.Stop(rh.testCtx))
+				time.Sleep(100 * time.Millisecond)
+				tp2 := rh.gsData.SetupGSTransportHost2(tp.RestartHints(rh.gsData.Loader2))
+				rh.dt2, err = NewDataTransfer(rh.gsData.DtDs2, rh.gsData.TempDir2, rh.gsData.DtNet2, tp2, rh.gsData.StoredCounter2)
+				require.NoError(rh.t, err)
+				require.NoError(rh.t, rh.dt2.RegisterVoucherType(&testutil.FakeDTType{}, rh.sv))
+				testutil.StartAndWaitForReady(rh.testCtx, t, rh.dt2)
+				rh.dt2.SubscribeToEvents(subscriber)
+				require.NoError(rh.t, rh.dt2.RestartDataTransferChannel(rh.testCtx, chId))
+			},
+		},
 	}
 
 	for name, tc := range tcs {
 		t.Run(name, func(t *testing.T) {
 			// CREATE HARNESS
-			rh := newRestartHarness(t)
+			rh := newRestartHarness(t, tc.restartHints)
 			defer rh.cancel()
 
 			// START DATA TRANSFER INSTANCES
@@ -435,6 +460,13 @@ func TestRestartPull(t *testing.T) {
 			require.Equal(t, expectedTransferSize, int(sendChan.Queued()))
 			require.Equal(t, expectedTransferSize, int(sendChan.Sent()))
 			require.Equal(t, expectedTransferSize, int(recvChan.Received()))
+
+			// with restart hints, the sender skips the subtrees the receiver has
+			// instead of loading every block
+			if tc.restartHints {
+				require.NotZero(t, rh.hintedLoads.Load())
+				require.Less(t, int(rh.hintedLoads.Load()), totalIncrements)
+			}
 		})
 	}
 }
@@ -456,9 +488,12 @@ type restartHarness struct {
 	root           ipld.Link
 	rootCid        cid.Cid
 	destDagService ipldformat.DAGService
+
+	// blocks the sender loaded to respond to requests with restart hints
+	hintedLoads *atomic.Int32
 }
 
-func newRestartHarness(t *testing.T) *restartHarness {
+func newRestartHarness(t *testing.T, restartHints bool) *restartHarness {
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
 
@@ -472,8 +507,17 @@ func newRestartHarness(t *testing.T) *restartHarness {
 	t.Logf("peer2 is %s", peer2.Pretty())
 
 	// Setup data transfer
-	tp1 := gsData.SetupGSTransportHost1()
-	tp2 := gsData.SetupGSTransportHost2()
+	hintedLoads := atomic.NewInt32(0)
+	var tp1Opts, tp2Opts []tp.Option
+	if restartHints {
+		tp1Opts = append(tp1Opts, tp.RestartHints(func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+			hintedLoads.Inc()
+			return gsData.Loader1(lnk, lnkCtx)
+		}))
+		tp2Opts = append(tp2Opts, tp.RestartHints(gsData.Loader2))
+	}
+	tp1 := gsData.SetupGSTransportHost1(tp1Opts...)
+	tp2 := gsData.SetupGSTransportHost2(tp2Opts...)
 
 	dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1, gsData.StoredCounter1)
 	require.NoError(t, err)
@@ -507,5 +551,7 @@ func newRestartHarness(t *testing.T) *restartHarness {
 		root:           root,
 		rootCid:        rootCid,
 		destDagService: destDagService,
+
+		hintedLoads: hintedLoads,
 	}
 }
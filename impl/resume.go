@@ -0,0 +1,187 @@
+package impl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+)
+
+// AutoResumeConfig configures how channels that were in progress when the
+// manager started are restarted
+type AutoResumeConfig struct {
+	// Statuses are the statuses of the channels initiated by this node that
+	// are restarted (defaults to Ongoing, so channels that were paused or not
+	// yet accepted are left alone). Channels opened by other peers are never
+	// restarted, as it is up to the initiator to restart them.
+	Statuses []datatransfer.Status
+	// MaxConcurrent is the maximum number of channels restarted at once
+	// (defaults to 8)
+	MaxConcurrent int
+	// MaxAttempts is the number of times to try to restart each channel
+	// (defaults to 5)
+	MaxAttempts int
+	// MinBackoff is the time to wait after the first failed attempt to
+	// restart a channel. The wait doubles after each subsequent failed
+	// attempt, up to MaxBackoff (defaults to 1s and 1m).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ConnectTimeout is the maximum time to spend connecting to the other
+	// peer in each attempt (defaults to 30s)
+	ConnectTimeout time.Duration
+}
+
+const (
+	defaultResumeMaxConcurrent  = 8
+	defaultResumeMaxAttempts    = 5
+	defaultResumeMinBackoff     = time.Second
+	defaultResumeMaxBackoff     = time.Minute
+	defaultResumeConnectTimeout = 30 * time.Second
+)
+
+// withDefaults returns a copy of the config with defaults in place of unset
+// values
+func (cfg AutoResumeConfig) withDefaults() AutoResumeConfig {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = defaultResumeMaxConcurrent
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultResumeMaxAttempts
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultResumeMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = defaultResumeMaxBackoff
+		if cfg.MaxBackoff < cfg.MinBackoff {
+			cfg.MaxBackoff = cfg.MinBackoff
+		}
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = defaultResumeConnectTimeout
+	}
+	if len(cfg.Statuses) == 0 {
+		cfg.Statuses = []datatransfer.Status{datatransfer.Ongoing}
+	}
+	return cfg
+}
+
+// resumeChannels restarts the channels this node initiated that were left
+// with one of the configured statuses, at most MaxConcurrent at a time.
+// Channels that were cleaning up finish cleaning up. A Resumed event is fired
+// on each channel that restarts and a ResumeFailed event on each channel that
+// fails to restart after all attempts.
+func (m *manager) resumeChannels() {
+	cfg := m.autoResumeCfg.withDefaults()
+
+	var cleanupStatuses []datatransfer.Status
+	for _, status := range channels.CleanupStates {
+		cleanupStatuses = append(cleanupStatuses, status.(datatransfer.Status))
+	}
+	chsts, err := m.channels.List(m.bgCtx, datatransfer.ChannelFilter{Statuses: cleanupStatuses})
+	if err != nil {
+		log.Errorf("listing channels to resume: %s", err)
+		return
+	}
+	inProgress, err := m.channels.List(m.bgCtx, datatransfer.ChannelFilter{
+		Statuses: cfg.Statuses,
+		Role:     datatransfer.InitiatorRole,
+	})
+	if err != nil {
+		log.Errorf("listing channels to resume: %s", err)
+		return
+	}
+	for _, chst := range inProgress {
+		if !channels.IsChannelCleaningUp(chst.Status()) {
+			chsts = append(chsts, chst)
+		}
+	}
+	if len(chsts) == 0 {
+		return
+	}
+	log.Infof("resuming %d channels", len(chsts))
+
+	sem := make(chan struct{}, cfg.MaxConcurrent)
+	var wg sync.WaitGroup
+	for _, chst := range chsts {
+		select {
+		case <-m.bgCtx.Done():
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(chst datatransfer.ChannelState) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			m.resumeChannel(cfg, chst)
+		}(chst)
+	}
+	wg.Wait()
+}
+
+// resumeChannel tries to restart the channel until it succeeds, the
+// attempts run out or the manager stops
+func (m *manager) resumeChannel(cfg AutoResumeConfig, chst datatransfer.ChannelState) {
+	chid := chst.ChannelID()
+	if channels.IsChannelCleaningUp(chst.Status()) {
+		if err := m.RestartDataTransferChannel(m.bgCtx, chid); err != nil {
+			log.Warnf("channel %s: failed to finish cleaning up: %s", chid, err)
+		}
+		return
+	}
+
+	backoff := cfg.MinBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = m.resumeAttempt(cfg, chst)
+		if err == nil {
+			log.Infof("channel %s: resumed", chid)
+			if err := m.channels.Resumed(chid); err != nil {
+				log.Warnf("channel %s: unable to record resume: %s", chid, err)
+			}
+			return
+		}
+		if attempt >= cfg.MaxAttempts {
+			break
+		}
+
+		log.Warnf("channel %s: resume attempt %d failed, retrying in %s: %s", chid, attempt, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-m.bgCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+
+	log.Warnf("channel %s: failed to resume after %d attempts: %s", chid, cfg.MaxAttempts, err)
+	err = xerrors.Errorf("failed to resume after %d attempts: %w", cfg.MaxAttempts, err)
+	if err := m.channels.ResumeFailed(chid, err); err != nil {
+		log.Warnf("channel %s: unable to record resume failure: %s", chid, err)
+	}
+}
+
+// resumeAttempt connects to the other peer of the channel and restarts it
+func (m *manager) resumeAttempt(cfg AutoResumeConfig, chst datatransfer.ChannelState) error {
+	ctx, cancel := context.WithTimeout(m.bgCtx, cfg.ConnectTimeout)
+	err := m.dataTransferNetwork.ConnectTo(ctx, chst.OtherPeer())
+	cancel()
+	if err != nil {
+		return xerrors.Errorf("unable to connect to peer %s: %w", chst.OtherPeer(), err)
+	}
+
+	// the transport may tie the restarted transfer to the context, so it
+	// must outlive the attempt
+	return m.RestartDataTransferChannel(m.bgCtx, chst.ChannelID())
+}
@@ -0,0 +1,147 @@
+package impl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+)
+
+// SigningConfig configures the signing of the messages the manager sends, and
+// the checking of the signatures of the messages it receives
+type SigningConfig struct {
+	// Key is the key the manager signs the messages it sends with, normally
+	// the private key of the libp2p host. Messages are not signed if it is
+	// nil.
+	Key crypto.PrivKey
+	// RequireSignatures rejects messages from other peers that are not
+	// signed. Otherwise unsigned messages are accepted, but messages with a
+	// signature that is not valid are always rejected.
+	RequireSignatures bool
+	// PublicKey returns the public key of a peer, eg from the peerstore of
+	// the libp2p host. If it is nil, the public key is extracted from the peer
+	// ID, which only works for peers with keys that are embedded in their ID,
+	// such as Ed25519 keys.
+	PublicKey func(peer.ID) (crypto.PubKey, error)
+}
+
+// MessageSigning makes the manager sign the messages it sends, and check the
+// signatures of the messages it receives. A signature covers the CBOR
+// encoding of the message, including any voucher or voucher result, and the
+// ID of the channel, so that a signed message can't be replayed on another
+// channel or to another peer. Validators that implement
+// datatransfer.SignatureValidator are given the signatures of the requests
+// they validate.
+// Only messages of the 1.2 protocol can be signed.
+func MessageSigning(cfg SigningConfig) DataTransferOption {
+	return func(m *manager) {
+		m.signing = &cfg
+	}
+}
+
+// signingDomain separates the signatures of data transfer messages from other
+// signatures made with the same key
+const signingDomain = "fil/data-transfer/message-signature"
+
+// signingPayload returns the bytes that are signed for a message sent on the
+// given channel, from the signed bytes of the message
+func signingPayload(chid datatransfer.ChannelID, signed []byte) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(signingDomain)
+	for _, p := range []peer.ID{chid.Initiator, chid.Responder} {
+		lenBuf := make([]byte, binary.MaxVarintLen64)
+		buf.Write(lenBuf[:binary.PutUvarint(lenBuf, uint64(len(p)))])
+		buf.WriteString(string(p))
+	}
+	idBuf := make([]byte, 8)
+	binary.BigEndian.PutUint64(idBuf, uint64(chid.ID))
+	buf.Write(idBuf)
+	buf.Write(signed)
+	return buf.Bytes()
+}
+
+// signMessage signs a message this node sends on the given channel, if
+// signing is enabled and the message is not signed yet
+func (m *manager) signMessage(chid datatransfer.ChannelID, msg datatransfer.Message) datatransfer.Message {
+	if m.signing == nil || m.signing.Key == nil || msg == nil || len(msg.Signature()) > 0 {
+		return msg
+	}
+	signed, err := message.SignedBytes(msg)
+	if err != nil {
+		// the message is of a protocol version that can't be signed
+		return msg
+	}
+	sig, err := m.signing.Key.Sign(signingPayload(chid, signed))
+	if err != nil {
+		log.Warnf("channel %s: unable to sign message: %s", chid, err)
+		return msg
+	}
+	switch typed := msg.(type) {
+	case datatransfer.Request:
+		return message.WithRequestSignature(typed, sig)
+	case datatransfer.Response:
+		return message.WithResponseSignature(typed, sig)
+	default:
+		return msg
+	}
+}
+
+// signResponse signs a response this node sends on the given channel
+func (m *manager) signResponse(chid datatransfer.ChannelID, response datatransfer.Response) datatransfer.Response {
+	if response == nil {
+		return nil
+	}
+	return m.signMessage(chid, response).(datatransfer.Response)
+}
+
+// verifySignature checks the signature of a message received from the given
+// peer on the given channel, if signing is enabled
+func (m *manager) verifySignature(chid datatransfer.ChannelID, sender peer.ID, msg datatransfer.Message) error {
+	if m.signing == nil {
+		return nil
+	}
+	sig := msg.Signature()
+	if len(sig) == 0 {
+		if m.signing.RequireSignatures {
+			return fmt.Errorf("%w: message is not signed", datatransfer.ErrInvalidSignature)
+		}
+		return nil
+	}
+	pubKey, err := m.publicKey(sender)
+	if err != nil {
+		return fmt.Errorf("%w: getting public key of %s: %s", datatransfer.ErrInvalidSignature, sender, err)
+	}
+	signed, err := message.SignedBytes(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %s", datatransfer.ErrInvalidSignature, err)
+	}
+	ok, err := pubKey.Verify(signingPayload(chid, signed), sig)
+	if err != nil || !ok {
+		return datatransfer.ErrInvalidSignature
+	}
+	return nil
+}
+
+// publicKey returns the public key signatures of the given peer are checked
+// with
+func (m *manager) publicKey(p peer.ID) (crypto.PubKey, error) {
+	if m.signing.PublicKey != nil {
+		return m.signing.PublicKey(p)
+	}
+	return p.ExtractPublicKey()
+}
+
+// verifiedSignature returns the signature of a request that was checked when
+// the request was received, or nil if the request is not signed or signatures
+// are not checked
+func (m *manager) verifiedSignature(request datatransfer.Request) []byte {
+	if m.signing == nil {
+		return nil
+	}
+	return request.Signature()
+}
@@ -0,0 +1,118 @@
+package impl
+
+import (
+	"math"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// OverSizeConfig says what the manager does when a channel receives more data
+// than its total size. By default the manager fires a
+// datatransfer.SizeExceeded event as soon as a channel receives more data than
+// its total size, and the transfer continues.
+type OverSizeConfig struct {
+	// ThresholdPercent is how much more data than its total size, as a
+	// percentage of the total size, a channel may receive before the policy
+	// applies
+	ThresholdPercent uint64
+	// MaxSize is the most data a channel may receive before the policy
+	// applies, whatever total size the other peer declared for it. It also
+	// applies to channels without a total size. Zero means no maximum.
+	MaxSize uint64
+	// Fail fails channels that exceed the threshold with
+	// datatransfer.ErrSizeExceeded, and cancels them with the other peer.
+	// Otherwise the manager fires a datatransfer.SizeExceeded event for the
+	// channel and the transfer continues.
+	Fail bool
+}
+
+// OverSizePolicy sets what the manager does when a channel receives more data
+// than its total size. Channels without a total size are only checked
+// against the maximum size of the config.
+func OverSizePolicy(cfg OverSizeConfig) DataTransferOption {
+	return func(m *manager) {
+		m.overSize = cfg
+	}
+}
+
+// sizeLimit returns the most data a channel with the given total size may
+// receive under the policy, or zero if there is no limit
+func (cfg OverSizeConfig) sizeLimit(totalSize uint64) uint64 {
+	if totalSize == 0 {
+		return cfg.MaxSize
+	}
+	limit := uint64(math.MaxUint64)
+	if cfg.ThresholdPercent == 0 || totalSize <= math.MaxUint64/cfg.ThresholdPercent {
+		extra := totalSize * cfg.ThresholdPercent / 100
+		if totalSize <= math.MaxUint64-extra {
+			limit = totalSize + extra
+		}
+	}
+	if cfg.MaxSize != 0 && limit > cfg.MaxSize {
+		limit = cfg.MaxSize
+	}
+	return limit
+}
+
+// checkReceivedSize applies the over size policy, the first time a channel
+// receives more data than its total size allows
+func (m *manager) checkReceivedSize(chst datatransfer.ChannelState) {
+	limit := m.overSize.sizeLimit(chst.TotalSize())
+	if limit == 0 || chst.Received() <= limit {
+		return
+	}
+
+	chid := chst.ChannelID()
+	m.exceededLk.Lock()
+	_, ok := m.exceeded[chid]
+	m.exceeded[chid] = struct{}{}
+	m.exceededLk.Unlock()
+	if ok {
+		return
+	}
+
+	log.Warnf("channel %s: received %d bytes, more than the %d bytes allowed for a total size of %d bytes", chid, chst.Received(), limit, chst.TotalSize())
+	if !m.overSize.Fail {
+		if err := m.channels.SizeExceeded(chid); err != nil {
+			log.Warnf("channel %s: unable to record exceeded size: %s", chid, err)
+		}
+		return
+	}
+
+	// the channel is closed in the background as events for it are still
+	// being processed
+	go func() {
+		err := m.CloseDataTransferChannelWithError(m.bgCtx, chid, datatransfer.NewCodedError(datatransfer.ErrorSizeExceeded, datatransfer.ErrSizeExceeded))
+		if err != nil {
+			log.Warnf("channel %s: unable to close channel that exceeded its size: %s", chid, err)
+		}
+	}()
+}
+
+// forgetExceededSize forgets that a channel exceeded its total size
+func (m *manager) forgetExceededSize(chid datatransfer.ChannelID) {
+	m.exceededLk.Lock()
+	defer m.exceededLk.Unlock()
+
+	delete(m.exceeded, chid)
+}
+
+// confirmTotalSize sets the total size of a channel that this node sent data
+// for to the size of the data it sent, and returns the size. It returns zero
+// if this node did not send any data for the channel.
+func (m *manager) confirmTotalSize(chid datatransfer.ChannelID) (uint64, error) {
+	chst, err := m.channels.GetByID(m.bgCtx, chid)
+	if err != nil {
+		return 0, err
+	}
+	size := chst.Queued()
+	if chst.Sender() != m.peerID || size == 0 {
+		return 0, nil
+	}
+	if size != chst.TotalSize() {
+		if err := m.channels.TotalSizeSet(chid, size); err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
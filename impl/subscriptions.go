@@ -0,0 +1,277 @@
+package impl
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// defaultEventQueueSize is the number of events queued for each subscriber
+// when events are dispatched asynchronously, if the config does not set it
+const defaultEventQueueSize = 256
+
+// EventDispatchConfig configures asynchronous dispatch of events to
+// subscribers.
+//
+// Each subscriber has its own queue of events, which a goroutine calls it
+// with, so that a slow subscriber does not hold up the channels or the other
+// subscribers. The events of a channel are delivered to each subscriber in
+// the order they happened, though events of different channels may be
+// interleaved in any order. When a subscriber's queue is full, the manager
+// notifies the other subscribers with a datatransfer.SlowSubscriber event.
+type EventDispatchConfig struct {
+	// QueueSize is the number of events queued for each subscriber
+	QueueSize int
+	// DropWhenFull drops events for a subscriber whose queue is full.
+	// Otherwise publishing an event waits until there is room in the queue,
+	// which holds up the channel the event is for.
+	DropWhenFull bool
+}
+
+// AsyncEventDispatch dispatches events to subscribers asynchronously, rather
+// than calling subscribers as the events happen
+func AsyncEventDispatch(cfg EventDispatchConfig) DataTransferOption {
+	return func(m *manager) {
+		if cfg.QueueSize <= 0 {
+			cfg.QueueSize = defaultEventQueueSize
+		}
+		m.subscriptions.async = &cfg
+	}
+}
+
+// queuedEvent is an event queued for a subscriber
+type queuedEvent struct {
+	evt  datatransfer.Event
+	chst datatransfer.ChannelState
+}
+
+// subscription is a subscriber to data transfer events
+type subscription struct {
+	key uint64
+	fn  datatransfer.Subscriber
+
+	// queue and done are set when events are dispatched asynchronously
+	queue chan queuedEvent
+	done  chan struct{}
+	// slow is set when the queue is full, until it has been emptied
+	slow int32
+}
+
+// run calls the subscriber with its queued events until it unsubscribes or
+// the manager stops
+func (sub *subscription) run(stopped <-chan struct{}) {
+	for {
+		select {
+		case <-sub.done:
+			return
+		case <-stopped:
+			return
+		case qe := <-sub.queue:
+			sub.fn(qe.evt, qe.chst)
+			if len(sub.queue) == 0 {
+				atomic.StoreInt32(&sub.slow, 0)
+			}
+		}
+	}
+}
+
+// subscriptions holds the subscribers to data transfer events, indexed by the
+// channel and the event codes they subscribed to, so that publishing an event
+// only visits the subscribers that are notified of it
+type subscriptions struct {
+	lk        sync.RWMutex
+	nextKey   uint64
+	all       map[uint64]*subscription
+	byChannel map[datatransfer.ChannelID]map[uint64]*subscription
+	byCode    map[datatransfer.EventCode]map[uint64]*subscription
+
+	// async is set to dispatch events asynchronously
+	async       *EventDispatchConfig
+	stopped     chan struct{}
+	stoppedOnce sync.Once
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		stopped:   make(chan struct{}),
+		all:       make(map[uint64]*subscription),
+		byChannel: make(map[datatransfer.ChannelID]map[uint64]*subscription),
+		byCode:    make(map[datatransfer.EventCode]map[uint64]*subscription),
+	}
+}
+
+// subscribe notifies the subscriber of all events
+func (s *subscriptions) subscribe(fn datatransfer.Subscriber) datatransfer.Unsubscribe {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	sub := s.newSubscription(fn)
+	s.all[sub.key] = sub
+	return s.unsubscribe(sub, func() {
+		delete(s.all, sub.key)
+	})
+}
+
+// subscribeToChannel notifies the subscriber of the events of a channel
+func (s *subscriptions) subscribeToChannel(chid datatransfer.ChannelID, fn datatransfer.Subscriber) datatransfer.Unsubscribe {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	sub := s.newSubscription(fn)
+	subs, ok := s.byChannel[chid]
+	if !ok {
+		subs = make(map[uint64]*subscription)
+		s.byChannel[chid] = subs
+	}
+	subs[sub.key] = sub
+	return s.unsubscribe(sub, func() {
+		delete(subs, sub.key)
+		if len(subs) == 0 {
+			delete(s.byChannel, chid)
+		}
+	})
+}
+
+// subscribeToCodes notifies the subscriber of the events with the given codes
+func (s *subscriptions) subscribeToCodes(codes []datatransfer.EventCode, fn datatransfer.Subscriber) datatransfer.Unsubscribe {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	sub := s.newSubscription(fn)
+	for _, code := range codes {
+		subs, ok := s.byCode[code]
+		if !ok {
+			subs = make(map[uint64]*subscription)
+			s.byCode[code] = subs
+		}
+		subs[sub.key] = sub
+	}
+	return s.unsubscribe(sub, func() {
+		for _, code := range codes {
+			if subs, ok := s.byCode[code]; ok {
+				delete(subs, sub.key)
+				if len(subs) == 0 {
+					delete(s.byCode, code)
+				}
+			}
+		}
+	})
+}
+
+func (s *subscriptions) newSubscription(fn datatransfer.Subscriber) *subscription {
+	sub := &subscription{key: s.nextKey, fn: fn}
+	s.nextKey++
+	if s.async != nil {
+		sub.queue = make(chan queuedEvent, s.async.QueueSize)
+		sub.done = make(chan struct{})
+		go sub.run(s.stopped)
+	}
+	return sub
+}
+
+// unsubscribe returns a function that removes a subscription. Subsequent
+// calls to the function are a no-op.
+func (s *subscriptions) unsubscribe(sub *subscription, remove func()) datatransfer.Unsubscribe {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.lk.Lock()
+			defer s.lk.Unlock()
+			remove()
+			if sub.done != nil {
+				close(sub.done)
+			}
+		})
+	}
+}
+
+// stop stops dispatching events asynchronously
+func (s *subscriptions) stop() {
+	s.stoppedOnce.Do(func() {
+		close(s.stopped)
+	})
+}
+
+// subscribers returns the subscribers that are notified of an event, in the
+// order they subscribed
+func (s *subscriptions) subscribers(evt datatransfer.Event, chst datatransfer.ChannelState) []*subscription {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	byChan := s.byChannel[chst.ChannelID()]
+	byCode := s.byCode[evt.Code]
+	subs := make([]*subscription, 0, len(s.all)+len(byChan)+len(byCode))
+	for _, sub := range s.all {
+		subs = append(subs, sub)
+	}
+	for _, sub := range byChan {
+		subs = append(subs, sub)
+	}
+	for _, sub := range byCode {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].key < subs[j].key })
+	return subs
+}
+
+// publish notifies the subscribers of an event. Subscribers are called
+// without holding the lock, so they may unsubscribe when they are notified.
+func (s *subscriptions) publish(evt datatransfer.Event, chst datatransfer.ChannelState) {
+	s.publishExcept(evt, chst, nil)
+}
+
+// publishExcept notifies the subscribers of an event, other than the given
+// subscriber
+func (s *subscriptions) publishExcept(evt datatransfer.Event, chst datatransfer.ChannelState, except *subscription) {
+	for _, sub := range s.subscribers(evt, chst) {
+		if sub == except {
+			continue
+		}
+		if s.async == nil {
+			sub.fn(evt, chst)
+			continue
+		}
+		s.enqueue(sub, evt, chst)
+	}
+}
+
+// enqueue queues an event for a subscriber. If the subscriber's queue is
+// full, the event is dropped or waits for room in the queue, according to
+// the config.
+func (s *subscriptions) enqueue(sub *subscription, evt datatransfer.Event, chst datatransfer.ChannelState) {
+	qe := queuedEvent{evt, chst}
+	select {
+	case sub.queue <- qe:
+		return
+	default:
+	}
+
+	if atomic.CompareAndSwapInt32(&sub.slow, 0, 1) {
+		s.reportSlow(sub, evt, chst)
+	}
+	if s.async.DropWhenFull {
+		return
+	}
+	select {
+	case sub.queue <- qe:
+	case <-sub.done:
+	case <-s.stopped:
+	}
+}
+
+// reportSlow notifies the other subscribers that a subscriber's queue is full
+func (s *subscriptions) reportSlow(sub *subscription, evt datatransfer.Event, chst datatransfer.ChannelState) {
+	action := "waiting for room"
+	if s.async.DropWhenFull {
+		action = "dropping events"
+	}
+	msg := fmt.Sprintf("subscriber %d is slow: its queue of %d events is full at %s event, %s",
+		sub.key, s.async.QueueSize, datatransfer.Events[evt.Code], action)
+	log.Warnf("channel %s: %s", chst.ChannelID(), msg)
+	slowEvt := datatransfer.Event{Code: datatransfer.SlowSubscriber, Message: msg, Timestamp: time.Now()}
+	s.publishExcept(slowEvt, chst, sub)
+}
@@ -0,0 +1,30 @@
+package impl
+
+import (
+	"time"
+)
+
+const defaultSweepInterval = 1 * time.Hour
+
+// sweepChannels periodically purges terminated channels according to the
+// channel retention policy, until the manager is stopped
+func (m *manager) sweepChannels() {
+	ticker := time.NewTicker(m.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := m.channels.Sweep(m.bgCtx, *m.retentionPolicy)
+		if err != nil {
+			log.Errorf("purging terminated channels: %s", err)
+		}
+		if len(purged) > 0 {
+			log.Infof("purged %d terminated channels", len(purged))
+		}
+
+		select {
+		case <-m.bgCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
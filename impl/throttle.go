@@ -0,0 +1,170 @@
+package impl
+
+import (
+	"context"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+)
+
+// throttle records that the given number of bytes were transferred on the
+// channel, and if the transfer has exceeded the bandwidth limits, pauses the
+// channel until the transfer rate is back within the limits.
+// If the channel was opened by another peer, and channels opened by other
+// peers with a lower priority are transferring data, those channels are
+// paused instead. Channels with a lower priority also stay paused for longer.
+// It returns datatransfer.ErrPause if the channel should be paused.
+func (m *manager) throttle(chid datatransfer.ChannelID, size uint64) error {
+	delay := m.reserveBandwidth(chid, size)
+	if delay <= 0 {
+		return nil
+	}
+
+	m.throttledLk.Lock()
+	defer m.throttledLk.Unlock()
+
+	if _, ok := m.throttled[chid]; ok {
+		return nil
+	}
+
+	if _, ok := m.transportFor(chid).(datatransfer.PauseableTransport); !ok {
+		return nil
+	}
+
+	if m.throttleLowerPriority(chid, delay) {
+		return nil
+	}
+
+	if err := m.channels.Throttled(chid); err != nil {
+		return err
+	}
+
+	m.startThrottleTimer(chid, delay)
+	return datatransfer.ErrPause
+}
+
+// reserveBandwidth charges the given number of bytes transferred on the
+// channel against the bandwidth limits, and returns how long the transfer
+// must wait to stay within the limits
+func (m *manager) reserveBandwidth(chid datatransfer.ChannelID, size uint64) time.Duration {
+	if m.bandwidthLimiter == nil {
+		return 0
+	}
+
+	m.priorities.transferred(chid)
+	return m.bandwidthLimiter.Reserve(chid.OtherParty(m.peerID), size)
+}
+
+// throttleLowerPriority pauses the channels with a lower priority than the
+// given channel that are transferring data, and returns true if it paused
+// any. It must be called with throttledLk held.
+func (m *manager) throttleLowerPriority(chid datatransfer.ChannelID, delay time.Duration) bool {
+	paused := false
+	for _, lower := range m.priorities.lowerPriority(chid) {
+		if _, ok := m.throttled[lower]; ok {
+			continue
+		}
+		pausable, ok := m.transportFor(lower).(datatransfer.PauseableTransport)
+		if !ok {
+			continue
+		}
+		if err := m.channels.Throttled(lower); err != nil {
+			log.Warnf("channel %s: unable to record throttle: %s", lower, err)
+			continue
+		}
+		log.Debugf("channel %s: throttled in favor of channel %s", lower, chid)
+		m.startThrottleTimer(lower, delay)
+		// the transport may be delivering the data that is being throttled,
+		// so pause the channel asynchronously
+		go func(lower datatransfer.ChannelID) {
+			if err := pausable.PauseChannel(m.bgCtx, lower); err != nil {
+				log.Warnf("channel %s: unable to pause throttled channel: %s", lower, err)
+			}
+		}(lower)
+		paused = true
+	}
+	return paused
+}
+
+// startThrottleTimer resumes a throttled channel after the given delay,
+// scaled by the priority of the channel. It must be called with throttledLk
+// held.
+func (m *manager) startThrottleTimer(chid datatransfer.ChannelID, delay time.Duration) {
+	delay = m.priorities.throttleDelay(chid, delay)
+	log.Debugf("channel %s: throttled for %s", chid, delay)
+	m.throttled[chid] = time.AfterFunc(delay, func() {
+		m.unthrottle(chid)
+	})
+}
+
+// unthrottle resumes a channel that was paused because it exceeded the
+// bandwidth limits, unless it has since been restarted or paused by the local
+// peer
+func (m *manager) unthrottle(chid datatransfer.ChannelID) {
+	m.throttledLk.Lock()
+	_, ok := m.throttled[chid]
+	delete(m.throttled, chid)
+	m.throttledLk.Unlock()
+	if !ok {
+		return
+	}
+
+	chst, err := m.channels.GetByID(context.TODO(), chid)
+	if err != nil {
+		log.Warnf("channel %s: unable to get channel state to unthrottle: %s", chid, err)
+		return
+	}
+	if !chst.Throttled() || m.pausedBySelf(chst) {
+		return
+	}
+	if channels.IsChannelTerminated(chst.Status()) {
+		return
+	}
+
+	pausable := m.transportFor(chid).(datatransfer.PauseableTransport)
+	if err := pausable.ResumeChannel(context.TODO(), nil, chid); err != nil {
+		log.Warnf("channel %s: unable to resume throttled channel: %s", chid, err)
+		return
+	}
+
+	if err := m.channels.Unthrottled(chid); err != nil {
+		log.Warnf("channel %s: unable to record unthrottle: %s", chid, err)
+	}
+}
+
+// pausedBySelf indicates whether the local peer has paused the channel
+func (m *manager) pausedBySelf(chst datatransfer.ChannelState) bool {
+	switch chst.Status() {
+	case datatransfer.BothPaused:
+		return true
+	case datatransfer.InitiatorPaused:
+		return chst.ChannelID().Initiator == m.peerID
+	case datatransfer.ResponderPaused:
+		return chst.ChannelID().Responder == m.peerID
+	default:
+		return false
+	}
+}
+
+// cleanupThrottle stops the timer for a throttled channel, if there is one
+func (m *manager) cleanupThrottle(chid datatransfer.ChannelID) {
+	m.throttledLk.Lock()
+	defer m.throttledLk.Unlock()
+
+	if timer, ok := m.throttled[chid]; ok {
+		timer.Stop()
+		delete(m.throttled, chid)
+	}
+}
+
+// stopThrottling stops the timers for all throttled channels
+func (m *manager) stopThrottling() {
+	m.throttledLk.Lock()
+	defer m.throttledLk.Unlock()
+
+	for chid, timer := range m.throttled {
+		timer.Stop()
+		delete(m.throttled, chid)
+	}
+}
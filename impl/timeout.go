@@ -0,0 +1,88 @@
+package impl
+
+import (
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+)
+
+// startChannelTimeout fails a channel this node opened if it has not
+// finished after the given time
+func (m *manager) startChannelTimeout(chid datatransfer.ChannelID, timeout time.Duration) {
+	m.timeoutsLk.Lock()
+	defer m.timeoutsLk.Unlock()
+
+	if timer, ok := m.timeouts[chid]; ok {
+		timer.Stop()
+	}
+	m.timeouts[chid] = time.AfterFunc(timeout, func() {
+		m.timeoutChannel(chid)
+	})
+}
+
+// timeoutChannel fails a channel that has not finished before its deadline
+func (m *manager) timeoutChannel(chid datatransfer.ChannelID) {
+	m.timeoutsLk.Lock()
+	_, ok := m.timeouts[chid]
+	delete(m.timeouts, chid)
+	m.timeoutsLk.Unlock()
+	if !ok {
+		return
+	}
+
+	chst, err := m.channels.GetByID(m.bgCtx, chid)
+	if err != nil {
+		log.Warnf("channel %s: unable to get channel state to time out: %s", chid, err)
+		return
+	}
+	if channels.IsChannelTerminated(chst.Status()) || channels.IsChannelCleaningUp(chst.Status()) {
+		return
+	}
+
+	log.Infof("channel %s: timed out", chid)
+	err = m.CloseDataTransferChannelWithError(m.bgCtx, chid, datatransfer.NewCodedError(datatransfer.ErrorTimedOut, datatransfer.ErrTimedOut))
+	if err != nil {
+		log.Warnf("channel %s: unable to close timed out channel: %s", chid, err)
+	}
+}
+
+// stopChannelTimeout stops the timer for a channel's deadline, if there is one
+func (m *manager) stopChannelTimeout(chid datatransfer.ChannelID) {
+	m.timeoutsLk.Lock()
+	defer m.timeoutsLk.Unlock()
+
+	if timer, ok := m.timeouts[chid]; ok {
+		timer.Stop()
+		delete(m.timeouts, chid)
+	}
+}
+
+// stopChannelTimeouts stops the timers for all channel deadlines
+func (m *manager) stopChannelTimeouts() {
+	m.timeoutsLk.Lock()
+	defer m.timeoutsLk.Unlock()
+
+	for chid, timer := range m.timeouts {
+		timer.Stop()
+		delete(m.timeouts, chid)
+	}
+}
+
+// restoreChannelTimeouts starts the timers for the deadlines of the channels
+// in progress that this node opened, when the manager starts
+func (m *manager) restoreChannelTimeouts() {
+	inProgress, err := m.channels.InProgress()
+	if err != nil {
+		log.Warnf("unable to list channels to restore timeouts: %s", err)
+		return
+	}
+	now := time.Now()
+	for chid, chst := range inProgress {
+		deadline := chst.Deadline()
+		if chid.Initiator != m.peerID || deadline.IsZero() {
+			continue
+		}
+		m.startChannelTimeout(chid, deadline.Sub(now))
+	}
+}
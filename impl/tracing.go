@@ -0,0 +1,84 @@
+package impl
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/tracing"
+)
+
+// startSpan starts a span for an operation on a channel, as a child of the
+// channel span if the channel has one
+func (m *manager) startSpan(ctx context.Context, chid datatransfer.ChannelID, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = m.spansIndex.ChannelContext(ctx, chid)
+	return tracing.Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, recording the error the operation failed with.
+// Pausing is not treated as a failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != datatransfer.ErrPause {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// sendMessage sends a message on a channel in a child span of the channel
+// span, unless the message is larger than the recipient accepts
+func (m *manager) sendMessage(ctx context.Context, chid datatransfer.ChannelID, to peer.ID, msg datatransfer.Message) error {
+	msg = m.signMessage(chid, msg)
+	if err := m.checkMessageSize(to, msg); err != nil {
+		return err
+	}
+	ctx, span := m.startSpan(ctx, chid, "sendMessage",
+		attribute.String("to", to.String()),
+		attribute.Bool("isRequest", msg.IsRequest()),
+	)
+	err := m.dataTransferNetwork.SendMessage(ctx, to, msg)
+	endSpan(span, err)
+	return err
+}
+
+// withTraceContext attaches the trace context in ctx to a request, if trace
+// context propagation is enabled
+func (m *manager) withTraceContext(ctx context.Context, req datatransfer.Request) datatransfer.Request {
+	if !m.propagateTraceContext {
+		return req
+	}
+	carrier := tracing.InjectTraceContext(ctx)
+	if carrier == nil {
+		return req
+	}
+	return message.WithTraceCarrier(req, carrier)
+}
+
+// traceEvent records a channel event on the channel span, and ends the span
+// once the channel terminates
+func (m *manager) traceEvent(evt datatransfer.Event, chst datatransfer.ChannelState) {
+	chid := chst.ChannelID()
+	// if the channel has no span this is a no-op span
+	span := trace.SpanFromContext(m.spansIndex.ChannelContext(context.Background(), chid))
+
+	attrs := []attribute.KeyValue{attribute.String("status", datatransfer.Statuses[chst.Status()])}
+	if evt.Message != "" {
+		attrs = append(attrs, attribute.String("message", evt.Message))
+	}
+	span.AddEvent(datatransfer.Events[evt.Code], trace.WithAttributes(attrs...))
+
+	if evt.Code != datatransfer.Purged && !channels.IsChannelTerminated(chst.Status()) {
+		return
+	}
+	switch chst.Status() {
+	case datatransfer.Failed, datatransfer.Cancelled:
+		span.SetStatus(codes.Error, chst.Message())
+	}
+	m.spansIndex.EndChannelSpan(chid)
+}
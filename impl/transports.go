@@ -0,0 +1,217 @@
+package impl
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// Transport registers an additional transport with the manager under the
+// given ID. Channels use the transport the manager was constructed with
+// unless a voucher type or channel option selects another one.
+// Push requests from a manager with more than one transport offer all of
+// them to the responder. Only the 1.2 protocol can select transports, so
+// channels with peers that speak an older version of the protocol use the
+// default transport.
+func Transport(id datatransfer.TransportID, transport datatransfer.Transport) DataTransferOption {
+	return func(m *manager) {
+		if _, ok := m.transports[id]; !ok {
+			m.transportIDs = append(m.transportIDs, id)
+		}
+		m.transports[id] = transport
+	}
+}
+
+// TransportForVoucherType sets the transport that channels opened with the
+// given voucher type prefer, unless a channel option selects another one
+func TransportForVoucherType(voucherType datatransfer.TypeIdentifier, id datatransfer.TransportID) DataTransferOption {
+	return func(m *manager) {
+		m.voucherTransports[voucherType] = id
+	}
+}
+
+// transportEvents handles the events of one of the manager's transports, so
+// that the manager knows which transport a pull request was received on
+type transportEvents struct {
+	*manager
+	id datatransfer.TransportID
+}
+
+func (te *transportEvents) OnRequestReceived(chid datatransfer.ChannelID, request datatransfer.Request) (datatransfer.Response, error) {
+	response, err := te.manager.onRequestReceived(chid, request, &te.id)
+	return te.manager.signResponse(chid, response), err
+}
+
+// checkTransports verifies that every transport selected by a voucher type
+// is registered
+func (m *manager) checkTransports() error {
+	for voucherType, id := range m.voucherTransports {
+		if _, ok := m.transports[id]; !ok {
+			return xerrors.Errorf("voucher type %s uses transport %q, which is not registered", voucherType, id)
+		}
+	}
+	return nil
+}
+
+// preferredTransport returns the transport a new channel opened by this
+// node with the given peer should prefer. If the peer advertised that it does
+// not support the transport selected for the voucher type, the channel uses
+// the first of the manager's transports that the peer supports instead. A
+// transport selected with a channel option is not replaced.
+func (m *manager) preferredTransport(to peer.ID, voucherType datatransfer.TypeIdentifier, opts datatransfer.ChannelOptions) (datatransfer.TransportID, error) {
+	id := m.voucherTransports[voucherType]
+	if opts.Transport != nil {
+		id = *opts.Transport
+	}
+	if _, ok := m.transports[id]; !ok {
+		return "", xerrors.Errorf("transport %q is not registered", id)
+	}
+
+	caps, ok := m.PeerCapabilities(to)
+	if !ok || caps.SupportsTransport(id) {
+		return id, nil
+	}
+	if opts.Transport == nil {
+		for _, supported := range m.transportIDs {
+			if caps.SupportsTransport(supported) {
+				log.Infof("peer %s does not support transport %q, using transport %q", to, id, supported)
+				return supported, nil
+			}
+		}
+	}
+	return "", xerrors.Errorf("peer %s does not support transport %q: %w", to, id, datatransfer.ErrUnsupported)
+}
+
+// offeredTransports returns the transports a push request offers to the
+// responder, starting with the preferred transport, or nil if the manager
+// only has the default transport. Transports the responder advertised that
+// it does not support are not offered.
+func (m *manager) offeredTransports(to peer.ID, preferred datatransfer.TransportID) []datatransfer.TransportID {
+	if len(m.transportIDs) < 2 {
+		return nil
+	}
+	caps, _ := m.PeerCapabilities(to)
+	offered := []datatransfer.TransportID{preferred}
+	for _, id := range m.transportIDs {
+		if id != preferred && caps.SupportsTransport(id) {
+			offered = append(offered, id)
+		}
+	}
+	return offered
+}
+
+// selectTransport chooses the transport for a new channel requested by the
+// other peer. A pull request uses the transport it was received on, and a
+// push request uses the first offered transport the manager has.
+func (m *manager) selectTransport(incoming datatransfer.Request, receivedOn *datatransfer.TransportID) (datatransfer.TransportID, error) {
+	if receivedOn != nil {
+		return *receivedOn, nil
+	}
+	offered := incoming.Transports()
+	if len(offered) == 0 {
+		return datatransfer.DefaultTransport, nil
+	}
+	for _, id := range offered {
+		if _, ok := m.transports[id]; ok {
+			return id, nil
+		}
+	}
+	return "", xerrors.Errorf("none of the offered transports %q are supported", offered)
+}
+
+// acceptedTransport returns the transport chosen by the responder to a
+// channel this node initiated. If the responder chose a different transport
+// than the one the channel was opened with, the channel moves to the chosen
+// transport.
+func (m *manager) acceptedTransport(chid datatransfer.ChannelID, response datatransfer.Response) (datatransfer.TransportID, error) {
+	chst, err := m.channels.GetByID(context.TODO(), chid)
+	if err != nil {
+		return "", err
+	}
+	opened := chst.Transport()
+
+	// the initiator of a pull channel chooses the transport by sending the
+	// request over it
+	if chst.IsPull() {
+		return opened, nil
+	}
+
+	chosen := response.Transport()
+	if chosen == opened {
+		return chosen, nil
+	}
+	if _, ok := m.transports[chosen]; !ok {
+		return "", xerrors.Errorf("responder chose transport %q, which is not registered", chosen)
+	}
+
+	log.Infof("channel %s: responder chose transport %q", chid, chosen)
+	m.transportByID(opened).CleanupChannel(chid)
+	m.setChannelTransport(chid, chosen)
+	// the voucher can only be decoded if a validator, revalidator or
+	// transport configurer is registered for its type
+	if voucher := chst.Voucher(); voucher != nil {
+		m.configureTransport(chid, voucher, chosen)
+	}
+	return chosen, nil
+}
+
+// configureTransport runs the transport configurer registered for the
+// voucher type, if any, on the given transport
+func (m *manager) configureTransport(chid datatransfer.ChannelID, voucher datatransfer.Voucher, id datatransfer.TransportID) {
+	processor, has := m.transportConfigurers.Processor(voucher.Type())
+	if has {
+		transportConfigurer := processor.(datatransfer.TransportConfigurer)
+		transportConfigurer(chid, voucher, m.transportByID(id))
+	}
+}
+
+// transportByID returns the transport registered under the given ID, or the
+// default transport if there is none
+func (m *manager) transportByID(id datatransfer.TransportID) datatransfer.Transport {
+	transport, ok := m.transports[id]
+	if !ok {
+		log.Warnf("transport %q is not registered, using default transport", id)
+		return m.transports[datatransfer.DefaultTransport]
+	}
+	return transport
+}
+
+// channelTransport returns the ID of the transport used by the channel
+func (m *manager) channelTransport(chid datatransfer.ChannelID) datatransfer.TransportID {
+	m.channelTransportsLk.RLock()
+	id, ok := m.channelTransports[chid]
+	m.channelTransportsLk.RUnlock()
+	if ok {
+		return id
+	}
+
+	chst, err := m.channels.GetByID(context.TODO(), chid)
+	if err != nil {
+		return datatransfer.DefaultTransport
+	}
+	return chst.Transport()
+}
+
+// transportFor returns the transport used by the channel
+func (m *manager) transportFor(chid datatransfer.ChannelID) datatransfer.Transport {
+	return m.transportByID(m.channelTransport(chid))
+}
+
+// setChannelTransport remembers the transport used by an active channel, so
+// that it can be looked up without reading the channel state
+func (m *manager) setChannelTransport(chid datatransfer.ChannelID, id datatransfer.TransportID) {
+	m.channelTransportsLk.Lock()
+	m.channelTransports[chid] = id
+	m.channelTransportsLk.Unlock()
+}
+
+// forgetChannelTransport removes the transport of a channel that has been
+// cleaned up
+func (m *manager) forgetChannelTransport(chid datatransfer.ChannelID) {
+	m.channelTransportsLk.Lock()
+	delete(m.channelTransports, chid)
+	m.channelTransportsLk.Unlock()
+}
@@ -37,7 +37,11 @@ func (m *manager) newRequest(ctx context.Context, selector ipld.Node, isPull boo
 		return nil, err
 	}
 	tid := datatransfer.TransferID(next)
-	return message.NewRequest(tid, false, isPull, voucher.Type(), voucher, baseCid, selector)
+	req, err := message.NewRequest(tid, false, isPull, voucher.Type(), voucher, baseCid, selector)
+	if err != nil {
+		return nil, err
+	}
+	return m.withCapabilities(req), nil
 }
 
 func (m *manager) response(isRestart bool, isNew bool, err error, tid datatransfer.TransferID, voucherResult datatransfer.VoucherResult) (datatransfer.Response, error) {
@@ -47,14 +51,26 @@ func (m *manager) response(isRestart bool, isNew bool, err error, tid datatransf
 	if voucherResult != nil {
 		resultType = voucherResult.Type()
 	}
+	var msg datatransfer.Response
+	var msgErr error
 	if isRestart {
-		return message.RestartResponse(tid, isAccepted, isPaused, resultType, voucherResult)
+		msg, msgErr = message.RestartResponse(tid, isAccepted, isPaused, resultType, voucherResult)
+	} else if isNew {
+		msg, msgErr = message.NewResponse(tid, isAccepted, isPaused, resultType, voucherResult)
+	} else {
+		msg, msgErr = message.VoucherResultResponse(tid, isAccepted, isPaused, resultType, voucherResult)
 	}
-
-	if isNew {
-		return message.NewResponse(tid, isAccepted, isPaused, resultType, voucherResult)
+	if msgErr != nil {
+		return nil, msgErr
 	}
-	return message.VoucherResultResponse(tid, isAccepted, isPaused, resultType, voucherResult)
+	if isRestart || isNew {
+		msg = message.WithResponseCapabilities(msg, m.localCapabilities())
+	}
+	if isAccepted {
+		return msg, nil
+	}
+	code, errMsg := errorMessage(err)
+	return message.WithResponseError(msg, code, errMsg), nil
 }
 
 func (m *manager) completeResponse(err error, tid datatransfer.TransferID, voucherResult datatransfer.VoucherResult) (datatransfer.Response, error) {
@@ -64,7 +80,60 @@ func (m *manager) completeResponse(err error, tid datatransfer.TransferID, vouch
 	if voucherResult != nil {
 		resultType = voucherResult.Type()
 	}
-	return message.CompleteResponse(tid, isAccepted, isPaused, resultType, voucherResult)
+	msg, msgErr := message.CompleteResponse(tid, isAccepted, isPaused, resultType, voucherResult)
+	if msgErr != nil || isAccepted {
+		return msg, msgErr
+	}
+	code, errMsg := errorMessage(err)
+	return message.WithResponseError(msg, code, errMsg), nil
+}
+
+// errorCode returns the code sent to the other peer for an error that rejects
+// or cancels a channel. Errors without a code are internal errors.
+func errorCode(err error) datatransfer.ErrorCode {
+	var coded *datatransfer.CodedError
+	if xerrors.As(err, &coded) {
+		return coded.Code
+	}
+	return datatransfer.ErrorInternal
+}
+
+// internalErrorMessage is sent to the other peer in place of the message of
+// an internal error
+const internalErrorMessage = "internal error"
+
+// errorMessage returns the code and message sent to the other peer for an
+// error that rejects or cancels a channel. Internal errors may reveal local
+// paths or datastore errors, so their message is logged rather than sent.
+func errorMessage(err error) (datatransfer.ErrorCode, string) {
+	code := errorCode(err)
+	if code == datatransfer.ErrorInternal {
+		log.Warnf("sending internal error to peer: %s", err)
+		return code, internalErrorMessage
+	}
+	return code, err.Error()
+}
+
+// withErrorCode gives an error the code, unless it already has one
+func withErrorCode(code datatransfer.ErrorCode, err error) error {
+	var coded *datatransfer.CodedError
+	if xerrors.As(err, &coded) {
+		return err
+	}
+	return datatransfer.NewCodedError(code, err)
+}
+
+// remoteError returns the error the other peer rejected or cancelled a
+// channel with, or nil if the peer did not send an error code
+func remoteError(msg datatransfer.Message, rejected bool) error {
+	if msg.ErrorCode() == datatransfer.NoError {
+		return nil
+	}
+	return &datatransfer.RemoteError{
+		Code:     msg.ErrorCode(),
+		Message:  msg.ErrorMessage(),
+		Rejected: rejected,
+	}
 }
 
 func (m *manager) resume(chid datatransfer.ChannelID) error {
@@ -116,6 +185,16 @@ func (m *manager) cancelMessage(chid datatransfer.ChannelID) datatransfer.Messag
 	return message.CancelResponse(chid.ID)
 }
 
+// cancelWithErrorMessage builds a cancel message that tells the other peer
+// the error the channel was closed with
+func (m *manager) cancelWithErrorMessage(chid datatransfer.ChannelID, err error) datatransfer.Message {
+	code, errMsg := errorMessage(err)
+	if chid.Initiator == m.peerID {
+		return message.WithRequestError(message.CancelRequest(chid.ID), code, errMsg)
+	}
+	return message.WithResponseError(message.CancelResponse(chid.ID), code, errMsg)
+}
+
 func (m *manager) decodeVoucherResult(response datatransfer.Response) (datatransfer.VoucherResult, error) {
 	vtypStr := datatransfer.TypeIdentifier(response.VoucherResultType())
 	decoder, has := m.resultTypes.Decoder(vtypStr)
@@ -133,7 +212,7 @@ func (m *manager) decodeVoucher(request datatransfer.Request, registry *registry
 	vtypStr := datatransfer.TypeIdentifier(request.VoucherType())
 	decoder, has := registry.Decoder(vtypStr)
 	if !has {
-		return nil, xerrors.Errorf("unknown voucher type: %s", vtypStr)
+		return nil, datatransfer.NewCodedError(datatransfer.ErrorUnknownVoucherType, xerrors.Errorf("unknown voucher type: %s", vtypStr))
 	}
 	encodable, err := request.Voucher(decoder)
 	if err != nil {
@@ -0,0 +1,242 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+//go:generate cbor-gen-for --map-encoding Entry
+
+// Entry is an event recorded in the journal
+type Entry struct {
+	// Seq is the sequence number of the event
+	Seq       uint64
+	ChannelID datatransfer.ChannelID
+	// Code is the datatransfer.EventCode of the event
+	Code      uint64
+	Message   string
+	Timestamp int64
+}
+
+// Event returns the data transfer event the entry records
+func (e *Entry) Event() datatransfer.Event {
+	return datatransfer.Event{
+		Code:      datatransfer.EventCode(e.Code),
+		Message:   e.Message,
+		Timestamp: time.Unix(0, e.Timestamp),
+		Seq:       e.Seq,
+	}
+}
+
+// RetentionPolicy determines how long events are kept in the journal before
+// they are trimmed
+type RetentionPolicy struct {
+	// MaxAge is how long an event is kept.
+	// Zero means events are kept regardless of age.
+	MaxAge time.Duration
+	// MaxEntries is the maximum number of events to keep. When there are
+	// more, the oldest events are trimmed.
+	// Zero means there is no limit.
+	MaxEntries int
+}
+
+// lastSeqKey is the key of the last sequence number assigned, which is kept
+// so that sequence numbers are not reused after events are trimmed
+var lastSeqKey = datastore.NewKey("last-seq")
+
+var entriesKey = datastore.NewKey("entries")
+
+// Journal is a persisted, append-only log of data transfer events, which
+// assigns each event a sequence number that is one more than the last
+type Journal struct {
+	ds      datastore.Batching
+	entries datastore.Batching
+
+	lk      sync.Mutex
+	lastSeq uint64
+}
+
+// New opens the journal in the given datastore
+func New(ds datastore.Batching) (*Journal, error) {
+	j := &Journal{
+		ds:      ds,
+		entries: namespace.Wrap(ds, entriesKey),
+	}
+	data, err := ds.Get(lastSeqKey)
+	switch err {
+	case nil:
+		if len(data) != 8 {
+			return nil, xerrors.Errorf("invalid last sequence number in event journal")
+		}
+		j.lastSeq = binary.BigEndian.Uint64(data)
+	case datastore.ErrNotFound:
+	default:
+		return nil, xerrors.Errorf("reading last sequence number of event journal: %w", err)
+	}
+	return j, nil
+}
+
+// entryKey is the key of the entry with the given sequence number. Keys are
+// padded so that they sort in sequence order.
+func entryKey(seq uint64) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%020d", seq))
+}
+
+// Append records an event of a channel, and returns its sequence number.
+// The entry and the last sequence number are written together, so a
+// sequence number is never reused for another entry.
+func (j *Journal) Append(chid datatransfer.ChannelID, evt datatransfer.Event) (uint64, error) {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	seq := j.lastSeq + 1
+	entry := Entry{
+		Seq:       seq,
+		ChannelID: chid,
+		Code:      uint64(evt.Code),
+		Message:   evt.Message,
+		Timestamp: evt.Timestamp.UnixNano(),
+	}
+	buf := new(bytes.Buffer)
+	if err := entry.MarshalCBOR(buf); err != nil {
+		return 0, err
+	}
+	seqBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqBytes, seq)
+	batch, err := j.ds.Batch()
+	if err != nil {
+		return 0, err
+	}
+	if err := batch.Put(entriesKey.Child(entryKey(seq)), buf.Bytes()); err != nil {
+		return 0, err
+	}
+	if err := batch.Put(lastSeqKey, seqBytes); err != nil {
+		return 0, err
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	j.lastSeq = seq
+	return seq, nil
+}
+
+// LastSeq returns the sequence number of the last event recorded, or zero if
+// no events have been recorded
+func (j *Journal) LastSeq() uint64 {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	return j.lastSeq
+}
+
+// ForEach calls the callback with the events in the journal that have a
+// sequence number of at least from and at most to, in sequence order
+func (j *Journal) ForEach(from uint64, to uint64, cb func(*Entry) error) error {
+	return j.forEachEntry(func(seq uint64, data []byte) (bool, error) {
+		if seq < from {
+			return true, nil
+		}
+		if seq > to {
+			return false, nil
+		}
+		var entry Entry
+		if err := entry.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+			return false, xerrors.Errorf("unmarshalling event journal entry %d: %w", seq, err)
+		}
+		return true, cb(&entry)
+	})
+}
+
+// Trim deletes the events that should no longer be retained according to the
+// policy, and returns the number of events deleted
+func (j *Journal) Trim(policy RetentionPolicy) (int, error) {
+	count := 0
+	if policy.MaxEntries > 0 {
+		if err := j.forEachEntry(func(uint64, []byte) (bool, error) {
+			count++
+			return true, nil
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now().UnixNano()
+	var trimmed []datastore.Key
+	err := j.forEachEntry(func(seq uint64, data []byte) (bool, error) {
+		if policy.MaxEntries > 0 && count-len(trimmed) > policy.MaxEntries {
+			trimmed = append(trimmed, entryKey(seq))
+			return true, nil
+		}
+		if policy.MaxAge <= 0 {
+			return false, nil
+		}
+		var entry Entry
+		if err := entry.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+			return false, xerrors.Errorf("unmarshalling event journal entry %d: %w", seq, err)
+		}
+		// entries are in the order they were recorded, so the rest are newer
+		if time.Duration(now-entry.Timestamp) < policy.MaxAge {
+			return false, nil
+		}
+		trimmed = append(trimmed, entryKey(seq))
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(trimmed) == 0 {
+		return 0, nil
+	}
+
+	batch, err := j.entries.Batch()
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range trimmed {
+		if err := batch.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return 0, err
+	}
+	return len(trimmed), nil
+}
+
+// forEachEntry calls the callback with the entries in sequence order, until
+// it returns false or an error
+func (j *Journal) forEachEntry(cb func(seq uint64, data []byte) (bool, error)) error {
+	results, err := j.entries.Query(query.Query{Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return xerrors.Errorf("querying event journal: %w", err)
+	}
+	defer results.Close() //nolint:errcheck
+
+	for res := range results.Next() {
+		if res.Error != nil {
+			return xerrors.Errorf("reading event journal: %w", res.Error)
+		}
+		var seq uint64
+		if _, err := fmt.Sscanf(datastore.RawKey(res.Key).BaseNamespace(), "%d", &seq); err != nil {
+			return xerrors.Errorf("invalid event journal key %s: %w", res.Key, err)
+		}
+		more, err := cb(seq, res.Value)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package journal_test
+
+import (
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/journal"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestJournal(t *testing.T) {
+	dstore := ds_sync.MutexWrap(ds.NewMapDatastore())
+	peers := testutil.GeneratePeers(2)
+	chid := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 1}
+
+	j, err := journal.New(dstore)
+	require.NoError(t, err)
+	require.Zero(t, j.LastSeq())
+
+	now := time.Now()
+	for i := 0; i < 12; i++ {
+		seq, err := j.Append(chid, datatransfer.Event{Code: datatransfer.DataReceived, Message: "msg", Timestamp: now})
+		require.NoError(t, err)
+		require.Equal(t, uint64(i+1), seq)
+	}
+
+	collect := func(j *journal.Journal, from, to uint64) []uint64 {
+		var seqs []uint64
+		err := j.ForEach(from, to, func(entry *journal.Entry) error {
+			require.Equal(t, chid, entry.ChannelID)
+			evt := entry.Event()
+			require.Equal(t, datatransfer.DataReceived, evt.Code)
+			require.Equal(t, "msg", evt.Message)
+			require.Equal(t, now.UnixNano(), evt.Timestamp.UnixNano())
+			require.Equal(t, entry.Seq, evt.Seq)
+			seqs = append(seqs, entry.Seq)
+			return nil
+		})
+		require.NoError(t, err)
+		return seqs
+	}
+	// keys sort in sequence order past a single digit
+	require.Equal(t, []uint64{9, 10, 11}, collect(j, 9, 11))
+
+	trimmed, err := j.Trim(journal.RetentionPolicy{MaxEntries: 5})
+	require.NoError(t, err)
+	require.Equal(t, 7, trimmed)
+	require.Equal(t, []uint64{8, 9, 10, 11, 12}, collect(j, 1, 100))
+
+	// sequence numbers are not reused after the journal is reopened
+	j, err = journal.New(dstore)
+	require.NoError(t, err)
+	require.Equal(t, uint64(12), j.LastSeq())
+	seq, err := j.Append(chid, datatransfer.Event{Code: datatransfer.DataReceived, Message: "msg", Timestamp: now})
+	require.NoError(t, err)
+	require.Equal(t, uint64(13), seq)
+
+	trimmed, err = j.Trim(journal.RetentionPolicy{MaxAge: time.Hour})
+	require.NoError(t, err)
+	require.Zero(t, trimmed)
+	time.Sleep(10 * time.Millisecond)
+	trimmed, err = j.Trim(journal.RetentionPolicy{MaxAge: time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, 6, trimmed)
+	require.Empty(t, collect(j, 1, 100))
+}
@@ -2,6 +2,7 @@ package datatransfer
 
 import (
 	"context"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
@@ -25,6 +26,18 @@ type RequestValidator interface {
 		selector ipld.Node) (VoucherResult, error)
 }
 
+// SignatureValidator is implemented by request validators that check the
+// signature of the request that carries a voucher, eg to only accept vouchers
+// sent in requests signed by the peer the voucher was issued to. It is only
+// called when the manager checks message signatures.
+type SignatureValidator interface {
+	// ValidateSignature is called before the voucher of a request on the given
+	// channel is validated, with the signature of the request, which the
+	// manager has verified was made by the sender for that channel, or nil if
+	// the request is not signed. An error rejects the request.
+	ValidateSignature(chid ChannelID, sender peer.ID, voucher Voucher, signature []byte) error
+}
+
 // Revalidator is a request validator revalidates in progress requests
 // by requesting request additional vouchers, and resuming when it receives them
 type Revalidator interface {
@@ -60,6 +73,104 @@ type Revalidator interface {
 // TransportConfigurer provides a mechanism to provide transport specific configuration for a given voucher type
 type TransportConfigurer func(chid ChannelID, voucher Voucher, transport Transport)
 
+// ChannelOptions are the optional parameters of a channel opened by a manager
+type ChannelOptions struct {
+	// Transport is the transport the channel should prefer, or nil to choose
+	// the transport from the voucher type
+	Transport *TransportID
+	// Priority is the priority of the channel, zero unless set
+	Priority int
+	// TotalSize is the expected total size of the data, in bytes, or zero if
+	// unknown
+	TotalSize uint64
+	// Label is a caller-supplied label for the channel
+	Label string
+	// Metadata is caller-supplied metadata for the channel
+	Metadata map[string]string
+	// Timeout is how long the channel may take to finish before it fails, or
+	// zero for no limit
+	Timeout time.Duration
+	// Paused is true if the channel should be opened paused
+	Paused bool
+	// DoNotSendCids are the CIDs of blocks the initiator of a pull channel
+	// already has, and the responder should not send
+	DoNotSendCids []cid.Cid
+}
+
+// ChannelOption sets an optional parameter of a channel opened by a manager
+type ChannelOption func(*ChannelOptions)
+
+// UseTransport sets the transport a channel should prefer. A pull channel
+// always uses the preferred transport. A push channel uses it if the
+// responder supports it, and otherwise the first other transport of the
+// manager that the responder supports.
+func UseTransport(id TransportID) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.Transport = &id
+	}
+}
+
+// WithPriority sets the priority of a channel. The priority is sent to the
+// responder, which admits queued requests and allocates bandwidth to
+// channels with a higher priority first, and pauses channels with a lower
+// priority first when it is short of bandwidth. Channels have a priority of
+// zero by default, and the priority may be negative.
+func WithPriority(priority int) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.Priority = priority
+	}
+}
+
+// WithTotalSize sets the expected total size, in bytes, of the data
+// transferred on a channel
+func WithTotalSize(size uint64) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.TotalSize = size
+	}
+}
+
+// WithLabel sets a label on a channel, which is stored with the channel
+// but not sent to the other peer
+func WithLabel(label string) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.Label = label
+	}
+}
+
+// WithMetadata sets metadata on a channel, which is stored with the channel
+// but not sent to the other peer
+func WithMetadata(metadata map[string]string) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.Metadata = metadata
+	}
+}
+
+// WithTimeout fails a channel with ErrTimedOut if it has not finished within
+// the given time after it was opened. The deadline is stored with the
+// channel, so it still applies if the manager restarts.
+func WithTimeout(timeout time.Duration) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.Timeout = timeout
+	}
+}
+
+// WithInitialPause opens a channel paused by the initiator, so that no data
+// is transferred until the initiator resumes it
+func WithInitialPause() ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.Paused = true
+	}
+}
+
+// WithDoNotSendCids sets the CIDs of blocks the initiator of a pull channel
+// already has, so that the responder does not send them. It is an error to
+// set them on a push channel.
+func WithDoNotSendCids(cids []cid.Cid) ChannelOption {
+	return func(opts *ChannelOptions) {
+		opts.DoNotSendCids = cids
+	}
+}
+
 // ReadyFunc is function that gets called once when the data transfer module is ready
 type ReadyFunc func(error)
 
@@ -104,6 +215,14 @@ type Manager interface {
 	// transfer parts of the piece that match the selector
 	OpenPullDataChannel(ctx context.Context, to peer.ID, voucher Voucher, baseCid cid.Cid, selector ipld.Node) (ChannelID, error)
 
+	// OpenPushDataChannelWithOptions opens a push data transfer with the given
+	// channel options
+	OpenPushDataChannelWithOptions(ctx context.Context, to peer.ID, voucher Voucher, baseCid cid.Cid, selector ipld.Node, options ...ChannelOption) (ChannelID, error)
+
+	// OpenPullDataChannelWithOptions opens a pull data transfer with the given
+	// channel options
+	OpenPullDataChannelWithOptions(ctx context.Context, to peer.ID, voucher Voucher, baseCid cid.Cid, selector ipld.Node, options ...ChannelOption) (ChannelID, error)
+
 	// send an intermediate voucher as needed when the receiver sends a request for revalidation
 	SendVoucher(ctx context.Context, chid ChannelID, voucher Voucher) error
 
@@ -125,9 +244,38 @@ type Manager interface {
 	// get notified when certain types of events happen
 	SubscribeToEvents(subscriber Subscriber) Unsubscribe
 
+	// SubscribeToChannelEvents gets notified of the events of the given
+	// channel only
+	SubscribeToChannelEvents(chid ChannelID, subscriber Subscriber) Unsubscribe
+
+	// SubscribeToEventCodes gets notified of the events with the given codes
+	// only, for all channels
+	SubscribeToEventCodes(codes []EventCode, subscriber Subscriber) Unsubscribe
+
+	// SubscribeToEventsFrom replays the events in the event journal starting
+	// from the given sequence number, then gets notified of events as they
+	// happen. It errors if the event journal is not enabled.
+	SubscribeToEventsFrom(seq uint64, subscriber Subscriber) (Unsubscribe, error)
+
+	// ChannelProgress returns the progress of a channel: how much data has
+	// been transferred, the transfer rate, and how long the channel is
+	// expected to take to finish
+	ChannelProgress(ctx context.Context, chid ChannelID) (Progress, error)
+
+	// SubscribeToProgress gets notified of the progress of the channels that
+	// transferred data, at most once per channel per interval
+	SubscribeToProgress(interval time.Duration, subscriber ProgressSubscriber) Unsubscribe
+
 	// get all in progress transfers
 	InProgressChannels(ctx context.Context) (map[ChannelID]ChannelState, error)
 
+	// list the channels that match the given filter, sorted by creation time
+	ListChannels(ctx context.Context, filter ChannelFilter) ([]ChannelState, error)
+
 	// RestartDataTransferChannel restarts an existing data transfer channel
 	RestartDataTransferChannel(ctx context.Context, chid ChannelID) error
+
+	// PeerCapabilities returns the capabilities the given peer advertised,
+	// and false if it has not advertised any
+	PeerCapabilities(p peer.ID) (Capabilities, bool)
 }
@@ -12,6 +12,11 @@ import (
 )
 
 var (
+	// ProtocolDataTransfer1_2 is the protocol identifier for the latest
+	// version of data transfer messages, which can carry error codes and
+	// advertise the capabilities of the sender
+	ProtocolDataTransfer1_2 protocol.ID = "/fil/datatransfer/1.2.0"
+
 	// ProtocolDataTransfer1_1 is the protocol identifier for graphsync messages
 	ProtocolDataTransfer1_1 protocol.ID = "/fil/datatransfer/1.1.0"
 
@@ -30,6 +35,20 @@ type Message interface {
 	IsPaused() bool
 	IsCancel() bool
 	TransferID() TransferID
+	// ErrorCode returns the code of the error the sender rejected or
+	// cancelled the channel with, or NoError if there was none
+	ErrorCode() ErrorCode
+	// ErrorMessage returns the message of the error the sender rejected or
+	// cancelled the channel with
+	ErrorMessage() string
+	// Capabilities returns the capabilities the sender advertised, or nil if
+	// the message does not carry them. Messages of protocol versions that
+	// cannot advertise capabilities return the capabilities that version
+	// implies.
+	Capabilities() *Capabilities
+	// Signature returns the sender's signature over the message, or nil if
+	// the message is not signed
+	Signature() []byte
 	cborgen.CBORMarshaler
 	cborgen.CBORUnmarshaler
 	ToNet(w io.Writer) error
@@ -47,6 +66,19 @@ type Request interface {
 	Selector() (ipld.Node, error)
 	IsRestartExistingChannelRequest() bool
 	RestartChannelId() (ChannelID, error)
+	// TraceCarrier returns the trace context of the sender as a map of
+	// propagation fields, or nil if the request carries no trace context
+	TraceCarrier() map[string]string
+	// Transports returns the transports the sender offers for the channel, in
+	// order of preference, or nil if the sender did not offer any. A sender
+	// that does not offer any transports uses the default transport.
+	Transports() []TransportID
+	// Priority returns the priority the sender set for the channel, or zero
+	// if the sender did not set one
+	Priority() int
+	// TotalSize returns the total size, in bytes, the sender declared for the
+	// data, or zero if the sender did not declare one
+	TotalSize() uint64
 }
 
 // Response is a response message for the data transfer protocol
@@ -58,4 +90,12 @@ type Response interface {
 	VoucherResultType() TypeIdentifier
 	VoucherResult(decoder encoding.Decoder) (encoding.Encodable, error)
 	EmptyVoucherResult() bool
+	// Transport returns the transport the responder chose for the channel
+	Transport() TransportID
+	// TotalSize returns the total size, in bytes, of the data the responder
+	// sent, or zero if the response does not carry it
+	TotalSize() uint64
+	// Receipt returns the receipt the responder computed for the data of the
+	// channel when it completed, or nil if the response does not carry one
+	Receipt() *Receipt
 }
@@ -1,18 +1,33 @@
 package message
 
 import (
-	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/message/message1_2"
 )
 
-var NewRequest = message1_1.NewRequest
-var RestartExistingChannelRequest = message1_1.RestartExistingChannelRequest
-var UpdateRequest = message1_1.UpdateRequest
-var VoucherRequest = message1_1.VoucherRequest
-var RestartResponse = message1_1.RestartResponse
-var NewResponse = message1_1.NewResponse
-var VoucherResultResponse = message1_1.VoucherResultResponse
-var CancelResponse = message1_1.CancelResponse
-var UpdateResponse = message1_1.UpdateResponse
-var FromNet = message1_1.FromNet
-var CompleteResponse = message1_1.CompleteResponse
-var CancelRequest = message1_1.CancelRequest
+var NewRequest = message1_2.NewRequest
+var RestartExistingChannelRequest = message1_2.RestartExistingChannelRequest
+var UpdateRequest = message1_2.UpdateRequest
+var VoucherRequest = message1_2.VoucherRequest
+var RestartResponse = message1_2.RestartResponse
+var NewResponse = message1_2.NewResponse
+var VoucherResultResponse = message1_2.VoucherResultResponse
+var CancelResponse = message1_2.CancelResponse
+var UpdateResponse = message1_2.UpdateResponse
+var FromNet = message1_2.FromNet
+var CompleteResponse = message1_2.CompleteResponse
+var CancelRequest = message1_2.CancelRequest
+var WithTraceCarrier = message1_2.WithTraceCarrier
+var WithTransports = message1_2.WithTransports
+var WithTransport = message1_2.WithTransport
+var WithRequestError = message1_2.WithRequestError
+var WithResponseError = message1_2.WithResponseError
+var WithRequestCapabilities = message1_2.WithRequestCapabilities
+var WithResponseCapabilities = message1_2.WithResponseCapabilities
+var WithRequestPriority = message1_2.WithRequestPriority
+var WithRequestPaused = message1_2.WithRequestPaused
+var WithRequestTotalSize = message1_2.WithRequestTotalSize
+var WithResponseTotalSize = message1_2.WithResponseTotalSize
+var WithResponseReceipt = message1_2.WithResponseReceipt
+var WithRequestSignature = message1_2.WithRequestSignature
+var WithResponseSignature = message1_2.WithResponseSignature
+var SignedBytes = message1_2.SignedBytes
@@ -141,6 +141,49 @@ func (trq *transferRequest) IsRestartExistingChannelRequest() bool {
 	return false
 }
 
+// TraceCarrier always returns nil, as the 1.0 protocol cannot carry a trace context
+func (trq *transferRequest) TraceCarrier() map[string]string {
+	return nil
+}
+
+// Transports always returns nil, as the 1.0 protocol cannot offer transports
+func (trq *transferRequest) Transports() []datatransfer.TransportID {
+	return nil
+}
+
+// Priority always returns zero, as the 1.0 protocol cannot carry a priority
+func (trq *transferRequest) Priority() int {
+	return 0
+}
+
+// TotalSize always returns zero, as the 1.0 protocol cannot carry a total size
+func (trq *transferRequest) TotalSize() uint64 {
+	return 0
+}
+
+// ErrorCode always returns NoError, as the 1.0 protocol cannot carry errors
+func (trq *transferRequest) ErrorCode() datatransfer.ErrorCode {
+	return datatransfer.NoError
+}
+
+// ErrorMessage always returns an empty message, as the 1.0 protocol cannot
+// carry errors
+func (trq *transferRequest) ErrorMessage() string {
+	return ""
+}
+
+// Signature always returns nil, as the 1.0 protocol cannot carry a signature
+func (trq *transferRequest) Signature() []byte {
+	return nil
+}
+
 func (trq *transferRequest) RestartChannelId() (datatransfer.ChannelID, error) {
 	return datatransfer.ChannelID{}, xerrors.New("not supported")
 }
+
+// Capabilities returns the capabilities implied by the 1.0 protocol, which
+// cannot advertise them
+func (trq *transferRequest) Capabilities() *datatransfer.Capabilities {
+	caps := datatransfer.LegacyCapabilities1_0
+	return &caps
+}
@@ -96,6 +96,38 @@ func (trsp *transferResponse) EmptyVoucherResult() bool {
 	return trsp.VTyp == datatransfer.EmptyTypeIdentifier
 }
 
+// Transport always returns the default transport, as the 1.0 protocol cannot
+// select a transport
+func (trsp *transferResponse) Transport() datatransfer.TransportID {
+	return datatransfer.DefaultTransport
+}
+
+// TotalSize always returns zero, as the 1.0 protocol cannot carry a total size
+func (trsp *transferResponse) TotalSize() uint64 {
+	return 0
+}
+
+// Receipt always returns nil, as the 1.0 protocol cannot carry a receipt
+func (trsp *transferResponse) Receipt() *datatransfer.Receipt {
+	return nil
+}
+
+// ErrorCode always returns NoError, as the 1.0 protocol cannot carry errors
+func (trsp *transferResponse) ErrorCode() datatransfer.ErrorCode {
+	return datatransfer.NoError
+}
+
+// ErrorMessage always returns an empty message, as the 1.0 protocol cannot
+// carry errors
+func (trsp *transferResponse) ErrorMessage() string {
+	return ""
+}
+
+// Signature always returns nil, as the 1.0 protocol cannot carry a signature
+func (trsp *transferResponse) Signature() []byte {
+	return nil
+}
+
 // ToNet serializes a transfer response. It's a wrapper for MarshalCBOR to provide
 // symmetry with FromNet
 func (trsp *transferResponse) ToNet(w io.Writer) error {
@@ -106,3 +138,10 @@ func (trsp *transferResponse) ToNet(w io.Writer) error {
 	}
 	return msg.MarshalCBOR(w)
 }
+
+// Capabilities returns the capabilities implied by the 1.0 protocol, which
+// cannot advertise them
+func (trsp *transferResponse) Capabilities() *datatransfer.Capabilities {
+	caps := datatransfer.LegacyCapabilities1_0
+	return &caps
+}
@@ -148,6 +148,43 @@ func (trq *transferRequest1_1) Selector() (ipld.Node, error) {
 	return builder.Build(), nil
 }
 
+// TraceCarrier always returns nil, as the 1.1 protocol cannot carry a trace
+// context
+func (trq *transferRequest1_1) TraceCarrier() map[string]string {
+	return nil
+}
+
+// Transports always returns nil, as the 1.1 protocol cannot offer transports
+func (trq *transferRequest1_1) Transports() []datatransfer.TransportID {
+	return nil
+}
+
+// Priority always returns zero, as the 1.1 protocol cannot carry a priority
+func (trq *transferRequest1_1) Priority() int {
+	return 0
+}
+
+// TotalSize always returns zero, as the 1.1 protocol cannot carry a total size
+func (trq *transferRequest1_1) TotalSize() uint64 {
+	return 0
+}
+
+// ErrorCode always returns NoError, as the 1.1 protocol cannot carry errors
+func (trq *transferRequest1_1) ErrorCode() datatransfer.ErrorCode {
+	return datatransfer.NoError
+}
+
+// ErrorMessage always returns an empty message, as the 1.1 protocol cannot
+// carry errors
+func (trq *transferRequest1_1) ErrorMessage() string {
+	return ""
+}
+
+// Signature always returns nil, as the 1.1 protocol cannot carry a signature
+func (trq *transferRequest1_1) Signature() []byte {
+	return nil
+}
+
 // IsCancel returns true if this is a cancel request
 func (trq *transferRequest1_1) IsCancel() bool {
 	return trq.Type == uint64(types.CancelMessage)
@@ -168,3 +205,10 @@ func (trq *transferRequest1_1) ToNet(w io.Writer) error {
 	}
 	return msg.MarshalCBOR(w)
 }
+
+// Capabilities returns the capabilities implied by the 1.1 protocol, which
+// cannot advertise them
+func (trq *transferRequest1_1) Capabilities() *datatransfer.Capabilities {
+	caps := datatransfer.LegacyCapabilities1_1
+	return &caps
+}
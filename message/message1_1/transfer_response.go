@@ -89,6 +89,38 @@ func (trsp *transferResponse1_1) EmptyVoucherResult() bool {
 	return trsp.VTyp == datatransfer.EmptyTypeIdentifier
 }
 
+// Transport always returns the default transport, as the 1.1 protocol cannot
+// select transports
+func (trsp *transferResponse1_1) Transport() datatransfer.TransportID {
+	return datatransfer.DefaultTransport
+}
+
+// TotalSize always returns zero, as the 1.1 protocol cannot carry a total size
+func (trsp *transferResponse1_1) TotalSize() uint64 {
+	return 0
+}
+
+// Receipt always returns nil, as the 1.1 protocol cannot carry a receipt
+func (trsp *transferResponse1_1) Receipt() *datatransfer.Receipt {
+	return nil
+}
+
+// ErrorCode always returns NoError, as the 1.1 protocol cannot carry errors
+func (trsp *transferResponse1_1) ErrorCode() datatransfer.ErrorCode {
+	return datatransfer.NoError
+}
+
+// ErrorMessage always returns an empty message, as the 1.1 protocol cannot
+// carry errors
+func (trsp *transferResponse1_1) ErrorMessage() string {
+	return ""
+}
+
+// Signature always returns nil, as the 1.1 protocol cannot carry a signature
+func (trsp *transferResponse1_1) Signature() []byte {
+	return nil
+}
+
 func (trsp *transferResponse1_1) MessageForProtocol(targetProtocol protocol.ID) (datatransfer.Message, error) {
 	switch targetProtocol {
 	case datatransfer.ProtocolDataTransfer1_1:
@@ -124,3 +156,10 @@ func (trsp *transferResponse1_1) ToNet(w io.Writer) error {
 	}
 	return msg.MarshalCBOR(w)
 }
+
+// Capabilities returns the capabilities implied by the 1.1 protocol, which
+// cannot advertise them
+func (trsp *transferResponse1_1) Capabilities() *datatransfer.Capabilities {
+	caps := datatransfer.LegacyCapabilities1_1
+	return &caps
+}
@@ -0,0 +1,395 @@
+package message1_2
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cborgen "github.com/whyrusleeping/cbor-gen"
+	xerrors "golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message/types"
+)
+
+// NewRequest generates a new request for the data transfer protocol
+func NewRequest(id datatransfer.TransferID, isRestart bool, isPull bool, vtype datatransfer.TypeIdentifier, voucher encoding.Encodable, baseCid cid.Cid, selector ipld.Node) (datatransfer.Request, error) {
+	vbytes, err := encoding.Encode(voucher)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	if baseCid == cid.Undef {
+		return nil, xerrors.Errorf("base CID must be defined")
+	}
+	selBytes, err := encoding.Encode(selector)
+	if err != nil {
+		return nil, xerrors.Errorf("Error encoding selector")
+	}
+
+	var typ uint64
+	if isRestart {
+		typ = uint64(types.RestartMessage)
+	} else {
+		typ = uint64(types.NewMessage)
+	}
+
+	return &transferRequest1_2{
+		Type:   typ,
+		Pull:   isPull,
+		Vouch:  &cborgen.Deferred{Raw: vbytes},
+		Stor:   &cborgen.Deferred{Raw: selBytes},
+		BCid:   &baseCid,
+		VTyp:   vtype,
+		XferID: uint64(id),
+	}, nil
+}
+
+// RestartExistingChannelRequest creates a request to ask the other side to restart an existing channel
+func RestartExistingChannelRequest(channelId datatransfer.ChannelID) datatransfer.Request {
+
+	return &transferRequest1_2{Type: uint64(types.RestartExistingChannelRequestMessage),
+		RestartChannel: channelId}
+}
+
+// CancelRequest request generates a request to cancel an in progress request
+func CancelRequest(id datatransfer.TransferID) datatransfer.Request {
+	return &transferRequest1_2{
+		Type:   uint64(types.CancelMessage),
+		XferID: uint64(id),
+	}
+}
+
+// UpdateRequest generates a new request update
+func UpdateRequest(id datatransfer.TransferID, isPaused bool) datatransfer.Request {
+	return &transferRequest1_2{
+		Type:   uint64(types.UpdateMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+	}
+}
+
+// VoucherRequest generates a new request for the data transfer protocol
+func VoucherRequest(id datatransfer.TransferID, vtype datatransfer.TypeIdentifier, voucher encoding.Encodable) (datatransfer.Request, error) {
+	vbytes, err := encoding.Encode(voucher)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferRequest1_2{
+		Type:   uint64(types.VoucherMessage),
+		Vouch:  &cborgen.Deferred{Raw: vbytes},
+		VTyp:   vtype,
+		XferID: uint64(id),
+	}, nil
+}
+
+// RestartResponse builds a new Data Transfer response
+func RestartResponse(id datatransfer.TransferID, accepted bool, isPaused bool, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	vbytes, err := encoding.Encode(voucherResult)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferResponse1_2{
+		Acpt:   accepted,
+		Type:   uint64(types.RestartMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+		VTyp:   voucherResultType,
+		VRes:   &cborgen.Deferred{Raw: vbytes},
+	}, nil
+}
+
+// NewResponse builds a new Data Transfer response
+func NewResponse(id datatransfer.TransferID, accepted bool, isPaused bool, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	vbytes, err := encoding.Encode(voucherResult)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferResponse1_2{
+		Acpt:   accepted,
+		Type:   uint64(types.NewMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+		VTyp:   voucherResultType,
+		VRes:   &cborgen.Deferred{Raw: vbytes},
+	}, nil
+}
+
+// VoucherResultResponse builds a new response for a voucher result
+func VoucherResultResponse(id datatransfer.TransferID, accepted bool, isPaused bool, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	vbytes, err := encoding.Encode(voucherResult)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferResponse1_2{
+		Acpt:   accepted,
+		Type:   uint64(types.VoucherResultMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+		VTyp:   voucherResultType,
+		VRes:   &cborgen.Deferred{Raw: vbytes},
+	}, nil
+}
+
+// UpdateResponse returns a new update response
+func UpdateResponse(id datatransfer.TransferID, isPaused bool) datatransfer.Response {
+	return &transferResponse1_2{
+		Type:   uint64(types.UpdateMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+	}
+}
+
+// CancelResponse makes a new cancel response message
+func CancelResponse(id datatransfer.TransferID) datatransfer.Response {
+	return &transferResponse1_2{
+		Type:   uint64(types.CancelMessage),
+		XferID: uint64(id),
+	}
+}
+
+// CompleteResponse returns a new complete response message
+func CompleteResponse(id datatransfer.TransferID, isAccepted bool, isPaused bool, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	vbytes, err := encoding.Encode(voucherResult)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferResponse1_2{
+		Type:   uint64(types.CompleteMessage),
+		Acpt:   isAccepted,
+		Paus:   isPaused,
+		VTyp:   voucherResultType,
+		VRes:   &cborgen.Deferred{Raw: vbytes},
+		XferID: uint64(id),
+	}, nil
+}
+
+// FromNet can read a network stream to deserialize a GraphSyncMessage
+func FromNet(r io.Reader) (datatransfer.Message, error) {
+	tresp := transferMessage1_2{}
+	err := tresp.UnmarshalCBOR(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if (tresp.IsRq && tresp.Request == nil) || (!tresp.IsRq && tresp.Response == nil) {
+		return nil, xerrors.Errorf("invalid/malformed message")
+	}
+
+	if tresp.IsRq {
+		return tresp.Request, nil
+	}
+	return tresp.Response, nil
+}
+
+// WithTraceCarrier returns a copy of the request that carries the given trace
+// context. Only the W3C trace context fields (traceparent and tracestate) are sent.
+// Requests that cannot carry a trace context are returned unchanged.
+func WithTraceCarrier(request datatransfer.Request, carrier map[string]string) datatransfer.Request {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok {
+		return request
+	}
+	traced := *trq
+	traced.TraceParent = carrier[traceParentField]
+	traced.TraceState = ""
+	if traced.TraceParent != "" {
+		traced.TraceState = carrier[traceStateField]
+	}
+	return &traced
+}
+
+// WithTransports returns a copy of the request that offers the given transports,
+// in order of preference.
+// Requests that cannot offer transports are returned unchanged.
+func WithTransports(request datatransfer.Request, transports []datatransfer.TransportID) datatransfer.Request {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok {
+		return request
+	}
+	offered := *trq
+	offered.Transps = transportOffers(transports)
+	return &offered
+}
+
+// WithTransport returns a copy of the response that records the transport
+// chosen for the channel.
+// Responses that cannot record a transport are returned unchanged.
+func WithTransport(response datatransfer.Response, transport datatransfer.TransportID) datatransfer.Response {
+	trsp, ok := response.(*transferResponse1_2)
+	if !ok {
+		return response
+	}
+	chosen := *trsp
+	chosen.Transp = transport
+	return &chosen
+}
+
+// WithRequestError returns a copy of the request that says why the sender
+// cancelled the channel.
+// Requests that cannot carry an error are returned unchanged.
+func WithRequestError(request datatransfer.Request, code datatransfer.ErrorCode, msg string) datatransfer.Request {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok {
+		return request
+	}
+	failed := *trq
+	failed.ErrCode = code
+	failed.ErrMsg = msg
+	return &failed
+}
+
+// WithResponseError returns a copy of the response that says why the responder
+// rejected or cancelled the channel.
+// Responses that cannot carry an error are returned unchanged.
+func WithResponseError(response datatransfer.Response, code datatransfer.ErrorCode, msg string) datatransfer.Response {
+	trsp, ok := response.(*transferResponse1_2)
+	if !ok {
+		return response
+	}
+	failed := *trsp
+	failed.ErrCode = code
+	failed.ErrMsg = msg
+	return &failed
+}
+
+// WithRequestCapabilities returns a copy of the request that advertises the
+// given capabilities of the sender.
+// Requests that cannot advertise capabilities are returned unchanged.
+func WithRequestCapabilities(request datatransfer.Request, caps datatransfer.Capabilities) datatransfer.Request {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok {
+		return request
+	}
+	advertised := *trq
+	advertised.Caps = encodeCapabilities(&caps)
+	return &advertised
+}
+
+// WithRequestPriority returns a copy of the request that sets the given
+// priority for the channel.
+// Requests that cannot carry a priority are returned unchanged.
+func WithRequestPriority(request datatransfer.Request, priority int) datatransfer.Request {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok {
+		return request
+	}
+	prioritized := *trq
+	prioritized.Prio = int64(priority)
+	return &prioritized
+}
+
+// WithRequestPaused returns a copy of a request that opens a channel, which
+// opens it paused by the sender
+func WithRequestPaused(request datatransfer.Request) datatransfer.Request {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok {
+		return request
+	}
+	paused := *trq
+	paused.Paus = true
+	return &paused
+}
+
+// WithRequestTotalSize returns a copy of the request that declares the total
+// size of the data for the channel.
+// Requests that cannot carry a total size are returned unchanged.
+func WithRequestTotalSize(request datatransfer.Request, size uint64) datatransfer.Request {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok {
+		return request
+	}
+	sized := *trq
+	sized.Size = size
+	return &sized
+}
+
+// WithResponseTotalSize returns a copy of the response that carries the total
+// size of the data the responder sent.
+// Responses that cannot carry a total size are returned unchanged.
+func WithResponseTotalSize(response datatransfer.Response, size uint64) datatransfer.Response {
+	trsp, ok := response.(*transferResponse1_2)
+	if !ok {
+		return response
+	}
+	sized := *trsp
+	sized.Size = size
+	return &sized
+}
+
+// WithResponseReceipt returns a copy of the response that carries the receipt
+// the responder computed for the data of the channel.
+// Responses that cannot carry a receipt are returned unchanged.
+func WithResponseReceipt(response datatransfer.Response, receipt datatransfer.Receipt) datatransfer.Response {
+	trsp, ok := response.(*transferResponse1_2)
+	if !ok {
+		return response
+	}
+	receipted := *trsp
+	receipted.Rcpt = encodeReceipt(&receipt)
+	return &receipted
+}
+
+// WithRequestSignature returns a copy of the request that carries the given
+// signature of the sender.
+// Requests that cannot carry a signature are returned unchanged.
+func WithRequestSignature(request datatransfer.Request, sig []byte) datatransfer.Request {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok {
+		return request
+	}
+	signed := *trq
+	signed.Sig = sig
+	return &signed
+}
+
+// WithResponseSignature returns a copy of the response that carries the given
+// signature of the responder.
+// Responses that cannot carry a signature are returned unchanged.
+func WithResponseSignature(response datatransfer.Response, sig []byte) datatransfer.Response {
+	trsp, ok := response.(*transferResponse1_2)
+	if !ok {
+		return response
+	}
+	signed := *trsp
+	signed.Sig = sig
+	return &signed
+}
+
+// SignedBytes returns the bytes a signature of the message is over, which are
+// the CBOR encoding of the message without its signature. It errors for
+// messages that cannot carry a signature.
+func SignedBytes(msg datatransfer.Message) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	switch m := msg.(type) {
+	case *transferRequest1_2:
+		unsigned := *m
+		unsigned.Sig = nil
+		if err := unsigned.MarshalCBOR(buf); err != nil {
+			return nil, err
+		}
+	case *transferResponse1_2:
+		unsigned := *m
+		unsigned.Sig = nil
+		if err := unsigned.MarshalCBOR(buf); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, xerrors.New("message cannot be signed")
+	}
+	return buf.Bytes(), nil
+}
+
+// WithResponseCapabilities returns a copy of the response that advertises the
+// given capabilities of the responder.
+// Responses that cannot advertise capabilities are returned unchanged.
+func WithResponseCapabilities(response datatransfer.Response, caps datatransfer.Capabilities) datatransfer.Response {
+	trsp, ok := response.(*transferResponse1_2)
+	if !ok {
+		return response
+	}
+	advertised := *trsp
+	advertised.Caps = encodeCapabilities(&caps)
+	return &advertised
+}
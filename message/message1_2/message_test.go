@@ -0,0 +1,725 @@
+package message1_2_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message/message1_2"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestNewRequest(t *testing.T) {
+	baseCid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	isPull := true
+	id := datatransfer.TransferID(rand.Int31())
+	voucher := testutil.NewFakeDTType()
+	request, err := message1_2.NewRequest(id, false, isPull, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+	assert.Equal(t, id, request.TransferID())
+	assert.False(t, request.IsCancel())
+	assert.False(t, request.IsUpdate())
+	assert.True(t, request.IsPull())
+	assert.True(t, request.IsRequest())
+	assert.Equal(t, baseCid.String(), request.BaseCid().String())
+	testutil.AssertFakeDTVoucher(t, request, voucher)
+	receivedSelector, err := request.Selector()
+	require.NoError(t, err)
+	require.Equal(t, selector, receivedSelector)
+	// Sanity check to make sure we can cast to datatransfer.Message
+	msg, ok := request.(datatransfer.Message)
+	require.True(t, ok)
+
+	assert.True(t, msg.IsRequest())
+	assert.Equal(t, request.TransferID(), msg.TransferID())
+	assert.False(t, msg.IsRestart())
+	assert.True(t, msg.IsNew())
+}
+
+func TestRestartRequest(t *testing.T) {
+	baseCid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	isPull := true
+	id := datatransfer.TransferID(rand.Int31())
+	voucher := testutil.NewFakeDTType()
+	request, err := message1_2.NewRequest(id, true, isPull, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+	assert.Equal(t, id, request.TransferID())
+	assert.False(t, request.IsCancel())
+	assert.False(t, request.IsUpdate())
+	assert.True(t, request.IsPull())
+	assert.True(t, request.IsRequest())
+	assert.Equal(t, baseCid.String(), request.BaseCid().String())
+	testutil.AssertFakeDTVoucher(t, request, voucher)
+	receivedSelector, err := request.Selector()
+	require.NoError(t, err)
+	require.Equal(t, selector, receivedSelector)
+	// Sanity check to make sure we can cast to datatransfer.Message
+	msg, ok := request.(datatransfer.Message)
+	require.True(t, ok)
+
+	assert.True(t, msg.IsRequest())
+	assert.Equal(t, request.TransferID(), msg.TransferID())
+	assert.True(t, msg.IsRestart())
+	assert.False(t, msg.IsNew())
+}
+
+func TestRestartExistingChannelRequest(t *testing.T) {
+	peers := testutil.GeneratePeers(2)
+	tid := uint64(1)
+	chid := datatransfer.ChannelID{Initiator: peers[0],
+		Responder: peers[1], ID: datatransfer.TransferID(tid)}
+	req := message1_2.RestartExistingChannelRequest(chid)
+
+	wbuf := new(bytes.Buffer)
+	require.NoError(t, req.ToNet(wbuf))
+
+	desMsg, err := message1_2.FromNet(wbuf)
+	require.NoError(t, err)
+	req, ok := (desMsg).(datatransfer.Request)
+	require.True(t, ok)
+	require.True(t, req.IsRestartExistingChannelRequest())
+	achid, err := req.RestartChannelId()
+	require.NoError(t, err)
+	require.Equal(t, chid, achid)
+}
+
+func TestTransferRequest_MarshalCBOR(t *testing.T) {
+	// sanity check MarshalCBOR does its thing w/o error
+	req, err := NewTestTransferRequest()
+	require.NoError(t, err)
+	wbuf := new(bytes.Buffer)
+	require.NoError(t, req.MarshalCBOR(wbuf))
+	assert.Greater(t, wbuf.Len(), 0)
+}
+func TestTransferRequest_UnmarshalCBOR(t *testing.T) {
+	req, err := NewTestTransferRequest()
+	require.NoError(t, err)
+	wbuf := new(bytes.Buffer)
+	// use ToNet / FromNet
+	require.NoError(t, req.ToNet(wbuf))
+
+	desMsg, err := message1_2.FromNet(wbuf)
+	require.NoError(t, err)
+
+	// Verify round-trip
+	assert.Equal(t, req.TransferID(), desMsg.TransferID())
+	assert.Equal(t, req.IsRequest(), desMsg.IsRequest())
+
+	desReq := desMsg.(datatransfer.Request)
+	assert.Equal(t, req.IsPull(), desReq.IsPull())
+	assert.Equal(t, req.IsCancel(), desReq.IsCancel())
+	assert.Equal(t, req.BaseCid(), desReq.BaseCid())
+	testutil.AssertEqualFakeDTVoucher(t, req, desReq)
+	testutil.AssertEqualSelector(t, req, desReq)
+}
+
+func TestResponses(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	voucherResult := testutil.NewFakeDTType()
+	response, err := message1_2.NewResponse(id, false, true, voucherResult.Type(), voucherResult) // not accepted
+	require.NoError(t, err)
+	assert.Equal(t, response.TransferID(), id)
+	assert.False(t, response.Accepted())
+	assert.True(t, response.IsNew())
+	assert.False(t, response.IsUpdate())
+	assert.True(t, response.IsPaused())
+	assert.False(t, response.IsRequest())
+	testutil.AssertFakeDTVoucherResult(t, response, voucherResult)
+	// Sanity check to make sure we can cast to datatransfer.Message
+	msg, ok := response.(datatransfer.Message)
+	require.True(t, ok)
+
+	assert.False(t, msg.IsRequest())
+	assert.True(t, msg.IsNew())
+	assert.False(t, msg.IsUpdate())
+	assert.True(t, msg.IsPaused())
+	assert.Equal(t, response.TransferID(), msg.TransferID())
+}
+
+func TestTransferResponse_MarshalCBOR(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	voucherResult := testutil.NewFakeDTType()
+	response, err := message1_2.NewResponse(id, true, false, voucherResult.Type(), voucherResult) // accepted
+	require.NoError(t, err)
+
+	// sanity check that we can marshal data
+	wbuf := new(bytes.Buffer)
+	require.NoError(t, response.ToNet(wbuf))
+	assert.Greater(t, wbuf.Len(), 0)
+}
+
+func TestTransferResponse_UnmarshalCBOR(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	voucherResult := testutil.NewFakeDTType()
+	response, err := message1_2.NewResponse(id, true, false, voucherResult.Type(), voucherResult) // accepted
+	require.NoError(t, err)
+
+	wbuf := new(bytes.Buffer)
+	require.NoError(t, response.ToNet(wbuf))
+
+	// verify round trip
+	desMsg, err := message1_2.FromNet(wbuf)
+	require.NoError(t, err)
+	assert.False(t, desMsg.IsRequest())
+	assert.True(t, desMsg.IsNew())
+	assert.False(t, desMsg.IsUpdate())
+	assert.False(t, desMsg.IsPaused())
+	assert.Equal(t, id, desMsg.TransferID())
+
+	desResp, ok := desMsg.(datatransfer.Response)
+	require.True(t, ok)
+	assert.True(t, desResp.Accepted())
+	assert.True(t, desResp.IsNew())
+	assert.False(t, desResp.IsUpdate())
+	assert.False(t, desMsg.IsPaused())
+	testutil.AssertFakeDTVoucherResult(t, desResp, voucherResult)
+}
+
+func TestRequestCancel(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	req := message1_2.CancelRequest(id)
+	require.Equal(t, req.TransferID(), id)
+	require.True(t, req.IsRequest())
+	require.True(t, req.IsCancel())
+	require.False(t, req.IsUpdate())
+
+	wbuf := new(bytes.Buffer)
+	require.NoError(t, req.ToNet(wbuf))
+
+	deserialized, err := message1_2.FromNet(wbuf)
+	require.NoError(t, err)
+
+	deserializedRequest, ok := deserialized.(datatransfer.Request)
+	require.True(t, ok)
+	require.Equal(t, deserializedRequest.TransferID(), req.TransferID())
+	require.Equal(t, deserializedRequest.IsCancel(), req.IsCancel())
+	require.Equal(t, deserializedRequest.IsRequest(), req.IsRequest())
+	require.Equal(t, deserializedRequest.IsUpdate(), req.IsUpdate())
+}
+
+func TestRequestUpdate(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	req := message1_2.UpdateRequest(id, true)
+	require.Equal(t, req.TransferID(), id)
+	require.True(t, req.IsRequest())
+	require.False(t, req.IsCancel())
+	require.True(t, req.IsUpdate())
+	require.True(t, req.IsPaused())
+
+	wbuf := new(bytes.Buffer)
+	require.NoError(t, req.ToNet(wbuf))
+
+	deserialized, err := message1_2.FromNet(wbuf)
+	require.NoError(t, err)
+
+	deserializedRequest, ok := deserialized.(datatransfer.Request)
+	require.True(t, ok)
+	require.Equal(t, deserializedRequest.TransferID(), req.TransferID())
+	require.Equal(t, deserializedRequest.IsCancel(), req.IsCancel())
+	require.Equal(t, deserializedRequest.IsRequest(), req.IsRequest())
+	require.Equal(t, deserializedRequest.IsUpdate(), req.IsUpdate())
+	require.Equal(t, deserializedRequest.IsPaused(), req.IsPaused())
+}
+
+func TestUpdateResponse(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	response := message1_2.UpdateResponse(id, true) // not accepted
+	assert.Equal(t, response.TransferID(), id)
+	assert.False(t, response.Accepted())
+	assert.False(t, response.IsNew())
+	assert.True(t, response.IsUpdate())
+	assert.True(t, response.IsPaused())
+	assert.False(t, response.IsRequest())
+
+	// Sanity check to make sure we can cast to datatransfer.Message
+	msg, ok := response.(datatransfer.Message)
+	require.True(t, ok)
+
+	assert.False(t, msg.IsRequest())
+	assert.False(t, msg.IsNew())
+	assert.True(t, msg.IsUpdate())
+	assert.True(t, msg.IsPaused())
+	assert.Equal(t, response.TransferID(), msg.TransferID())
+}
+
+func TestCancelResponse(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	response := message1_2.CancelResponse(id)
+	assert.Equal(t, response.TransferID(), id)
+	assert.False(t, response.IsNew())
+	assert.False(t, response.IsUpdate())
+	assert.True(t, response.IsCancel())
+	assert.False(t, response.IsRequest())
+	// Sanity check to make sure we can cast to datatransfer.Message
+	msg, ok := response.(datatransfer.Message)
+	require.True(t, ok)
+
+	assert.False(t, msg.IsRequest())
+	assert.False(t, msg.IsNew())
+	assert.False(t, msg.IsUpdate())
+	assert.True(t, msg.IsCancel())
+	assert.Equal(t, response.TransferID(), msg.TransferID())
+}
+
+func TestCompleteResponse(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	response, err := message1_2.CompleteResponse(id, true, true, datatransfer.EmptyTypeIdentifier, nil)
+	require.NoError(t, err)
+	assert.Equal(t, response.TransferID(), id)
+	assert.False(t, response.IsNew())
+	assert.False(t, response.IsUpdate())
+	assert.True(t, response.IsPaused())
+	assert.True(t, response.IsVoucherResult())
+	assert.True(t, response.EmptyVoucherResult())
+	assert.True(t, response.IsComplete())
+	assert.False(t, response.IsRequest())
+	// Sanity check to make sure we can cast to datatransfer.Message
+	msg, ok := response.(datatransfer.Message)
+	require.True(t, ok)
+
+	assert.False(t, msg.IsRequest())
+	assert.False(t, msg.IsNew())
+	assert.False(t, msg.IsUpdate())
+	assert.Equal(t, response.TransferID(), msg.TransferID())
+}
+func TestToNetFromNetEquivalency(t *testing.T) {
+	baseCid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	isPull := false
+	id := datatransfer.TransferID(rand.Int31())
+	accepted := false
+	voucher := testutil.NewFakeDTType()
+	voucherResult := testutil.NewFakeDTType()
+	request, err := message1_2.NewRequest(id, false, isPull, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	err = request.ToNet(buf)
+	require.NoError(t, err)
+	require.Greater(t, buf.Len(), 0)
+	deserialized, err := message1_2.FromNet(buf)
+	require.NoError(t, err)
+
+	deserializedRequest, ok := deserialized.(datatransfer.Request)
+	require.True(t, ok)
+
+	require.Equal(t, deserializedRequest.TransferID(), request.TransferID())
+	require.Equal(t, deserializedRequest.IsCancel(), request.IsCancel())
+	require.Equal(t, deserializedRequest.IsPull(), request.IsPull())
+	require.Equal(t, deserializedRequest.IsRequest(), request.IsRequest())
+	require.Equal(t, deserializedRequest.BaseCid(), request.BaseCid())
+	testutil.AssertEqualFakeDTVoucher(t, request, deserializedRequest)
+	testutil.AssertEqualSelector(t, request, deserializedRequest)
+
+	response, err := message1_2.NewResponse(id, accepted, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+	err = response.ToNet(buf)
+	require.NoError(t, err)
+	deserialized, err = message1_2.FromNet(buf)
+	require.NoError(t, err)
+
+	deserializedResponse, ok := deserialized.(datatransfer.Response)
+	require.True(t, ok)
+
+	require.Equal(t, deserializedResponse.TransferID(), response.TransferID())
+	require.Equal(t, deserializedResponse.Accepted(), response.Accepted())
+	require.Equal(t, deserializedResponse.IsRequest(), response.IsRequest())
+	require.Equal(t, deserializedResponse.IsUpdate(), response.IsUpdate())
+	require.Equal(t, deserializedResponse.IsPaused(), response.IsPaused())
+	testutil.AssertEqualFakeDTVoucherResult(t, response, deserializedResponse)
+
+	request = message1_2.CancelRequest(id)
+	err = request.ToNet(buf)
+	require.NoError(t, err)
+	deserialized, err = message1_2.FromNet(buf)
+	require.NoError(t, err)
+
+	deserializedRequest, ok = deserialized.(datatransfer.Request)
+	require.True(t, ok)
+
+	require.Equal(t, deserializedRequest.TransferID(), request.TransferID())
+	require.Equal(t, deserializedRequest.IsCancel(), request.IsCancel())
+	require.Equal(t, deserializedRequest.IsRequest(), request.IsRequest())
+}
+
+func TestTraceCarrier(t *testing.T) {
+	baseCid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	id := datatransfer.TransferID(rand.Int31())
+	voucher := testutil.NewFakeDTType()
+	request, err := message1_2.NewRequest(id, false, false, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+	require.Nil(t, request.TraceCarrier())
+
+	untracedBuf := new(bytes.Buffer)
+	require.NoError(t, request.ToNet(untracedBuf))
+
+	// an empty trace context is encoded like no trace context
+	emptyTraced := message1_2.WithTraceCarrier(request, map[string]string{})
+	emptyTracedBuf := new(bytes.Buffer)
+	require.NoError(t, emptyTraced.ToNet(emptyTracedBuf))
+	require.Equal(t, untracedBuf.Bytes(), emptyTracedBuf.Bytes())
+
+	carrier := map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"tracestate":  "congo=t61rcWkgMzE",
+	}
+	traced := message1_2.WithTraceCarrier(request, carrier)
+	require.Equal(t, carrier, traced.TraceCarrier())
+	// the original request is not modified
+	require.Nil(t, request.TraceCarrier())
+
+	tracedBuf := new(bytes.Buffer)
+	require.NoError(t, traced.ToNet(tracedBuf))
+	deserialized, err := message1_2.FromNet(tracedBuf)
+	require.NoError(t, err)
+	deserializedRequest, ok := deserialized.(datatransfer.Request)
+	require.True(t, ok)
+	require.Equal(t, carrier, deserializedRequest.TraceCarrier())
+	require.Equal(t, request.TransferID(), deserializedRequest.TransferID())
+	require.Equal(t, request.BaseCid(), deserializedRequest.BaseCid())
+	testutil.AssertEqualFakeDTVoucher(t, request, deserializedRequest)
+
+	deserialized, err = message1_2.FromNet(untracedBuf)
+	require.NoError(t, err)
+	deserializedRequest, ok = deserialized.(datatransfer.Request)
+	require.True(t, ok)
+	require.Nil(t, deserializedRequest.TraceCarrier())
+
+	// the 1.0 and 1.1 protocols cannot carry a trace context
+	for _, legacyProtocol := range []protocol.ID{datatransfer.ProtocolDataTransfer1_0, datatransfer.ProtocolDataTransfer1_1} {
+		legacy, err := traced.MessageForProtocol(legacyProtocol)
+		require.NoError(t, err)
+		require.Nil(t, legacy.(datatransfer.Request).TraceCarrier())
+	}
+}
+
+func TestTransports(t *testing.T) {
+	baseCid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	id := datatransfer.TransferID(rand.Int31())
+	voucher := testutil.NewFakeDTType()
+	request, err := message1_2.NewRequest(id, false, false, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+	require.Nil(t, request.Transports())
+
+	plainBuf := new(bytes.Buffer)
+	require.NoError(t, request.ToNet(plainBuf))
+
+	// an empty offer is encoded like no offer
+	noOffer := message1_2.WithTransports(request, nil)
+	noOfferBuf := new(bytes.Buffer)
+	require.NoError(t, noOffer.ToNet(noOfferBuf))
+	require.Equal(t, plainBuf.Bytes(), noOfferBuf.Bytes())
+
+	offered := []datatransfer.TransportID{"stream", datatransfer.DefaultTransport}
+	offer := message1_2.WithTransports(request, offered)
+	require.Equal(t, offered, offer.Transports())
+	require.Nil(t, request.Transports())
+
+	offerBuf := new(bytes.Buffer)
+	require.NoError(t, offer.ToNet(offerBuf))
+	deserialized, err := message1_2.FromNet(offerBuf)
+	require.NoError(t, err)
+	deserializedRequest, ok := deserialized.(datatransfer.Request)
+	require.True(t, ok)
+	require.Equal(t, offered, deserializedRequest.Transports())
+	require.Nil(t, deserializedRequest.TraceCarrier())
+	testutil.AssertEqualFakeDTVoucher(t, request, deserializedRequest)
+
+	response, err := message1_2.NewResponse(id, true, false, voucher.Type(), voucher)
+	require.NoError(t, err)
+	require.Equal(t, datatransfer.DefaultTransport, response.Transport())
+
+	plainBuf = new(bytes.Buffer)
+	require.NoError(t, response.ToNet(plainBuf))
+
+	// choosing the default transport is encoded like choosing no transport
+	defaultChoice := message1_2.WithTransport(response, datatransfer.DefaultTransport)
+	defaultChoiceBuf := new(bytes.Buffer)
+	require.NoError(t, defaultChoice.ToNet(defaultChoiceBuf))
+	require.Equal(t, plainBuf.Bytes(), defaultChoiceBuf.Bytes())
+
+	choice := message1_2.WithTransport(response, "stream")
+	require.Equal(t, datatransfer.TransportID("stream"), choice.Transport())
+	require.Equal(t, datatransfer.DefaultTransport, response.Transport())
+
+	choiceBuf := new(bytes.Buffer)
+	require.NoError(t, choice.ToNet(choiceBuf))
+	deserialized, err = message1_2.FromNet(choiceBuf)
+	require.NoError(t, err)
+	deserializedResponse, ok := deserialized.(datatransfer.Response)
+	require.True(t, ok)
+	require.Equal(t, datatransfer.TransportID("stream"), deserializedResponse.Transport())
+	require.True(t, deserializedResponse.Accepted())
+
+	// the 1.0 and 1.1 protocols cannot select transports
+	for _, legacyProtocol := range []protocol.ID{datatransfer.ProtocolDataTransfer1_0, datatransfer.ProtocolDataTransfer1_1} {
+		legacy, err := offer.MessageForProtocol(legacyProtocol)
+		require.NoError(t, err)
+		require.Nil(t, legacy.(datatransfer.Request).Transports())
+		legacy, err = choice.MessageForProtocol(legacyProtocol)
+		require.NoError(t, err)
+		require.Equal(t, datatransfer.DefaultTransport, legacy.(datatransfer.Response).Transport())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	voucherResult := testutil.NewFakeDTType()
+	response, err := message1_2.NewResponse(id, false, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+	require.Equal(t, datatransfer.NoError, response.ErrorCode())
+	require.Empty(t, response.ErrorMessage())
+
+	rejected := message1_2.WithResponseError(response, datatransfer.ErrorResourceExhausted, "too many transfers")
+	require.Equal(t, datatransfer.ErrorResourceExhausted, rejected.ErrorCode())
+	require.Equal(t, "too many transfers", rejected.ErrorMessage())
+	// the original response is not modified
+	require.Equal(t, datatransfer.NoError, response.ErrorCode())
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, rejected.ToNet(buf))
+	deserialized, err := message1_2.FromNet(buf)
+	require.NoError(t, err)
+	deserializedResponse, ok := deserialized.(datatransfer.Response)
+	require.True(t, ok)
+	require.False(t, deserializedResponse.Accepted())
+	require.Equal(t, datatransfer.ErrorResourceExhausted, deserializedResponse.ErrorCode())
+	require.Equal(t, "too many transfers", deserializedResponse.ErrorMessage())
+
+	cancelResponse := message1_2.WithResponseError(message1_2.CancelResponse(id), datatransfer.ErrorInternal, "failed")
+	buf = new(bytes.Buffer)
+	require.NoError(t, cancelResponse.ToNet(buf))
+	deserialized, err = message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.True(t, deserialized.IsCancel())
+	require.Equal(t, datatransfer.ErrorInternal, deserialized.ErrorCode())
+	require.Equal(t, "failed", deserialized.ErrorMessage())
+
+	cancelRequest := message1_2.WithRequestError(message1_2.CancelRequest(id), datatransfer.ErrorUnknownChannel, "no such channel")
+	buf = new(bytes.Buffer)
+	require.NoError(t, cancelRequest.ToNet(buf))
+	deserialized, err = message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.True(t, deserialized.IsRequest())
+	require.True(t, deserialized.IsCancel())
+	require.Equal(t, datatransfer.ErrorUnknownChannel, deserialized.ErrorCode())
+	require.Equal(t, "no such channel", deserialized.ErrorMessage())
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := datatransfer.Capabilities{
+		Restart:        true,
+		Pause:          true,
+		Transports:     []datatransfer.TransportID{"graphsync", "stream"},
+		Compression:    []string{"gzip"},
+		MaxMessageSize: 1 << 20,
+	}
+
+	request, err := NewTestTransferRequest()
+	require.NoError(t, err)
+	require.Nil(t, request.Capabilities())
+	advertised := message1_2.WithRequestCapabilities(request, caps)
+	require.Equal(t, &caps, advertised.Capabilities())
+	// the original request is not modified
+	require.Nil(t, request.Capabilities())
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, advertised.ToNet(buf))
+	deserialized, err := message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.Equal(t, &caps, deserialized.Capabilities())
+
+	id := datatransfer.TransferID(rand.Int31())
+	response, err := message1_2.NewResponse(id, true, false, datatransfer.EmptyTypeIdentifier, nil)
+	require.NoError(t, err)
+	require.Nil(t, response.Capabilities())
+	noRestart := datatransfer.Capabilities{Pause: true}
+	advertisedResponse := message1_2.WithResponseCapabilities(response, noRestart)
+	buf = new(bytes.Buffer)
+	require.NoError(t, advertisedResponse.ToNet(buf))
+	deserialized, err = message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.Equal(t, &noRestart, deserialized.Capabilities())
+
+	// older protocols cannot advertise capabilities, so a message converted
+	// to them reports the capabilities the protocol implies
+	legacy, err := advertised.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+	require.NoError(t, err)
+	require.Equal(t, &datatransfer.LegacyCapabilities1_1, legacy.Capabilities())
+	legacy, err = advertised.MessageForProtocol(datatransfer.ProtocolDataTransfer1_0)
+	require.NoError(t, err)
+	require.Equal(t, &datatransfer.LegacyCapabilities1_0, legacy.Capabilities())
+}
+
+func TestPriority(t *testing.T) {
+	request, err := NewTestTransferRequest()
+	require.NoError(t, err)
+	require.Equal(t, 0, request.Priority())
+	prioritized := message1_2.WithRequestPriority(request, -3)
+	require.Equal(t, -3, prioritized.Priority())
+	// the original request is not modified
+	require.Equal(t, 0, request.Priority())
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, prioritized.ToNet(buf))
+	deserialized, err := message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.Equal(t, -3, deserialized.(datatransfer.Request).Priority())
+
+	// older protocols cannot carry a priority
+	legacy, err := prioritized.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+	require.NoError(t, err)
+	require.Equal(t, 0, legacy.(datatransfer.Request).Priority())
+}
+
+func TestRequestPaused(t *testing.T) {
+	request, err := NewTestTransferRequest()
+	require.NoError(t, err)
+	require.False(t, request.IsPaused())
+	paused := message1_2.WithRequestPaused(request)
+	require.True(t, paused.IsPaused())
+	// the original request is not modified
+	require.False(t, request.IsPaused())
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, paused.ToNet(buf))
+	deserialized, err := message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.True(t, deserialized.(datatransfer.Request).IsPaused())
+
+	legacy, err := paused.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+	require.NoError(t, err)
+	require.True(t, legacy.(datatransfer.Request).IsPaused())
+}
+
+func TestTotalSize(t *testing.T) {
+	request, err := NewTestTransferRequest()
+	require.NoError(t, err)
+	require.Zero(t, request.TotalSize())
+	sized := message1_2.WithRequestTotalSize(request, 1000)
+	require.Equal(t, uint64(1000), sized.TotalSize())
+	// the original request is not modified
+	require.Zero(t, request.TotalSize())
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, sized.ToNet(buf))
+	deserialized, err := message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), deserialized.(datatransfer.Request).TotalSize())
+
+	response, err := message1_2.CompleteResponse(request.TransferID(), true, false, datatransfer.EmptyTypeIdentifier, nil)
+	require.NoError(t, err)
+	require.Zero(t, response.TotalSize())
+	sizedResponse := message1_2.WithResponseTotalSize(response, 900)
+	require.Equal(t, uint64(900), sizedResponse.TotalSize())
+
+	buf = new(bytes.Buffer)
+	require.NoError(t, sizedResponse.ToNet(buf))
+	deserialized, err = message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.Equal(t, uint64(900), deserialized.(datatransfer.Response).TotalSize())
+
+	// older protocols cannot carry a total size
+	legacy, err := sized.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+	require.NoError(t, err)
+	require.Zero(t, legacy.(datatransfer.Request).TotalSize())
+}
+
+func TestReceipt(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	response, err := message1_2.CompleteResponse(id, true, false, datatransfer.EmptyTypeIdentifier, nil)
+	require.NoError(t, err)
+	require.Nil(t, response.Receipt())
+	receipt := datatransfer.Receipt{Blocks: 10, Bytes: 2000, Hash: []byte("receipt hash")}
+	receipted := message1_2.WithResponseReceipt(response, receipt)
+	require.Equal(t, &receipt, receipted.Receipt())
+	// the original response is not modified
+	require.Nil(t, response.Receipt())
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, receipted.ToNet(buf))
+	deserialized, err := message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.Equal(t, &receipt, deserialized.(datatransfer.Response).Receipt())
+
+	// older protocols cannot carry a receipt
+	legacy, err := receipted.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+	require.NoError(t, err)
+	require.Nil(t, legacy.(datatransfer.Response).Receipt())
+}
+
+func TestSignature(t *testing.T) {
+	request, err := NewTestTransferRequest()
+	require.NoError(t, err)
+	require.Nil(t, request.Signature())
+	signedBytes, err := message1_2.SignedBytes(request)
+	require.NoError(t, err)
+	signed := message1_2.WithRequestSignature(request, []byte("request signature"))
+	require.Equal(t, []byte("request signature"), signed.Signature())
+	// the original request is not modified
+	require.Nil(t, request.Signature())
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, signed.ToNet(buf))
+	deserialized, err := message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("request signature"), deserialized.Signature())
+	// the signature is over the message without the signature
+	deserializedBytes, err := message1_2.SignedBytes(deserialized)
+	require.NoError(t, err)
+	require.Equal(t, signedBytes, deserializedBytes)
+
+	response, err := message1_2.CompleteResponse(request.TransferID(), true, false, datatransfer.EmptyTypeIdentifier, nil)
+	require.NoError(t, err)
+	signedBytes, err = message1_2.SignedBytes(response)
+	require.NoError(t, err)
+	signedResponse := message1_2.WithResponseSignature(response, []byte("response signature"))
+	buf = new(bytes.Buffer)
+	require.NoError(t, signedResponse.ToNet(buf))
+	deserialized, err = message1_2.FromNet(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("response signature"), deserialized.Signature())
+	deserializedBytes, err = message1_2.SignedBytes(deserialized)
+	require.NoError(t, err)
+	require.Equal(t, signedBytes, deserializedBytes)
+
+	// older protocols cannot carry a signature
+	legacy, err := signed.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+	require.NoError(t, err)
+	require.Nil(t, legacy.Signature())
+	_, err = message1_2.SignedBytes(legacy)
+	require.Error(t, err)
+}
+
+func TestFromNetMessageValidation(t *testing.T) {
+	// craft request message with nil request struct
+	buf := []byte{0x83, 0xf5, 0xf6, 0xf6}
+	msg, err := message1_2.FromNet(bytes.NewBuffer(buf))
+	assert.Error(t, err)
+	assert.Nil(t, msg)
+
+	// craft response message with nil response struct
+	buf = []byte{0x83, 0xf4, 0xf6, 0xf6}
+	msg, err = message1_2.FromNet(bytes.NewBuffer(buf))
+	assert.Error(t, err)
+	assert.Nil(t, msg)
+}
+
+func NewTestTransferRequest() (datatransfer.Request, error) {
+	bcid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	isPull := false
+	id := datatransfer.TransferID(rand.Int31())
+	voucher := testutil.NewFakeDTType()
+	return message1_2.NewRequest(id, false, isPull, voucher.Type(), voucher, bcid, selector)
+}
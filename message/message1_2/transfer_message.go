@@ -0,0 +1,147 @@
+package message1_2
+
+import (
+	"io"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+//go:generate cbor-gen-for --map-encoding transferMessage1_2 transportOffer1_2 capabilities1_2 compression1_2 receipt1_2
+
+// transferMessage1_2 is the transfer message for the 1.2 Data Transfer Protocol.
+type transferMessage1_2 struct {
+	IsRq bool
+
+	Request  *transferRequest1_2
+	Response *transferResponse1_2
+}
+
+// transportOffer1_2 is a transport offered in a request
+type transportOffer1_2 struct {
+	ID datatransfer.TransportID
+}
+
+// capabilities1_2 are the capabilities advertised by the sender of a message
+type capabilities1_2 struct {
+	Restart     bool
+	Pause       bool
+	Transps     []transportOffer1_2
+	Compression []compression1_2
+	MaxMsgSize  uint64
+}
+
+// compression1_2 is a compression scheme the sender can decode
+type compression1_2 struct {
+	Name string
+}
+
+// receipt1_2 is the receipt the responder computed for the data of a channel
+type receipt1_2 struct {
+	Blocks uint64
+	Bytes  uint64
+	Hash   []byte
+}
+
+const (
+	traceParentField = "traceparent"
+	traceStateField  = "tracestate"
+)
+
+func transportOffers(transports []datatransfer.TransportID) []transportOffer1_2 {
+	if len(transports) == 0 {
+		return nil
+	}
+	offers := make([]transportOffer1_2, 0, len(transports))
+	for _, id := range transports {
+		offers = append(offers, transportOffer1_2{ID: id})
+	}
+	return offers
+}
+
+func offeredTransports(offers []transportOffer1_2) []datatransfer.TransportID {
+	if len(offers) == 0 {
+		return nil
+	}
+	transports := make([]datatransfer.TransportID, 0, len(offers))
+	for _, offer := range offers {
+		transports = append(transports, offer.ID)
+	}
+	return transports
+}
+
+func encodeCapabilities(caps *datatransfer.Capabilities) *capabilities1_2 {
+	if caps == nil {
+		return nil
+	}
+	var compression []compression1_2
+	for _, name := range caps.Compression {
+		compression = append(compression, compression1_2{Name: name})
+	}
+	return &capabilities1_2{
+		Restart:     caps.Restart,
+		Pause:       caps.Pause,
+		Transps:     transportOffers(caps.Transports),
+		Compression: compression,
+		MaxMsgSize:  caps.MaxMessageSize,
+	}
+}
+
+func decodeCapabilities(caps *capabilities1_2) *datatransfer.Capabilities {
+	if caps == nil {
+		return nil
+	}
+	var compression []string
+	for _, c := range caps.Compression {
+		compression = append(compression, c.Name)
+	}
+	return &datatransfer.Capabilities{
+		Restart:        caps.Restart,
+		Pause:          caps.Pause,
+		Transports:     offeredTransports(caps.Transps),
+		Compression:    compression,
+		MaxMessageSize: caps.MaxMsgSize,
+	}
+}
+
+// ========= datatransfer.Message interface
+
+// IsRequest returns true if this message is a data request
+func (tm *transferMessage1_2) IsRequest() bool {
+	return tm.IsRq
+}
+
+// TransferID returns the TransferID of this message
+func (tm *transferMessage1_2) TransferID() datatransfer.TransferID {
+	if tm.IsRequest() {
+		return tm.Request.TransferID()
+	}
+	return tm.Response.TransferID()
+}
+
+// ToNet serializes a transfer message type. It is simply a wrapper for MarshalCBOR, to provide
+// symmetry with FromNet
+func (tm *transferMessage1_2) ToNet(w io.Writer) error {
+	return tm.MarshalCBOR(w)
+}
+
+func encodeReceipt(receipt *datatransfer.Receipt) *receipt1_2 {
+	if receipt == nil {
+		return nil
+	}
+	return &receipt1_2{
+		Blocks: receipt.Blocks,
+		Bytes:  receipt.Bytes,
+		Hash:   receipt.Hash,
+	}
+}
+
+func decodeReceipt(receipt *receipt1_2) *datatransfer.Receipt {
+	if receipt == nil {
+		return nil
+	}
+	return &datatransfer.Receipt{
+		Blocks: receipt.Blocks,
+		Bytes:  receipt.Bytes,
+		Hash:   receipt.Hash,
+	}
+}
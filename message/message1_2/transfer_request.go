@@ -0,0 +1,257 @@
+package message1_2
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	xerrors "golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message/message1_0"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/message/types"
+)
+
+//go:generate cbor-gen-for --map-encoding transferRequest1_2
+
+// transferRequest1_2 is a struct for the 1.2 Data Transfer Protocol that fulfills the datatransfer.Request interface.
+// its members are exported to be used by cbor-gen
+type transferRequest1_2 struct {
+	BCid   *cid.Cid
+	Type   uint64
+	Paus   bool
+	Part   bool
+	Pull   bool
+	Stor   *cbg.Deferred
+	Vouch  *cbg.Deferred
+	VTyp   datatransfer.TypeIdentifier
+	XferID uint64
+
+	RestartChannel datatransfer.ChannelID
+
+	// TraceParent and TraceState are the W3C trace context
+	// (https://www.w3.org/TR/trace-context/) of the sender
+	TraceParent string
+	TraceState  string
+	// Transps are the transports offered by the sender
+	Transps []transportOffer1_2
+
+	// ErrCode and ErrMsg say why the sender cancelled the channel
+	ErrCode datatransfer.ErrorCode
+	ErrMsg  string
+
+	// Caps are the capabilities of the sender
+	Caps *capabilities1_2
+
+	// Prio is the priority the sender set for the channel
+	Prio int64
+
+	// Size is the total size of the data the sender declared for the channel
+	Size uint64
+
+	// Sig is the sender's signature over the request
+	Sig []byte
+}
+
+func (trq *transferRequest1_2) MessageForProtocol(targetProtocol protocol.ID) (datatransfer.Message, error) {
+	switch targetProtocol {
+	case datatransfer.ProtocolDataTransfer1_2:
+		return trq, nil
+	case datatransfer.ProtocolDataTransfer1_1:
+		lreq := message1_1.NewTransferRequest(
+			trq.BCid,
+			trq.Type,
+			trq.Paus,
+			trq.Part,
+			trq.Pull,
+			trq.Stor,
+			trq.Vouch,
+			trq.VTyp,
+			trq.XferID,
+			trq.RestartChannel,
+		)
+		return lreq, nil
+	case datatransfer.ProtocolDataTransfer1_0:
+		if trq.IsRestart() || trq.IsRestartExistingChannelRequest() {
+			return nil, xerrors.New("restart not supported on 1.0")
+		}
+
+		lreq := message1_0.NewTransferRequest(
+			trq.BCid,
+			trq.Type,
+			trq.Paus,
+			trq.Part,
+			trq.Pull,
+			trq.Stor,
+			trq.Vouch,
+			trq.VTyp,
+			trq.XferID,
+		)
+		return lreq, nil
+
+	default:
+		return nil, xerrors.Errorf("protocol not supported")
+	}
+}
+
+// IsRequest always returns true in this case because this is a transfer request
+func (trq *transferRequest1_2) IsRequest() bool {
+	return true
+}
+
+func (trq *transferRequest1_2) IsRestart() bool {
+	return trq.Type == uint64(types.RestartMessage)
+}
+
+func (trq *transferRequest1_2) IsRestartExistingChannelRequest() bool {
+	return trq.Type == uint64(types.RestartExistingChannelRequestMessage)
+}
+
+func (trq *transferRequest1_2) RestartChannelId() (datatransfer.ChannelID, error) {
+	if !trq.IsRestartExistingChannelRequest() {
+		return datatransfer.ChannelID{}, xerrors.New("not a restart request")
+	}
+	return trq.RestartChannel, nil
+}
+
+func (trq *transferRequest1_2) IsNew() bool {
+	return trq.Type == uint64(types.NewMessage)
+}
+
+func (trq *transferRequest1_2) IsUpdate() bool {
+	return trq.Type == uint64(types.UpdateMessage)
+}
+
+func (trq *transferRequest1_2) IsVoucher() bool {
+	return trq.Type == uint64(types.VoucherMessage) || trq.Type == uint64(types.NewMessage)
+}
+
+func (trq *transferRequest1_2) IsPaused() bool {
+	return trq.Paus
+}
+
+func (trq *transferRequest1_2) TransferID() datatransfer.TransferID {
+	return datatransfer.TransferID(trq.XferID)
+}
+
+// ========= datatransfer.Request interface
+// IsPull returns true if this is a data pull request
+func (trq *transferRequest1_2) IsPull() bool {
+	return trq.Pull
+}
+
+// VoucherType returns the Voucher ID
+func (trq *transferRequest1_2) VoucherType() datatransfer.TypeIdentifier {
+	return trq.VTyp
+}
+
+// Voucher returns the Voucher bytes
+func (trq *transferRequest1_2) Voucher(decoder encoding.Decoder) (encoding.Encodable, error) {
+	if trq.Vouch == nil {
+		return nil, xerrors.New("No voucher present to read")
+	}
+	return decoder.DecodeFromCbor(trq.Vouch.Raw)
+}
+
+func (trq *transferRequest1_2) EmptyVoucher() bool {
+	return trq.VTyp == datatransfer.EmptyTypeIdentifier
+}
+
+// BaseCid returns the Base CID
+func (trq *transferRequest1_2) BaseCid() cid.Cid {
+	if trq.BCid == nil {
+		return cid.Undef
+	}
+	return *trq.BCid
+}
+
+// Selector returns the message Selector bytes
+func (trq *transferRequest1_2) Selector() (ipld.Node, error) {
+	if trq.Stor == nil {
+		return nil, xerrors.New("No selector present to read")
+	}
+	builder := basicnode.Prototype.Any.NewBuilder()
+	reader := bytes.NewReader(trq.Stor.Raw)
+	err := dagcbor.Decoder(builder, reader)
+	if err != nil {
+		return nil, xerrors.Errorf("Error decoding selector: %w", err)
+	}
+	return builder.Build(), nil
+}
+
+// TraceCarrier returns the trace context of the sender, if any
+func (trq *transferRequest1_2) TraceCarrier() map[string]string {
+	if trq.TraceParent == "" {
+		return nil
+	}
+	carrier := map[string]string{traceParentField: trq.TraceParent}
+	if trq.TraceState != "" {
+		carrier[traceStateField] = trq.TraceState
+	}
+	return carrier
+}
+
+// Transports returns the transports offered by the sender, if any
+func (trq *transferRequest1_2) Transports() []datatransfer.TransportID {
+	return offeredTransports(trq.Transps)
+}
+
+// Capabilities returns the capabilities advertised by the sender, if any
+func (trq *transferRequest1_2) Capabilities() *datatransfer.Capabilities {
+	return decodeCapabilities(trq.Caps)
+}
+
+// Priority returns the priority the sender set for the channel
+func (trq *transferRequest1_2) Priority() int {
+	return int(trq.Prio)
+}
+
+// TotalSize returns the total size the sender declared for the data, if any
+func (trq *transferRequest1_2) TotalSize() uint64 {
+	return trq.Size
+}
+
+// ErrorCode returns the code of the error the sender cancelled the channel
+// with, if any
+func (trq *transferRequest1_2) ErrorCode() datatransfer.ErrorCode {
+	return trq.ErrCode
+}
+
+// ErrorMessage returns the message of the error the sender cancelled the
+// channel with, if any
+func (trq *transferRequest1_2) ErrorMessage() string {
+	return trq.ErrMsg
+}
+
+// Signature returns the sender's signature over the request, if it is signed
+func (trq *transferRequest1_2) Signature() []byte {
+	return trq.Sig
+}
+
+// IsCancel returns true if this is a cancel request
+func (trq *transferRequest1_2) IsCancel() bool {
+	return trq.Type == uint64(types.CancelMessage)
+}
+
+// IsPartial returns true if this is a partial request
+func (trq *transferRequest1_2) IsPartial() bool {
+	return trq.Part
+}
+
+// ToNet serializes a transfer request. It's a wrapper for MarshalCBOR to provide
+// symmetry with FromNet
+func (trq *transferRequest1_2) ToNet(w io.Writer) error {
+	msg := transferMessage1_2{
+		IsRq:     true,
+		Request:  trq,
+		Response: nil,
+	}
+	return msg.MarshalCBOR(w)
+}
@@ -0,0 +1,149 @@
+package message1_2_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/message/message1_2"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestRequestMessageForProtocol(t *testing.T) {
+	baseCid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	isPull := true
+	id := datatransfer.TransferID(rand.Int31())
+	voucher := testutil.NewFakeDTType()
+
+	// for the new protocol
+	request, err := message1_2.NewRequest(id, false, isPull, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+	carrier := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+	request = message1_2.WithTraceCarrier(request, carrier)
+	request = message1_2.WithTransports(request, []datatransfer.TransportID{"stream"})
+
+	out, err := request.MessageForProtocol(datatransfer.ProtocolDataTransfer1_2)
+	require.NoError(t, err)
+	require.Equal(t, request, out)
+
+	// for the 1.1 protocol
+	out, err = request.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+	require.NoError(t, err)
+	req, ok := out.(datatransfer.Request)
+	require.True(t, ok)
+	require.True(t, req.IsNew())
+	require.Equal(t, id, req.TransferID())
+	require.Equal(t, baseCid, req.BaseCid())
+	require.True(t, req.IsPull())
+	require.Equal(t, voucher.Type(), req.VoucherType())
+	require.Nil(t, req.TraceCarrier())
+	require.Nil(t, req.Transports())
+
+	// for the old protocol
+	out, err = request.MessageForProtocol(datatransfer.ProtocolDataTransfer1_0)
+	require.NoError(t, err)
+	req, ok = out.(datatransfer.Request)
+	require.True(t, ok)
+	require.False(t, req.IsRestart())
+	require.False(t, req.IsRestartExistingChannelRequest())
+	require.Equal(t, baseCid, req.BaseCid())
+	require.True(t, req.IsPull())
+	n, err := req.Selector()
+	require.NoError(t, err)
+	require.Equal(t, selector, n)
+	require.Equal(t, voucher.Type(), req.VoucherType())
+
+	// random protocol
+	out, err = request.MessageForProtocol("RAND")
+	require.Error(t, err)
+	require.Nil(t, out)
+}
+
+func TestRequestDowngradeEncodesAs1_1(t *testing.T) {
+	baseCid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	id := datatransfer.TransferID(rand.Int31())
+	voucher := testutil.NewFakeDTType()
+
+	request, err := message1_2.NewRequest(id, false, true, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+	request = message1_2.WithTraceCarrier(request, map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"})
+	request = message1_2.WithTransports(request, []datatransfer.TransportID{"stream", datatransfer.DefaultTransport})
+	request = message1_2.WithRequestCapabilities(request, datatransfer.Capabilities{Restart: true, Pause: true, MaxMessageSize: 1 << 20})
+	request = message1_2.WithRequestPriority(request, 5)
+	request = message1_2.WithRequestTotalSize(request, 1<<30)
+	request = message1_2.WithRequestSignature(request, []byte("signature"))
+	legacyRequest, err := message1_1.NewRequest(id, false, true, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+
+	cancel := message1_2.WithRequestError(message1_2.CancelRequest(id), datatransfer.ErrorInternal, "something went wrong")
+	cancel = message1_2.WithRequestSignature(cancel, []byte("signature"))
+
+	for original, legacy := range map[datatransfer.Request]datatransfer.Request{
+		request: legacyRequest,
+		cancel:  message1_1.CancelRequest(id),
+	} {
+		out, err := original.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+		require.NoError(t, err)
+
+		// peers that only speak 1.1 reject fields they do not know, so the
+		// downgraded request must be encoded exactly like a 1.1 request
+		buf := new(bytes.Buffer)
+		require.NoError(t, out.ToNet(buf))
+		legacyBuf := new(bytes.Buffer)
+		require.NoError(t, legacy.ToNet(legacyBuf))
+		require.Equal(t, legacyBuf.Bytes(), buf.Bytes())
+
+		decoded, err := message1_1.FromNet(buf)
+		require.NoError(t, err)
+		decodedRequest, ok := decoded.(datatransfer.Request)
+		require.True(t, ok)
+		require.Equal(t, id, decodedRequest.TransferID())
+		require.Equal(t, original.IsCancel(), decodedRequest.IsCancel())
+	}
+}
+
+func TestCancelRequestErrorDowngrade(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	request := message1_2.WithRequestError(message1_2.CancelRequest(id), datatransfer.ErrorInternal, "something went wrong")
+	require.Equal(t, datatransfer.ErrorInternal, request.ErrorCode())
+	require.Equal(t, "something went wrong", request.ErrorMessage())
+
+	// older protocols send a plain cancel
+	for _, protocol := range []protocol.ID{datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0} {
+		out, err := request.MessageForProtocol(protocol)
+		require.NoError(t, err)
+		require.True(t, out.IsCancel())
+		require.Equal(t, id, out.TransferID())
+		require.Equal(t, datatransfer.NoError, out.ErrorCode())
+		require.Empty(t, out.ErrorMessage())
+	}
+}
+
+func TestRequestMessageForProtocolRestartDowngradeFails(t *testing.T) {
+	baseCid := testutil.GenerateCids(1)[0]
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	isPull := true
+	id := datatransfer.TransferID(rand.Int31())
+	voucher := testutil.NewFakeDTType()
+
+	request, err := message1_2.NewRequest(id, true, isPull, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+
+	out, err := request.MessageForProtocol(datatransfer.ProtocolDataTransfer1_0)
+	require.Nil(t, out)
+	require.EqualError(t, err, "restart not supported on 1.0")
+
+	req2 := message1_2.RestartExistingChannelRequest(datatransfer.ChannelID{})
+	out, err = req2.MessageForProtocol(datatransfer.ProtocolDataTransfer1_0)
+	require.Nil(t, out)
+	require.EqualError(t, err, "restart not supported on 1.0")
+}
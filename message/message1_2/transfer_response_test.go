@@ -0,0 +1,116 @@
+package message1_2_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/message/message1_2"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestResponseMessageForProtocol(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	voucherResult := testutil.NewFakeDTType()
+	response, err := message1_2.NewResponse(id, false, true, voucherResult.Type(), voucherResult) // not accepted
+	require.NoError(t, err)
+
+	response = message1_2.WithResponseError(response, datatransfer.ErrorValidationFailed, "invalid voucher")
+
+	// new protocol
+	out, err := response.MessageForProtocol(datatransfer.ProtocolDataTransfer1_2)
+	require.NoError(t, err)
+	require.Equal(t, response, out)
+
+	// 1.1 protocol, which cannot carry the error
+	out, err = response.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+	require.NoError(t, err)
+	resp, ok := (out).(datatransfer.Response)
+	require.True(t, ok)
+	require.False(t, resp.Accepted())
+	require.True(t, resp.IsPaused())
+	require.Equal(t, id, resp.TransferID())
+	require.Equal(t, voucherResult.Type(), resp.VoucherResultType())
+	require.Equal(t, datatransfer.NoError, resp.ErrorCode())
+	require.Empty(t, resp.ErrorMessage())
+
+	// old protocol
+	out, err = response.MessageForProtocol(datatransfer.ProtocolDataTransfer1_0)
+	require.NoError(t, err)
+	resp, ok = (out).(datatransfer.Response)
+	require.True(t, ok)
+	require.True(t, resp.IsPaused())
+	require.Equal(t, voucherResult.Type(), resp.VoucherResultType())
+	require.True(t, resp.IsVoucherResult())
+
+	// random protocol
+	out, err = response.MessageForProtocol("RAND")
+	require.Error(t, err)
+	require.Nil(t, out)
+}
+
+func TestResponseDowngradeEncodesAs1_1(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	voucherResult := testutil.NewFakeDTType()
+
+	response, err := message1_2.NewResponse(id, true, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+	response = message1_2.WithTransport(response, "stream")
+	response = message1_2.WithResponseCapabilities(response, datatransfer.Capabilities{Restart: true, Pause: true})
+	response = message1_2.WithResponseSignature(response, []byte("signature"))
+	legacyResponse, err := message1_1.NewResponse(id, true, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+
+	complete, err := message1_2.CompleteResponse(id, true, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+	complete = message1_2.WithResponseTotalSize(complete, 1<<30)
+	complete = message1_2.WithResponseReceipt(complete, datatransfer.Receipt{Blocks: 10, Bytes: 1 << 30, Hash: []byte("hash")})
+	legacyComplete, err := message1_1.CompleteResponse(id, true, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+
+	rejected, err := message1_2.NewResponse(id, false, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+	rejected = message1_2.WithResponseError(rejected, datatransfer.ErrorValidationFailed, "invalid voucher")
+	legacyRejected, err := message1_1.NewResponse(id, false, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+
+	for original, legacy := range map[datatransfer.Response]datatransfer.Response{
+		response: legacyResponse,
+		complete: legacyComplete,
+		rejected: legacyRejected,
+	} {
+		out, err := original.MessageForProtocol(datatransfer.ProtocolDataTransfer1_1)
+		require.NoError(t, err)
+
+		// peers that only speak 1.1 reject fields they do not know, so the
+		// downgraded response must be encoded exactly like a 1.1 response
+		buf := new(bytes.Buffer)
+		require.NoError(t, out.ToNet(buf))
+		legacyBuf := new(bytes.Buffer)
+		require.NoError(t, legacy.ToNet(legacyBuf))
+		require.Equal(t, legacyBuf.Bytes(), buf.Bytes())
+
+		decoded, err := message1_1.FromNet(buf)
+		require.NoError(t, err)
+		decodedResponse, ok := decoded.(datatransfer.Response)
+		require.True(t, ok)
+		require.Equal(t, id, decodedResponse.TransferID())
+		require.Equal(t, original.Accepted(), decodedResponse.Accepted())
+		require.Equal(t, original.IsComplete(), decodedResponse.IsComplete())
+	}
+}
+
+func TestResponseMessageForProtocolFail(t *testing.T) {
+	id := datatransfer.TransferID(rand.Int31())
+	voucherResult := testutil.NewFakeDTType()
+	response, err := message1_2.RestartResponse(id, false, true, voucherResult.Type(), voucherResult) // not accepted
+	require.NoError(t, err)
+
+	out, err := response.MessageForProtocol(datatransfer.ProtocolDataTransfer1_0)
+	require.Nil(t, out)
+	require.EqualError(t, err, "restart not supported for 1.0 protocol")
+}
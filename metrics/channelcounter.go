@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"sync"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// ChannelCounter keeps track of the number of channels with each status, and
+// reports the counts to a Recorder when they change.
+// The status of a channel is only tracked until the channel reaches its final
+// status, after which the channel is just counted under that status.
+type ChannelCounter struct {
+	recorder Recorder
+
+	lk       sync.Mutex
+	statuses map[datatransfer.ChannelID]datatransfer.Status
+	counts   map[datatransfer.Status]int64
+}
+
+// NewChannelCounter returns a new counter that reports to the given recorder
+func NewChannelCounter(recorder Recorder) *ChannelCounter {
+	return &ChannelCounter{
+		recorder: recorder,
+		statuses: make(map[datatransfer.ChannelID]datatransfer.Status),
+		counts:   make(map[datatransfer.Status]int64),
+	}
+}
+
+// Init adds channels that existed before the counter was created.
+// Channels the counter has already seen are ignored, as their status is
+// already up to date. The given function reports whether a status is final.
+func (cc *ChannelCounter) Init(statuses map[datatransfer.ChannelID]datatransfer.Status, isFinal func(datatransfer.Status) bool) {
+	cc.lk.Lock()
+	defer cc.lk.Unlock()
+
+	changed := make(map[datatransfer.Status]struct{})
+	for chid, status := range statuses {
+		if _, ok := cc.statuses[chid]; ok {
+			continue
+		}
+		if !isFinal(status) {
+			cc.statuses[chid] = status
+		}
+		cc.counts[status]++
+		changed[status] = struct{}{}
+	}
+	for status := range changed {
+		cc.recorder.ChannelCount(status, cc.counts[status])
+	}
+}
+
+// Update records the current status of a channel
+func (cc *ChannelCounter) Update(chid datatransfer.ChannelID, status datatransfer.Status) {
+	cc.lk.Lock()
+	defer cc.lk.Unlock()
+
+	prev, ok := cc.statuses[chid]
+	if ok && prev == status {
+		return
+	}
+	cc.statuses[chid] = status
+	if ok {
+		cc.counts[prev]--
+		cc.recorder.ChannelCount(prev, cc.counts[prev])
+	}
+	cc.counts[status]++
+	cc.recorder.ChannelCount(status, cc.counts[status])
+}
+
+// Finish records the final status of a channel, and stops tracking the
+// status of the channel. Channels the counter is not tracking have already
+// finished, so they are ignored.
+func (cc *ChannelCounter) Finish(chid datatransfer.ChannelID, status datatransfer.Status) {
+	cc.lk.Lock()
+	defer cc.lk.Unlock()
+
+	prev, ok := cc.statuses[chid]
+	if !ok {
+		return
+	}
+	delete(cc.statuses, chid)
+	if prev == status {
+		return
+	}
+	cc.counts[prev]--
+	cc.recorder.ChannelCount(prev, cc.counts[prev])
+	cc.counts[status]++
+	cc.recorder.ChannelCount(status, cc.counts[status])
+}
+
+// Remove stops counting a channel with the given status, eg because it has
+// been deleted
+func (cc *ChannelCounter) Remove(chid datatransfer.ChannelID, status datatransfer.Status) {
+	cc.lk.Lock()
+	defer cc.lk.Unlock()
+
+	if prev, ok := cc.statuses[chid]; ok {
+		delete(cc.statuses, chid)
+		status = prev
+	}
+	if cc.counts[status] <= 0 {
+		return
+	}
+	cc.counts[status]--
+	cc.recorder.ChannelCount(status, cc.counts[status])
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+type nilRecorder struct{ Recorder }
+
+func (nilRecorder) ChannelCount(datatransfer.Status, int64) {}
+
+func TestChannelCounterForgetsFinishedChannels(t *testing.T) {
+	counter := NewChannelCounter(nilRecorder{})
+	for i := 0; i < 100; i++ {
+		chid := datatransfer.ChannelID{Initiator: "initiator", Responder: "responder", ID: datatransfer.TransferID(i)}
+		counter.Update(chid, datatransfer.Requested)
+		counter.Update(chid, datatransfer.Ongoing)
+		counter.Finish(chid, datatransfer.Completed)
+	}
+	require.Empty(t, counter.statuses)
+	require.Equal(t, int64(100), counter.counts[datatransfer.Completed])
+	require.Equal(t, int64(0), counter.counts[datatransfer.Ongoing])
+}
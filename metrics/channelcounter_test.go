@@ -0,0 +1,66 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/metrics"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestChannelCounter(t *testing.T) {
+	peers := testutil.GeneratePeers(2)
+	chid1 := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 1}
+	chid2 := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 2}
+	chid3 := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 3}
+
+	recorder := testutil.NewFakeMetricsRecorder()
+	counter := metrics.NewChannelCounter(recorder)
+
+	// a channel seen before Init keeps its latest status
+	counter.Update(chid1, datatransfer.Ongoing)
+	counter.Init(map[datatransfer.ChannelID]datatransfer.Status{
+		chid1: datatransfer.Requested,
+		chid2: datatransfer.Requested,
+	}, isFinal)
+	require.Equal(t, int64(1), recorder.ChannelCountFor(datatransfer.Ongoing))
+	require.Equal(t, int64(1), recorder.ChannelCountFor(datatransfer.Requested))
+
+	counter.Update(chid2, datatransfer.Ongoing)
+	counter.Update(chid3, datatransfer.Requested)
+	require.Equal(t, int64(2), recorder.ChannelCountFor(datatransfer.Ongoing))
+	require.Equal(t, int64(1), recorder.ChannelCountFor(datatransfer.Requested))
+
+	// updating to the same status does not change the count
+	counter.Update(chid3, datatransfer.Requested)
+	require.Equal(t, int64(1), recorder.ChannelCountFor(datatransfer.Requested))
+
+	counter.Finish(chid1, datatransfer.Completed)
+	require.Equal(t, int64(1), recorder.ChannelCountFor(datatransfer.Ongoing))
+	require.Equal(t, int64(1), recorder.ChannelCountFor(datatransfer.Completed))
+
+	// a finished channel is no longer tracked, so finishing it again does not
+	// count it twice
+	counter.Finish(chid1, datatransfer.Completed)
+	require.Equal(t, int64(1), recorder.ChannelCountFor(datatransfer.Completed))
+
+	counter.Remove(chid1, datatransfer.Completed)
+	require.Equal(t, int64(0), recorder.ChannelCountFor(datatransfer.Completed))
+
+	// removing a channel that is not counted does nothing
+	counter.Remove(chid1, datatransfer.Completed)
+	require.Equal(t, int64(0), recorder.ChannelCountFor(datatransfer.Completed))
+
+	// channels that had already finished are counted but not tracked
+	chid4 := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 4}
+	counter.Init(map[datatransfer.ChannelID]datatransfer.Status{chid4: datatransfer.Failed}, isFinal)
+	require.Equal(t, int64(1), recorder.ChannelCountFor(datatransfer.Failed))
+	counter.Remove(chid4, datatransfer.Failed)
+	require.Equal(t, int64(0), recorder.ChannelCountFor(datatransfer.Failed))
+}
+
+func isFinal(status datatransfer.Status) bool {
+	return status == datatransfer.Completed || status == datatransfer.Failed || status == datatransfer.Cancelled
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// Direction is the direction in which data flows on a channel, relative to
+// the peer that initiated the channel
+type Direction string
+
+const (
+	// Push means the initiator sends data
+	Push Direction = "push"
+	// Pull means the initiator receives data
+	Pull Direction = "pull"
+)
+
+// DirectionOf returns the direction of the given channel
+func DirectionOf(chst datatransfer.ChannelState) Direction {
+	if chst.IsPull() {
+		return Pull
+	}
+	return Push
+}
+
+// Recorder records data transfer metrics. Implementations can export the
+// metrics to a monitoring system such as Prometheus or OpenCensus.
+// Methods are called inline as data is transferred, so implementations must
+// be safe for concurrent use and must not block.
+type Recorder interface {
+	// ChannelCount records the number of channels that currently have the
+	// given status
+	ChannelCount(status datatransfer.Status, count int64)
+
+	// BytesQueued records bytes read from the local store and queued for
+	// sending
+	BytesQueued(dir Direction, bytes uint64)
+
+	// BytesSent records bytes sent to the remote peer
+	BytesSent(dir Direction, bytes uint64)
+
+	// BytesReceived records bytes received from the remote peer
+	BytesReceived(dir Direction, bytes uint64)
+
+	// ChannelRestarted records that a channel was restarted
+	ChannelRestarted(dir Direction)
+
+	// ChannelPaused records that a channel was paused by either party
+	ChannelPaused(dir Direction)
+
+	// ChannelResumed records that a channel was resumed by either party
+	ChannelResumed(dir Direction)
+
+	// ValidationRejected records that a request with the given voucher type
+	// was rejected by the validator
+	ValidationRejected(voucherType datatransfer.TypeIdentifier)
+
+	// MessageSent records how long it took to send a data transfer message,
+	// and the error if sending failed
+	MessageSent(latency time.Duration, err error)
+}
+
+// NoopRecorder is a Recorder that discards all metrics
+type NoopRecorder struct{}
+
+var _ Recorder = NoopRecorder{}
+
+// ChannelCount does nothing
+func (NoopRecorder) ChannelCount(datatransfer.Status, int64) {}
+
+// BytesQueued does nothing
+func (NoopRecorder) BytesQueued(Direction, uint64) {}
+
+// BytesSent does nothing
+func (NoopRecorder) BytesSent(Direction, uint64) {}
+
+// BytesReceived does nothing
+func (NoopRecorder) BytesReceived(Direction, uint64) {}
+
+// ChannelRestarted does nothing
+func (NoopRecorder) ChannelRestarted(Direction) {}
+
+// ChannelPaused does nothing
+func (NoopRecorder) ChannelPaused(Direction) {}
+
+// ChannelResumed does nothing
+func (NoopRecorder) ChannelResumed(Direction) {}
+
+// ValidationRejected does nothing
+func (NoopRecorder) ValidationRejected(datatransfer.TypeIdentifier) {}
+
+// MessageSent does nothing
+func (NoopRecorder) MessageSent(time.Duration, error) {}
@@ -17,6 +17,8 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/message"
 	"github.com/filecoin-project/go-data-transfer/message/message1_0"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/metrics"
 )
 
 var log = logging.Logger("data_transfer_network")
@@ -39,7 +41,7 @@ const defaultMaxAttemptDuration = 5 * time.Minute
 // The multiplier in the backoff time for each retry
 const defaultBackoffFactor = 5
 
-var defaultDataTransferProtocols = []protocol.ID{datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0}
+var defaultDataTransferProtocols = []protocol.ID{datatransfer.ProtocolDataTransfer1_2, datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0}
 
 // Option is an option for configuring the libp2p storage market network
 type Option func(*libp2pDataTransferNetwork)
@@ -70,6 +72,13 @@ func RetryParameters(minDuration time.Duration, maxDuration time.Duration, attem
 	}
 }
 
+// MetricsRecorder sets the recorder that message send latencies are reported to
+func MetricsRecorder(recorder metrics.Recorder) Option {
+	return func(impl *libp2pDataTransferNetwork) {
+		impl.metricsRecorder = recorder
+	}
+}
+
 // NewFromLibp2pHost returns a GraphSyncNetwork supported by underlying Libp2p host.
 func NewFromLibp2pHost(host host.Host, options ...Option) DataTransferNetwork {
 	dataTransferNetwork := libp2pDataTransferNetwork{
@@ -82,6 +91,7 @@ func NewFromLibp2pHost(host host.Host, options ...Option) DataTransferNetwork {
 		maxAttemptDuration:    defaultMaxAttemptDuration,
 		backoffFactor:         defaultBackoffFactor,
 		dtProtocols:           defaultDataTransferProtocols,
+		metricsRecorder:       metrics.NoopRecorder{},
 	}
 
 	for _, option := range options {
@@ -105,6 +115,7 @@ type libp2pDataTransferNetwork struct {
 	maxAttemptDuration    time.Duration
 	dtProtocols           []protocol.ID
 	backoffFactor         float64
+	metricsRecorder       metrics.Recorder
 }
 
 func (impl *libp2pDataTransferNetwork) openStream(ctx context.Context, id peer.ID, protocols ...protocol.ID) (network.Stream, error) {
@@ -155,6 +166,17 @@ func (dtnet *libp2pDataTransferNetwork) SendMessage(
 	p peer.ID,
 	outgoing datatransfer.Message) error {
 
+	start := time.Now()
+	err := dtnet.sendMessage(ctx, p, outgoing)
+	dtnet.metricsRecorder.MessageSent(time.Since(start), err)
+	return err
+}
+
+func (dtnet *libp2pDataTransferNetwork) sendMessage(
+	ctx context.Context,
+	p peer.ID,
+	outgoing datatransfer.Message) error {
+
 	s, err := dtnet.openStream(ctx, p, dtnet.dtProtocols...)
 	if err != nil {
 		return err
@@ -199,9 +221,12 @@ func (dtnet *libp2pDataTransferNetwork) handleNewStream(s network.Stream) {
 	for {
 		var received datatransfer.Message
 		var err error
-		if s.Protocol() == datatransfer.ProtocolDataTransfer1_1 {
+		switch s.Protocol() {
+		case datatransfer.ProtocolDataTransfer1_2:
 			received, err = message.FromNet(s)
-		} else {
+		case datatransfer.ProtocolDataTransfer1_1:
+			received, err = message1_1.FromNet(s)
+		default:
 			received, err = message1_0.FromNet(s)
 		}
 
@@ -262,6 +287,7 @@ func (dtnet *libp2pDataTransferNetwork) msgToStream(ctx context.Context, s netwo
 	}
 
 	switch s.Protocol() {
+	case datatransfer.ProtocolDataTransfer1_2:
 	case datatransfer.ProtocolDataTransfer1_1:
 	case datatransfer.ProtocolDataTransfer1_0:
 	default:
@@ -256,7 +256,8 @@ func TestSendMessageRetry(t *testing.T) {
 				time.Millisecond,
 				float64(tcase.attempts),
 				1)
-			dtnet1 := network.NewFromLibp2pHost(host1, retry)
+			metricsRecorder := testutil.NewFakeMetricsRecorder()
+			dtnet1 := network.NewFromLibp2pHost(host1, retry, network.MetricsRecorder(metricsRecorder))
 			dtnet2 := network.NewFromLibp2pHost(host2)
 			r := &receiver{
 				messageReceived: make(chan struct{}),
@@ -277,12 +278,16 @@ func TestSendMessageRetry(t *testing.T) {
 			require.NoError(t, err)
 
 			err = dtnet1.SendMessage(ctx, host2.ID(), request)
+			sent, sendErrors := metricsRecorder.MessagesSent()
+			require.Equal(t, 1, sent)
 			if !tcase.expSuccess {
 				require.Error(t, err)
+				require.Equal(t, 1, sendErrors)
 				return
 			}
 
 			require.NoError(t, err)
+			require.Equal(t, 0, sendErrors)
 
 			select {
 			case <-ctx.Done():
@@ -0,0 +1,37 @@
+package datatransfer
+
+import "time"
+
+// Progress is a snapshot of the progress of a channel
+type Progress struct {
+	// ChannelID is the channel the progress is for
+	ChannelID ChannelID
+	// Transferred is the number of bytes this node has sent for the channel,
+	// if it is the sender, or received, if it is the receiver
+	Transferred uint64
+	// TotalSize is the total size of the data, or zero if it is not known
+	TotalSize uint64
+	// Rates are the transfer rates over each of the rate windows of the
+	// manager, shortest window first
+	Rates []ProgressRate
+	// PercentComplete is the percentage of the total size transferred, or
+	// zero if the total size is not known
+	PercentComplete float64
+	// ETA is the time until the channel is expected to finish, at the rate
+	// over the longest rate window, or zero if it cannot be estimated
+	ETA time.Duration
+	// Timestamp is when the snapshot was taken
+	Timestamp time.Time
+}
+
+// ProgressRate is the transfer rate of a channel over a window of time
+type ProgressRate struct {
+	// Window is how far back the rate is measured over
+	Window time.Duration
+	// BytesPerSecond is the average number of bytes transferred per second
+	// over the window
+	BytesPerSecond float64
+}
+
+// ProgressSubscriber is a callback that is called with progress updates
+type ProgressSubscriber func(progress Progress)
@@ -0,0 +1,53 @@
+// Package pullchannelmonitor configures the monitor of pull channels. The
+// monitor is implemented by the channelmonitor package, which also monitors
+// push channels.
+package pullchannelmonitor
+
+import (
+	"time"
+
+	"github.com/filecoin-project/go-data-transfer/channelmonitor"
+)
+
+// Monitor watches the data-rate for pull channels, and restarts
+// a channel if the data-rate falls too low
+type Monitor = channelmonitor.Monitor
+
+type Config struct {
+	// Max time to wait for other side to accept pull before attempting restart
+	AcceptTimeout time.Duration
+	// Interval between checks of transfer rate
+	Interval time.Duration
+	// Min bytes that must be received in interval
+	MinBytesReceived uint64
+	// Number of times to check transfer rate per interval
+	ChecksPerInterval uint32
+	// Backoff after restarting
+	RestartBackoff time.Duration
+	// Number of times to try to restart before failing
+	MaxConsecutiveRestarts uint32
+	// Max time to wait for the responder to send a Complete message once all
+	// data has been received
+	CompleteTimeout time.Duration
+}
+
+// MonitorConfig returns the configuration of the channel monitor for pull
+// channels, or nil if cfg is nil
+func (cfg *Config) MonitorConfig() *channelmonitor.Config {
+	if cfg == nil {
+		return nil
+	}
+	return &channelmonitor.Config{
+		AcceptTimeout:          cfg.AcceptTimeout,
+		Interval:               cfg.Interval,
+		MinBytesTransferred:    cfg.MinBytesReceived,
+		ChecksPerInterval:      cfg.ChecksPerInterval,
+		RestartBackoff:         cfg.RestartBackoff,
+		MaxConsecutiveRestarts: cfg.MaxConsecutiveRestarts,
+		CompleteTimeout:        cfg.CompleteTimeout,
+	}
+}
+
+func NewMonitor(mgr channelmonitor.MonitorAPI, cfg *Config) *Monitor {
+	return channelmonitor.NewMonitor(mgr, channelmonitor.Pull, cfg.MonitorConfig())
+}
@@ -0,0 +1,104 @@
+package pullchannelmonitor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channelmonitor"
+	"github.com/filecoin-project/go-data-transfer/pullchannelmonitor"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestMonitorConfig(t *testing.T) {
+	var nilCfg *pullchannelmonitor.Config
+	require.Nil(t, nilCfg.MonitorConfig())
+
+	cfg := &pullchannelmonitor.Config{
+		AcceptTimeout:          time.Second,
+		Interval:               2 * time.Second,
+		MinBytesReceived:       100,
+		ChecksPerInterval:      3,
+		RestartBackoff:         4 * time.Second,
+		MaxConsecutiveRestarts: 5,
+		CompleteTimeout:        6 * time.Second,
+	}
+	require.Equal(t, &channelmonitor.Config{
+		AcceptTimeout:          time.Second,
+		Interval:               2 * time.Second,
+		MinBytesTransferred:    100,
+		ChecksPerInterval:      3,
+		RestartBackoff:         4 * time.Second,
+		MaxConsecutiveRestarts: 5,
+		CompleteTimeout:        6 * time.Second,
+	}, cfg.MonitorConfig())
+}
+
+func TestNewMonitor(t *testing.T) {
+	peers := testutil.GeneratePeers(2)
+	chid := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 1}
+
+	t.Run("no config disables the monitor", func(t *testing.T) {
+		var m *pullchannelmonitor.Monitor = pullchannelmonitor.NewMonitor(newMockMonitorAPI(), nil)
+		require.Nil(t, m.AddChannel(chid))
+	})
+
+	t.Run("config is checked for pull channels", func(t *testing.T) {
+		require.PanicsWithValue(t, "data-transfer channel pull monitor config MinBytesTransferred is 0 but must be > 0", func() {
+			pullchannelmonitor.NewMonitor(newMockMonitorAPI(), &pullchannelmonitor.Config{
+				AcceptTimeout:          time.Second,
+				Interval:               time.Second,
+				ChecksPerInterval:      1,
+				MaxConsecutiveRestarts: 1,
+				CompleteTimeout:        time.Second,
+			})
+		})
+	})
+
+	t.Run("channels are monitored by the shared monitor", func(t *testing.T) {
+		mockAPI := newMockMonitorAPI()
+		m := pullchannelmonitor.NewMonitor(mockAPI, &pullchannelmonitor.Config{
+			AcceptTimeout:          10 * time.Millisecond,
+			Interval:               time.Second,
+			MinBytesReceived:       1,
+			ChecksPerInterval:      1,
+			MaxConsecutiveRestarts: 1,
+			CompleteTimeout:        time.Second,
+		})
+		m.Start()
+		defer m.Shutdown()
+		require.NotNil(t, m.AddChannel(chid))
+
+		// the responder never accepts, so the channel is closed
+		select {
+		case closed := <-mockAPI.closed:
+			require.Equal(t, chid, closed)
+		case <-time.After(time.Second):
+			require.Fail(t, "timed out waiting for the channel to be closed")
+		}
+	})
+}
+
+type mockMonitorAPI struct {
+	closed chan datatransfer.ChannelID
+}
+
+func newMockMonitorAPI() *mockMonitorAPI {
+	return &mockMonitorAPI{closed: make(chan datatransfer.ChannelID, 1)}
+}
+
+func (m *mockMonitorAPI) SubscribeToChannelEvents(chid datatransfer.ChannelID, subscriber datatransfer.Subscriber) datatransfer.Unsubscribe {
+	return func() {}
+}
+
+func (m *mockMonitorAPI) RestartDataTransferChannel(ctx context.Context, chid datatransfer.ChannelID) error {
+	return nil
+}
+
+func (m *mockMonitorAPI) CloseDataTransferChannelWithError(ctx context.Context, chid datatransfer.ChannelID, cherr error) error {
+	m.closed <- chid
+	return nil
+}
@@ -0,0 +1,21 @@
+package datatransfer
+
+import "bytes"
+
+// Receipt summarizes the data of a channel, as found by traversing the
+// channel's selector from its root over a local store. Two peers that hold
+// the same data for a channel compute the same receipt.
+type Receipt struct {
+	// Blocks is the number of blocks the traversal loaded
+	Blocks uint64
+	// Bytes is the total size, in bytes, of the blocks the traversal loaded
+	Bytes uint64
+	// Hash is the sha256 hash of the root, the selector, and the CIDs of the
+	// blocks in the order the traversal loaded them
+	Hash []byte
+}
+
+// Equals returns true if both receipts are for the same data
+func (r Receipt) Equals(other Receipt) bool {
+	return r.Blocks == other.Blocks && r.Bytes == other.Bytes && bytes.Equal(r.Hash, other.Hash)
+}
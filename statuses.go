@@ -58,6 +58,10 @@ const (
 
 	// ChannelNotFoundError means the searched for data transfer does not exist
 	ChannelNotFoundError
+
+	// Queued means the responder accepted the request but is waiting for
+	// capacity to serve the channel before transferring data
+	Queued
 )
 
 // Statuses are human readable names for data transfer states
@@ -80,4 +84,5 @@ var Statuses = map[Status]string{
 	ResponderFinalizing:                 "ResponderFinalizing",
 	ResponderFinalizingTransferFinished: "ResponderFinalizingTransferFinished",
 	ChannelNotFoundError:                "ChannelNotFoundError",
+	Queued:                              "Queued",
 }
@@ -24,7 +24,7 @@ import (
 func matchDtMessage(t *testing.T, extensions []graphsync.ExtensionData) datatransfer.Message {
 	var matchedExtension *graphsync.ExtensionData
 	for _, ext := range extensions {
-		if ext.Name == extension.ExtensionDataTransfer1_1 {
+		if ext.Name == extension.ExtensionDataTransfer1_2 {
 			matchedExtension = &ext
 			break
 		}
@@ -0,0 +1,171 @@
+package testutil
+
+import (
+	"sync"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/metrics"
+)
+
+// FakeMetricsRecorder is a metrics recorder that keeps the recorded metrics
+// in memory so they can be inspected by tests
+type FakeMetricsRecorder struct {
+	lk                 sync.Mutex
+	channelCounts      map[datatransfer.Status]int64
+	bytesQueued        map[metrics.Direction]uint64
+	bytesSent          map[metrics.Direction]uint64
+	bytesReceived      map[metrics.Direction]uint64
+	restarts           map[metrics.Direction]int
+	pauses             map[metrics.Direction]int
+	resumes            map[metrics.Direction]int
+	validationRejected map[datatransfer.TypeIdentifier]int
+	messagesSent       int
+	messageSendErrors  int
+}
+
+var _ metrics.Recorder = &FakeMetricsRecorder{}
+
+// NewFakeMetricsRecorder returns a new FakeMetricsRecorder
+func NewFakeMetricsRecorder() *FakeMetricsRecorder {
+	return &FakeMetricsRecorder{
+		channelCounts:      make(map[datatransfer.Status]int64),
+		bytesQueued:        make(map[metrics.Direction]uint64),
+		bytesSent:          make(map[metrics.Direction]uint64),
+		bytesReceived:      make(map[metrics.Direction]uint64),
+		restarts:           make(map[metrics.Direction]int),
+		pauses:             make(map[metrics.Direction]int),
+		resumes:            make(map[metrics.Direction]int),
+		validationRejected: make(map[datatransfer.TypeIdentifier]int),
+	}
+}
+
+// ChannelCount records the number of channels with a status
+func (fmr *FakeMetricsRecorder) ChannelCount(status datatransfer.Status, count int64) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.channelCounts[status] = count
+}
+
+// BytesQueued records bytes queued
+func (fmr *FakeMetricsRecorder) BytesQueued(dir metrics.Direction, bytes uint64) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.bytesQueued[dir] += bytes
+}
+
+// BytesSent records bytes sent
+func (fmr *FakeMetricsRecorder) BytesSent(dir metrics.Direction, bytes uint64) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.bytesSent[dir] += bytes
+}
+
+// BytesReceived records bytes received
+func (fmr *FakeMetricsRecorder) BytesReceived(dir metrics.Direction, bytes uint64) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.bytesReceived[dir] += bytes
+}
+
+// ChannelRestarted records a restart
+func (fmr *FakeMetricsRecorder) ChannelRestarted(dir metrics.Direction) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.restarts[dir]++
+}
+
+// ChannelPaused records a pause
+func (fmr *FakeMetricsRecorder) ChannelPaused(dir metrics.Direction) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.pauses[dir]++
+}
+
+// ChannelResumed records a resume
+func (fmr *FakeMetricsRecorder) ChannelResumed(dir metrics.Direction) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.resumes[dir]++
+}
+
+// ValidationRejected records a rejected voucher
+func (fmr *FakeMetricsRecorder) ValidationRejected(voucherType datatransfer.TypeIdentifier) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.validationRejected[voucherType]++
+}
+
+// MessageSent records a sent message
+func (fmr *FakeMetricsRecorder) MessageSent(latency time.Duration, err error) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	fmr.messagesSent++
+	if err != nil {
+		fmr.messageSendErrors++
+	}
+}
+
+// ChannelCountFor returns the last recorded count of channels with a status
+func (fmr *FakeMetricsRecorder) ChannelCountFor(status datatransfer.Status) int64 {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.channelCounts[status]
+}
+
+// BytesQueuedFor returns the total bytes queued in a direction
+func (fmr *FakeMetricsRecorder) BytesQueuedFor(dir metrics.Direction) uint64 {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.bytesQueued[dir]
+}
+
+// BytesSentFor returns the total bytes sent in a direction
+func (fmr *FakeMetricsRecorder) BytesSentFor(dir metrics.Direction) uint64 {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.bytesSent[dir]
+}
+
+// BytesReceivedFor returns the total bytes received in a direction
+func (fmr *FakeMetricsRecorder) BytesReceivedFor(dir metrics.Direction) uint64 {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.bytesReceived[dir]
+}
+
+// RestartsFor returns the number of restarts in a direction
+func (fmr *FakeMetricsRecorder) RestartsFor(dir metrics.Direction) int {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.restarts[dir]
+}
+
+// PausesFor returns the number of pauses in a direction
+func (fmr *FakeMetricsRecorder) PausesFor(dir metrics.Direction) int {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.pauses[dir]
+}
+
+// ResumesFor returns the number of resumes in a direction
+func (fmr *FakeMetricsRecorder) ResumesFor(dir metrics.Direction) int {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.resumes[dir]
+}
+
+// ValidationRejectedFor returns the number of rejected vouchers of a type
+func (fmr *FakeMetricsRecorder) ValidationRejectedFor(voucherType datatransfer.TypeIdentifier) int {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.validationRejected[voucherType]
+}
+
+// MessagesSent returns the number of messages sent and the number of sends
+// that failed
+func (fmr *FakeMetricsRecorder) MessagesSent() (int, int) {
+	fmr.lk.Lock()
+	defer fmr.lk.Unlock()
+	return fmr.messagesSent, fmr.messageSendErrors
+}
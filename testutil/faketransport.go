@@ -2,6 +2,7 @@ package testutil
 
 import (
 	"context"
+	"sync"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
@@ -46,6 +47,8 @@ type FakeTransport struct {
 	CustomizedTransfers []CustomizedTransfer
 	EventHandler        datatransfer.EventsHandler
 	SetEventHandlerErr  error
+
+	lk sync.Mutex
 }
 
 // NewFakeTransport returns a new instance of FakeTransport
@@ -88,12 +91,24 @@ func (ft *FakeTransport) PauseChannel(ctx context.Context, chid datatransfer.Cha
 
 // ResumeChannel resumes the given channel
 func (ft *FakeTransport) ResumeChannel(ctx context.Context, msg datatransfer.Message, chid datatransfer.ChannelID) error {
+	ft.lk.Lock()
+	defer ft.lk.Unlock()
 	ft.ResumedChannels = append(ft.ResumedChannels, ResumedChannel{chid, msg})
 	return ft.ResumeChannelErr
 }
 
+// Resumed returns the channels resumed so far, for channels resumed in the
+// background
+func (ft *FakeTransport) Resumed() []ResumedChannel {
+	ft.lk.Lock()
+	defer ft.lk.Unlock()
+	return append([]ResumedChannel(nil), ft.ResumedChannels...)
+}
+
 // CleanupChannel cleans up the given channel
 func (ft *FakeTransport) CleanupChannel(chid datatransfer.ChannelID) {
+	ft.lk.Lock()
+	defer ft.lk.Unlock()
 	ft.CleanedUpChannels = append(ft.CleanedUpChannels, chid)
 }
 
@@ -60,6 +60,7 @@ const unixfsChunkSize uint64 = 1 << 10
 const unixfsLinksPerLevel = 1024
 
 var extsForProtocol = map[protocol.ID]graphsync.ExtensionName{
+	datatransfer.ProtocolDataTransfer1_2: extension.ExtensionDataTransfer1_2,
 	datatransfer.ProtocolDataTransfer1_1: extension.ExtensionDataTransfer1_1,
 	datatransfer.ProtocolDataTransfer1_0: extension.ExtensionDataTransfer1_0,
 }
@@ -82,6 +82,11 @@ func (sv *StubbedValidator) StubErrorPull() {
 	sv.pullError = errors.New("something went wrong")
 }
 
+// StubCodedErrorPull sets ValidatePull to error with the given code
+func (sv *StubbedValidator) StubCodedErrorPull(code datatransfer.ErrorCode) {
+	sv.pullError = datatransfer.NewCodedError(code, errors.New("something went wrong"))
+}
+
 // StubSuccessPull sets ValidatePull to succeed
 func (sv *StubbedValidator) StubSuccessPull() {
 	sv.pullError = nil
@@ -98,6 +103,12 @@ func (sv *StubbedValidator) ExpectErrorPull() {
 	sv.StubErrorPull()
 }
 
+// ExpectCodedErrorPull expects ValidatePull to error with the given code
+func (sv *StubbedValidator) ExpectCodedErrorPull(code datatransfer.ErrorCode) {
+	sv.expectPull = true
+	sv.StubCodedErrorPull(code)
+}
+
 // ExpectSuccessPull expects ValidatePull to error
 func (sv *StubbedValidator) ExpectSuccessPull() {
 	sv.expectPull = true
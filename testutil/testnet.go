@@ -2,6 +2,7 @@ package testutil
 
 import (
 	"context"
+	"sync"
 
 	"github.com/libp2p/go-libp2p-core/peer"
 
@@ -21,6 +22,11 @@ type FakeNetwork struct {
 	PeerID       peer.ID
 	SentMessages []FakeSentMessage
 	Delegate     network.Receiver
+	// ConnectErr is returned by ConnectTo if set
+	ConnectErr error
+
+	lk             sync.Mutex
+	connectedPeers []peer.ID
 }
 
 // NewFakeNetwork returns a new fake data transfer network instance
@@ -30,6 +36,8 @@ func NewFakeNetwork(id peer.ID) *FakeNetwork {
 
 // SendMessage sends a GraphSync message to a peer.
 func (fn *FakeNetwork) SendMessage(ctx context.Context, p peer.ID, m datatransfer.Message) error {
+	fn.lk.Lock()
+	defer fn.lk.Unlock()
 	fn.SentMessages = append(fn.SentMessages, FakeSentMessage{p, m})
 	return nil
 }
@@ -40,9 +48,28 @@ func (fn *FakeNetwork) SetDelegate(receiver network.Receiver) {
 	fn.Delegate = receiver
 }
 
-// ConnectTo establishes a connection to the given peer
-func (fn *FakeNetwork) ConnectTo(_ context.Context, _ peer.ID) error {
-	panic("not implemented")
+// ConnectTo records an attempt to connect to the given peer, and returns
+// ConnectErr
+func (fn *FakeNetwork) ConnectTo(_ context.Context, p peer.ID) error {
+	fn.lk.Lock()
+	defer fn.lk.Unlock()
+	fn.connectedPeers = append(fn.connectedPeers, p)
+	return fn.ConnectErr
+}
+
+// ConnectedPeers returns the peers ConnectTo was called with, in order
+func (fn *FakeNetwork) ConnectedPeers() []peer.ID {
+	fn.lk.Lock()
+	defer fn.lk.Unlock()
+	return append([]peer.ID(nil), fn.connectedPeers...)
+}
+
+// Sent returns the messages sent on the network so far, for messages sent in
+// the background
+func (fn *FakeNetwork) Sent() []FakeSentMessage {
+	fn.lk.Lock()
+	defer fn.lk.Unlock()
+	return append([]FakeSentMessage(nil), fn.SentMessages...)
 }
 
 // ID returns a stubbed id for host of this network
@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// TracerName is the name of the tracer used for data transfer spans
+const TracerName = "data-transfer"
+
+// Tracer returns the tracer used for data transfer spans, from the global
+// tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// SpansIndex keeps track of the span that covers the lifetime of each channel,
+// so that operations on the channel can be recorded as child spans
+type SpansIndex struct {
+	lk    sync.Mutex
+	spans map[datatransfer.ChannelID]trace.Span
+}
+
+// NewSpansIndex returns a new, empty SpansIndex
+func NewSpansIndex() *SpansIndex {
+	return &SpansIndex{
+		spans: make(map[datatransfer.ChannelID]trace.Span),
+	}
+}
+
+// SpanByChannelID returns the span for the given channel, along with a context
+// that holds the span. If the channel does not have a span yet, a new one is
+// started as a child of any span in the given context.
+func (si *SpansIndex) SpanByChannelID(ctx context.Context, chid datatransfer.ChannelID) (context.Context, trace.Span) {
+	si.lk.Lock()
+	defer si.lk.Unlock()
+
+	span, ok := si.spans[chid]
+	if ok {
+		return trace.ContextWithSpan(ctx, span), span
+	}
+	ctx, span = Tracer().Start(ctx, "transfer", trace.WithAttributes(
+		attribute.String("channelID", chid.String()),
+		attribute.String("initiator", chid.Initiator.String()),
+		attribute.String("responder", chid.Responder.String()),
+		attribute.Int64("transferID", int64(chid.ID)),
+	))
+	si.spans[chid] = span
+	return ctx, span
+}
+
+// ChannelContext returns a context that holds the span for the given channel,
+// or the given context unchanged if the channel does not have a span
+func (si *SpansIndex) ChannelContext(ctx context.Context, chid datatransfer.ChannelID) context.Context {
+	si.lk.Lock()
+	defer si.lk.Unlock()
+
+	span, ok := si.spans[chid]
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithSpan(ctx, span)
+}
+
+// EndChannelSpan ends the span for the given channel, if it has one
+func (si *SpansIndex) EndChannelSpan(chid datatransfer.ChannelID) {
+	si.lk.Lock()
+	span, ok := si.spans[chid]
+	delete(si.spans, chid)
+	si.lk.Unlock()
+
+	if ok {
+		span.End()
+	}
+}
+
+// EndAll ends the spans of all channels, eg when the data transfer manager
+// shuts down
+func (si *SpansIndex) EndAll() {
+	si.lk.Lock()
+	spans := si.spans
+	si.spans = make(map[datatransfer.ChannelID]trace.Span)
+	si.lk.Unlock()
+
+	for _, span := range spans {
+		span.End()
+	}
+}
+
+// InjectTraceContext returns the W3C trace context of the span in the given
+// context as a map of propagation fields, or nil if the context holds no
+// valid span
+func InjectTraceContext(ctx context.Context) map[string]string {
+	carrier := make(mapCarrier)
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// ExtractTraceContext returns a context that holds the remote span described
+// by the given W3C trace context fields, so that spans started from it join
+// the remote trace
+func ExtractTraceContext(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, mapCarrier(carrier))
+}
+
+// mapCarrier adapts a map to the propagation.TextMapCarrier interface
+type mapCarrier map[string]string
+
+func (mc mapCarrier) Get(key string) string {
+	return mc[key]
+}
+
+func (mc mapCarrier) Set(key string, value string) {
+	mc[key] = value
+}
+
+func (mc mapCarrier) Keys() []string {
+	keys := make([]string, 0, len(mc))
+	for key := range mc {
+		keys = append(keys, key)
+	}
+	return keys
+}
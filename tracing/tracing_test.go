@@ -0,0 +1,75 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/trace"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+	"github.com/filecoin-project/go-data-transfer/tracing"
+)
+
+func TestSpansIndex(t *testing.T) {
+	sr := new(oteltest.SpanRecorder)
+	prevProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr)))
+	defer otel.SetTracerProvider(prevProvider)
+
+	ctx := context.Background()
+	peers := testutil.GeneratePeers(2)
+	chid1 := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 1}
+	chid2 := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 2}
+	si := tracing.NewSpansIndex()
+
+	// a context for a channel without a span is returned unchanged
+	require.Equal(t, ctx, si.ChannelContext(ctx, chid1))
+
+	ctx1, span1 := si.SpanByChannelID(ctx, chid1)
+	require.True(t, span1.SpanContext().IsValid())
+	require.Equal(t, span1, trace.SpanFromContext(ctx1))
+	require.Equal(t, span1, trace.SpanFromContext(si.ChannelContext(ctx, chid1)))
+
+	// the span is only started once per channel
+	_, span := si.SpanByChannelID(ctx, chid1)
+	require.Equal(t, span1, span)
+	require.Len(t, sr.Started(), 1)
+
+	_, span2 := si.SpanByChannelID(ctx, chid2)
+	require.NotEqual(t, span1, span2)
+
+	si.EndChannelSpan(chid1)
+	require.Len(t, sr.Completed(), 1)
+	require.Equal(t, ctx, si.ChannelContext(ctx, chid1))
+
+	// ending a channel without a span does nothing
+	si.EndChannelSpan(chid1)
+	require.Len(t, sr.Completed(), 1)
+
+	si.EndAll()
+	require.Len(t, sr.Completed(), 2)
+	require.Equal(t, ctx, si.ChannelContext(ctx, chid2))
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	sr := new(oteltest.SpanRecorder)
+	tracer := oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr)).Tracer("test")
+	ctx := context.Background()
+
+	// no trace context is injected without a valid span
+	require.Nil(t, tracing.InjectTraceContext(ctx))
+	require.Equal(t, ctx, tracing.ExtractTraceContext(ctx, nil))
+
+	ctx, parent := tracer.Start(ctx, "parent")
+	carrier := tracing.InjectTraceContext(ctx)
+	require.NotEmpty(t, carrier["traceparent"])
+
+	remoteCtx := tracing.ExtractTraceContext(context.Background(), carrier)
+	_, child := tracer.Start(remoteCtx, "child")
+	require.Equal(t, parent.SpanContext().TraceID(), child.SpanContext().TraceID())
+	require.Equal(t, parent.SpanContext().SpanID(), child.(*oteltest.Span).ParentSpanID())
+}
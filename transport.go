@@ -62,6 +62,14 @@ type EventsHandler interface {
 	OnRequestDisconnected(ctx context.Context, chid ChannelID) error
 }
 
+// TransportID identifies a transport registered with a data transfer manager
+type TransportID string
+
+// DefaultTransport identifies the transport a data transfer manager was
+// constructed with. It is also the transport used by peers and channels that
+// predate transport selection.
+const DefaultTransport TransportID = ""
+
 /*
 Transport defines the interface for a transport layer for data
 transfer. Where the data transfer manager will coordinate setting up push and
@@ -100,6 +108,40 @@ type Transport interface {
 	Shutdown(ctx context.Context) error
 }
 
+// DoNotSendSource reads the CIDs of the blocks the receiver of a channel
+// already has, only when they are needed
+type DoNotSendSource interface {
+	// Len returns the number of blocks
+	Len() int
+	// ForEach calls the callback with each block
+	ForEach(cb func(cid.Cid) error) error
+}
+
+// RestartableTransport is a transport that can reopen a channel without being
+// given the full list of blocks the receiver already has, for transports that
+// can often tell the sender about those blocks in another way
+type RestartableTransport interface {
+	Transport
+	// RestartChannel is like OpenChannel, but only reads the blocks the
+	// receiver has from the source if it needs to list them
+	RestartChannel(ctx context.Context,
+		dataSender peer.ID,
+		channelID ChannelID,
+		root ipld.Link,
+		stor ipld.Node,
+		doNotSend DoNotSendSource,
+		msg Message) error
+}
+
+// LoaderTransport is a transport that can say which loader it loads the
+// blocks of a channel with
+type LoaderTransport interface {
+	Transport
+	// ChannelLoader returns the loader for the blocks of the given channel, or
+	// nil if the transport does not know it
+	ChannelLoader(chid ChannelID) ipld.Loader
+}
+
 // PauseableTransport is a transport that can also pause and resume channels
 type PauseableTransport interface {
 	Transport
@@ -26,7 +26,11 @@ type graphsyncKey struct {
 	p         peer.ID
 }
 
-var defaultSupportedExtensions = []graphsync.ExtensionName{extension.ExtensionDataTransfer1_1, extension.ExtensionDataTransfer1_0}
+// TransportID identifies the graphsync transport when it is registered with a
+// data transfer manager alongside other transports
+const TransportID datatransfer.TransportID = "graphsync"
+
+var defaultSupportedExtensions = []graphsync.ExtensionName{extension.ExtensionDataTransfer1_2, extension.ExtensionDataTransfer1_1, extension.ExtensionDataTransfer1_0}
 
 // Option is an option for setting up the graphsync transport
 type Option func(*Transport)
@@ -58,7 +62,10 @@ type Transport struct {
 	pending                  map[datatransfer.ChannelID]chan struct{}
 	requestorCancelledMap    map[datatransfer.ChannelID]struct{}
 	pendingExtensions        map[datatransfer.ChannelID][]graphsync.ExtensionData
-	stores                   map[datatransfer.ChannelID]struct{}
+	stores                   map[datatransfer.ChannelID]ipld.Loader
+	hintLoader               ipld.Loader
+	hinted                   map[datatransfer.ChannelID]*cid.Set
+	hintedLoaders            map[datatransfer.ChannelID]*hintedLoader
 	supportedExtensions      []graphsync.ExtensionName
 	unregisterFuncs          []graphsync.UnregisterHookFunc
 	completedRequestListener func(channelID datatransfer.ChannelID)
@@ -75,7 +82,9 @@ func NewTransport(peerID peer.ID, gs graphsync.GraphExchange, options ...Option)
 		pendingExtensions:     make(map[datatransfer.ChannelID][]graphsync.ExtensionData),
 		channelIDMap:          make(map[datatransfer.ChannelID]graphsyncKey),
 		pending:               make(map[datatransfer.ChannelID]chan struct{}),
-		stores:                make(map[datatransfer.ChannelID]struct{}),
+		stores:                make(map[datatransfer.ChannelID]ipld.Loader),
+		hinted:                make(map[datatransfer.ChannelID]*cid.Set),
+		hintedLoaders:         make(map[datatransfer.ChannelID]*hintedLoader),
 		supportedExtensions:   defaultSupportedExtensions,
 	}
 	for _, option := range options {
@@ -96,6 +105,18 @@ func (t *Transport) OpenChannel(ctx context.Context,
 	stor ipld.Node,
 	doNotSendCids []cid.Cid,
 	msg datatransfer.Message) error {
+	return t.RestartChannel(ctx, dataSender, channelID, root, stor, doNotSendList(doNotSendCids), msg)
+}
+
+// RestartChannel is like OpenChannel, but only reads the blocks the receiver
+// has from the source if the channel can't be restarted with a restart hint
+func (t *Transport) RestartChannel(ctx context.Context,
+	dataSender peer.ID,
+	channelID datatransfer.ChannelID,
+	root ipld.Link,
+	stor ipld.Node,
+	doNotSend datatransfer.DoNotSendSource,
+	msg datatransfer.Message) error {
 	if t.events == nil {
 		return datatransfer.ErrHandlerNotSet
 	}
@@ -115,10 +136,28 @@ func (t *Transport) OpenChannel(ctx context.Context,
 	t.contextCancelMap[channelID] = internalCancel
 	t.dataLock.Unlock()
 
-	if len(doNotSendCids) != 0 {
+	// the receiver has blocks already, so either hint at which ones or list them
+	hasBlocks := doNotSend.Len() != 0
+	var hinted bool
+	if hasBlocks && t.hintLoader != nil {
+		var hintExt graphsync.ExtensionData
+		var have *cid.Set
+		hintExt, have, hinted = t.restartHint(ctx, channelID, root, stor)
+		if hinted {
+			exts = append(exts, hintExt)
+			t.dataLock.Lock()
+			t.hinted[channelID] = have
+			t.dataLock.Unlock()
+		}
+	}
+	if hasBlocks && !hinted {
 		set := cid.NewSet()
-		for _, c := range doNotSendCids {
+		err := doNotSend.ForEach(func(c cid.Cid) error {
 			set.Add(c)
+			return nil
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to read do not send cids: %w", err)
 		}
 		bz, err := cidset.EncodeCidSet(set)
 		if err != nil {
@@ -134,18 +173,25 @@ func (t *Transport) OpenChannel(ctx context.Context,
 	return nil
 }
 
-func (t *Transport) consumeResponses(responseChan <-chan graphsync.ResponseProgress, errChan <-chan error) error {
+func (t *Transport) consumeResponses(responseChan <-chan graphsync.ResponseProgress, errChan <-chan error, have *cid.Set) error {
 	var lastError error
 	for range responseChan {
 	}
 	for err := range errChan {
+		// the sender skips the subtrees in the restart hint
+		if isHintedMissingBlock(err, have) {
+			continue
+		}
 		lastError = err
 	}
 	return lastError
 }
 
 func (t *Transport) executeGsRequest(ctx context.Context, internalCtx context.Context, channelID datatransfer.ChannelID, responseChan <-chan graphsync.ResponseProgress, errChan <-chan error) {
-	lastError := t.consumeResponses(responseChan, errChan)
+	t.dataLock.RLock()
+	have := t.hinted[channelID]
+	t.dataLock.RUnlock()
+	lastError := t.consumeResponses(responseChan, errChan, have)
 
 	if _, ok := lastError.(graphsync.RequestContextCancelledErr); ok {
 		log.Warnf("graphsync request context cancelled, channel Id: %v", channelID)
@@ -350,10 +396,18 @@ func (t *Transport) UseStore(channelID datatransfer.ChannelID, loader ipld.Loade
 	if err != nil {
 		return err
 	}
-	t.stores[channelID] = struct{}{}
+	t.stores[channelID] = loader
 	return nil
 }
 
+// ChannelLoader returns the loader of the store the channel uses, or nil if
+// the channel uses the store graphsync was set up with
+func (t *Transport) ChannelLoader(chid datatransfer.ChannelID) ipld.Loader {
+	t.dataLock.RLock()
+	defer t.dataLock.RUnlock()
+	return t.stores[chid]
+}
+
 func (t *Transport) gsOutgoingRequestHook(p peer.ID, request graphsync.RequestData, hookActions graphsync.OutgoingRequestHookActions) {
 	message, _ := extension.GetTransferData(request)
 
@@ -537,7 +591,12 @@ func (t *Transport) gsReqRecdHook(p peer.ID, request graphsync.RequestData, hook
 	if ok {
 		hookActions.UsePersistenceOption("data-transfer-" + chid.String())
 	}
+	err = t.useRestartHint(chid, request, hookActions)
 	t.dataLock.Unlock()
+	if err != nil {
+		hookActions.TerminateWithError(err)
+		return
+	}
 	hookActions.ValidateRequest()
 }
 
@@ -556,6 +615,14 @@ func (t *Transport) gsCompletedResponseListener(p peer.ID, request graphsync.Req
 		return
 	}
 
+	// the response is partial when the subtrees in a restart hint are skipped
+	t.dataLock.RLock()
+	hl, hinted := t.hintedLoaders[chid]
+	t.dataLock.RUnlock()
+	if status == graphsync.RequestCompletedPartial && hinted && hl.onlySkippedHinted() {
+		status = graphsync.RequestCompletedFull
+	}
+
 	var completeErr error
 	if status != graphsync.RequestCompletedFull {
 		statusStr := gsResponseStatusCodeString(status)
@@ -608,6 +675,8 @@ func (t *Transport) cleanupChannel(chid datatransfer.ChannelID, gsKey graphsyncK
 		}
 	}
 	delete(t.stores, chid)
+	delete(t.hinted, chid)
+	t.removeHintedLoader(chid)
 }
 
 func (t *Transport) gsRequestUpdatedHook(p peer.ID, request graphsync.RequestData, update graphsync.RequestData, hookActions graphsync.RequestUpdatedHookActions) {
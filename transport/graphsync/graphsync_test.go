@@ -9,10 +9,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-graphsync"
 	"github.com/ipfs/go-graphsync/cidset"
 	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	"github.com/stretchr/testify/require"
 
@@ -24,7 +27,18 @@ import (
 )
 
 func TestManager(t *testing.T) {
+	hintedSource := &doNotSendSource{cids: testutil.GenerateCids(2)}
+	// a block the receiver has, for the restart hint
+	hintedBlock := new(bytes.Buffer)
+	require.NoError(t, dagcbor.Encoder(basicnode.NewString("hinted"), hintedBlock))
+	hintedPrefix := hintedSource.cids[0].Prefix()
+	hintedPrefix.Version = 1
+	hintedPrefix.Codec = cid.DagCBOR
+	hintedRoot, err := hintedPrefix.Sum(hintedBlock.Bytes())
+	require.NoError(t, err)
+	listedSource := &doNotSendSource{cids: testutil.GenerateCids(2)}
 	testCases := map[string]struct {
+		options        []Option
 		requestConfig  gsRequestConfig
 		responseConfig gsResponseConfig
 		updatedConfig  gsRequestConfig
@@ -237,7 +251,7 @@ func TestManager(t *testing.T) {
 				require.Equal(t, 1, events.OnRequestReceivedCallCount)
 				require.Equal(t, 0, events.OnResponseReceivedCallCount)
 				require.Equal(t, events.RequestReceivedChannelID, datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.self, Initiator: gsData.other})
-				dtRequestData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_1)
+				dtRequestData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_2)
 				assertDecodesToMessage(t, dtRequestData, events.RequestReceivedRequest)
 				require.True(t, gsData.incomingRequestHookActions.Validated)
 				assertHasOutgoingMessage(t, gsData.incomingRequestHookActions.SentExtensions, events.RequestReceivedResponse)
@@ -255,7 +269,7 @@ func TestManager(t *testing.T) {
 				require.Equal(t, 0, events.OnRequestReceivedCallCount)
 				require.Equal(t, 1, events.OnResponseReceivedCallCount)
 				require.Equal(t, events.ResponseReceivedChannelID, datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self})
-				dtResponseData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_1)
+				dtResponseData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_2)
 				assertDecodesToMessage(t, dtResponseData, events.ResponseReceivedResponse)
 				require.True(t, gsData.incomingRequestHookActions.Validated)
 				require.NoError(t, gsData.incomingRequestHookActions.TerminationError)
@@ -286,7 +300,7 @@ func TestManager(t *testing.T) {
 				require.Equal(t, 1, events.OnRequestReceivedCallCount)
 				require.Equal(t, 0, events.OnResponseReceivedCallCount)
 				require.Equal(t, events.RequestReceivedChannelID, datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.self, Initiator: gsData.other})
-				dtRequestData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_1)
+				dtRequestData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_2)
 				assertDecodesToMessage(t, dtRequestData, events.RequestReceivedRequest)
 				require.False(t, gsData.incomingRequestHookActions.Validated)
 				assertHasOutgoingMessage(t, gsData.incomingRequestHookActions.SentExtensions, events.RequestReceivedResponse)
@@ -653,8 +667,8 @@ func TestManager(t *testing.T) {
 				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
 
 				ext := requestReceived.Extensions
-				require.Len(t, ext, 3)
-				doNotSend := ext[2]
+				require.Len(t, ext, 4)
+				doNotSend := ext[3]
 
 				name := doNotSend.Name
 				require.Equal(t, graphsync.ExtensionDoNotSendCIDs, name)
@@ -664,6 +678,57 @@ func TestManager(t *testing.T) {
 				require.Equal(t, cs.Len(), 2)
 			},
 		},
+		"restart channel with restart hints does not read the blocks the receiver has": {
+			options: []Option{RestartHints(func(ipld.Link, ipld.LinkContext) (io.Reader, error) {
+				return bytes.NewReader(hintedBlock.Bytes()), nil
+			})},
+			action: func(gsData *harness) {
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.RestartChannel(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: hintedRoot},
+					stor,
+					hintedSource,
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+
+				ext := requestReceived.Extensions
+				require.Len(t, ext, 4)
+				require.Equal(t, extension.ExtensionRestartHint, ext[3].Name)
+				hint, err := cidset.DecodeCidSet(ext[3].Data)
+				require.NoError(t, err)
+				require.True(t, hint.Has(hintedRoot))
+				require.False(t, hintedSource.read)
+			},
+		},
+		"restart channel without restart hints lists the blocks the receiver has": {
+			action: func(gsData *harness) {
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.RestartChannel(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: gsData.outgoing.BaseCid()},
+					stor,
+					listedSource,
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+
+				ext := requestReceived.Extensions
+				require.Len(t, ext, 4)
+				require.Equal(t, graphsync.ExtensionDoNotSendCIDs, ext[3].Name)
+				cs, err := cidset.DecodeCidSet(ext[3].Data)
+				require.NoError(t, err)
+				require.Equal(t, 2, cs.Len())
+				require.True(t, listedSource.read)
+			},
+		},
 		"open channel cancels an existing request with the same channel ID": {
 			action: func(gsData *harness) {
 				cids := testutil.GenerateCids(2)
@@ -926,7 +991,7 @@ func TestManager(t *testing.T) {
 			fgs := testutil.NewFakeGraphSync()
 			outgoing := testutil.NewDTRequest(t, transferID)
 			incoming := testutil.NewDTResponse(t, transferID)
-			transport := NewTransport(peers[0], fgs)
+			transport := NewTransport(peers[0], fgs, data.options...)
 			gsData := &harness{
 				ctx:                         ctx,
 				outgoing:                    outgoing,
@@ -956,6 +1021,27 @@ func TestManager(t *testing.T) {
 	}
 }
 
+// doNotSendSource is a source of the blocks the receiver of a channel has
+// that records whether the blocks were read
+type doNotSendSource struct {
+	cids []cid.Cid
+	read bool
+}
+
+func (s *doNotSendSource) Len() int {
+	return len(s.cids)
+}
+
+func (s *doNotSendSource) ForEach(cb func(cid.Cid) error) error {
+	s.read = true
+	for _, c := range s.cids {
+		if err := cb(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type fakeEvents struct {
 	ChannelOpenedChannelID      datatransfer.ChannelID
 	RequestReceivedChannelID    datatransfer.ChannelID
@@ -1106,7 +1192,7 @@ func (dtc *dtConfig) extensions(t *testing.T, transferID datatransfer.TransferID
 	extensions := make(map[graphsync.ExtensionName][]byte)
 	if !dtc.dtExtensionMissing {
 		if dtc.dtExtensionMalformed {
-			extensions[extension.ExtensionDataTransfer1_1] = testutil.RandomBytes(100)
+			extensions[extension.ExtensionDataTransfer1_2] = testutil.RandomBytes(100)
 		} else {
 			var msg datatransfer.Message
 			if dtc.dtIsResponse {
@@ -1117,7 +1203,7 @@ func (dtc *dtConfig) extensions(t *testing.T, transferID datatransfer.TransferID
 			buf := new(bytes.Buffer)
 			err := msg.ToNet(buf)
 			require.NoError(t, err)
-			extensions[extension.ExtensionDataTransfer1_1] = buf.Bytes()
+			extensions[extension.ExtensionDataTransfer1_2] = buf.Bytes()
 		}
 	}
 	return extensions
@@ -1168,7 +1254,7 @@ func assertHasOutgoingMessage(t *testing.T, extensions []graphsync.ExtensionData
 	err := expected.ToNet(buf)
 	require.NoError(t, err)
 	expectedExt := graphsync.ExtensionData{
-		Name: extension.ExtensionDataTransfer1_1,
+		Name: extension.ExtensionDataTransfer1_2,
 		Data: buf.Bytes(),
 	}
 	require.Contains(t, extensions, expectedExt)
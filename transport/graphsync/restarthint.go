@@ -0,0 +1,270 @@
+package graphsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync"
+	"github.com/ipfs/go-graphsync/cidset"
+	"github.com/ipfs/go-graphsync/ipldutil"
+	ipld "github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/transport/graphsync/extension"
+)
+
+// RestartHints makes the transport tell the sender which blocks it already
+// has when it opens a channel that has received blocks before, with the roots
+// of the subtrees of the selector traversal it has all the blocks of, instead
+// of the list of every block. The sender skips those subtrees. The given loader
+// loads blocks from the store graphsync uses, for channels that do not use a
+// store of their own. Both peers need the option for the hints to be used;
+// peers without it send the full list, and ignore hints they receive.
+func RestartHints(loader ipld.Loader) Option {
+	return func(t *Transport) {
+		t.hintLoader = loader
+	}
+}
+
+var errHintedBlock = errors.New("block is in a subtree the receiver has")
+
+// missingBlockErrPrefix is the prefix of the error graphsync reports to the
+// requestor for blocks the responder did not send, which is followed by the
+// CID of the block
+const missingBlockErrPrefix = "Remote Peer Is Missing Block: "
+
+// hintedLoader loads the blocks for a response to a request with a restart
+// hint, refusing the roots of the subtrees the receiver has so that graphsync
+// skips those subtrees
+type hintedLoader struct {
+	loader ipld.Loader
+	have   *cid.Set
+	name   string
+
+	lk sync.Mutex
+	// missing is set when a block outside the hinted subtrees can't be loaded
+	missing bool
+}
+
+func (hl *hintedLoader) load(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+	if asCidLink, ok := lnk.(cidlink.Link); ok && hl.have.Has(asCidLink.Cid) {
+		return nil, errHintedBlock
+	}
+	r, err := hl.loader(lnk, lnkCtx)
+	if err != nil {
+		hl.lk.Lock()
+		hl.missing = true
+		hl.lk.Unlock()
+	}
+	return r, err
+}
+
+// onlySkippedHinted returns true if every block missing from the response was
+// skipped because of the hint
+func (hl *hintedLoader) onlySkippedHinted() bool {
+	hl.lk.Lock()
+	defer hl.lk.Unlock()
+	return !hl.missing
+}
+
+// loaderFor returns the loader for the blocks of a channel. The data lock must
+// be held.
+func (t *Transport) loaderFor(chid datatransfer.ChannelID) ipld.Loader {
+	if loader, ok := t.stores[chid]; ok {
+		return loader
+	}
+	return t.hintLoader
+}
+
+// restartHint builds the extension that tells the sender the subtrees the
+// receiver already has, or returns false if the hint can't be built
+func (t *Transport) restartHint(ctx context.Context, chid datatransfer.ChannelID, root ipld.Link, stor ipld.Node) (graphsync.ExtensionData, *cid.Set, bool) {
+	t.dataLock.RLock()
+	loader := t.loaderFor(chid)
+	t.dataLock.RUnlock()
+
+	have, err := completeSubtrees(ctx, loader, root, stor)
+	if err != nil {
+		log.Warnf("channel %s: finding complete subtrees for restart hint: %s", chid, err)
+		return graphsync.ExtensionData{}, nil, false
+	}
+	bz, err := cidset.EncodeCidSet(have)
+	if err != nil {
+		log.Warnf("channel %s: encoding restart hint: %s", chid, err)
+		return graphsync.ExtensionData{}, nil, false
+	}
+	return graphsync.ExtensionData{Name: extension.ExtensionRestartHint, Data: bz}, have, true
+}
+
+// useRestartHint makes graphsync skip the subtrees in the restart hint of an
+// incoming request, if it has one. The data lock must be held.
+func (t *Transport) useRestartHint(chid datatransfer.ChannelID, request graphsync.RequestData, hookActions graphsync.IncomingRequestHookActions) error {
+	data, ok := request.Extension(extension.ExtensionRestartHint)
+	if !ok || t.hintLoader == nil {
+		return nil
+	}
+	have, err := cidset.DecodeCidSet(data)
+	if err != nil {
+		return xerrors.Errorf("decoding restart hint: %w", err)
+	}
+
+	t.removeHintedLoader(chid)
+	hl := &hintedLoader{
+		loader: t.loaderFor(chid),
+		have:   have,
+		name:   "data-transfer-hint-" + chid.String(),
+	}
+	// the storer is only used for requests we make, which never use the hint
+	if err := t.gs.RegisterPersistenceOption(hl.name, hl.load, nil); err != nil {
+		return xerrors.Errorf("registering loader for restart hint: %w", err)
+	}
+	t.hintedLoaders[chid] = hl
+	hookActions.UsePersistenceOption(hl.name)
+	return nil
+}
+
+// removeHintedLoader unregisters the loader for the restart hint of a channel,
+// if it has one. The data lock must be held.
+func (t *Transport) removeHintedLoader(chid datatransfer.ChannelID) {
+	hl, ok := t.hintedLoaders[chid]
+	if !ok {
+		return
+	}
+	delete(t.hintedLoaders, chid)
+	if err := t.gs.UnregisterPersistenceOption(hl.name); err != nil {
+		log.Warnf("channel %s: unregistering loader for restart hint: %s", chid, err)
+	}
+}
+
+// isHintedMissingBlock returns true if the error is graphsync reporting that
+// the sender did not send a block that is in the restart hint
+func isHintedMissingBlock(err error, have *cid.Set) bool {
+	if have == nil || !strings.HasPrefix(err.Error(), missingBlockErrPrefix) {
+		return false
+	}
+	c, decodeErr := cid.Decode(strings.TrimPrefix(err.Error(), missingBlockErrPrefix))
+	return decodeErr == nil && have.Has(c)
+}
+
+// subtree is a block reached in a selector traversal
+type subtree struct {
+	c        cid.Cid
+	path     ipld.Path
+	parent   int
+	complete bool
+}
+
+// completeSubtrees traverses the selector over the local store, and returns
+// the roots of the largest subtrees that have all their blocks in the store
+func completeSubtrees(ctx context.Context, loader ipld.Loader, root ipld.Link, stor ipld.Node) (*cid.Set, error) {
+	if loader == nil {
+		return nil, xerrors.New("no loader for local blocks")
+	}
+
+	traverser := ipldutil.TraversalBuilder{Root: root, Selector: stor}.Start(ctx)
+	defer traverser.Shutdown(ctx)
+
+	var subtrees []subtree
+	// the subtrees on the path to the current block
+	var stack []int
+	for {
+		isComplete, err := traverser.IsComplete()
+		if isComplete {
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		lnk, lnkCtx := traverser.CurrentRequest()
+		asCidLink, ok := lnk.(cidlink.Link)
+		if !ok {
+			return nil, xerrors.Errorf("unsupported link type %T", lnk)
+		}
+		for len(stack) > 0 && !isParentPath(subtrees[stack[len(stack)-1]].path, lnkCtx.LinkPath) {
+			stack = stack[:len(stack)-1]
+		}
+		parent := -1
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		subtrees = append(subtrees, subtree{c: asCidLink.Cid, path: lnkCtx.LinkPath, parent: parent, complete: true})
+		idx := len(subtrees) - 1
+
+		r, err := loader(lnk, lnkCtx)
+		if err != nil {
+			// the block is missing, so neither it nor the subtrees it is in are
+			// complete
+			for i := idx; i >= 0 && subtrees[i].complete; i = subtrees[i].parent {
+				subtrees[i].complete = false
+			}
+			traverser.Error(traversal.SkipMe{})
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if _, err := io.Copy(buf, r); err != nil {
+			return nil, err
+		}
+		stack = append(stack, idx)
+		if err := traverser.Advance(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	// a block can be reached by more than one path, and is only a complete
+	// subtree if it is complete on all of them
+	incomplete := cid.NewSet()
+	for _, st := range subtrees {
+		if !st.complete {
+			incomplete.Add(st.c)
+		}
+	}
+	eligible := func(i int) bool {
+		return subtrees[i].complete && !incomplete.Has(subtrees[i].c)
+	}
+	have := cid.NewSet()
+	for i, st := range subtrees {
+		if eligible(i) && (st.parent == -1 || !eligible(st.parent)) {
+			have.Add(st.c)
+		}
+	}
+	return have, nil
+}
+
+// isParentPath returns true if the child path is below the parent path
+func isParentPath(parent ipld.Path, child ipld.Path) bool {
+	parentSegs := parent.Segments()
+	childSegs := child.Segments()
+	if len(childSegs) <= len(parentSegs) {
+		return false
+	}
+	for i, seg := range parentSegs {
+		if !seg.Equals(childSegs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// doNotSendList is a list of the blocks the receiver of a channel has
+type doNotSendList []cid.Cid
+
+func (l doNotSendList) Len() int {
+	return len(l)
+}
+
+func (l doNotSendList) ForEach(cb func(cid.Cid) error) error {
+	for _, c := range l {
+		if err := cb(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
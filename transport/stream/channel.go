@@ -0,0 +1,644 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipld/go-ipld-prime"
+	dagpb "github.com/ipld/go-ipld-prime-proto"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/transport/stream/internal"
+)
+
+// The maximum amount of time to wait to tell the other party a channel was
+// closed
+const closeTimeout = 5 * time.Second
+
+var defaultChooser traversal.LinkTargetNodePrototypeChooser = dagpb.AddDagPBSupportToChooser(func(ipld.Link, ipld.LinkContext) (ipld.NodePrototype, error) {
+	return basicnode.Prototype.Any, nil
+})
+
+// channel is the state of a single channel on the stream transport, on
+// either the sending or the receiving side
+type channel struct {
+	t       *Transport
+	chid    datatransfer.ChannelID
+	other   peer.ID
+	sending bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	// ready is closed once the stream is open, or could not be opened
+	ready   chan struct{}
+	stream  network.Stream
+	reader  *bufio.Reader
+	writeLk sync.Mutex
+
+	// incoming holds the block and complete frames received by the receiver,
+	// in the order they were sent
+	incoming chan *internal.Frame
+
+	lk            sync.Mutex
+	pausedBySelf  bool
+	pausedByOther bool
+	unpaused      chan struct{}
+	// closed is set when the channel is closed by either party, in which
+	// case no further events are fired
+	closed bool
+	// done is set when the traversal has finished
+	done         bool
+	disconnected bool
+	failErr      error
+}
+
+func newChannel(ctx context.Context, t *Transport, chid datatransfer.ChannelID, other peer.ID, sending bool) *channel {
+	ctx, cancel := context.WithCancel(ctx)
+	return &channel{
+		t:        t,
+		chid:     chid,
+		other:    other,
+		sending:  sending,
+		ctx:      ctx,
+		cancel:   cancel,
+		ready:    make(chan struct{}),
+		incoming: make(chan *internal.Frame, 16),
+		unpaused: make(chan struct{}),
+	}
+}
+
+// setStream records the stream for the channel, or that it could not be
+// opened if s is nil. It returns false if the channel was closed in the
+// meantime.
+func (ch *channel) setStream(s network.Stream, reader *bufio.Reader) bool {
+	ch.lk.Lock()
+	defer ch.lk.Unlock()
+	defer close(ch.ready)
+	if ch.closed {
+		return false
+	}
+	ch.stream = s
+	ch.reader = reader
+	return true
+}
+
+func (ch *channel) writeFrame(ctx context.Context, frame *internal.Frame) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ch.ready:
+	}
+	if ch.stream == nil {
+		return xerrors.Errorf("channel %s: no stream to %s", ch.chid, ch.other)
+	}
+	buf := new(bytes.Buffer)
+	if err := frame.MarshalCBOR(buf); err != nil {
+		return xerrors.Errorf("channel %s: encoding frame: %w", ch.chid, err)
+	}
+
+	ch.writeLk.Lock()
+	defer ch.writeLk.Unlock()
+	if _, err := ch.stream.Write(buf.Bytes()); err != nil {
+		ch.setDisconnected()
+		return xerrors.Errorf("channel %s: writing to stream: %w", ch.chid, err)
+	}
+	return nil
+}
+
+func (ch *channel) writeMessage(ctx context.Context, frameType internal.FrameType, msg datatransfer.Message) error {
+	msgBytes, err := encodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	return ch.writeFrame(ctx, &internal.Frame{Type: frameType, Message: msgBytes})
+}
+
+// readFrames reads frames from the other party until the stream closes
+func (ch *channel) readFrames() {
+	defer func() {
+		close(ch.incoming)
+		_ = ch.stream.Close()
+	}()
+	for {
+		frame := new(internal.Frame)
+		if err := frame.UnmarshalCBOR(ch.reader); err != nil {
+			if ch.setDisconnected() {
+				log.Warnf("channel %s: reading from stream: %s", ch.chid, err)
+			}
+			return
+		}
+
+		switch frame.Type {
+		case internal.BlockFrame, internal.CompleteFrame:
+			if ch.sending {
+				log.Warnf("channel %s: received unexpected frame of type %d from receiver", ch.chid, frame.Type)
+				continue
+			}
+			select {
+			case ch.incoming <- frame:
+			case <-ch.ctx.Done():
+				return
+			}
+			if frame.Type == internal.CompleteFrame {
+				return
+			}
+		case internal.MessageFrame:
+			ch.receiveMessage(frame.Message)
+		case internal.PauseFrame:
+			ch.setPausedByOther(true)
+		case internal.ResumeFrame:
+			if len(frame.Message) > 0 {
+				ch.receiveMessage(frame.Message)
+			}
+			ch.setPausedByOther(false)
+		case internal.CancelFrame:
+			ch.close(false)
+			return
+		default:
+			log.Warnf("channel %s: received unexpected frame of type %d", ch.chid, frame.Type)
+		}
+	}
+}
+
+// receiveMessage processes a data transfer message sent along with the data,
+// and sends back the response if there is one
+func (ch *channel) receiveMessage(data []byte) {
+	msg, err := message.FromNet(bytes.NewReader(data))
+	if err != nil {
+		ch.fail(xerrors.Errorf("decoding data transfer message: %w", err))
+		return
+	}
+	response, err := ch.t.processMessage(ch.chid, msg, ch.other)
+	if response != nil {
+		if writeErr := ch.writeMessage(ch.ctx, internal.MessageFrame, response); writeErr != nil {
+			log.Warnf("channel %s: sending response: %s", ch.chid, writeErr)
+			return
+		}
+	}
+	switch err {
+	case nil:
+	case datatransfer.ErrPause:
+		if pauseErr := ch.pause(ch.ctx); pauseErr != nil {
+			log.Warnf("channel %s: pausing: %s", ch.chid, pauseErr)
+		}
+	case datatransfer.ErrResume:
+		if resumeErr := ch.resume(ch.ctx, nil); resumeErr != nil {
+			log.Warnf("channel %s: resuming: %s", ch.chid, resumeErr)
+		}
+	default:
+		ch.fail(err)
+	}
+}
+
+func (ch *channel) pause(ctx context.Context) error {
+	ch.lk.Lock()
+	if ch.closed || ch.done {
+		ch.lk.Unlock()
+		return nil
+	}
+	ch.pausedBySelf = true
+	ch.lk.Unlock()
+
+	if ch.sending {
+		// the sender stops before sending the next block
+		return nil
+	}
+	return ch.writeFrame(ctx, &internal.Frame{Type: internal.PauseFrame})
+}
+
+func (ch *channel) resume(ctx context.Context, msg datatransfer.Message) error {
+	ch.lk.Lock()
+	finished := ch.closed || ch.done
+	ch.lk.Unlock()
+	if finished {
+		return nil
+	}
+
+	if !ch.sending {
+		ch.lk.Lock()
+		ch.pausedBySelf = false
+		ch.lk.Unlock()
+		return ch.writeMessage(ctx, internal.ResumeFrame, msg)
+	}
+
+	// send the message before any more blocks
+	if msg != nil {
+		if err := ch.writeMessage(ctx, internal.MessageFrame, msg); err != nil {
+			return err
+		}
+	}
+	ch.lk.Lock()
+	ch.pausedBySelf = false
+	ch.signalUnpaused()
+	ch.lk.Unlock()
+	return nil
+}
+
+func (ch *channel) setPausedByOther(paused bool) {
+	ch.lk.Lock()
+	defer ch.lk.Unlock()
+	ch.pausedByOther = paused
+	if !paused {
+		ch.signalUnpaused()
+	}
+}
+
+// signalUnpaused wakes up the sender if it is waiting for the channel to be
+// resumed. It must be called with the lock held.
+func (ch *channel) signalUnpaused() {
+	close(ch.unpaused)
+	ch.unpaused = make(chan struct{})
+}
+
+// waitForResume blocks until the channel is paused by neither party
+func (ch *channel) waitForResume() error {
+	for {
+		ch.lk.Lock()
+		if !ch.pausedBySelf && !ch.pausedByOther {
+			ch.lk.Unlock()
+			return nil
+		}
+		unpaused := ch.unpaused
+		ch.lk.Unlock()
+
+		select {
+		case <-ch.ctx.Done():
+			return ch.ctx.Err()
+		case <-unpaused:
+		}
+	}
+}
+
+// setDisconnected records that the stream failed, unless the channel has
+// already finished. It returns true if the channel was still active.
+func (ch *channel) setDisconnected() bool {
+	ch.lk.Lock()
+	defer ch.lk.Unlock()
+	if ch.closed || ch.done {
+		return false
+	}
+	ch.disconnected = true
+	ch.cancel()
+	return true
+}
+
+// fail stops the traversal, which finishes with the given error
+func (ch *channel) fail(err error) {
+	ch.lk.Lock()
+	defer ch.lk.Unlock()
+	if ch.failErr == nil {
+		ch.failErr = err
+	}
+	ch.cancel()
+}
+
+// close stops the channel without firing any further events. If notifyOther
+// is true, the other party is told the channel was closed.
+func (ch *channel) close(notifyOther bool) {
+	ch.lk.Lock()
+	if ch.closed {
+		ch.lk.Unlock()
+		return
+	}
+	ch.closed = true
+	ch.cancel()
+	s := ch.stream
+	ch.lk.Unlock()
+
+	if s == nil {
+		return
+	}
+	go func() {
+		if notifyOther {
+			_ = s.SetWriteDeadline(time.Now().Add(closeTimeout))
+			ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+			_ = ch.writeFrame(ctx, &internal.Frame{Type: internal.CancelFrame})
+			cancel()
+		}
+		_ = s.Close()
+	}()
+}
+
+// finish fires the event for how the traversal ended, unless the channel was
+// closed. ctx is the context the channel was opened with.
+func (ch *channel) finish(ctx context.Context, err error) {
+	ch.lk.Lock()
+	closed := ch.closed
+	disconnected := ch.disconnected
+	if ch.failErr != nil {
+		err = ch.failErr
+	}
+	ch.done = true
+	ch.lk.Unlock()
+
+	if closed {
+		return
+	}
+
+	switch {
+	case disconnected:
+		log.Warnf("channel %s: stream to %s disconnected", ch.chid, ch.other)
+		if eventErr := ch.t.events.OnRequestDisconnected(ctx, ch.chid); eventErr != nil {
+			log.Error(eventErr)
+		}
+		ch.close(false)
+		return
+	case !ch.sending && ctx.Err() != nil:
+		log.Warnf("channel %s: request context cancelled", ch.chid)
+		if eventErr := ch.t.events.OnRequestTimedOut(ctx, ch.chid); eventErr != nil {
+			log.Error(eventErr)
+		}
+		ch.close(true)
+		return
+	}
+
+	var completeErr error
+	if err != nil {
+		completeErr = xerrors.Errorf("stream transfer failed to complete: %w", err)
+	}
+	if ch.sending {
+		frame := &internal.Frame{Type: internal.CompleteFrame}
+		if completeErr != nil {
+			frame.Error = completeErr.Error()
+		}
+		if writeErr := ch.writeFrame(context.Background(), frame); writeErr != nil {
+			log.Warnf("channel %s: sending complete: %s", ch.chid, writeErr)
+		} else {
+			// the receiver closes the stream once it has read everything
+			_ = ch.stream.CloseWrite()
+		}
+	}
+
+	if eventErr := ch.t.events.OnChannelCompleted(ch.chid, completeErr); eventErr != nil {
+		log.Error(eventErr)
+	}
+
+	if !ch.sending {
+		ch.close(completeErr != nil)
+	}
+}
+
+// send traverses the selector, sending each block the receiver does not
+// already have
+func (ch *channel) send(root cid.Cid, stor ipld.Node, doNotSend *cid.Set) {
+	loader, _ := ch.t.storeFor(ch.chid)
+	err := traverse(ch.ctx, ch.sendingLoader(loader, doNotSend), root, stor)
+	if err == nil {
+		// if the channel was paused with the last block, hold back completing
+		// until it is resumed
+		err = ch.waitForResume()
+	}
+	ch.finish(context.Background(), err)
+}
+
+func (ch *channel) sendingLoader(loader ipld.Loader, doNotSend *cid.Set) ipld.Loader {
+	sent := cid.NewSet()
+	return func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+		asCidLink, ok := lnk.(cidlink.Link)
+		if !ok {
+			return nil, xerrors.Errorf("link %s is not a CID link", lnk)
+		}
+		r, err := loader(lnk, lnkCtx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if !doNotSend.Has(asCidLink.Cid) && sent.Visit(asCidLink.Cid) {
+			if err := ch.sendBlock(asCidLink, data); err != nil {
+				return nil, err
+			}
+		}
+		return bytes.NewReader(data), nil
+	}
+}
+
+func (ch *channel) sendBlock(lnk cidlink.Link, data []byte) error {
+	if err := ch.waitForResume(); err != nil {
+		return err
+	}
+
+	size := uint64(len(data))
+	msg, err := ch.t.events.OnDataQueued(ch.chid, lnk, size)
+	if err != nil && err != datatransfer.ErrPause {
+		return err
+	}
+	if msg != nil {
+		if err := ch.writeMessage(ch.ctx, internal.MessageFrame, msg); err != nil {
+			return err
+		}
+	}
+
+	if err := ch.writeFrame(ch.ctx, &internal.Frame{Type: internal.BlockFrame, Link: &lnk.Cid, Data: data}); err != nil {
+		return err
+	}
+	if err := ch.t.events.OnDataSent(ch.chid, lnk, size); err != nil {
+		log.Errorf("failed to process data sent: %+v", err)
+	}
+
+	if err == datatransfer.ErrPause {
+		// the block is still sent, but the next block waits until the channel
+		// is resumed
+		ch.lk.Lock()
+		ch.pausedBySelf = true
+		ch.lk.Unlock()
+	}
+	return nil
+}
+
+// receive opens a stream to the data sender, and traverses the selector,
+// reading each block from the stream as the traversal reaches it
+func (ch *channel) receive(ctx context.Context, root cid.Cid, stor ipld.Node, doNotSendCids []cid.Cid, request *internal.Frame) {
+	if err := ch.t.events.OnChannelOpened(ch.chid); err != nil {
+		log.Warnf("channel %s: not opening stream: %s", ch.chid, err)
+		ch.close(false)
+		return
+	}
+
+	openCtx, cancel := context.WithTimeout(ch.ctx, ch.t.openStreamTimeout)
+	s, err := ch.t.host.NewStream(openCtx, ch.other, ProtocolDataTransferStream)
+	cancel()
+	if err != nil {
+		ch.setStream(nil, nil)
+		if ch.setDisconnected() {
+			log.Warnf("channel %s: opening stream to %s: %s", ch.chid, ch.other, err)
+		}
+		ch.finish(ctx, err)
+		return
+	}
+	if !ch.setStream(s, bufio.NewReader(s)) {
+		_ = s.Reset()
+		return
+	}
+
+	// the sender resets the stream if asked not to send too many cids, so
+	// any more are sent and received again
+	if len(doNotSendCids) > ch.t.maxDoNotSendCids {
+		doNotSendCids = doNotSendCids[:ch.t.maxDoNotSendCids]
+	}
+	doNotSend := cid.NewSet()
+	for _, c := range doNotSendCids {
+		doNotSend.Add(c)
+	}
+	for len(doNotSendCids) > 0 {
+		n := len(doNotSendCids)
+		if n > maxCidsPerFrame {
+			n = maxCidsPerFrame
+		}
+		frame := &internal.Frame{Type: internal.DoNotSendFrame, DoNotSend: doNotSendCids[:n]}
+		if err := ch.writeFrame(ch.ctx, frame); err != nil {
+			ch.finish(ctx, err)
+			return
+		}
+		doNotSendCids = doNotSendCids[n:]
+	}
+	if err := ch.writeFrame(ch.ctx, request); err != nil {
+		ch.finish(ctx, err)
+		return
+	}
+	go ch.readFrames()
+
+	loader, storer := ch.t.storeFor(ch.chid)
+	err = traverse(ch.ctx, ch.receivingLoader(loader, storer, doNotSend), root, stor)
+	if err == nil {
+		err = ch.awaitComplete()
+	}
+	ch.finish(ctx, err)
+}
+
+func (ch *channel) nextFrame() (*internal.Frame, error) {
+	select {
+	case <-ch.ctx.Done():
+		return nil, ch.ctx.Err()
+	case frame, ok := <-ch.incoming:
+		if !ok {
+			return nil, xerrors.Errorf("stream to %s closed", ch.other)
+		}
+		return frame, nil
+	}
+}
+
+// awaitComplete waits for the sender to finish the traversal
+func (ch *channel) awaitComplete() error {
+	frame, err := ch.nextFrame()
+	if err != nil {
+		return err
+	}
+	if frame.Type != internal.CompleteFrame {
+		return xerrors.Errorf("received unexpected block %s", frame.Link)
+	}
+	if frame.Error != "" {
+		return xerrors.Errorf("data sender failed: %s", frame.Error)
+	}
+	return nil
+}
+
+func (ch *channel) receivingLoader(loader ipld.Loader, storer ipld.Storer, doNotSend *cid.Set) ipld.Loader {
+	received := cid.NewSet()
+	return func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+		asCidLink, ok := lnk.(cidlink.Link)
+		if !ok {
+			return nil, xerrors.Errorf("link %s is not a CID link", lnk)
+		}
+		c := asCidLink.Cid
+		// blocks the sender skips must already be in the local store
+		if doNotSend.Has(c) || received.Has(c) {
+			return loader(lnk, lnkCtx)
+		}
+
+		frame, err := ch.nextFrame()
+		if err != nil {
+			return nil, err
+		}
+		if frame.Type == internal.CompleteFrame {
+			if frame.Error != "" {
+				return nil, xerrors.Errorf("data sender failed: %s", frame.Error)
+			}
+			return nil, xerrors.Errorf("data sender finished without sending block %s", c)
+		}
+		if frame.Link == nil || !frame.Link.Equals(c) {
+			return nil, xerrors.Errorf("expected block %s, received %s", c, frame.Link)
+		}
+		sum, err := c.Prefix().Sum(frame.Data)
+		if err != nil {
+			return nil, xerrors.Errorf("hashing block %s: %w", c, err)
+		}
+		if !sum.Equals(c) {
+			return nil, xerrors.Errorf("block data does not match CID %s", c)
+		}
+
+		w, commit, err := storer(lnkCtx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(frame.Data); err != nil {
+			return nil, err
+		}
+		if err := commit(lnk); err != nil {
+			return nil, err
+		}
+		received.Add(c)
+
+		err = ch.t.events.OnDataReceived(ch.chid, lnk, uint64(len(frame.Data)))
+		if err == datatransfer.ErrPause {
+			if pauseErr := ch.pause(ch.ctx); pauseErr != nil {
+				log.Warnf("channel %s: pausing: %s", ch.chid, pauseErr)
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(frame.Data), nil
+	}
+}
+
+// traverse walks the selector from the root, loading blocks with the given
+// loader
+func traverse(ctx context.Context, loader ipld.Loader, root cid.Cid, stor ipld.Node) error {
+	sel, err := selector.ParseSelector(stor)
+	if err != nil {
+		return xerrors.Errorf("parsing selector: %w", err)
+	}
+	rootLink := cidlink.Link{Cid: root}
+	proto, err := defaultChooser(rootLink, ipld.LinkContext{})
+	if err != nil {
+		return err
+	}
+	nb := proto.NewBuilder()
+	if err := rootLink.Load(ctx, ipld.LinkContext{}, nb, loader); err != nil {
+		return err
+	}
+	return traversal.Progress{
+		Cfg: &traversal.Config{
+			Ctx:                            ctx,
+			LinkLoader:                     loader,
+			LinkTargetNodePrototypeChooser: defaultChooser,
+		},
+	}.WalkAdv(nb.Build(), sel, func(traversal.Progress, ipld.Node, traversal.VisitReason) error {
+		return nil
+	})
+}
+
+func decodeSelector(data []byte) (ipld.Node, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decoder(nb, bytes.NewReader(data)); err != nil {
+		return nil, xerrors.Errorf("decoding selector: %w", err)
+	}
+	return nb.Build(), nil
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+//go:generate cbor-gen-for Frame
+
+// FrameType identifies what a frame on a stream transport stream carries
+type FrameType uint64
+
+const (
+	// RequestFrame is the first frame the receiver sends on a new stream.
+	// It carries the data transfer message and the selector traversal to
+	// perform.
+	RequestFrame FrameType = iota
+
+	// DoNotSendFrame carries CIDs the receiver already has. The receiver sends
+	// these before the request frame, up to the maximum number of CIDs the
+	// sender accepts.
+	DoNotSendFrame
+
+	// MessageFrame carries a data transfer message, in either direction
+	MessageFrame
+
+	// BlockFrame carries a block, from the sender to the receiver
+	BlockFrame
+
+	// PauseFrame asks the sender to stop sending blocks
+	PauseFrame
+
+	// ResumeFrame asks the sender to start sending blocks again, and may
+	// carry a data transfer message
+	ResumeFrame
+
+	// CancelFrame tells the other party the channel was closed
+	CancelFrame
+
+	// CompleteFrame tells the receiver that the sender has finished the
+	// traversal. Error is set if the traversal failed.
+	CompleteFrame
+)
+
+// Frame is a unit of communication on a stream transport stream
+type Frame struct {
+	Type FrameType
+	// Message is a data transfer message in network format
+	Message []byte
+	// Root is the root of the traversal, in request frames
+	Root *cid.Cid
+	// Selector is the selector for the traversal, in request frames
+	Selector *cbg.Deferred
+	// DoNotSend is a list of CIDs not to send, in do not send frames
+	DoNotSend []cid.Cid
+	// Link is the CID of the block, in block frames
+	Link *cid.Cid
+	// Data is the raw block data, in block frames
+	Data []byte
+	// Error is the reason the traversal failed, in complete frames
+	Error string
+}
@@ -0,0 +1,422 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	ipld "github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/transport/stream/internal"
+)
+
+var log = logging.Logger("dt_stream")
+
+// ProtocolDataTransferStream is the libp2p protocol the stream transport
+// sends blocks over
+const ProtocolDataTransferStream protocol.ID = "/fil/datatransfer/stream/1.0.0"
+
+// TransportID identifies the stream transport when it is registered with a
+// data transfer manager alongside other transports
+const TransportID datatransfer.TransportID = "stream"
+
+// The maximum amount of time to wait to open a stream to the data sender
+const defaultOpenStreamTimeout = 10 * time.Second
+
+// The maximum number of CIDs sent in a single do not send frame
+const maxCidsPerFrame = 4096
+
+// The default maximum number of CIDs the receiver can ask the sender not to
+// send for a channel
+const defaultMaxDoNotSendCids = 1 << 20
+
+// Option is an option for setting up the stream transport
+type Option func(*Transport)
+
+// MaxDoNotSendCids sets the maximum number of CIDs a peer can ask this
+// transport not to send for a channel. The sender resets streams on which
+// the peer sends more, and the receiver only sends that many, so both
+// peers should use the same maximum.
+func MaxDoNotSendCids(max int) Option {
+	return func(t *Transport) {
+		t.maxDoNotSendCids = max
+	}
+}
+
+// OpenStreamTimeout sets how long the receiver waits to open a stream to the
+// data sender before the channel is considered disconnected
+func OpenStreamTimeout(timeout time.Duration) Option {
+	return func(t *Transport) {
+		t.openStreamTimeout = timeout
+	}
+}
+
+type store struct {
+	loader ipld.Loader
+	storer ipld.Storer
+}
+
+// Transport is a data transfer transport that sends the blocks for a selector
+// traversal directly over a dedicated libp2p protocol, without graphsync.
+//
+// For each channel the receiver opens a stream to the data sender. Both
+// parties then traverse the selector: the sender sends each block over the
+// stream as its traversal loads it, and the receiver verifies and stores each
+// block as its own traversal reaches it.
+type Transport struct {
+	host              host.Host
+	loader            ipld.Loader
+	storer            ipld.Storer
+	openStreamTimeout time.Duration
+	maxDoNotSendCids  int
+	events            datatransfer.EventsHandler
+
+	lk       sync.Mutex
+	channels map[datatransfer.ChannelID]*channel
+	stores   map[datatransfer.ChannelID]store
+}
+
+var _ datatransfer.PauseableTransport = (*Transport)(nil)
+
+// NewTransport makes a new stream transport on the given host, that loads
+// and stores blocks with the given loader and storer
+func NewTransport(h host.Host, loader ipld.Loader, storer ipld.Storer, options ...Option) *Transport {
+	t := &Transport{
+		host:              h,
+		loader:            loader,
+		storer:            storer,
+		openStreamTimeout: defaultOpenStreamTimeout,
+		maxDoNotSendCids:  defaultMaxDoNotSendCids,
+		channels:          make(map[datatransfer.ChannelID]*channel),
+		stores:            make(map[datatransfer.ChannelID]store),
+	}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+// OpenChannel initiates an outgoing request for the other peer to send data
+// to us on this channel
+// Note: from a data transfer symantic standpoint, it doesn't matter if the
+// request is push or pull -- OpenChannel is called by the party that is
+// intending to receive data
+func (t *Transport) OpenChannel(ctx context.Context,
+	dataSender peer.ID,
+	channelID datatransfer.ChannelID,
+	root ipld.Link,
+	stor ipld.Node,
+	doNotSendCids []cid.Cid,
+	msg datatransfer.Message) error {
+	if t.events == nil {
+		return datatransfer.ErrHandlerNotSet
+	}
+	rootLink, ok := root.(cidlink.Link)
+	if !ok {
+		return xerrors.Errorf("root link %s is not a CID link", root)
+	}
+	msgBytes, err := encodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	selBytes, err := encoding.Encode(stor)
+	if err != nil {
+		return xerrors.Errorf("encoding selector: %w", err)
+	}
+	request := &internal.Frame{
+		Type:     internal.RequestFrame,
+		Message:  msgBytes,
+		Root:     &rootLink.Cid,
+		Selector: &cbg.Deferred{Raw: selBytes},
+	}
+
+	ch := newChannel(ctx, t, channelID, dataSender, false)
+
+	t.lk.Lock()
+	// if we have an existing request for the channel (eg because the channel
+	// is being restarted), cancel it first
+	if existing, ok := t.channels[channelID]; ok {
+		existing.close(true)
+	}
+	t.channels[channelID] = ch
+	t.lk.Unlock()
+
+	go ch.receive(ctx, rootLink.Cid, stor, doNotSendCids, request)
+	return nil
+}
+
+// PauseChannel paused the given channel ID
+func (t *Transport) PauseChannel(ctx context.Context,
+	chid datatransfer.ChannelID,
+) error {
+	if t.events == nil {
+		return datatransfer.ErrHandlerNotSet
+	}
+	ch, err := t.channel(chid)
+	if err != nil {
+		return err
+	}
+	return ch.pause(ctx)
+}
+
+// ResumeChannel resumes the given channel
+func (t *Transport) ResumeChannel(ctx context.Context,
+	msg datatransfer.Message,
+	chid datatransfer.ChannelID,
+) error {
+	if t.events == nil {
+		return datatransfer.ErrHandlerNotSet
+	}
+	ch, err := t.channel(chid)
+	if err != nil {
+		return err
+	}
+	return ch.resume(ctx, msg)
+}
+
+// CloseChannel closes the given channel
+func (t *Transport) CloseChannel(ctx context.Context, chid datatransfer.ChannelID) error {
+	if t.events == nil {
+		return datatransfer.ErrHandlerNotSet
+	}
+	ch, err := t.channel(chid)
+	if err != nil {
+		return err
+	}
+	ch.close(true)
+	return nil
+}
+
+// CleanupChannel is called on the otherside of a cancel - removes any associated
+// data for the channel
+func (t *Transport) CleanupChannel(chid datatransfer.ChannelID) {
+	t.lk.Lock()
+	ch, ok := t.channels[chid]
+	delete(t.channels, chid)
+	delete(t.stores, chid)
+	t.lk.Unlock()
+
+	if ok {
+		ch.close(false)
+	}
+}
+
+// SetEventHandler sets the handler for events on channels
+func (t *Transport) SetEventHandler(events datatransfer.EventsHandler) error {
+	if t.events != nil {
+		return datatransfer.ErrHandlerAlreadySet
+	}
+	t.events = events
+	t.host.SetStreamHandler(ProtocolDataTransferStream, t.handleStream)
+	return nil
+}
+
+// Shutdown stops accepting streams and cancels all open channels
+func (t *Transport) Shutdown(ctx context.Context) error {
+	t.host.RemoveStreamHandler(ProtocolDataTransferStream)
+
+	t.lk.Lock()
+	channels := make([]*channel, 0, len(t.channels))
+	for _, ch := range t.channels {
+		channels = append(channels, ch)
+	}
+	t.lk.Unlock()
+
+	for _, ch := range channels {
+		ch.close(true)
+	}
+	return nil
+}
+
+// UseStore tells the stream transport to use the given loader and storer for this channelID
+func (t *Transport) UseStore(channelID datatransfer.ChannelID, loader ipld.Loader, storer ipld.Storer) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.stores[channelID] = store{loader: loader, storer: storer}
+	return nil
+}
+
+// ChannelLoader returns the loader the stream transport uses for this channelID
+func (t *Transport) ChannelLoader(chid datatransfer.ChannelID) ipld.Loader {
+	loader, _ := t.storeFor(chid)
+	return loader
+}
+
+func (t *Transport) storeFor(chid datatransfer.ChannelID) (ipld.Loader, ipld.Storer) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if s, ok := t.stores[chid]; ok {
+		return s.loader, s.storer
+	}
+	return t.loader, t.storer
+}
+
+func (t *Transport) channel(chid datatransfer.ChannelID) (*channel, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	ch, ok := t.channels[chid]
+	if !ok {
+		return nil, datatransfer.ErrChannelNotFound
+	}
+	return ch, nil
+}
+
+// handleStream handles a stream opened by a peer that wants us to send it
+// data
+func (t *Transport) handleStream(s network.Stream) {
+	p := s.Conn().RemotePeer()
+	reader := bufio.NewReader(s)
+
+	// the do not send frames arrive before the request, so bound them to
+	// stop the peer from filling up memory without ever sending a request
+	maxFrames := (t.maxDoNotSendCids + maxCidsPerFrame - 1) / maxCidsPerFrame
+	var doNotSendFrames int
+	var doNotSendCids []cid.Cid
+	var request internal.Frame
+	for {
+		var frame internal.Frame
+		if err := frame.UnmarshalCBOR(reader); err != nil {
+			log.Warnf("reading request from %s: %s", p, err)
+			_ = s.Reset()
+			return
+		}
+		if frame.Type == internal.DoNotSendFrame {
+			doNotSendFrames++
+			if doNotSendFrames > maxFrames || len(doNotSendCids)+len(frame.DoNotSend) > t.maxDoNotSendCids {
+				log.Warnf("%s sent more than %d do not send cids", p, t.maxDoNotSendCids)
+				_ = s.Reset()
+				return
+			}
+			doNotSendCids = append(doNotSendCids, frame.DoNotSend...)
+			continue
+		}
+		if frame.Type != internal.RequestFrame {
+			log.Warnf("expected request from %s, received frame of type %d", p, frame.Type)
+			_ = s.Reset()
+			return
+		}
+		request = frame
+		break
+	}
+
+	msg, err := message.FromNet(bytes.NewReader(request.Message))
+	if err != nil {
+		rejectStream(s, xerrors.Errorf("decoding data transfer message: %w", err))
+		return
+	}
+	if request.Root == nil || request.Selector == nil {
+		rejectStream(s, errors.New("request is missing root or selector"))
+		return
+	}
+	stor, err := decodeSelector(request.Selector.Raw)
+	if err != nil {
+		rejectStream(s, err)
+		return
+	}
+
+	var chid datatransfer.ChannelID
+	var responseMessage datatransfer.Message
+	if msg.IsRequest() {
+		// when a DT request comes in on the stream, it's a pull
+		chid = datatransfer.ChannelID{ID: msg.TransferID(), Initiator: p, Responder: t.host.ID()}
+		responseMessage, err = t.events.OnRequestReceived(chid, msg.(datatransfer.Request))
+	} else {
+		// when a DT response comes in on the stream, it's a push
+		chid = datatransfer.ChannelID{ID: msg.TransferID(), Initiator: t.host.ID(), Responder: p}
+		err = t.events.OnResponseReceived(chid, msg.(datatransfer.Response))
+	}
+
+	ch := newChannel(context.Background(), t, chid, p, true)
+	ch.setStream(s, reader)
+
+	if responseMessage != nil {
+		if writeErr := ch.writeMessage(ch.ctx, internal.MessageFrame, responseMessage); writeErr != nil {
+			log.Warnf("channel %s: sending response: %s", chid, writeErr)
+			_ = s.Reset()
+			return
+		}
+	}
+
+	if err != nil && err != datatransfer.ErrPause {
+		rejectStream(s, err)
+		return
+	}
+
+	if err == datatransfer.ErrPause {
+		ch.pausedBySelf = true
+	}
+
+	t.lk.Lock()
+	// a new request for an existing channel replaces it (eg because the
+	// receiver restarted the channel)
+	if existing, ok := t.channels[chid]; ok {
+		existing.close(false)
+	}
+	t.channels[chid] = ch
+	t.lk.Unlock()
+
+	doNotSend := cid.NewSet()
+	for _, c := range doNotSendCids {
+		doNotSend.Add(c)
+	}
+	go ch.readFrames()
+	ch.send(*request.Root, stor, doNotSend)
+}
+
+func (t *Transport) processMessage(chid datatransfer.ChannelID, msg datatransfer.Message, p peer.ID) (datatransfer.Message, error) {
+	if msg.IsRequest() {
+		// only accept request message updates when original message was also request
+		if (chid != datatransfer.ChannelID{ID: msg.TransferID(), Initiator: p, Responder: t.host.ID()}) {
+			return nil, errors.New("received request on response channel")
+		}
+		return t.events.OnRequestReceived(chid, msg.(datatransfer.Request))
+	}
+
+	// only accept response message updates when original message was also response
+	if (chid != datatransfer.ChannelID{ID: msg.TransferID(), Initiator: t.host.ID(), Responder: p}) {
+		return nil, errors.New("received response on request channel")
+	}
+	return nil, t.events.OnResponseReceived(chid, msg.(datatransfer.Response))
+}
+
+// rejectStream tells the receiver that the request failed and closes the stream
+func rejectStream(s network.Stream, err error) {
+	log.Warnf("rejecting request from %s: %s", s.Conn().RemotePeer(), err)
+	buf := new(bytes.Buffer)
+	frame := &internal.Frame{Type: internal.CompleteFrame, Error: err.Error()}
+	if err := frame.MarshalCBOR(buf); err != nil {
+		_ = s.Reset()
+		return
+	}
+	if _, err := s.Write(buf.Bytes()); err != nil {
+		_ = s.Reset()
+		return
+	}
+	_ = s.Close()
+}
+
+func encodeMessage(msg datatransfer.Message) ([]byte, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	buf := new(bytes.Buffer)
+	if err := msg.ToNet(buf); err != nil {
+		return nil, xerrors.Errorf("encoding data transfer message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
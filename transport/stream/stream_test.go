@@ -0,0 +1,387 @@
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+	"github.com/filecoin-project/go-data-transfer/transport/stream"
+	"github.com/filecoin-project/go-data-transfer/transport/stream/internal"
+)
+
+func TestStreamTransport(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+	root := gsData.LoadUnixFSFile(t, false)
+	rootCid := root.(cidlink.Link).Cid
+
+	sender := stream.NewTransport(gsData.Host1, gsData.Loader1, gsData.Storer1)
+	receiver := stream.NewTransport(gsData.Host2, gsData.Loader2, gsData.Storer2)
+	senderEvents := newFakeEvents()
+	receiverEvents := newFakeEvents()
+	require.NoError(t, sender.SetEventHandler(senderEvents))
+	require.NoError(t, receiver.SetEventHandler(receiverEvents))
+
+	transferID := datatransfer.TransferID(1)
+	chid := datatransfer.ChannelID{Initiator: gsData.Host2.ID(), Responder: gsData.Host1.ID(), ID: transferID}
+	voucher := testutil.NewFakeDTType()
+	request, err := message.NewRequest(transferID, false, true, voucher.Type(), voucher, rootCid, gsData.AllSelector)
+	require.NoError(t, err)
+
+	t.Run("transfers blocks", func(t *testing.T) {
+		response, err := message.NewResponse(transferID, true, false, voucher.Type(), voucher)
+		require.NoError(t, err)
+		senderEvents.setRequestReceivedResponse(response, nil)
+
+		err = receiver.OpenChannel(ctx, gsData.Host1.ID(), chid, root, gsData.AllSelector, nil, request)
+		require.NoError(t, err)
+
+		require.NoError(t, receiverEvents.waitForCompleted(ctx))
+		require.NoError(t, senderEvents.waitForCompleted(ctx))
+		gsData.VerifyFileTransferred(t, root, true)
+
+		require.Equal(t, []datatransfer.ChannelID{chid}, receiverEvents.channelsOpened())
+		requests := senderEvents.requestsReceived()
+		require.Len(t, requests, 1)
+		require.Equal(t, rootCid, requests[0].BaseCid())
+		responses := receiverEvents.responsesReceived()
+		require.Len(t, responses, 1)
+		require.True(t, responses[0].Accepted())
+
+		sent := senderEvents.dataSent()
+		require.NotEmpty(t, sent)
+		require.Equal(t, sent, receiverEvents.dataReceived())
+		require.Equal(t, sent, senderEvents.dataQueued())
+	})
+
+	t.Run("restart does not send cids the receiver has", func(t *testing.T) {
+		received := receiverEvents.dataReceived()
+		doNotSendCids := received[:len(received)/2]
+
+		senderEvents.reset()
+		receiverEvents.reset()
+		senderEvents.setRequestReceivedResponse(nil, nil)
+
+		err := receiver.OpenChannel(ctx, gsData.Host1.ID(), chid, root, gsData.AllSelector, doNotSendCids, request)
+		require.NoError(t, err)
+
+		require.NoError(t, receiverEvents.waitForCompleted(ctx))
+		require.NoError(t, senderEvents.waitForCompleted(ctx))
+		require.Equal(t, received[len(received)/2:], senderEvents.dataSent())
+		require.Equal(t, received[len(received)/2:], receiverEvents.dataReceived())
+	})
+
+	t.Run("pauses and resumes", func(t *testing.T) {
+		senderEvents.reset()
+		receiverEvents.reset()
+		senderEvents.setRequestReceivedResponse(nil, nil)
+		senderEvents.setDataQueuedError(datatransfer.ErrPause)
+
+		err := receiver.OpenChannel(ctx, gsData.Host1.ID(), chid, root, gsData.AllSelector, nil, request)
+		require.NoError(t, err)
+
+		// the sender pauses after sending the first block
+		require.Eventually(t, func() bool { return len(senderEvents.dataSent()) == 1 }, time.Second, 10*time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		require.Len(t, senderEvents.dataSent(), 1)
+
+		// the receiver pauses as well, and then resumes
+		senderEvents.setDataQueuedError(nil)
+		require.NoError(t, receiver.PauseChannel(ctx, chid))
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, sender.ResumeChannel(ctx, nil, chid))
+		time.Sleep(100 * time.Millisecond)
+		require.Len(t, senderEvents.dataSent(), 1)
+
+		resumeRequest := message.UpdateRequest(transferID, false)
+		require.NoError(t, receiver.ResumeChannel(ctx, resumeRequest, chid))
+
+		require.NoError(t, receiverEvents.waitForCompleted(ctx))
+		require.NoError(t, senderEvents.waitForCompleted(ctx))
+		require.Equal(t, senderEvents.dataSent(), receiverEvents.dataReceived())
+
+		// the resume message is passed to the sender
+		requests := senderEvents.requestsReceived()
+		require.Len(t, requests, 2)
+		require.True(t, requests[1].IsUpdate())
+		require.False(t, requests[1].IsPaused())
+	})
+
+	t.Run("rejected request", func(t *testing.T) {
+		senderEvents.reset()
+		receiverEvents.reset()
+		senderEvents.setRequestReceivedResponse(nil, errors.New("something went wrong"))
+
+		err := receiver.OpenChannel(ctx, gsData.Host1.ID(), chid, root, gsData.AllSelector, nil, request)
+		require.NoError(t, err)
+
+		require.Error(t, receiverEvents.waitForCompleted(ctx))
+		require.Empty(t, senderEvents.dataSent())
+		require.Empty(t, receiverEvents.dataReceived())
+	})
+
+	t.Run("closed channel fires no events", func(t *testing.T) {
+		senderEvents.reset()
+		receiverEvents.reset()
+		senderEvents.setRequestReceivedResponse(nil, nil)
+		senderEvents.setDataQueuedError(datatransfer.ErrPause)
+
+		err := receiver.OpenChannel(ctx, gsData.Host1.ID(), chid, root, gsData.AllSelector, nil, request)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return len(senderEvents.dataSent()) == 1 }, time.Second, 10*time.Millisecond)
+
+		require.NoError(t, receiver.CloseChannel(ctx, chid))
+		time.Sleep(100 * time.Millisecond)
+		require.False(t, receiverEvents.hasCompleted())
+		require.False(t, senderEvents.hasCompleted())
+		require.False(t, senderEvents.hasDisconnected())
+
+		receiver.CleanupChannel(chid)
+		require.Equal(t, datatransfer.ErrChannelNotFound, receiver.PauseChannel(ctx, chid))
+	})
+
+	require.NoError(t, sender.Shutdown(ctx))
+	require.NoError(t, receiver.Shutdown(ctx))
+}
+
+func TestStreamTransportMaxDoNotSendCids(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+	root := gsData.LoadUnixFSFile(t, false)
+	rootCid := root.(cidlink.Link).Cid
+
+	sender := stream.NewTransport(gsData.Host1, gsData.Loader1, gsData.Storer1, stream.MaxDoNotSendCids(2))
+	receiver := stream.NewTransport(gsData.Host2, gsData.Loader2, gsData.Storer2, stream.MaxDoNotSendCids(2))
+	senderEvents := newFakeEvents()
+	receiverEvents := newFakeEvents()
+	require.NoError(t, sender.SetEventHandler(senderEvents))
+	require.NoError(t, receiver.SetEventHandler(receiverEvents))
+
+	transferID := datatransfer.TransferID(1)
+	chid := datatransfer.ChannelID{Initiator: gsData.Host2.ID(), Responder: gsData.Host1.ID(), ID: transferID}
+	voucher := testutil.NewFakeDTType()
+	request, err := message.NewRequest(transferID, false, true, voucher.Type(), voucher, rootCid, gsData.AllSelector)
+	require.NoError(t, err)
+
+	t.Run("receiver only asks for the maximum", func(t *testing.T) {
+		senderEvents.setRequestReceivedResponse(nil, nil)
+		err := receiver.OpenChannel(ctx, gsData.Host1.ID(), chid, root, gsData.AllSelector, nil, request)
+		require.NoError(t, err)
+		require.NoError(t, receiverEvents.waitForCompleted(ctx))
+		require.NoError(t, senderEvents.waitForCompleted(ctx))
+		received := receiverEvents.dataReceived()
+		require.Greater(t, len(received), 4)
+
+		senderEvents.reset()
+		receiverEvents.reset()
+		senderEvents.setRequestReceivedResponse(nil, nil)
+		err = receiver.OpenChannel(ctx, gsData.Host1.ID(), chid, root, gsData.AllSelector, received[:4], request)
+		require.NoError(t, err)
+		require.NoError(t, receiverEvents.waitForCompleted(ctx))
+		require.NoError(t, senderEvents.waitForCompleted(ctx))
+		require.Equal(t, received[2:], senderEvents.dataSent())
+		require.Equal(t, received[2:], receiverEvents.dataReceived())
+	})
+
+	t.Run("sender resets stream with too many cids", func(t *testing.T) {
+		senderEvents.reset()
+		s, err := gsData.Host2.NewStream(ctx, gsData.Host1.ID(), stream.ProtocolDataTransferStream)
+		require.NoError(t, err)
+		cids := testutil.GenerateCids(2)
+		for i := 0; i < 2; i++ {
+			frame := &internal.Frame{Type: internal.DoNotSendFrame, DoNotSend: cids}
+			require.NoError(t, frame.MarshalCBOR(s))
+		}
+
+		_, err = s.Read(make([]byte, 1))
+		require.Error(t, err)
+		require.Empty(t, senderEvents.requestsReceived())
+	})
+
+	require.NoError(t, sender.Shutdown(ctx))
+	require.NoError(t, receiver.Shutdown(ctx))
+}
+
+type fakeEvents struct {
+	lk                      sync.Mutex
+	opened                  []datatransfer.ChannelID
+	requests                []datatransfer.Request
+	responses               []datatransfer.Response
+	queued                  []cid.Cid
+	sent                    []cid.Cid
+	received                []cid.Cid
+	requestReceivedResponse datatransfer.Response
+	requestReceivedErr      error
+	dataQueuedErr           error
+	completed               chan error
+	disconnected            bool
+}
+
+func newFakeEvents() *fakeEvents {
+	return &fakeEvents{completed: make(chan error, 1)}
+}
+
+func (fe *fakeEvents) reset() {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.opened = nil
+	fe.requests = nil
+	fe.responses = nil
+	fe.queued = nil
+	fe.sent = nil
+	fe.received = nil
+	fe.dataQueuedErr = nil
+	fe.disconnected = false
+	fe.completed = make(chan error, 1)
+}
+
+func (fe *fakeEvents) setRequestReceivedResponse(response datatransfer.Response, err error) {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.requestReceivedResponse = response
+	fe.requestReceivedErr = err
+}
+
+func (fe *fakeEvents) setDataQueuedError(err error) {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.dataQueuedErr = err
+}
+
+func (fe *fakeEvents) waitForCompleted(ctx context.Context) error {
+	fe.lk.Lock()
+	completed := fe.completed
+	fe.lk.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-completed:
+		return err
+	}
+}
+
+func (fe *fakeEvents) hasCompleted() bool {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	return len(fe.completed) > 0
+}
+
+func (fe *fakeEvents) hasDisconnected() bool {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	return fe.disconnected
+}
+
+func (fe *fakeEvents) channelsOpened() []datatransfer.ChannelID {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	return append([]datatransfer.ChannelID{}, fe.opened...)
+}
+
+func (fe *fakeEvents) requestsReceived() []datatransfer.Request {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	return append([]datatransfer.Request{}, fe.requests...)
+}
+
+func (fe *fakeEvents) responsesReceived() []datatransfer.Response {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	return append([]datatransfer.Response{}, fe.responses...)
+}
+
+func (fe *fakeEvents) dataQueued() []cid.Cid {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	return append([]cid.Cid{}, fe.queued...)
+}
+
+func (fe *fakeEvents) dataSent() []cid.Cid {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	return append([]cid.Cid{}, fe.sent...)
+}
+
+func (fe *fakeEvents) dataReceived() []cid.Cid {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	return append([]cid.Cid{}, fe.received...)
+}
+
+func (fe *fakeEvents) OnChannelOpened(chid datatransfer.ChannelID) error {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.opened = append(fe.opened, chid)
+	return nil
+}
+
+func (fe *fakeEvents) OnResponseReceived(chid datatransfer.ChannelID, msg datatransfer.Response) error {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.responses = append(fe.responses, msg)
+	return nil
+}
+
+func (fe *fakeEvents) OnDataReceived(chid datatransfer.ChannelID, link ipld.Link, size uint64) error {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.received = append(fe.received, link.(cidlink.Link).Cid)
+	return nil
+}
+
+func (fe *fakeEvents) OnDataQueued(chid datatransfer.ChannelID, link ipld.Link, size uint64) (datatransfer.Message, error) {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.queued = append(fe.queued, link.(cidlink.Link).Cid)
+	return nil, fe.dataQueuedErr
+}
+
+func (fe *fakeEvents) OnDataSent(chid datatransfer.ChannelID, link ipld.Link, size uint64) error {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.sent = append(fe.sent, link.(cidlink.Link).Cid)
+	return nil
+}
+
+func (fe *fakeEvents) OnRequestReceived(chid datatransfer.ChannelID, msg datatransfer.Request) (datatransfer.Response, error) {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.requests = append(fe.requests, msg)
+	return fe.requestReceivedResponse, fe.requestReceivedErr
+}
+
+func (fe *fakeEvents) OnChannelCompleted(chid datatransfer.ChannelID, err error) error {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.completed <- err
+	return nil
+}
+
+func (fe *fakeEvents) OnRequestTimedOut(ctx context.Context, chid datatransfer.ChannelID) error {
+	return nil
+}
+
+func (fe *fakeEvents) OnRequestDisconnected(ctx context.Context, chid datatransfer.ChannelID) error {
+	fe.lk.Lock()
+	defer fe.lk.Unlock()
+	fe.disconnected = true
+	return nil
+}
+
+var _ datatransfer.EventsHandler = (*fakeEvents)(nil)
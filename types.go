@@ -2,6 +2,7 @@ package datatransfer
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
@@ -130,6 +131,121 @@ type ChannelState interface {
 	// ReceivedCids returns the cids received so far on the channel
 	ReceivedCids() []cid.Cid
 
+	// ReceivedCidsLen returns the number of cids received so far on the channel
+	ReceivedCidsLen() int
+
+	// ForEachReceivedCid calls the callback with each cid received so far on
+	// the channel in order, without loading them all at once. It stops at the
+	// first error the callback returns, and returns it.
+	ForEachReceivedCid(cb func(cid.Cid) error) error
+
 	// Queued returns the number of bytes read from the node and queued for sending
 	Queued() uint64
+
+	// CreatedAt returns the time the channel was created, or the zero time if
+	// the channel was created before creation times were recorded
+	CreatedAt() time.Time
+
+	// LastDataActivity returns the last time data was queued, sent or received
+	// on the channel, or the zero time if there has been no data activity
+	LastDataActivity() time.Time
+
+	// History returns the most recent lifecycle events on the channel, oldest
+	// first. Data events are not included in the history.
+	History() []ChannelHistoryEntry
+
+	// Transport returns the ID of the transport that moves data on this channel
+	Transport() TransportID
+
+	// ErrorCode returns the code of the error the other peer rejected or
+	// cancelled this channel with, or NoError if the channel did not fail
+	// because of such an error
+	ErrorCode() ErrorCode
+
+	// Priority returns the priority of this channel, set by the initiator
+	// when it opened the channel
+	Priority() int
+
+	// Label returns the label the initiator set on this channel
+	Label() string
+
+	// Metadata returns the metadata the initiator set on this channel, or
+	// nil if it did not set any
+	Metadata() map[string]string
+
+	// Deadline returns the time by which this channel must finish, or the
+	// zero time if the channel has no timeout
+	Deadline() time.Time
+
+	// Throttled indicates whether the local peer paused this channel to stay
+	// within the bandwidth limits
+	Throttled() bool
+
+	// DoNotSendCids returns the CIDs of blocks the initiator of a pull
+	// channel said it already had when it opened the channel
+	DoNotSendCids() []cid.Cid
+}
+
+// ChannelHistoryEntry records an event in the lifecycle of a channel
+type ChannelHistoryEntry struct {
+	// Code is the event that occurred
+	Code EventCode
+	// Status is the status of the channel after the event
+	Status Status
+	// Message is the channel message after the event
+	Message string
+	// Timestamp is the time of the event
+	Timestamp time.Time
+}
+
+// ChannelDirection selects channels by the direction data flows relative to
+// the initiator
+type ChannelDirection uint8
+
+const (
+	// AnyDirection matches both push and pull channels
+	AnyDirection ChannelDirection = iota
+	// PushDirection matches channels where the initiator sends data
+	PushDirection
+	// PullDirection matches channels where the initiator receives data
+	PullDirection
+)
+
+// ChannelRole selects channels by the role of the local peer
+type ChannelRole uint8
+
+const (
+	// AnyRole matches all channels
+	AnyRole ChannelRole = iota
+	// InitiatorRole matches channels initiated by the local peer
+	InitiatorRole
+	// ResponderRole matches channels initiated by a remote peer
+	ResponderRole
+)
+
+// ChannelFilter selects the channels returned by Manager.ListChannels.
+// Each field that is left at its zero value matches all channels.
+type ChannelFilter struct {
+	// Peers matches channels where the other party is one of the given peers
+	Peers []peer.ID
+	// Statuses matches channels with one of the given statuses
+	Statuses []Status
+	// Direction matches push or pull channels
+	Direction ChannelDirection
+	// Role matches channels where the local peer is the initiator or responder
+	Role ChannelRole
+	// VoucherTypes matches channels opened with one of the given voucher types
+	VoucherTypes []TypeIdentifier
+	// BaseCid matches channels with the given base CID
+	BaseCid cid.Cid
+	// CreatedAfter matches channels created at or after the given time
+	CreatedAfter time.Time
+	// CreatedBefore matches channels created before the given time
+	CreatedBefore time.Time
+	// Descending sorts channels newest first, instead of oldest first
+	Descending bool
+	// Offset skips the given number of matching channels
+	Offset int
+	// Limit is the maximum number of channels to return (zero means no limit)
+	Limit int
 }